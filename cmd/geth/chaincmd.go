@@ -141,6 +141,47 @@ Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
 be gzipped.`,
+	}
+	exportDiffsCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportDiffs),
+		Name:      "export-diffs",
+		Usage:     "Export the diff layers of a range of blocks into file",
+		ArgsUsage: "<blockNumFirst> <blockNumLast> <filename>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.DiffFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The export-diffs command writes the diff layers persisted for the canonical blocks
+between the first and last block, both inclusive, to an RLP stream. Each diff layer
+carries the hash of its block. Blocks without transactions have no diff layer. The
+node must have run with --persistdiff to keep diff layers. If the file ends with
+.gz, the output will be gzipped.`,
+	}
+	importDiffsCommand = cli.Command{
+		Action:    utils.MigrateFlags(importDiffs),
+		Name:      "import-diffs",
+		Usage:     "Import a blockchain file applying the blocks from diff layers",
+		ArgsUsage: "<blocksfile> <diffsfile>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.GCModeFlag,
+			utils.SnapshotFlag,
+			utils.CacheDatabaseFlag,
+			utils.CacheGCFlag,
+			utils.TxLookupLimitFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The import-diffs command imports the blocks of a file written by export, applying
+them with the diff layers of a file written by export-diffs instead of executing
+their transactions. The diff layers are checked against the hashes of the blocks
+and the state roots of their headers. Blocks without a diff layer are executed.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
@@ -449,6 +490,59 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+func exportDiffs(ctx *cli.Context) error {
+	if len(ctx.Args()) < 3 {
+		utils.Fatalf("This command requires three arguments.")
+	}
+	first, ferr := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	last, lerr := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+	if ferr != nil || lerr != nil {
+		utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+
+	diffStore, err := stack.OpenDiffDatabase("chaindata", utils.MakeDatabaseHandles()/2, ctx.GlobalString(utils.DiffFlag.Name), "", true)
+	if err != nil {
+		utils.Fatalf("Could not open diff database: %v", err)
+	}
+	db.SetDiffStore(diffStore)
+
+	if head := chain.CurrentBlock(); last > head.NumberU64() {
+		utils.Fatalf("Export error: block number %d larger than head block %d\n", last, head.NumberU64())
+	}
+	start := time.Now()
+	if err := utils.ExportDiffLayers(chain, ctx.Args().Get(2), first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+func importDiffs(ctx *cli.Context) error {
+	if len(ctx.Args()) < 2 {
+		utils.Fatalf("This command requires two arguments.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+	core.EnableLightProcessor(chain)
+
+	start := time.Now()
+	err := utils.ImportDiffLayers(chain, ctx.Args().Get(0), ctx.Args().Get(1))
+	chain.Stop()
+	if err != nil {
+		utils.Fatalf("Import error: %v\n", err)
+	}
+	fmt.Printf("Import done in %v\n", time.Since(start))
+	return nil
+}
+
 // importPreimages imports preimage data from the specified file.
 func importPreimages(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/mev"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/naoina/toml"
@@ -81,6 +82,7 @@ type gethConfig struct {
 	Node     node.Config
 	Ethstats ethstatsConfig
 	Metrics  metrics.Config
+	Mev      mev.Config
 }
 
 func loadConfig(file string, cfg *gethConfig) error {
@@ -115,6 +117,7 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 		Eth:     ethconfig.Defaults,
 		Node:    defaultNodeConfig(),
 		Metrics: metrics.DefaultConfig,
+		Mev:     mev.DefaultConfig,
 	}
 
 	// Load config file.
@@ -135,6 +138,7 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 		cfg.Ethstats.URL = ctx.GlobalString(utils.EthStatsURLFlag.Name)
 	}
 	applyMetricConfig(ctx, &cfg)
+	utils.SetMevConfig(ctx, &cfg.Mev)
 
 	return stack, cfg
 }
@@ -165,6 +169,13 @@ func makeFullNode(ctx *cli.Context) (*node.Node, ethapi.Backend) {
 	if cfg.Ethstats.URL != "" {
 		utils.RegisterEthStatsService(stack, backend, cfg.Ethstats.URL)
 	}
+	// Add the pending transaction strategy service if requested.
+	if cfg.Mev.Enabled {
+		if eth == nil {
+			utils.Fatalf("MEV strategies do not work in light client mode.")
+		}
+		utils.RegisterMevService(stack, backend, &cfg.Mev)
+	}
 	return stack, backend
 }
 
@@ -194,6 +205,13 @@ func makeFullNodeWithEthereum(ctx *cli.Context) (*node.Node, ethapi.Backend, *et
 	if cfg.Ethstats.URL != "" {
 		utils.RegisterEthStatsService(stack, backend, cfg.Ethstats.URL)
 	}
+	// Add the pending transaction strategy service if requested.
+	if cfg.Mev.Enabled {
+		if eth == nil {
+			utils.Fatalf("MEV strategies do not work in light client mode.")
+		}
+		utils.RegisterMevService(stack, backend, &cfg.Mev)
+	}
 	return stack, backend, eth
 }
 
@@ -63,6 +63,8 @@ Remove blockchain and state databases`,
 			dbGetSlotsCmd,
 			dbDumpFreezerIndex,
 			ancientInspectCmd,
+			dbExportHistoryCmd,
+			dbImportHistoryCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -206,6 +208,46 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		Description: `This commands will read current offset from kvdb, which is the current offset and starting BlockNumber
 of ancientStore, will also displays the reserved number of blocks in ancientStore `,
 	}
+	dbExportHistoryCmd = cli.Command{
+		Action:    utils.MigrateFlags(exportHistory),
+		Name:      "export-history",
+		Usage:     "Export the blocks and receipts of a range of blocks into history files",
+		ArgsUsage: "<dir> <blockNumFirst> <blockNumLast>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.SyncModeFlag,
+		},
+		Description: `
+The export-history command writes the canonical blocks between the first and last
+block, both inclusive, with their receipts into files of epochs of 8192 blocks in
+the directory. Each file is indexed for random access, and named after the
+accumulator of the hashes and total difficulties of its blocks. The sha256
+checksums of the files are kept in checksums.txt, in the format of sha256sum.
+Files of full epochs are deterministic.`,
+	}
+	dbImportHistoryCmd = cli.Command{
+		Action:    utils.MigrateFlags(importHistory),
+		Name:      "import-history",
+		Usage:     "Import the blocks and receipts of history files into the ancient store",
+		ArgsUsage: "<dir>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.TxLookupLimitFlag,
+		},
+		Description: `
+The import-history command imports the history files written by export-history
+into the ancient store, after checking them against checksums.txt. The headers,
+bodies and receipts are verified, but the blocks are not executed: the chain is
+rehydrated up to the fast block head, and the state has to be synced to go on.
+
+The blocks pruned by 'geth snapshot prune-block' are written back below the
+ancient store, which is rebuilt next to the original one and replaces it. An
+interrupted import must be run again before starting the node.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -308,6 +350,53 @@ func ancientInspect(ctx *cli.Context) error {
 	return rawdb.AncientInspect(db)
 }
 
+func exportHistory(ctx *cli.Context) error {
+	if ctx.NArg() < 3 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	first, ferr := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+	last, lerr := strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+	if ferr != nil || lerr != nil {
+		return fmt.Errorf("block number not an integer")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, true, false)
+	defer db.Close()
+
+	start := time.Now()
+	if err := utils.ExportHistory(db, ctx.Args().Get(0), first, last); err != nil {
+		return err
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+func importHistory(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	// Restore the pruned blocks first, the ancient store is replaced if any
+	start := time.Now()
+	if err := utils.RestoreHistory(stack, "chaindata", config.Eth.DatabaseCache, utils.MakeDatabaseHandles(), ctx.GlobalString(utils.AncientFlag.Name), "", ctx.Args().Get(0)); err != nil {
+		return err
+	}
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+
+	err := utils.ImportHistory(chain, ctx.Args().Get(0))
+	chain.Stop()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Import done in %v\n", time.Since(start))
+	return nil
+}
+
 func showLeveldbStats(db ethdb.Stater) {
 	if stats, err := db.Stat("leveldb.stats"); err != nil {
 		log.Warn("Failed to read database stats", "error", err)
@@ -0,0 +1,369 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"gopkg.in/urfave/cli.v1"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+)
+
+var (
+	devnetValidatorsFlag = cli.IntFlag{
+		Name:  "validators",
+		Usage: "Number of validators in the genesis validator set",
+		Value: 3,
+	}
+	devnetStandbyFlag = cli.IntFlag{
+		Name:  "standby",
+		Usage: "Number of standby validators rotated into the validator set after the first epoch",
+	}
+	devnetOfflineFlag = cli.StringFlag{
+		Name:  "offline",
+		Usage: "Comma separated indexes of genesis validators which never come online",
+	}
+	devnetPeriodFlag = cli.Uint64Flag{
+		Name:  "period",
+		Usage: "Block period in seconds",
+		Value: 1,
+	}
+	devnetEpochFlag = cli.Uint64Flag{
+		Name:  "epoch",
+		Usage: "Number of blocks per epoch",
+		Value: 20,
+	}
+	devnetBlocksFlag = cli.Uint64Flag{
+		Name:  "blocks",
+		Usage: "Number of blocks to run the network for (0 = until interrupted)",
+	}
+	devnetOutputFlag = cli.StringFlag{
+		Name:  "output",
+		Usage: "Directory to write the genesis and the validator keys to",
+	}
+
+	devnetCommand = cli.Command{
+		Name:     "devnet",
+		Usage:    "Run local development networks",
+		Category: "MISCELLANEOUS COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "parlia",
+				Usage:  "Run a local multi-validator parlia network",
+				Action: utils.MigrateFlags(devnetParlia),
+				Flags: []cli.Flag{
+					devnetValidatorsFlag,
+					devnetStandbyFlag,
+					devnetOfflineFlag,
+					devnetPeriodFlag,
+					devnetEpochFlag,
+					devnetBlocksFlag,
+					devnetOutputFlag,
+				},
+				Description: `
+geth devnet parlia [--validators 3] [--standby 1] [--offline 2]
+
+generates the validator keys and a genesis with the validator set and slash
+system contracts, initialised with the validators at block 1, then runs every
+validator in-process over a simulated p2p network. The cross chain contract is
+replaced by a relay allowing the faucet to deliver validator set packages.
+
+Offline validators stay in the validator set but never seal, exercising the
+backoff and slashing of their peers. Standby validators run a node from the
+start and are rotated into the validator set by the faucet halfway through
+the first epoch.`,
+			},
+		},
+	}
+)
+
+// devnetValidator is a validator of a parlia devnet.
+type devnetValidator struct {
+	name    string
+	key     *ecdsa.PrivateKey
+	address common.Address
+	backend *eth.Ethereum // Full node of the validator, nil if offline
+}
+
+// start imports the validator key into the node and registers its full node.
+func (v *devnetValidator) start(stack *node.Node, genesis *core.Genesis) (*eth.Ethereum, error) {
+	backends := stack.AccountManager().Backends(keystore.KeyStoreType)
+	if len(backends) == 0 {
+		return nil, errors.New("keystore unavailable")
+	}
+	ks := backends[0].(*keystore.KeyStore)
+	account, err := ks.ImportECDSA(v.key, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		return nil, err
+	}
+	config := ethconfig.Defaults
+	config.Genesis = genesis
+	config.NetworkId = genesis.Config.ChainID.Uint64()
+	config.SyncMode = downloader.FullSync
+	config.Miner.Etherbase = v.address
+
+	backend, err := eth.New(stack, &config)
+	if err != nil {
+		return nil, err
+	}
+	v.backend = backend
+	return backend, nil
+}
+
+// devnetParlia runs a local parlia network until the requested number of
+// blocks is reached or it is interrupted.
+func devnetParlia(ctx *cli.Context) error {
+	var (
+		size    = ctx.Int(devnetValidatorsFlag.Name)
+		standby = ctx.Int(devnetStandbyFlag.Name)
+		period  = ctx.Uint64(devnetPeriodFlag.Name)
+		epoch   = ctx.Uint64(devnetEpochFlag.Name)
+		blocks  = ctx.Uint64(devnetBlocksFlag.Name)
+	)
+	if size < 1 || standby < 0 {
+		utils.Fatalf("At least one validator is required")
+	}
+	if epoch < 2 {
+		utils.Fatalf("Epoch must span at least two blocks")
+	}
+	offline, err := parseDevnetOffline(ctx.String(devnetOfflineFlag.Name), size)
+	if err != nil {
+		utils.Fatalf("Invalid offline validators: %v", err)
+	}
+	if len(offline) == size {
+		utils.Fatalf("At least one genesis validator must be online")
+	}
+	// Generate the validator and faucet keys and the genesis sealed by them
+	validators := make([]*devnetValidator, size+standby)
+	for i := range validators {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return err
+		}
+		validators[i] = &devnetValidator{
+			name:    fmt.Sprintf("validator%d", i),
+			key:     key,
+			address: crypto.PubkeyToAddress(key.PublicKey),
+		}
+	}
+	faucet, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	initial := make([]common.Address, size)
+	for i, validator := range validators[:size] {
+		initial[i] = validator.address
+	}
+	genesis := core.DeveloperParliaGenesisBlock(period, epoch, initial, crypto.PubkeyToAddress(faucet.PublicKey))
+	if dir := ctx.String(devnetOutputFlag.Name); dir != "" {
+		if err := writeDevnet(dir, genesis, validators, faucet); err != nil {
+			utils.Fatalf("Failed to write devnet files: %v", err)
+		}
+	}
+	// Assemble the simulated network, every online validator running a full node
+	lookup := make(map[enode.ID]*devnetValidator)
+	adapter := adapters.NewSimAdapter(adapters.LifecycleConstructors{
+		"eth": func(sctx *adapters.ServiceContext, stack *node.Node) (node.Lifecycle, error) {
+			return lookup[sctx.Config.ID].start(stack, genesis)
+		},
+	})
+	network := simulations.NewNetwork(adapter, &simulations.NetworkConfig{ID: "parlia-devnet", DefaultService: "eth"})
+	defer network.Shutdown()
+
+	var (
+		ids    []enode.ID
+		online []*devnetValidator
+	)
+	for i, validator := range validators {
+		if offline[i] {
+			log.Info("Keeping devnet validator offline", "name", validator.name, "address", validator.address)
+			continue
+		}
+		config := adapters.RandomNodeConfig()
+		config.Name = validator.name
+		lookup[config.ID] = validator
+
+		if _, err := network.NewNodeWithConfig(config); err != nil {
+			return err
+		}
+		if err := network.Start(config.ID); err != nil {
+			return err
+		}
+		ids = append(ids, config.ID)
+		online = append(online, validator)
+	}
+	if err := network.ConnectNodesFull(ids); err != nil {
+		return err
+	}
+	for _, validator := range online {
+		if err := validator.backend.StartMining(1); err != nil {
+			return err
+		}
+		log.Info("Started devnet validator", "name", validator.name, "address", validator.address)
+	}
+	return monitorDevnet(online[0].backend, validators, size, faucet, epoch, blocks)
+}
+
+// monitorDevnet reports the blocks imported by the given node, rotates in the
+// standby validators and stops the network after the requested blocks.
+func monitorDevnet(backend *eth.Ethereum, validators []*devnetValidator, size int, faucet *ecdsa.PrivateKey, epoch, blocks uint64) error {
+	names := make(map[common.Address]string)
+	for _, validator := range validators {
+		names[validator.address] = validator.name
+	}
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := backend.BlockChain().SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+
+	rotated := len(validators) == size
+	for {
+		select {
+		case ev := <-heads:
+			header := ev.Block.Header()
+			number := header.Number.Uint64()
+
+			// In turn blocks are sealed with difficulty 2, out of turn ones with 1
+			log.Info("Devnet block", "number", number, "hash", header.Hash(), "validator", names[header.Coinbase],
+				"inturn", header.Difficulty.Uint64() == 2, "txs", len(ev.Block.Transactions()))
+			if number%epoch == 0 {
+				log.Info("Devnet epoch", "number", number, "validators", (len(header.Extra)-32-crypto.SignatureLength)/common.AddressLength)
+			}
+			if !rotated && number >= epoch/2 {
+				if err := rotateDevnet(backend, validators, faucet); err != nil {
+					log.Error("Failed to rotate devnet validators", "err", err)
+				}
+				rotated = true
+			}
+			if blocks > 0 && number >= blocks {
+				return reportDevnet(backend, validators)
+			}
+		case <-sigc:
+			return reportDevnet(backend, validators)
+		case err := <-sub.Err():
+			return err
+		}
+	}
+}
+
+// rotateDevnet submits the faucet transaction extending the validator set to
+// every devnet validator.
+func rotateDevnet(backend *eth.Ethereum, validators []*devnetValidator, faucet *ecdsa.PrivateKey) error {
+	addresses := make([]common.Address, len(validators))
+	for i, validator := range validators {
+		addresses[i] = validator.address
+	}
+	config := backend.BlockChain().Config()
+	tx := types.NewTransaction(0, common.HexToAddress(systemcontracts.CrossChainContract), new(big.Int), 1000000,
+		ethconfig.Defaults.Miner.GasPrice, systemcontracts.DevnetUpdateValidatorsData(addresses))
+	tx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainID), faucet)
+	if err != nil {
+		return err
+	}
+	log.Info("Rotating devnet validators", "validators", len(addresses), "tx", tx.Hash())
+	return backend.TxPool().AddLocal(tx)
+}
+
+// reportDevnet logs the number of times each validator was slashed.
+func reportDevnet(backend *eth.Ethereum, validators []*devnetValidator) error {
+	statedb, err := backend.BlockChain().State()
+	if err != nil {
+		return err
+	}
+	slash := common.HexToAddress(systemcontracts.SlashContract)
+	for _, validator := range validators {
+		slashes := statedb.GetState(slash, systemcontracts.DevnetSlashKey(validator.address)).Big()
+		log.Info("Devnet validator", "name", validator.name, "address", validator.address, "online", validator.backend != nil, "slashes", slashes)
+	}
+	return nil
+}
+
+// parseDevnetOffline parses the comma separated indexes of offline validators.
+func parseDevnetOffline(list string, size int) (map[int]bool, error) {
+	offline := make(map[int]bool)
+	if list == "" {
+		return offline, nil
+	}
+	for _, field := range strings.Split(list, ",") {
+		index, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if index < 0 || index >= size {
+			return nil, fmt.Errorf("validator index %d out of range [0, %d)", index, size)
+		}
+		offline[index] = true
+	}
+	return offline, nil
+}
+
+// writeDevnet stores the genesis and the keys of the validators and the faucet
+// in dir, allowing the devnet to be run by standalone nodes.
+func writeDevnet(dir string, genesis *core.Genesis, validators []*devnetValidator, faucet *ecdsa.PrivateKey) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	blob, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "genesis.json"), blob, 0644); err != nil {
+		return err
+	}
+	for _, validator := range validators {
+		if err := crypto.SaveECDSA(filepath.Join(dir, validator.name+".key"), validator.key); err != nil {
+			return err
+		}
+	}
+	if err := crypto.SaveECDSA(filepath.Join(dir, "faucet.key"), faucet); err != nil {
+		return err
+	}
+	log.Info("Wrote devnet genesis and keys", "dir", dir)
+	return nil
+}
@@ -19,10 +19,6 @@ package main
 
 import (
 	"fmt"
-	"github.com/ethereum/go-ethereum/core"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/mev"
-	"math/big"
 	"os"
 	"sort"
 	"strconv"
@@ -69,6 +65,8 @@ var (
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.HistoryDirFlag,
+		utils.DBEngineFlag,
 		utils.MinFreeDiskSpaceFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
@@ -76,11 +74,14 @@ var (
 		utils.DirectBroadcastFlag,
 		utils.DisableSnapProtocolFlag,
 		utils.DiffSyncFlag,
+		utils.DiffSyncVerifyFlag,
 		utils.PipeCommitFlag,
+		utils.ParallelExecutionFlag,
 		utils.RangeLimitFlag,
 		utils.USBFlag,
 		utils.SmartCardDaemonPathFlag,
 		utils.OverrideBerlinFlag,
+		utils.OverrideUpgradesFlag,
 		utils.EthashCacheDirFlag,
 		utils.EthashCachesInMemoryFlag,
 		utils.EthashCachesOnDiskFlag,
@@ -105,7 +106,10 @@ var (
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
+		utils.OnlinePruningFlag,
+		utils.OnlinePruningThrottleFlag,
 		utils.TxLookupLimitFlag,
+		utils.ContractIndexFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
 		utils.LightEgressFlag,
@@ -201,6 +205,7 @@ var (
 		utils.IPCPathFlag,
 		utils.InsecureUnlockAllowedFlag,
 		utils.RPCGlobalGasCapFlag,
+		utils.RPCGlobalEVMTimeoutFlag,
 		utils.RPCGlobalTxFeeCapFlag,
 		utils.AllowUnprotectedTxs,
 	}
@@ -217,6 +222,17 @@ var (
 		utils.MetricsInfluxDBPasswordFlag,
 		utils.MetricsInfluxDBTagsFlag,
 	}
+
+	mevFlags = []cli.Flag{
+		utils.MevEnabledFlag,
+		utils.MevStrategiesFlag,
+		utils.MevWorkersFlag,
+		utils.MevQueueFlag,
+		utils.MevTimeoutFlag,
+		utils.MevSenderFlag,
+		utils.MevDetectorRulesFlag,
+		utils.MevDetectorSinkFlag,
+	}
 )
 
 func init() {
@@ -230,6 +246,8 @@ func init() {
 		initNetworkCommand,
 		importCommand,
 		exportCommand,
+		exportDiffsCommand,
+		importDiffsCommand,
 		importPreimagesCommand,
 		exportPreimagesCommand,
 		removedbCommand,
@@ -256,6 +274,8 @@ func init() {
 		utils.ShowDeprecated,
 		// See snapshot.go
 		snapshotCommand,
+		// See devnetcmd.go
+		devnetCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -264,6 +284,7 @@ func init() {
 	app.Flags = append(app.Flags, consoleFlags...)
 	app.Flags = append(app.Flags, debug.Flags...)
 	app.Flags = append(app.Flags, metricsFlags...)
+	app.Flags = append(app.Flags, mevFlags...)
 
 	app.Before = func(ctx *cli.Context) error {
 		return debug.Setup(ctx)
@@ -340,59 +361,10 @@ func geth(ctx *cli.Context) error {
 	defer stack.Close()
 
 	startNode(ctx, stack, backend)
-	//启动一个routine做我的事情
-	//todo
-	//go parsePending(backend, eth)
-	//go onTopOfBlock(backend, eth)
 	stack.Wait()
 	return nil
 }
 
-var latestBlock *types.Block = nil
-func onTopOfBlock(backend ethapi.Backend, eth *eth.Ethereum) {
-	for {
-		curBlock := backend.CurrentBlock()
-		if latestBlock == nil {
-			latestBlock = curBlock
-		} else {
-			if latestBlock.Number().Cmp(curBlock.Number()) == 0 {
-				//
-				continue
-			}else{
-				latestBlock = curBlock
-				txns, _ := backend.GetPoolTransactions()
-				var maxGas = big.NewInt(0)
-				for _, tx := range txns{
-					txGas := tx.GasPrice()
-					if txGas.Cmp(maxGas) == 1{
-						maxGas = txGas
-					}
-				}
-				fmt.Printf("new block: %s max Gas: %s \n", latestBlock.Number().String(), maxGas.String())
-				// TODO: on top of block strategy
-				go mev.SimRebaseTokenSkim(backend, eth, maxGas)
-			}
-		}
-	}
-}
-
-
-func parsePending(backend ethapi.Backend, eth *eth.Ethereum) {
-	newTxCh := make(chan core.NewTxsEvent)
-	backend.SubscribeNewTxsEvent(newTxCh)
-	for {
-		select {
-		case tx := <-newTxCh:
-			for _, txn := range tx.Txs {
-				//we do different things here TODO:
-				//go mev.TrackHelenaSwap(txn, backend, eth)
-				//go mev.SimulateTx(txn, backend, eth)
-				go mev.SimulateOriginalTx(txn, backend, eth)
-			}
-		}
-	}
-}
-
 // startNode boots up the system node and all registered protocols, after which
 // it unlocks any requested accounts, and starts the RPC/IPC interfaces and the
 // miner.
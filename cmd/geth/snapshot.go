@@ -29,6 +29,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/state/pruner"
@@ -37,6 +39,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -49,6 +52,14 @@ var (
 	emptyCode = crypto.Keccak256(nil)
 )
 
+var (
+	parliaRetentionFlag = cli.Uint64Flag{
+		Name:  "retention",
+		Usage: "Number of blocks behind the head to keep the parlia snapshots of",
+		Value: params.FullImmutabilityThreshold,
+	}
+)
+
 var (
 	snapshotCommand = cli.Command{
 		Name:        "snapshot",
@@ -174,6 +185,55 @@ verification. The default checking target is the HEAD state. It's basically iden
 to traverse-state, but the check granularity is smaller. 
 
 It's also usable without snapshot enabled.
+`,
+			},
+			{
+				Name:     "parlia-prune",
+				Usage:    "Prune stale parlia snapshots",
+				Action:   utils.MigrateFlags(pruneParliaSnapshots),
+				Category: "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					parliaRetentionFlag,
+				},
+				Description: `
+geth snapshot parlia-prune --retention <blocks>
+will delete the parlia snapshots which are not on the canonical chain or older
+than the given number of blocks behind the head. The most recent canonical
+checkpoint is always kept.
+`,
+			},
+			{
+				Name:     "parlia-rebuild",
+				Usage:    "Recompute the parlia snapshots from the headers",
+				Action:   utils.MigrateFlags(rebuildParliaSnapshots),
+				Category: "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+				},
+				Description: `
+geth snapshot parlia-rebuild
+will replace all parlia snapshots with ones recomputed from the canonical headers,
+starting from the validators of the genesis block. A snapshot is stored at every
+checkpoint, as the consensus engine does. No state is needed.
+`,
+			},
+			{
+				Name:     "parlia-verify",
+				Usage:    "Compare the stored parlia snapshots with recomputed ones",
+				Action:   utils.MigrateFlags(verifyParliaSnapshots),
+				Category: "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+				},
+				Description: `
+geth snapshot parlia-verify
+will recompute the parlia snapshots from the canonical headers and compare every
+stored snapshot of the canonical chain against them. Mismatching snapshots can be
+fixed with "geth snapshot parlia-rebuild".
 `,
 			},
 		},
@@ -616,3 +676,82 @@ func parseRoot(input string) (common.Hash, error) {
 	}
 	return h, nil
 }
+
+// openParliaChain opens the header chain of a parlia database.
+func openParliaChain(ctx *cli.Context, stack *node.Node, readonly bool) (ethdb.Database, *core.HeaderChain, error) {
+	chaindb := utils.MakeChainDatabase(ctx, stack, readonly, false)
+
+	config := rawdb.ReadChainConfig(chaindb, rawdb.ReadCanonicalHash(chaindb, 0))
+	if config == nil || config.Parlia == nil {
+		chaindb.Close()
+		return nil, nil, errors.New("not a parlia chain")
+	}
+	chain, err := core.NewHeaderChain(chaindb, config, nil, func() bool { return false })
+	if err != nil {
+		chaindb.Close()
+		return nil, nil, err
+	}
+	return chaindb, chain, nil
+}
+
+func pruneParliaSnapshots(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb, chain, err := openParliaChain(ctx, stack, false)
+	if err != nil {
+		log.Error("Failed to open chain", "err", err)
+		return err
+	}
+	defer chaindb.Close()
+
+	if _, err := parlia.PruneSnapshots(chain, chaindb, ctx.Uint64(parliaRetentionFlag.Name)); err != nil {
+		log.Error("Failed to prune parlia snapshots", "err", err)
+		return err
+	}
+	return nil
+}
+
+func rebuildParliaSnapshots(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb, chain, err := openParliaChain(ctx, stack, false)
+	if err != nil {
+		log.Error("Failed to open chain", "err", err)
+		return err
+	}
+	defer chaindb.Close()
+
+	if _, err := parlia.RebuildSnapshots(chain, chaindb); err != nil {
+		log.Error("Failed to rebuild parlia snapshots", "err", err)
+		return err
+	}
+	return nil
+}
+
+func verifyParliaSnapshots(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb, chain, err := openParliaChain(ctx, stack, true)
+	if err != nil {
+		log.Error("Failed to open chain", "err", err)
+		return err
+	}
+	defer chaindb.Close()
+
+	checked, mismatches, err := parlia.VerifySnapshots(chain, chaindb)
+	if err != nil {
+		log.Error("Failed to verify parlia snapshots", "err", err)
+		return err
+	}
+	for _, mismatch := range mismatches {
+		log.Error("Parlia snapshot mismatch", "number", mismatch.Number, "hash", mismatch.Hash, "stored", string(mismatch.Stored), "want", string(mismatch.Want))
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d of %d parlia snapshots mismatch", len(mismatches), checked)
+	}
+	log.Info("Verified parlia snapshots", "checked", checked)
+	return nil
+}
@@ -36,6 +36,8 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			configFileFlag,
 			utils.DataDirFlag,
 			utils.AncientFlag,
+			utils.HistoryDirFlag,
+			utils.DBEngineFlag,
 			utils.MinFreeDiskSpaceFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
@@ -49,10 +51,16 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.RinkebyFlag,
 			utils.YoloV3Flag,
 			utils.RopstenFlag,
+			utils.OverrideUpgradesFlag,
 			utils.SyncModeFlag,
+			utils.DiffSyncVerifyFlag,
 			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
+			utils.OnlinePruningFlag,
+			utils.OnlinePruningThrottleFlag,
 			utils.TxLookupLimitFlag,
+			utils.ContractIndexFlag,
+			utils.ParallelExecutionFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
@@ -157,6 +165,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.GraphQLCORSDomainFlag,
 			utils.GraphQLVirtualHostsFlag,
 			utils.RPCGlobalGasCapFlag,
+			utils.RPCGlobalEVMTimeoutFlag,
 			utils.RPCGlobalTxFeeCapFlag,
 			utils.AllowUnprotectedTxs,
 			utils.JSpathFlag,
@@ -224,6 +233,10 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Name:  "METRICS AND STATS",
 		Flags: metricsFlags,
 	},
+	{
+		Name:  "MEV",
+		Flags: mevFlags,
+	},
 	{
 		Name: "ALIASED (deprecated)",
 		Flags: []cli.Flag{
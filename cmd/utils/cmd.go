@@ -18,12 +18,21 @@
 package utils
 
 import (
+	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -36,14 +45,20 @@ import (
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/internal/debug"
+	"github.com/ethereum/go-ethereum/internal/era"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 	"gopkg.in/urfave/cli.v1"
 )
 
 const (
 	importBatchSize = 2500
+
+	// diffImportBatchSize is the number of blocks imported at once with their
+	// diff layers, kept below the number of diff layers a chain queues ahead.
+	diffImportBatchSize = 1024
 )
 
 // Fatalf formats a message to standard error and exits the program.
@@ -269,6 +284,213 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	return nil
 }
 
+// ExportDiffLayers exports the diff layers of the canonical blocks between first
+// and last into the specified file, truncating any data already present in the
+// file. Blocks without transactions have no diff layer and are skipped.
+func ExportDiffLayers(chain *core.BlockChain, fn string, first uint64, last uint64) error {
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	log.Info("Exporting diff layers", "file", fn, "first", first, "last", last)
+
+	// Open the file handle and potentially wrap with a gzip stream
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	// Iterate over the blocks and export the diff layers as stored, each of them
+	// carrying the hash of its block
+	var (
+		exported, missing int
+		start, reported   = time.Now(), time.Now()
+	)
+	for number := first; number <= last; number++ {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return fmt.Errorf("export failed on #%d: not found", number)
+		}
+		blob := chain.GetDiffLayerRLP(header.Hash())
+		if len(blob) == 0 {
+			if header.TxHash != types.EmptyRootHash {
+				missing++
+			}
+			continue
+		}
+		if _, err := writer.Write(blob); err != nil {
+			return err
+		}
+		exported++
+
+		if time.Since(reported) >= 8*time.Second {
+			log.Info("Exporting diff layers", "number", number, "exported", exported, "missing", missing, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	if missing > 0 {
+		log.Warn("Some diff layers are not available", "missing", missing)
+	}
+	log.Info("Exported diff layers", "file", fn, "exported", exported, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// ImportDiffLayers imports the blocks of a chain export, applying them through
+// the light processor with the diff layers of a diff export instead of
+// executing them. The chain must run the light processor, the blocks without
+// a diff layer are executed.
+func ImportDiffLayers(chain *core.BlockChain, blocksFn string, diffsFn string) error {
+	// Watch for Ctrl-C while the import is running.
+	// If a signal is received, the import will stop at the next batch.
+	interrupt := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	defer close(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			log.Info("Interrupted during import, stopping at next batch")
+		}
+		close(stop)
+	}()
+	checkInterrupt := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+	log.Info("Importing blockchain with diff layers", "blocks", blocksFn, "diffs", diffsFn)
+
+	blockStream, blockFile, err := openRLPStream(blocksFn)
+	if err != nil {
+		return err
+	}
+	defer blockFile.Close()
+
+	diffStream, diffFile, err := openRLPStream(diffsFn)
+	if err != nil {
+		return err
+	}
+	defer diffFile.Close()
+
+	var (
+		blocks  = make(types.Blocks, diffImportBatchSize)
+		next    *types.DiffLayer // Diff layer read but not yet handed over
+		n       int
+		applied int
+	)
+	for batch := 0; ; batch++ {
+		// Load a batch of RLP blocks.
+		if checkInterrupt() {
+			return fmt.Errorf("interrupted")
+		}
+		i := 0
+		for ; i < diffImportBatchSize; i++ {
+			var b types.Block
+			if err := blockStream.Decode(&b); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("at block %d: %v", n, err)
+			}
+			// don't import first block
+			if b.NumberU64() == 0 {
+				i--
+				continue
+			}
+			blocks[i] = &b
+			n++
+		}
+		if i == 0 {
+			break
+		}
+		// Hand the diff layers of the batch over to the light processor, checking
+		// they belong to the imported blocks. Each batch is served by its own
+		// fake peer to stay within the diff layers tracked per peer.
+		first, last := blocks[0].NumberU64(), blocks[i-1].NumberU64()
+		for {
+			if next == nil {
+				if next, err = readDiffLayer(diffStream); err == io.EOF {
+					break
+				} else if err != nil {
+					return fmt.Errorf("at diff layer %d: %v", applied, err)
+				}
+			}
+			if next.Number > last {
+				break
+			}
+			if next.Number >= first {
+				index := next.Number - first
+				if index >= uint64(i) || blocks[index].NumberU64() != next.Number {
+					return fmt.Errorf("diff layer of block #%d out of the imported blocks", next.Number)
+				}
+				if hash := blocks[index].Hash(); hash != next.BlockHash {
+					return fmt.Errorf("diff layer of block #%d mismatch: have hash %x, want %x", next.Number, next.BlockHash, hash)
+				}
+				if err := chain.HandleDiffLayer(next, fmt.Sprintf("import-%d", batch), true); err != nil {
+					return err
+				}
+				applied++
+			}
+			next = nil
+		}
+		// Import the batch.
+		if checkInterrupt() {
+			return fmt.Errorf("interrupted")
+		}
+		missing := missingBlocks(chain, blocks[:i])
+		if len(missing) == 0 {
+			log.Info("Skipping batch as all blocks present", "batch", batch, "first", blocks[0].Hash(), "last", blocks[i-1].Hash())
+			continue
+		}
+		if _, err := chain.InsertChain(missing); err != nil {
+			return fmt.Errorf("invalid block %d: %v", n, err)
+		}
+	}
+	log.Info("Imported blockchain with diff layers", "blocks", n, "diffs", applied)
+	return nil
+}
+
+// openRLPStream opens an RLP stream over the file, unwrapping it if gzipped.
+func openRLPStream(fn string) (*rlp.Stream, io.Closer, error) {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	var reader io.Reader = fh
+	if strings.HasSuffix(fn, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			fh.Close()
+			return nil, nil, err
+		}
+	}
+	return rlp.NewStream(reader, 0), fh, nil
+}
+
+// readDiffLayer decodes the next diff layer of the stream, hashing it as the
+// diff protocol does.
+func readDiffLayer(stream *rlp.Stream) (*types.DiffLayer, error) {
+	blob, err := stream.Raw()
+	if err != nil {
+		return nil, err
+	}
+	diff := new(types.DiffLayer)
+	if err := rlp.DecodeBytes(blob, diff); err != nil {
+		return nil, err
+	}
+	if err := diff.Validate(); err != nil {
+		return nil, err
+	}
+	diff.DiffHash = crypto.Keccak256Hash(blob)
+	return diff, nil
+}
+
 // ImportPreimages imports a batch of exported hash preimages into the database.
 func ImportPreimages(db ethdb.Database, fn string) error {
 	log.Info("Importing preimages", "file", fn)
@@ -344,3 +566,648 @@ func ExportPreimages(db ethdb.Database, fn string) error {
 	log.Info("Exported preimages", "file", fn)
 	return nil
 }
+
+// historyChecksums is the file listing the sha256 checksums of the history files
+// of a directory, in the format of sha256sum.
+const historyChecksums = "checksums.txt"
+
+// ExportHistory exports the canonical blocks between first and last, with their
+// receipts, into history files of the epochs in the specified directory. The
+// checksums of the files are recorded along the ones already present. A file of
+// an epoch exported before is merged into the new one, which replaces it.
+func ExportHistory(db ethdb.Database, dir string, first uint64, last uint64) error {
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	checksums, err := readHistoryChecksums(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if checksums == nil {
+		checksums = make(map[string]common.Hash)
+	}
+	network := era.Network(rawdb.ReadCanonicalHash(db, 0))
+	log.Info("Exporting history", "dir", dir, "network", network, "first", first, "last", last)
+
+	start, reported := time.Now(), time.Now()
+	for epoch := era.Epoch(first); epoch <= era.Epoch(last); epoch++ {
+		from, to := epoch*era.BlocksPerFile, (epoch+1)*era.BlocksPerFile-1
+		if from < first {
+			from = first
+		}
+		if to > last {
+			to = last
+		}
+		var (
+			prefix = fmt.Sprintf("%s-%05d-", network, epoch)
+			olds   []string
+			files  []*era.Era
+		)
+		for old := range checksums {
+			if !strings.HasPrefix(old, prefix) {
+				continue
+			}
+			e, err := openHistoryFile(dir, old, checksums)
+			if err != nil {
+				for _, e := range files {
+					e.Close()
+				}
+				return err
+			}
+			olds, files = append(olds, old), append(files, e)
+		}
+		name, checksum, err := exportHistoryEpoch(db, dir, network, epoch, from, to, files)
+		for _, e := range files {
+			e.Close()
+		}
+		if err != nil {
+			return err
+		}
+		// The new file holds all the blocks of the ones exported before
+		for _, old := range olds {
+			if old != name {
+				delete(checksums, old)
+				os.Remove(filepath.Join(dir, old))
+			}
+		}
+		checksums[name] = checksum
+
+		if time.Since(reported) >= 8*time.Second {
+			log.Info("Exporting history", "number", to, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	if err := writeHistoryChecksums(dir, checksums); err != nil {
+		return err
+	}
+	log.Info("Exported history", "dir", dir, "files", era.Epoch(last)-era.Epoch(first)+1, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// exportHistoryEpoch exports the blocks between from and to, of a single epoch,
+// into a history file, along with the blocks of the given files of the epoch
+// exported before. It returns the name of the file and its checksum.
+func exportHistoryEpoch(db ethdb.Database, dir string, network string, epoch, from, to uint64, files []*era.Era) (string, common.Hash, error) {
+	// The new file replaces the ones exported before, so it has to cover their
+	// blocks too. Outside of the requested range, the blocks pruned from the
+	// database are taken from the files.
+	start, end := from, to
+	for _, e := range files {
+		if e.Start() < start {
+			start = e.Start()
+		}
+		if last := e.Start() + e.Count() - 1; last > end {
+			end = last
+		}
+	}
+	f, err := ioutil.TempFile(dir, fmt.Sprintf("%s-%05d-*.tmp", network, epoch))
+	if err != nil {
+		return "", common.Hash{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var (
+		hasher  = sha256.New()
+		builder = era.NewBuilder(io.MultiWriter(f, hasher))
+		parent  common.Hash
+	)
+	for number := start; number <= end; number++ {
+		block := readHistoryBlock(db, number)
+		if block == nil && (number < from || number > to) {
+			for _, e := range files {
+				if number >= e.Start() && number < e.Start()+e.Count() {
+					if block, err = e.Block(number); err != nil {
+						return "", common.Hash{}, err
+					}
+					break
+				}
+			}
+		}
+		if block == nil {
+			return "", common.Hash{}, fmt.Errorf("export failed on #%d: not found", number)
+		}
+		// Blocks of different sources must still form a chain
+		var header types.Header
+		if err := rlp.DecodeBytes(block.Header, &header); err != nil {
+			return "", common.Hash{}, fmt.Errorf("export failed on #%d: %v", number, err)
+		}
+		if number > start && header.ParentHash != parent {
+			return "", common.Hash{}, fmt.Errorf("export failed on #%d: parent mismatch with the history exported before", number)
+		}
+		parent = block.Hash
+		if err := builder.Add(number, block.Header, block.Body, block.Receipts, block.TD); err != nil {
+			return "", common.Hash{}, err
+		}
+	}
+	accumulator, err := builder.Finalize()
+	if err != nil {
+		return "", common.Hash{}, err
+	}
+	if err := f.Sync(); err != nil {
+		return "", common.Hash{}, err
+	}
+	if err := f.Close(); err != nil {
+		return "", common.Hash{}, err
+	}
+	name := era.Filename(network, epoch, accumulator)
+	if err := os.Rename(f.Name(), filepath.Join(dir, name)); err != nil {
+		return "", common.Hash{}, err
+	}
+	return name, common.BytesToHash(hasher.Sum(nil)), nil
+}
+
+// readHistoryBlock reads a canonical block with its receipts from the database,
+// nil if any of its data is missing.
+func readHistoryBlock(db ethdb.Database, number uint64) *era.Block {
+	hash := rawdb.ReadCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	block := &era.Block{
+		Number:   number,
+		Hash:     hash,
+		Header:   rawdb.ReadHeaderRLP(db, hash, number),
+		Body:     rawdb.ReadBodyRLP(db, hash, number),
+		Receipts: rawdb.ReadReceiptsRLP(db, hash, number),
+		TD:       rawdb.ReadTd(db, hash, number),
+	}
+	if len(block.Header) == 0 || len(block.Body) == 0 || len(block.Receipts) == 0 || block.TD == nil {
+		return nil
+	}
+	return block
+}
+
+// ImportHistory imports the blocks and receipts of the history files in the
+// specified directory into the ancient store, after verifying the checksums of
+// the files. The blocks are not executed, the chain is only rehydrated up to
+// the fast block head.
+func ImportHistory(chain *core.BlockChain, dir string) error {
+	// Watch for Ctrl-C while the import is running.
+	// If a signal is received, the import will stop at the next batch.
+	interrupt := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	defer close(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			log.Info("Interrupted during import, stopping at next batch")
+		}
+		close(stop)
+	}()
+	checkInterrupt := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+	checksums, err := readHistoryChecksums(dir)
+	if err != nil {
+		return err
+	}
+	network := era.Network(chain.Genesis().Hash())
+	names, err := era.ReadDir(dir, network)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no history files of %s in %s", network, dir)
+	}
+	log.Info("Importing history", "dir", dir, "network", network, "files", len(names))
+
+	var (
+		start    = time.Now()
+		imported int
+	)
+	for _, name := range names {
+		if checkInterrupt() {
+			return fmt.Errorf("interrupted")
+		}
+		e, err := openHistoryFile(dir, name, checksums)
+		if err != nil {
+			return err
+		}
+		n, err := importHistoryFile(chain, e, checkInterrupt)
+		e.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		imported += n
+		log.Info("Imported history file", "file", name, "blocks", n, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	log.Info("Imported history", "dir", dir, "blocks", imported, "head", chain.CurrentFastBlock().NumberU64(), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// importHistoryFile imports the blocks of a history file missing from the chain,
+// checking them against the headers and the accumulator of the file.
+func importHistoryFile(chain *core.BlockChain, e *era.Era, checkInterrupt func() bool) (int, error) {
+	var (
+		hasher    = crypto.NewKeccakState()
+		blocks    = make(types.Blocks, 0, importBatchSize)
+		receipts  = make([]types.Receipts, 0, importBatchSize)
+		tds       = make([]*big.Int, 0, importBatchSize)
+		imported  int
+		pruned    bool
+		lastBlock = e.Start() + e.Count() - 1
+	)
+	// flush inserts the headers, and then the blocks along with their receipts
+	// into the ancient store
+	flush := func() error {
+		if len(blocks) == 0 {
+			return nil
+		}
+		headers := make([]*types.Header, len(blocks))
+		for i, block := range blocks {
+			headers[i] = block.Header()
+		}
+		if _, err := chain.InsertHeaderChain(headers, 1); err != nil {
+			return err
+		}
+		for i, block := range blocks {
+			if td := chain.GetTd(block.Hash(), block.NumberU64()); td == nil || td.Cmp(tds[i]) != 0 {
+				return fmt.Errorf("total difficulty mismatch of block #%d: have %v, want %v", block.NumberU64(), td, tds[i])
+			}
+		}
+		if _, err := chain.InsertReceiptChain(blocks, receipts, math.MaxUint64); err != nil {
+			return err
+		}
+		imported += len(blocks)
+		blocks, receipts, tds = blocks[:0], receipts[:0], tds[:0]
+		return nil
+	}
+	for number := e.Start(); number <= lastBlock; number++ {
+		raw, err := e.Block(number)
+		if err != nil {
+			return imported, err
+		}
+		hasher.Write(raw.Hash[:])
+		hasher.Write(common.BigToHash(raw.TD).Bytes())
+
+		block, blockReceipts, err := decodeHistoryBlock(raw)
+		if err != nil {
+			return imported, err
+		}
+		// Skip the blocks already present, including the genesis, and the ones
+		// pruned from the ancient store, which only RestoreHistory can write
+		if number <= chain.CurrentFastBlock().NumberU64() {
+			hash := chain.GetCanonicalHash(number)
+			if hash == (common.Hash{}) {
+				if !pruned {
+					log.Warn("Skipping blocks pruned from the ancient store", "number", number)
+					pruned = true
+				}
+				continue
+			}
+			if hash != raw.Hash {
+				return imported, fmt.Errorf("block #%d mismatch: have %x, want %x", number, raw.Hash, hash)
+			}
+			continue
+		}
+		blocks, receipts, tds = append(blocks, block), append(receipts, blockReceipts), append(tds, raw.TD)
+		if len(blocks) == importBatchSize {
+			if checkInterrupt() {
+				return imported, fmt.Errorf("interrupted")
+			}
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	var accumulator common.Hash
+	hasher.Read(accumulator[:])
+	if accumulator != e.Accumulator() {
+		return imported, fmt.Errorf("accumulator mismatch: have %x, want %x", accumulator, e.Accumulator())
+	}
+	return imported, flush()
+}
+
+// historyRestoreMarker is the file marking an ancient store assembled by
+// RestoreHistory as complete, holding its offset until it replaced the original.
+const historyRestoreMarker = "RESTORED"
+
+// RestoreHistory writes the blocks pruned from the ancient store, below its
+// offset, back from the history files in the specified directory. The ancient
+// store is append-only, so a new one holding the restored blocks followed by
+// the ones of the original is assembled next to it, and then replaces it. The
+// database must not be in use. An interrupted restoration is resumed on the
+// next run.
+func RestoreHistory(stack *node.Node, name string, cache, handles int, ancient, namespace, dir string) error {
+	switch {
+	case ancient == "":
+		ancient = filepath.Join(stack.ResolvePath(name), "ancient")
+	case !filepath.IsAbs(ancient):
+		ancient = stack.ResolvePath(ancient)
+	}
+	restore := ancient + "_restore"
+
+	// Finish replacing the ancient store if it was fully assembled already,
+	// start over otherwise.
+	if blob, err := ioutil.ReadFile(filepath.Join(restore, historyRestoreMarker)); err == nil {
+		offset, err := strconv.ParseUint(string(blob), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid history restoration marker: %v", err)
+		}
+		log.Info("Resuming interrupted history restoration", "offset", offset)
+		return replaceAncients(stack, name, cache, handles, namespace, ancient, restore, offset)
+	}
+	if err := os.RemoveAll(restore); err != nil {
+		return err
+	}
+	db, err := stack.OpenDatabaseWithFreezer(name, cache, handles, ancient, namespace, false, true, false)
+	if err != nil {
+		return err
+	}
+	offset, err := assembleAncients(db, dir, restore, namespace)
+	db.Close()
+	if err != nil {
+		os.RemoveAll(restore)
+		return err
+	}
+	if offset == nil {
+		return nil
+	}
+	return replaceAncients(stack, name, cache, handles, namespace, ancient, restore, *offset)
+}
+
+// assembleAncients writes the blocks of the history files pruned from the
+// ancient store of the database, followed by the blocks of the ancient store,
+// into a new ancient store. It returns the offset of the new store, or nil if
+// there is nothing to restore.
+func assembleAncients(db ethdb.Database, dir string, restore string, namespace string) (*uint64, error) {
+	offset := db.AncientOffSet()
+	if offset == 0 {
+		return nil, nil
+	}
+	frozen, err := db.Ancients()
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := readHistoryChecksums(dir)
+	if err != nil {
+		return nil, err
+	}
+	network := era.Network(rawdb.ReadCanonicalHash(db, 0))
+	names, err := era.ReadDir(dir, network)
+	if err != nil {
+		return nil, err
+	}
+	// Pick the files holding the pruned blocks contiguously up to the offset
+	var files []*era.Era
+	defer func() {
+		for _, e := range files {
+			e.Close()
+		}
+	}()
+	for i := len(names) - 1; i >= 0; i-- {
+		e, err := openHistoryFile(dir, names[i], checksums)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(files) == 0 && e.Start() >= offset:
+			e.Close()
+			continue
+		case len(files) == 0 && e.Start()+e.Count() < offset:
+			e.Close()
+			return nil, fmt.Errorf("no history file holds block #%d", offset-1)
+		case len(files) > 0 && e.Start()+e.Count() != files[0].Start():
+			e.Close()
+		default:
+			files = append([]*era.Era{e}, files...)
+			continue
+		}
+		break
+	}
+	if len(files) == 0 {
+		log.Info("No history files of pruned blocks", "dir", dir, "offset", offset)
+		return nil, nil
+	}
+	start := files[0].Start()
+	log.Info("Restoring pruned history", "dir", dir, "first", start, "last", offset-1)
+
+	frdb, err := rawdb.NewFreezerDb(db, restore, namespace, false, start)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		begin    = time.Now()
+		reported = time.Now()
+		parent   common.Hash
+		td       *big.Int
+	)
+	for _, e := range files {
+		hasher := crypto.NewKeccakState()
+		for number := e.Start(); number < e.Start()+e.Count(); number++ {
+			raw, err := e.Block(number)
+			if err != nil {
+				frdb.Close()
+				return nil, err
+			}
+			hasher.Write(raw.Hash[:])
+			hasher.Write(common.BigToHash(raw.TD).Bytes())
+
+			// Blocks still in the ancient store are copied from there
+			if number >= offset {
+				if hash := rawdb.ReadCanonicalHash(db, number); hash != (common.Hash{}) && hash != raw.Hash {
+					frdb.Close()
+					return nil, fmt.Errorf("block #%d mismatch: have %x, want %x", number, raw.Hash, hash)
+				}
+				continue
+			}
+			block, receipts, err := decodeHistoryBlock(raw)
+			if err == nil && td != nil && block.ParentHash() != parent {
+				err = fmt.Errorf("parent mismatch of block #%d: have %x, want %x", number, block.ParentHash(), parent)
+			}
+			if err == nil && td != nil && new(big.Int).Add(td, block.Difficulty()).Cmp(raw.TD) != 0 {
+				err = fmt.Errorf("total difficulty mismatch of block #%d: have %v, want %v", number, raw.TD, new(big.Int).Add(td, block.Difficulty()))
+			}
+			if err != nil {
+				frdb.Close()
+				return nil, err
+			}
+			rawdb.WriteAncientBlock(frdb, block, receipts, raw.TD)
+			parent, td = block.Hash(), raw.TD
+
+			if time.Since(reported) >= 8*time.Second {
+				log.Info("Restoring pruned history", "number", number, "elapsed", common.PrettyDuration(time.Since(begin)))
+				reported = time.Now()
+			}
+		}
+		var accumulator common.Hash
+		hasher.Read(accumulator[:])
+		if accumulator != e.Accumulator() {
+			frdb.Close()
+			return nil, fmt.Errorf("accumulator mismatch of history file #%d: have %x, want %x", era.Epoch(e.Start()), accumulator, e.Accumulator())
+		}
+	}
+	// The restored blocks must lead to the first block of the ancient store
+	hash := rawdb.ReadCanonicalHash(db, offset)
+	header, ancientTd := rawdb.ReadHeader(db, hash, offset), rawdb.ReadTd(db, hash, offset)
+	if header == nil || ancientTd == nil {
+		frdb.Close()
+		return nil, fmt.Errorf("ancient block #%d missing", offset)
+	}
+	if header.ParentHash != parent || new(big.Int).Add(td, header.Difficulty).Cmp(ancientTd) != 0 {
+		frdb.Close()
+		return nil, fmt.Errorf("history doesn't lead to ancient block #%d", offset)
+	}
+	for number := offset; number < frozen; number++ {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		block, receipts, td := rawdb.ReadBlock(db, hash, number), rawdb.ReadRawReceipts(db, hash, number), rawdb.ReadTd(db, hash, number)
+		if block == nil || receipts == nil || td == nil {
+			frdb.Close()
+			return nil, fmt.Errorf("ancient block #%d missing", number)
+		}
+		rawdb.WriteAncientBlock(frdb, block, receipts, td)
+	}
+	if err := frdb.Close(); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(restore, historyRestoreMarker), []byte(strconv.FormatUint(start, 10)), 0644); err != nil {
+		return nil, err
+	}
+	log.Info("Restored pruned history", "blocks", offset-start, "elapsed", common.PrettyDuration(time.Since(begin)))
+	return &start, nil
+}
+
+// replaceAncients records the offset of the assembled ancient store and moves
+// it in place of the original one.
+func replaceAncients(stack *node.Node, name string, cache, handles int, namespace, ancient, restore string, offset uint64) error {
+	// The original ancient store can't be opened along the new offset, update
+	// it on the key-value store only
+	db, err := stack.OpenDatabase(name, cache, handles, namespace, false)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteOffSetOfCurrentAncientFreezer(db, offset)
+	db.Close()
+
+	if err := os.RemoveAll(ancient); err != nil {
+		return err
+	}
+	if err := os.Rename(restore, ancient); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(ancient, historyRestoreMarker))
+}
+
+// decodeHistoryBlock decodes a block of a history file with its receipts, checking
+// the body and the receipts against the header.
+func decodeHistoryBlock(raw *era.Block) (*types.Block, types.Receipts, error) {
+	var (
+		header   = new(types.Header)
+		body     = new(types.Body)
+		receipts []*types.ReceiptForStorage
+	)
+	if err := rlp.DecodeBytes(raw.Header, header); err != nil {
+		return nil, nil, fmt.Errorf("invalid header of block #%d: %v", raw.Number, err)
+	}
+	if header.Number.Uint64() != raw.Number {
+		return nil, nil, fmt.Errorf("header number mismatch: have %d, want %d", header.Number, raw.Number)
+	}
+	if hash := header.Hash(); hash != raw.Hash {
+		return nil, nil, fmt.Errorf("header hash mismatch of block #%d: have %x, want %x", raw.Number, hash, raw.Hash)
+	}
+	if err := rlp.DecodeBytes(raw.Body, body); err != nil {
+		return nil, nil, fmt.Errorf("invalid body of block #%d: %v", raw.Number, err)
+	}
+	if err := rlp.DecodeBytes(raw.Receipts, &receipts); err != nil {
+		return nil, nil, fmt.Errorf("invalid receipts of block #%d: %v", raw.Number, err)
+	}
+	block := types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles)
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != header.TxHash {
+		return nil, nil, fmt.Errorf("transactions root mismatch of block #%d: have %x, want %x", raw.Number, hash, header.TxHash)
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != header.UncleHash {
+		return nil, nil, fmt.Errorf("uncles hash mismatch of block #%d: have %x, want %x", raw.Number, hash, header.UncleHash)
+	}
+	blockReceipts := make(types.Receipts, len(receipts))
+	for i, receipt := range receipts {
+		blockReceipts[i] = (*types.Receipt)(receipt)
+	}
+	if hash := types.DeriveSha(blockReceipts, trie.NewStackTrie(nil)); hash != header.ReceiptHash {
+		return nil, nil, fmt.Errorf("receipts root mismatch of block #%d: have %x, want %x", raw.Number, hash, header.ReceiptHash)
+	}
+	return block, blockReceipts, nil
+}
+
+// openHistoryFile opens a history file of the directory, after checking it
+// against the recorded checksum.
+func openHistoryFile(dir string, name string, checksums map[string]common.Hash) (*era.Era, error) {
+	want, ok := checksums[name]
+	if !ok {
+		return nil, fmt.Errorf("no checksum of %s", name)
+	}
+	if have, err := historyChecksum(filepath.Join(dir, name)); err != nil {
+		return nil, err
+	} else if have != want {
+		return nil, fmt.Errorf("checksum mismatch of %s: have %x, want %x", name, have, want)
+	}
+	return era.Open(filepath.Join(dir, name))
+}
+
+// historyChecksum computes the sha256 checksum of a history file.
+func historyChecksum(path string) (common.Hash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(hasher.Sum(nil)), nil
+}
+
+// readHistoryChecksums reads the checksums of the history files of a directory.
+func readHistoryChecksums(dir string) (map[string]common.Hash, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, historyChecksums))
+	if err != nil {
+		return nil, err
+	}
+	checksums := make(map[string]common.Hash)
+	for i, line := range strings.Split(string(blob), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != 2*common.HashLength {
+			return nil, fmt.Errorf("invalid checksum at line %d of %s", i+1, historyChecksums)
+		}
+		checksum, err := hex.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid checksum at line %d of %s: %v", i+1, historyChecksums, err)
+		}
+		checksums[fields[1]] = common.BytesToHash(checksum)
+	}
+	return checksums, nil
+}
+
+// writeHistoryChecksums writes the checksums of the history files of a directory,
+// sorted by file name.
+func writeHistoryChecksums(dir string, checksums map[string]common.Hash) error {
+	names := make([]string, 0, len(checksums))
+	for name := range checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%x  %s\n", checksums[name], name)
+	}
+	path := filepath.Join(dir, historyChecksums)
+	if err := ioutil.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
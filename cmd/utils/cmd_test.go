@@ -0,0 +1,356 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr   = crypto.PubkeyToAddress(testKey.PublicKey)
+	testGspec  = &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{testAddr: {Balance: big.NewInt(1000000000000000000)}},
+	}
+)
+
+func newDiffTestChain(t *testing.T) (*core.BlockChain, ethdb.Database) {
+	db := rawdb.NewMemoryDatabase()
+	testGspec.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return chain, db
+}
+
+func TestDiffLayersExportImport(t *testing.T) {
+	source, db := newDiffTestChain(t)
+	defer source.Stop()
+
+	// Every other block transfers some funds, the others have no diff layer
+	signer := types.HomesteadSigner{}
+	blocks, _ := core.GenerateChain(params.TestChainConfig, source.Genesis(), ethash.NewFaker(), db, 64, func(i int, block *core.BlockGen) {
+		if i%2 == 0 {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddr), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, testKey)
+			block.AddTx(tx)
+		}
+	})
+	if _, err := source.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	dir := t.TempDir()
+	blocksFile, diffsFile := filepath.Join(dir, "blocks.rlp"), filepath.Join(dir, "diffs.rlp.gz")
+	if err := ExportChain(source, blocksFile); err != nil {
+		t.Fatalf("failed to export chain: %v", err)
+	}
+	if err := ExportDiffLayers(source, diffsFile, 1, 64); err != nil {
+		t.Fatalf("failed to export diff layers: %v", err)
+	}
+	// The replica ends up on the same chain and state
+	replica, _ := newDiffTestChain(t)
+	defer replica.Stop()
+	core.EnableLightProcessor(replica)
+
+	if err := ImportDiffLayers(replica, blocksFile, diffsFile); err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	// The 32 blocks with transactions are light processed, but for the at most
+	// two ones randomly picked for a full execution
+	if light := replica.Processor().(*core.LightStateProcessor).LightProcessed(); light < 30 {
+		t.Fatalf("light processed block count mismatch: have %d, want at least 30", light)
+	}
+	if have, want := replica.CurrentBlock().Hash(), source.CurrentBlock().Hash(); have != want {
+		t.Fatalf("head mismatch: have %x, want %x", have, want)
+	}
+	if !replica.HasState(replica.CurrentBlock().Root()) {
+		t.Fatalf("head state missing")
+	}
+	// Diff layers of other blocks are rejected
+	stream, file, err := openRLPStream(diffsFile)
+	if err != nil {
+		t.Fatalf("failed to open diff layers: %v", err)
+	}
+	defer file.Close()
+
+	diff, err := readDiffLayer(stream)
+	if err != nil {
+		t.Fatalf("failed to read diff layer: %v", err)
+	}
+	diff.BlockHash = common.Hash{0x01}
+	blob, _ := rlp.EncodeToBytes(diff)
+	badFile := filepath.Join(dir, "bad.rlp")
+	if err := os.WriteFile(badFile, blob, 0600); err != nil {
+		t.Fatalf("failed to write diff layers: %v", err)
+	}
+	other, _ := newDiffTestChain(t)
+	defer other.Stop()
+	core.EnableLightProcessor(other)
+
+	if err := ImportDiffLayers(other, blocksFile, badFile); err == nil {
+		t.Fatalf("mismatching diff layer imported")
+	}
+}
+
+func TestHistoryExportImport(t *testing.T) {
+	source, db := newDiffTestChain(t)
+	defer source.Stop()
+
+	signer := types.HomesteadSigner{}
+	blocks, _ := core.GenerateChain(params.TestChainConfig, source.Genesis(), ethash.NewFaker(), db, 64, func(i int, block *core.BlockGen) {
+		if i%2 == 0 {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddr), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, testKey)
+			block.AddTx(tx)
+		}
+	})
+	if _, err := source.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	dir := t.TempDir()
+	if err := ExportHistory(db, dir, 0, 64); err != nil {
+		t.Fatalf("failed to export history: %v", err)
+	}
+	// The history is rehydrated into the ancient store of a fresh node
+	ancientdb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), t.TempDir(), "", false, false, false)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	testGspec.MustCommit(ancientdb)
+	replica, err := core.NewBlockChain(ancientdb, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer replica.Stop()
+
+	if err := ImportHistory(replica, dir); err != nil {
+		t.Fatalf("failed to import history: %v", err)
+	}
+	if have, want := replica.CurrentFastBlock().Hash(), source.CurrentBlock().Hash(); have != want {
+		t.Fatalf("fast head mismatch: have %x, want %x", have, want)
+	}
+	if frozen, _ := ancientdb.Ancients(); frozen != 65 {
+		t.Fatalf("ancients mismatch: have %d, want %d", frozen, 65)
+	}
+	for _, block := range blocks {
+		if have := replica.GetBlockByNumber(block.NumberU64()); have == nil || have.Hash() != block.Hash() || len(have.Transactions()) != len(block.Transactions()) {
+			t.Fatalf("block #%d mismatch", block.NumberU64())
+		}
+		have, _ := rlp.EncodeToBytes(replica.GetReceiptsByHash(block.Hash()))
+		want, _ := rlp.EncodeToBytes(source.GetReceiptsByHash(block.Hash()))
+		if !bytes.Equal(have, want) {
+			t.Fatalf("receipts of block #%d mismatch", block.NumberU64())
+		}
+	}
+	// Importing again is a no-op, corrupted files are rejected
+	if err := ImportHistory(replica, dir); err != nil {
+		t.Fatalf("failed to import history again: %v", err)
+	}
+	names, err := era.ReadDir(dir, era.Network(source.Genesis().Hash()))
+	if err != nil || len(names) != 1 {
+		t.Fatalf("history files mismatch: %v %v", names, err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, names[0]), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed to open history file: %v", err)
+	}
+	f.WriteAt([]byte{0xff}, 100)
+	f.Close()
+
+	if err := ImportHistory(replica, dir); err == nil {
+		t.Fatalf("corrupted history file imported")
+	}
+}
+
+// Tests that the blocks pruned from the ancient store are restored from the
+// history files.
+func TestHistoryExportIncremental(t *testing.T) {
+	source, db := newDiffTestChain(t)
+	defer source.Stop()
+
+	blocks, _ := core.GenerateChain(params.TestChainConfig, source.Genesis(), ethash.NewFaker(), db, 64, nil)
+	if _, err := source.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	network := era.Network(source.Genesis().Hash())
+	dir := t.TempDir()
+	if err := ExportHistory(db, dir, 0, 40); err != nil {
+		t.Fatalf("failed to export history: %v", err)
+	}
+	// Blocks exported before and pruned from the database since are kept
+	for number := uint64(1); number <= 20; number++ {
+		rawdb.DeleteCanonicalHash(db, number)
+	}
+	if err := ExportHistory(db, dir, 30, 50); err != nil {
+		t.Fatalf("failed to export history: %v", err)
+	}
+	names, err := era.ReadDir(dir, network)
+	if err != nil || len(names) != 1 {
+		t.Fatalf("history files mismatch: %v %v", names, err)
+	}
+	e, err := era.Open(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatalf("failed to open history file: %v", err)
+	}
+	if e.Start() != 0 || e.Count() != 51 {
+		t.Fatalf("history range mismatch: have %d+%d, want 0+51", e.Start(), e.Count())
+	}
+	for _, block := range blocks[:50] {
+		have, err := e.Block(block.NumberU64())
+		if err != nil || have.Hash != block.Hash() {
+			t.Fatalf("block #%d mismatch: %v", block.NumberU64(), err)
+		}
+	}
+	e.Close()
+
+	// Pruned blocks inside the requested range can't be exported
+	if err := ExportHistory(db, dir, 10, 64); err == nil {
+		t.Fatalf("exported pruned blocks")
+	}
+	if names, _ := era.ReadDir(dir, network); len(names) != 1 {
+		t.Fatalf("history files mismatch: %v", names)
+	}
+}
+
+func TestHistoryRestorePruned(t *testing.T) {
+	source, sourcedb := newDiffTestChain(t)
+	defer source.Stop()
+
+	signer := types.HomesteadSigner{}
+	blocks, receipts := core.GenerateChain(params.TestChainConfig, source.Genesis(), ethash.NewFaker(), sourcedb, 64, func(i int, block *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddr), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, testKey)
+		block.AddTx(tx)
+	})
+	if _, err := source.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	dir := t.TempDir()
+	if err := ExportHistory(sourcedb, dir, 0, 64); err != nil {
+		t.Fatalf("failed to export history: %v", err)
+	}
+	// Create a node with all the blocks in the ancient store, and prune them
+	stack, err := node.New(&node.Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	defer stack.Close()
+
+	ancient := filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	db, err := stack.OpenDatabaseWithFreezer("chaindata", 0, 0, ancient, "", false, true, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	testGspec.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if _, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert headers: %v", err)
+	}
+	if _, err := chain.InsertReceiptChain(blocks, receipts, math.MaxUint64); err != nil {
+		t.Fatalf("failed to insert receipts: %v", err)
+	}
+	chain.Stop()
+	db.Close()
+
+	blockPruner := pruner.NewBlockPruner(nil, stack, ancient, filepath.Join(filepath.Dir(ancient), "ancient_back"), 16)
+	if err := blockPruner.BlockPruneBackUp("chaindata", 0, 0, "", false, false); err != nil {
+		t.Fatalf("failed to prune blocks: %v", err)
+	}
+	if err := blockPruner.AncientDbReplacer(); err != nil {
+		t.Fatalf("failed to replace ancient store: %v", err)
+	}
+	// Importing into the pruned node skips the pruned blocks, restoring them
+	// rebuilds the ancient store
+	db, err = stack.OpenDatabaseWithFreezer("chaindata", 0, 0, ancient, "", false, true, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if offset := db.AncientOffSet(); offset != 49 {
+		t.Fatalf("offset mismatch: have %d, want %d", offset, 49)
+	}
+	chain, err = core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if err := ImportHistory(chain, dir); err != nil {
+		t.Fatalf("failed to import history into pruned node: %v", err)
+	}
+	if hash := chain.GetCanonicalHash(10); hash != (common.Hash{}) {
+		t.Fatalf("pruned block imported: %x", hash)
+	}
+	chain.Stop()
+	db.Close()
+
+	if err := RestoreHistory(stack, "chaindata", 0, 0, ancient, "", dir); err != nil {
+		t.Fatalf("failed to restore history: %v", err)
+	}
+	db, err = stack.OpenDatabaseWithFreezer("chaindata", 0, 0, ancient, "", false, true, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if offset := db.AncientOffSet(); offset != 0 {
+		t.Fatalf("offset mismatch: have %d, want %d", offset, 0)
+	}
+	if frozen, _ := db.Ancients(); frozen != 65 {
+		t.Fatalf("ancients mismatch: have %d, want %d", frozen, 65)
+	}
+	for _, block := range blocks {
+		number := block.NumberU64()
+		if hash := rawdb.ReadCanonicalHash(db, number); hash != block.Hash() {
+			t.Fatalf("block #%d: hash mismatch: have %x, want %x", number, hash, block.Hash())
+		}
+		if have := rawdb.ReadBlock(db, block.Hash(), number); have == nil || have.Hash() != block.Hash() || len(have.Transactions()) != 1 {
+			t.Fatalf("block #%d: block mismatch", number)
+		}
+		have, _ := rlp.EncodeToBytes(rawdb.ReadRawReceipts(db, block.Hash(), number))
+		want, _ := rlp.EncodeToBytes(rawdb.ReadRawReceipts(sourcedb, block.Hash(), number))
+		if !bytes.Equal(have, want) {
+			t.Fatalf("block #%d: receipts mismatch", number)
+		}
+		if have, want := rawdb.ReadTd(db, block.Hash(), number), source.GetTd(block.Hash(), number); have == nil || have.Cmp(want) != 0 {
+			t.Fatalf("block #%d: td mismatch: have %v, want %v", number, have, want)
+		}
+	}
+}
@@ -46,6 +46,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
@@ -63,6 +64,7 @@ import (
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/metrics/exp"
 	"github.com/ethereum/go-ethereum/metrics/influxdb"
+	"github.com/ethereum/go-ethereum/mev"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -127,10 +129,18 @@ var (
 		Usage: "Enable diffy sync, Please note that enable diffsync will improve the syncing speed, " +
 			"but will degrade the security to light client level",
 	}
+	DiffSyncVerifyFlag = cli.Float64Flag{
+		Name:  "diffsync.verify",
+		Usage: "Fraction of the blocks imported by diff sync to re-execute in the background, dropping peers serving bad diff layers (0 = disabled)",
+	}
 	PipeCommitFlag = cli.BoolFlag{
 		Name:  "pipecommit",
 		Usage: "Enable MPT pipeline commit, it will improve syncing performance. It is an experimental feature(default is false), diffsync will be disable if pipeline commit is enabled",
 	}
+	ParallelExecutionFlag = cli.BoolFlag{
+		Name:  "parallel",
+		Usage: "Execute the transactions of blocks speculatively in parallel, re-executing the conflicting ones (experimental)",
+	}
 	RangeLimitFlag = cli.BoolFlag{
 		Name:  "rangelimit",
 		Usage: "Enable 5000 blocks limit for range query",
@@ -143,6 +153,14 @@ var (
 		Name:  "datadir.diff",
 		Usage: "Data directory for difflayer segments (default = inside chaindata)",
 	}
+	HistoryDirFlag = DirectoryFlag{
+		Name:  "history.dir",
+		Usage: "Directory of the history files exported by 'geth db export-history', serving the ancient data pruned from the freezer",
+	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use ('leveldb' or 'pebble', default = detected from the datadir or leveldb)",
+	}
 	MinFreeDiskSpaceFlag = DirectoryFlag{
 		Name:  "datadir.minfreedisk",
 		Usage: "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
@@ -241,11 +259,24 @@ var (
 		Name:  "snapshot",
 		Usage: `Enables snapshot-database mode (default = enable)`,
 	}
+	OnlinePruningFlag = cli.BoolFlag{
+		Name:  "pruning.online",
+		Usage: "Prune the stale state in the background while the node is running (requires --snapshot)",
+	}
+	OnlinePruningThrottleFlag = cli.DurationFlag{
+		Name:  "pruning.online.throttle",
+		Usage: "Pause between two deletion batches of the online state pruner",
+		Value: ethconfig.Defaults.OnlinePruningThrottle,
+	}
 	TxLookupLimitFlag = cli.Uint64Flag{
 		Name:  "txlookuplimit",
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: ethconfig.Defaults.TxLookupLimit,
 	}
+	ContractIndexFlag = cli.BoolFlag{
+		Name:  "contractindex",
+		Usage: "Enable indexing the transactions creating contracts, including internal creations (disables --parallel, not supported with --diffsync)",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -268,6 +299,10 @@ var (
 		Name:  "override.berlin",
 		Usage: "Manually specify Berlin fork-block, overriding the bundled setting",
 	}
+	OverrideUpgradesFlag = cli.StringFlag{
+		Name:  "override.upgrades",
+		Usage: "JSON file of system contract upgrades to apply on a private parlia network",
+	}
 	// Light server and client settings
 	LightServeFlag = cli.IntFlag{
 		Name:  "light.serve",
@@ -543,6 +578,11 @@ var (
 		Usage: "Sets a cap on gas that can be used in eth_call/estimateGas (0=infinite)",
 		Value: ethconfig.Defaults.RPCGasCap,
 	}
+	RPCGlobalEVMTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.evmtimeout",
+		Usage: "Sets a timeout used for eth_callBundle and eth_simulateBundle (0=infinite)",
+		Value: ethconfig.Defaults.RPCEVMTimeout,
+	}
 	RPCGlobalTxFeeCapFlag = cli.Float64Flag{
 		Name:  "rpc.txfeecap",
 		Usage: "Sets a cap on transaction fee (in ether) that can be sent via the RPC APIs (0 = no cap)",
@@ -842,6 +882,43 @@ var (
 		Name:  "check-snapshot-with-mpt",
 		Usage: "Enable checking between snapshot and MPT ",
 	}
+
+	// MEV strategy settings
+	MevEnabledFlag = cli.BoolFlag{
+		Name:  "mev",
+		Usage: "Enable the pending transaction strategy service",
+	}
+	MevStrategiesFlag = cli.StringFlag{
+		Name:  "mev.strategies",
+		Usage: "Comma separated list of strategies to run (" + strings.Join(mev.Registered(), ", ") + ")",
+	}
+	MevWorkersFlag = cli.IntFlag{
+		Name:  "mev.workers",
+		Usage: "Number of workers executing strategy callbacks",
+		Value: mev.DefaultConfig.Workers,
+	}
+	MevQueueFlag = cli.IntFlag{
+		Name:  "mev.queue",
+		Usage: "Maximum number of strategy callbacks waiting for a worker",
+		Value: mev.DefaultConfig.QueueSize,
+	}
+	MevTimeoutFlag = cli.DurationFlag{
+		Name:  "mev.timeout",
+		Usage: "Maximum duration of a single strategy callback",
+		Value: mev.DefaultConfig.Timeout,
+	}
+	MevSenderFlag = cli.StringFlag{
+		Name:  "mev.sender",
+		Usage: "Account signing strategy transactions (keystore, usb wallet or external signer)",
+	}
+	MevDetectorRulesFlag = cli.StringFlag{
+		Name:  "mev.detector.rules",
+		Usage: "JSON file with the exploit detector rules (default = built-in flashloan rules)",
+	}
+	MevDetectorSinkFlag = cli.StringFlag{
+		Name:  "mev.detector.sink",
+		Usage: "File the exploit detector appends its alerts to as JSON lines",
+	}
 )
 
 // MakeDataDir retrieves the currently requested data directory, terminating
@@ -1292,6 +1369,7 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setWS(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setDataDir(ctx, cfg)
+	setDBEngine(ctx, cfg)
 	setSmartCard(ctx, cfg)
 
 	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
@@ -1344,6 +1422,21 @@ func setSmartCard(ctx *cli.Context, cfg *node.Config) {
 	cfg.SmartCardDaemonPath = path
 }
 
+func setDBEngine(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		cfg.DBEngine = ctx.GlobalString(DBEngineFlag.Name)
+	}
+	switch cfg.DBEngine {
+	case "", rawdb.DBLeveldb:
+	case rawdb.DBPebble:
+		if !rawdb.PebbleEnabled {
+			Fatalf("Database engine %q is not supported on this platform", cfg.DBEngine)
+		}
+	default:
+		Fatalf("Invalid choice for db.engine '%s', allowed 'leveldb' or 'pebble'", cfg.DBEngine)
+	}
+}
+
 func setDataDir(ctx *cli.Context, cfg *node.Config) {
 	switch {
 	case ctx.GlobalIsSet(DataDirFlag.Name):
@@ -1554,11 +1647,44 @@ func CheckExclusive(ctx *cli.Context, args ...interface{}) {
 	}
 }
 
+// SetMevConfig applies mev-related command line flags to the config.
+func SetMevConfig(ctx *cli.Context, cfg *mev.Config) {
+	if ctx.GlobalIsSet(MevEnabledFlag.Name) {
+		cfg.Enabled = ctx.GlobalBool(MevEnabledFlag.Name)
+	}
+	if ctx.GlobalIsSet(MevStrategiesFlag.Name) {
+		cfg.Strategies = SplitAndTrim(ctx.GlobalString(MevStrategiesFlag.Name))
+	}
+	if ctx.GlobalIsSet(MevWorkersFlag.Name) {
+		cfg.Workers = ctx.GlobalInt(MevWorkersFlag.Name)
+	}
+	if ctx.GlobalIsSet(MevQueueFlag.Name) {
+		cfg.QueueSize = ctx.GlobalInt(MevQueueFlag.Name)
+	}
+	if ctx.GlobalIsSet(MevTimeoutFlag.Name) {
+		cfg.Timeout = ctx.GlobalDuration(MevTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(MevSenderFlag.Name) {
+		sender := ctx.GlobalString(MevSenderFlag.Name)
+		if !common.IsHexAddress(sender) {
+			Fatalf("Invalid mev sender address %q", sender)
+		}
+		cfg.Sender = common.HexToAddress(sender)
+	}
+	if ctx.GlobalIsSet(MevDetectorRulesFlag.Name) {
+		cfg.DetectorRules = ctx.GlobalString(MevDetectorRulesFlag.Name)
+	}
+	if ctx.GlobalIsSet(MevDetectorSinkFlag.Name) {
+		cfg.DetectorSink = ctx.GlobalString(MevDetectorSinkFlag.Name)
+	}
+}
+
 // SetEthConfig applies eth-related command line flags to the config.
 func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	// Avoid conflicting network flags
 	CheckExclusive(ctx, MainnetFlag, DeveloperFlag, RopstenFlag, RinkebyFlag, GoerliFlag, YoloV3Flag)
 	CheckExclusive(ctx, LightServeFlag, SyncModeFlag, "light")
+	CheckExclusive(ctx, ContractIndexFlag, DiffSyncFlag)
 	CheckExclusive(ctx, DeveloperFlag, ExternalSignerFlag) // Can't use both ephemeral unlocked and external signer
 	if ctx.GlobalString(GCModeFlag.Name) == "archive" && ctx.GlobalUint64(TxLookupLimitFlag.Name) != 0 {
 		ctx.GlobalSet(TxLookupLimitFlag.Name, "0")
@@ -1615,9 +1741,19 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(DiffFlag.Name) {
 		cfg.DatabaseDiff = ctx.GlobalString(DiffFlag.Name)
 	}
+	if ctx.GlobalIsSet(HistoryDirFlag.Name) {
+		cfg.HistoryDir = ctx.GlobalString(HistoryDirFlag.Name)
+	}
 	if ctx.GlobalIsSet(PersistDiffFlag.Name) {
 		cfg.PersistDiff = ctx.GlobalBool(PersistDiffFlag.Name)
 	}
+	if ctx.GlobalIsSet(OverrideUpgradesFlag.Name) {
+		upgrades, err := systemcontracts.LoadUpgrades(ctx.GlobalString(OverrideUpgradesFlag.Name))
+		if err != nil {
+			Fatalf("Failed to load system contract upgrades: %v", err)
+		}
+		cfg.OverrideUpgrades = upgrades
+	}
 	if ctx.GlobalIsSet(DiffBlockFlag.Name) {
 		cfg.DiffBlock = ctx.GlobalUint64(DiffBlockFlag.Name)
 	}
@@ -1627,6 +1763,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(GCModeFlag.Name) {
 		cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
 	}
+	if ctx.GlobalIsSet(OnlinePruningFlag.Name) {
+		cfg.OnlinePruning = ctx.GlobalBool(OnlinePruningFlag.Name)
+		if cfg.OnlinePruning && cfg.NoPruning {
+			Fatalf("--%s is not available in archive mode", OnlinePruningFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(OnlinePruningThrottleFlag.Name) {
+		cfg.OnlinePruningThrottle = ctx.GlobalDuration(OnlinePruningThrottleFlag.Name)
+	}
 	if ctx.GlobalIsSet(DirectBroadcastFlag.Name) {
 		cfg.DirectBroadcast = ctx.GlobalBool(DirectBroadcastFlag.Name)
 	}
@@ -1636,9 +1781,19 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(DiffSyncFlag.Name) {
 		cfg.DiffSync = ctx.GlobalBool(DiffSyncFlag.Name)
 	}
+	if ctx.GlobalIsSet(DiffSyncVerifyFlag.Name) {
+		ratio := ctx.GlobalFloat64(DiffSyncVerifyFlag.Name)
+		if ratio < 0 || ratio > 1 {
+			Fatalf("Invalid --%s %v, must be between 0 and 1", DiffSyncVerifyFlag.Name, ratio)
+		}
+		cfg.DiffVerifyRatio = ratio
+	}
 	if ctx.GlobalIsSet(PipeCommitFlag.Name) {
 		cfg.PipeCommit = ctx.GlobalBool(PipeCommitFlag.Name)
 	}
+	if ctx.GlobalIsSet(ParallelExecutionFlag.Name) {
+		cfg.ParallelExecution = ctx.GlobalBool(ParallelExecutionFlag.Name)
+	}
 	if ctx.GlobalIsSet(RangeLimitFlag.Name) {
 		cfg.RangeLimit = ctx.GlobalBool(RangeLimitFlag.Name)
 	}
@@ -1651,6 +1806,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(ContractIndexFlag.Name) {
+		cfg.ContractIndex = ctx.GlobalBool(ContractIndexFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1678,6 +1836,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 			cfg.SnapshotCache = 0 // Disabled
 		}
 	}
+	if cfg.OnlinePruning && cfg.SnapshotCache == 0 {
+		Fatalf("--%s requires --%s", OnlinePruningFlag.Name, SnapshotFlag.Name)
+	}
 	if ctx.GlobalIsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.GlobalString(DocRootFlag.Name)
 	}
@@ -1701,6 +1862,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	} else {
 		log.Info("Global gas cap disabled")
 	}
+	if ctx.GlobalIsSet(RPCGlobalEVMTimeoutFlag.Name) {
+		cfg.RPCEVMTimeout = ctx.GlobalDuration(RPCGlobalEVMTimeoutFlag.Name)
+	}
 	if ctx.GlobalIsSet(RPCGlobalTxFeeCapFlag.Name) {
 		cfg.RPCTxFeeCap = ctx.GlobalFloat64(RPCGlobalTxFeeCapFlag.Name)
 	}
@@ -1848,6 +2012,14 @@ func RegisterEthStatsService(stack *node.Node, backend ethapi.Backend, url strin
 	}
 }
 
+// RegisterMevService configures the pending transaction strategy service and
+// adds it to the given node.
+func RegisterMevService(stack *node.Node, backend ethapi.Backend, cfg *mev.Config) {
+	if _, err := mev.New(stack, backend, cfg); err != nil {
+		Fatalf("Failed to register the mev strategy service: %v", err)
+	}
+}
+
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
 func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, cfg node.Config) {
 	if err := graphql.New(stack, backend, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
@@ -17,12 +17,21 @@
 package parlia
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// maxHistoryRange is the maximum number of blocks a single history query may
+// span, about a day of blocks.
+const maxHistoryRange = 28800
+
+var errInvalidHistoryRange = errors.New("invalid block range")
+
 // API is a user facing RPC API to allow query snapshot and validators
 type API struct {
 	chain  consensus.ChainHeaderReader
@@ -86,3 +95,90 @@ func (api *API) GetValidatorsAtHash(hash common.Hash) ([]common.Address, error)
 	}
 	return snap.validators(), nil
 }
+
+// GetLiveness reports the block production of every validator over the given
+// block range: blocks produced in and out of turn, missed slots and slashes.
+func (api *API) GetLiveness(from, to rpc.BlockNumber) (*LivenessReport, error) {
+	return api.history(from, to)
+}
+
+// GetSlashes retrieves the slash system transactions issued for missed slots
+// over the given block range.
+func (api *API) GetSlashes(from, to rpc.BlockNumber) ([]*SlashEvent, error) {
+	report, err := api.history(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return report.Slashes, nil
+}
+
+// GetValidatorSetHistory retrieves the validator set transitions over the given
+// block range.
+func (api *API) GetValidatorSetHistory(from, to rpc.BlockNumber) ([]*ValidatorSetTransition, error) {
+	report, err := api.history(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return report.Transitions, nil
+}
+
+// GetDoubleSigns retrieves the evidence of the double signs detected over the
+// given block range, along with the offline export of each of them.
+func (api *API) GetDoubleSigns(from, to rpc.BlockNumber) ([]*DoubleSignEvidence, error) {
+	first, last := api.resolveNumber(from), api.resolveNumber(to)
+	if first > last {
+		return nil, errInvalidHistoryRange
+	}
+	return api.parlia.doubleSigns(first, last)
+}
+
+// history replays the snapshots over the given block range, recording the
+// production of every block. Only headers are needed, no state is accessed.
+func (api *API) history(from, to rpc.BlockNumber) (*LivenessReport, error) {
+	first, last := api.resolveNumber(from), api.resolveNumber(to)
+	if first == 0 {
+		first = 1 // Genesis is not produced by any validator
+	}
+	if first > last {
+		return nil, errInvalidHistoryRange
+	}
+	if last-first >= maxHistoryRange {
+		return nil, fmt.Errorf("block range too large: %d > %d", last-first+1, maxHistoryRange)
+	}
+	// Gather the headers backwards to stay on a single chain
+	headers := make([]*types.Header, last-first+1)
+	if headers[len(headers)-1] = api.chain.GetHeaderByNumber(last); headers[len(headers)-1] == nil {
+		return nil, errUnknownBlock
+	}
+	for i := len(headers) - 2; i >= 0; i-- {
+		if headers[i] = api.chain.GetHeader(headers[i+1].ParentHash, first+uint64(i)); headers[i] == nil {
+			return nil, errUnknownBlock
+		}
+	}
+	snap, err := api.parlia.snapshot(api.chain, first-1, headers[0].ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	report := newLivenessReport(first, last)
+	for _, header := range headers {
+		report.record(snap, header)
+
+		next, err := snap.apply([]*types.Header{header}, api.chain, nil, api.parlia.chainConfig.ChainID)
+		if err != nil {
+			return nil, err
+		}
+		if t := transition(snap, next); t != nil {
+			report.Transitions = append(report.Transitions, t)
+		}
+		snap = next
+	}
+	return report, nil
+}
+
+// resolveNumber converts a block number argument into an absolute number.
+func (api *API) resolveNumber(number rpc.BlockNumber) uint64 {
+	if number < 0 {
+		return api.chain.CurrentHeader().Number.Uint64()
+	}
+	return uint64(number)
+}
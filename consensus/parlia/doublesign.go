@@ -0,0 +1,154 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const inMemorySealedHeaders = 4096 // Number of recently sealed headers to keep in memory to detect double signs
+
+// evidencePrefix + number (uint64 big endian) + validator -> DoubleSignEvidence
+var evidencePrefix = []byte("parlia-evidence-")
+
+var doubleSignMeter = metrics.NewRegisteredMeter("parlia/doublesign", nil)
+
+// DoubleSignEvidence is the proof of a validator sealing two different headers
+// at the same height on top of the same parent.
+type DoubleSignEvidence struct {
+	Validator common.Address `json:"validator"`
+	Number    hexutil.Uint64 `json:"number"`
+	Header1   *types.Header  `json:"header1"`
+	Header2   *types.Header  `json:"header2"`
+
+	Payload hexutil.Bytes `json:"payload" rlp:"-"` // Offline export of the evidence, see doubleSignPayload
+}
+
+// sealKey identifies the headers which a validator may only seal once.
+type sealKey struct {
+	number uint64
+	parent common.Hash
+	signer common.Address
+}
+
+// evidenceKey = evidencePrefix + number (uint64 big endian) + validator
+func evidenceKey(number uint64, validator common.Address) []byte {
+	key := make([]byte, len(evidencePrefix)+8+common.AddressLength)
+	copy(key, evidencePrefix)
+	binary.BigEndian.PutUint64(key[len(evidencePrefix):], number)
+	copy(key[len(evidencePrefix)+8:], validator[:])
+	return key
+}
+
+// recordSeal remembers the header sealed by the signer, persisting the evidence
+// of a double sign if the signer already sealed a different header at the same
+// height on top of the same parent.
+func (p *Parlia) recordSeal(header *types.Header, signer common.Address) {
+	key := sealKey{number: header.Number.Uint64(), parent: header.ParentHash, signer: signer}
+
+	p.sealedLock.Lock()
+	known, ok := p.sealed.Get(key)
+	if !ok {
+		p.sealed.Add(key, header)
+	}
+	p.sealedLock.Unlock()
+
+	if !ok || known.(*types.Header).Hash() == header.Hash() {
+		return
+	}
+	first := known.(*types.Header)
+	if has, err := p.db.Has(evidenceKey(key.number, signer)); err != nil || has {
+		return
+	}
+	evidence := &DoubleSignEvidence{
+		Validator: signer,
+		Number:    hexutil.Uint64(key.number),
+		Header1:   first,
+		Header2:   header,
+	}
+	blob, err := rlp.EncodeToBytes(evidence)
+	if err != nil {
+		log.Error("Failed to encode double sign evidence", "err", err)
+		return
+	}
+	if err := p.db.Put(evidenceKey(key.number, signer), blob); err != nil {
+		log.Error("Failed to store double sign evidence", "err", err)
+		return
+	}
+	doubleSignMeter.Mark(1)
+	log.Warn("Detected double sign", "validator", signer, "number", key.number, "hash1", first.Hash(), "hash2", header.Hash())
+}
+
+// ObserveHeader checks a header which bypassed the verification, like a side
+// chain block, for a conflicting seal of its signer.
+func (p *Parlia) ObserveHeader(header *types.Header) {
+	if header.Number == nil || header.Number.Sign() == 0 {
+		return
+	}
+	signer, err := ecrecover(header, p.signatures, p.chainConfig.ChainID)
+	if err != nil || signer != header.Coinbase {
+		return
+	}
+	p.recordSeal(header, signer)
+}
+
+// doubleSigns retrieves the double sign evidence recorded between the given
+// block numbers, both inclusive.
+func (p *Parlia) doubleSigns(from, to uint64) ([]*DoubleSignEvidence, error) {
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, from)
+
+	it := p.db.NewIterator(evidencePrefix, start)
+	defer it.Release()
+
+	evidences := []*DoubleSignEvidence{}
+	for it.Next() {
+		if len(it.Key()) != len(evidencePrefix)+8+common.AddressLength {
+			continue
+		}
+		if binary.BigEndian.Uint64(it.Key()[len(evidencePrefix):]) > to {
+			break
+		}
+		evidence := new(DoubleSignEvidence)
+		if err := rlp.DecodeBytes(it.Value(), evidence); err != nil {
+			return nil, err
+		}
+		payload, err := p.doubleSignPayload(evidence)
+		if err != nil {
+			return nil, err
+		}
+		evidence.Payload = payload
+		evidences = append(evidences, evidence)
+	}
+	return evidences, it.Error()
+}
+
+// doubleSignPayload returns the offline export of the evidence, the RLP list of
+// both headers. It is not the input of a contract call: the slash indicator
+// contracts of the supported forks have no double sign entry point, double signs
+// are submitted to the slashing module of the Binance Chain, which takes the two
+// conflicting headers.
+func (p *Parlia) doubleSignPayload(evidence *DoubleSignEvidence) ([]byte, error) {
+	return rlp.EncodeToBytes([]*types.Header{evidence.Header1, evidence.Header2})
+}
@@ -0,0 +1,125 @@
+package parlia
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// checkEvidence verifies that the evidence proves a double sign and that its
+// payload carries both headers.
+func checkEvidence(engine *Parlia, evidence *DoubleSignEvidence) error {
+	header1, header2 := evidence.Header1, evidence.Header2
+	if header1.Number.Uint64() != uint64(evidence.Number) || header2.Number.Uint64() != uint64(evidence.Number) {
+		return fmt.Errorf("number mismatch: have %d and %d, want %d", header1.Number, header2.Number, evidence.Number)
+	}
+	if header1.ParentHash != header2.ParentHash {
+		return errors.New("different parents")
+	}
+	if header1.Hash() == header2.Hash() {
+		return errors.New("identical headers")
+	}
+	for _, header := range []*types.Header{header1, header2} {
+		signer, err := ecrecover(header, engine.signatures, engine.chainConfig.ChainID)
+		if err != nil {
+			return err
+		}
+		if signer != evidence.Validator {
+			return fmt.Errorf("signer mismatch: have %x, want %x", signer, evidence.Validator)
+		}
+	}
+	var decoded []*types.Header
+	if err := rlp.DecodeBytes(evidence.Payload, &decoded); err != nil {
+		return err
+	}
+	if len(decoded) != 2 {
+		return fmt.Errorf("payload header count mismatch: have %d, want 2", len(decoded))
+	}
+	for i, header := range []*types.Header{header1, header2} {
+		if decoded[i].Hash() != header.Hash() {
+			return fmt.Errorf("payload header %d mismatch: have %x, want %x", i+1, decoded[i].Hash(), header.Hash())
+		}
+	}
+	return nil
+}
+
+func newDoubleSignEngine(db ethdb.Database) *Parlia {
+	config := *params.AllParliaProtocolChanges
+	config.Parlia = &params.ParliaConfig{Period: 3, Epoch: 200}
+	return New(&config, db, ethapi.NewPublicBlockChainAPI(nil), common.Hash{})
+}
+
+func signedHeader(key *ecdsa.PrivateKey, parent common.Hash, number int64, vanity byte) *types.Header {
+	header := &types.Header{
+		ParentHash: parent,
+		Number:     big.NewInt(number),
+		Coinbase:   crypto.PubkeyToAddress(key.PublicKey),
+		Difficulty: new(big.Int).Set(diffInTurn),
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+	header.Extra[0] = vanity
+
+	sig, err := crypto.Sign(SealHash(header, params.AllParliaProtocolChanges.ChainID).Bytes(), key)
+	if err != nil {
+		panic(err)
+	}
+	copy(header.Extra[extraVanity:], sig)
+	return header
+}
+
+func TestDoubleSignEvidence(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	engine := newDoubleSignEngine(db)
+
+	key, _ := crypto.GenerateKey()
+	parent := common.HexToHash("0x01")
+
+	// Seeing the same header twice or headers on different branches is fine
+	engine.ObserveHeader(signedHeader(key, parent, 5, 0))
+	engine.ObserveHeader(signedHeader(key, parent, 5, 0))
+	engine.ObserveHeader(signedHeader(key, common.HexToHash("0x02"), 5, 1))
+	engine.ObserveHeader(signedHeader(key, parent, 6, 1))
+
+	if evidences, err := engine.doubleSigns(0, 10); err != nil || len(evidences) != 0 {
+		t.Fatalf("unexpected evidence: %v, err %v", evidences, err)
+	}
+	// A second header on the same parent and height is a double sign, further
+	// ones don't replace the evidence
+	engine.ObserveHeader(signedHeader(key, parent, 5, 1))
+	engine.ObserveHeader(signedHeader(key, parent, 5, 2))
+
+	evidences, err := engine.doubleSigns(0, 10)
+	if err != nil {
+		t.Fatalf("failed to retrieve evidence: %v", err)
+	}
+	if len(evidences) != 1 {
+		t.Fatalf("evidence count mismatch: have %d, want 1", len(evidences))
+	}
+	if err := checkEvidence(engine, evidences[0]); err != nil {
+		t.Fatalf("invalid evidence: %v", err)
+	}
+	if have, want := evidences[0].Header2.Extra[0], byte(1); have != want {
+		t.Errorf("evidence replaced: have vanity %d, want %d", have, want)
+	}
+	// The evidence is persisted and filtered by height
+	engine.Close()
+	engine = newDoubleSignEngine(db)
+
+	if evidences, err := engine.doubleSigns(5, 5); err != nil || len(evidences) != 1 {
+		t.Fatalf("evidence not persisted: %v, err %v", evidences, err)
+	}
+	if evidences, err := engine.doubleSigns(6, 10); err != nil || len(evidences) != 0 {
+		t.Fatalf("evidence out of range: %v, err %v", evidences, err)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/gopool"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// EventType is the kind of a parlia event.
+type EventType string
+
+const (
+	EventValidatorSetChange EventType = "validatorSetChange" // The validator set rotated after an epoch
+	EventSlash              EventType = "slash"              // A validator was slashed for a missed slot
+	EventReward             EventType = "reward"             // The fees of a block were distributed
+)
+
+// RewardEvent is the distribution of the fees collected by a block to the
+// validator and system reward contracts.
+type RewardEvent struct {
+	Number       hexutil.Uint64 `json:"number"`
+	Hash         common.Hash    `json:"hash"`
+	Validator    common.Address `json:"validator"`    // Validator credited with the deposit
+	Deposit      *hexutil.Big   `json:"deposit"`      // Amount deposited to the validator contract
+	SystemReward *hexutil.Big   `json:"systemReward"` // Amount sent to the system reward contract
+}
+
+// Event is a consensus event derived from an imported block. Only the payload
+// matching the type is set.
+type Event struct {
+	Type       EventType               `json:"type"`
+	Transition *ValidatorSetTransition `json:"transition,omitempty"`
+	Slash      *SlashEvent             `json:"slash,omitempty"`
+	Reward     *RewardEvent            `json:"reward,omitempty"`
+}
+
+// SubscribeEvents registers a subscription for the consensus events of the
+// canonical blocks imported by a chain watched by the engine.
+func (p *Parlia) SubscribeEvents(ch chan<- *Event) event.Subscription {
+	return p.eventScope.Track(p.eventFeed.Subscribe(ch))
+}
+
+// watchedChain is the subset of the blockchain needed to derive the events of
+// the imported blocks.
+type watchedChain interface {
+	consensus.ChainHeaderReader
+	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+	SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription
+}
+
+// WatchChain follows the blocks imported into the chain until the engine is
+// closed, checking the side blocks for double signs and publishing the events
+// of the canonical ones.
+func (p *Parlia) WatchChain(chain watchedChain) {
+	var (
+		heads    = make(chan core.ChainEvent, 16)
+		headsSub = chain.SubscribeChainEvent(heads)
+		sides    = make(chan core.ChainSideEvent, 16)
+		sidesSub = chain.SubscribeChainSideEvent(sides)
+	)
+	go func() {
+		defer headsSub.Unsubscribe()
+		defer sidesSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-heads:
+				if p.eventScope.Count() == 0 {
+					continue
+				}
+				events, err := p.blockEvents(chain, ev.Block)
+				if err != nil {
+					log.Warn("Failed to derive parlia events", "number", ev.Block.Number(), "hash", ev.Hash, "err", err)
+					continue
+				}
+				for _, event := range events {
+					p.eventFeed.Send(event)
+				}
+			case ev := <-sides:
+				p.ObserveHeader(ev.Block.Header())
+			case <-headsSub.Err():
+				return
+			case <-sidesSub.Err():
+				return
+			case <-p.closeCh:
+				return
+			}
+		}
+	}()
+}
+
+// blockEvents derives the consensus events of a block: the validator set
+// change from the snapshots around it and the slashes and rewards from its
+// system transactions.
+func (p *Parlia) blockEvents(chain consensus.ChainHeaderReader, block *types.Block) ([]*Event, error) {
+	header := block.Header()
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil, nil
+	}
+	parent, err := p.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := p.snapshot(chain, number, block.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var events []*Event
+	if t := transition(parent, snap); t != nil {
+		events = append(events, &Event{Type: EventValidatorSetChange, Transition: t})
+	}
+	var reward *RewardEvent
+	for _, tx := range block.Transactions() {
+		if system, err := p.IsSystemTransaction(tx, header); err != nil || !system {
+			continue
+		}
+		switch *tx.To() {
+		case common.HexToAddress(systemcontracts.SlashContract):
+			if args := unpackCall(p.slashABI, "slash", tx.Data()); args != nil {
+				events = append(events, &Event{Type: EventSlash, Slash: &SlashEvent{
+					Number:    hexutil.Uint64(number),
+					Hash:      block.Hash(),
+					Validator: args[0].(common.Address),
+					Producer:  header.Coinbase,
+				}})
+			}
+		case common.HexToAddress(systemcontracts.ValidatorContract):
+			if args := unpackCall(p.validatorSetABI, "deposit", tx.Data()); args != nil {
+				if reward == nil {
+					reward = newRewardEvent(block)
+				}
+				reward.Validator = args[0].(common.Address)
+				reward.Deposit = (*hexutil.Big)(tx.Value())
+			}
+		case common.HexToAddress(systemcontracts.SystemRewardContract):
+			if reward == nil {
+				reward = newRewardEvent(block)
+			}
+			reward.SystemReward = (*hexutil.Big)(tx.Value())
+		}
+	}
+	if reward != nil {
+		events = append(events, &Event{Type: EventReward, Reward: reward})
+	}
+	return events, nil
+}
+
+func newRewardEvent(block *types.Block) *RewardEvent {
+	return &RewardEvent{
+		Number:       hexutil.Uint64(block.NumberU64()),
+		Hash:         block.Hash(),
+		Validator:    block.Coinbase(),
+		Deposit:      new(hexutil.Big),
+		SystemReward: new(hexutil.Big),
+	}
+}
+
+// unpackCall returns the arguments of a call to the given contract method, or
+// nil if the input calls another method.
+func unpackCall(contract abi.ABI, name string, input []byte) []interface{} {
+	method := contract.Methods[name]
+	if len(input) < 4 || !bytes.Equal(input[:4], method.ID) {
+		return nil
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil || len(args) != len(method.Inputs) {
+		return nil
+	}
+	return args
+}
+
+// EventAPI provides the subscription to the parlia events in the eth namespace.
+type EventAPI struct {
+	parlia *Parlia
+}
+
+// ParliaEvents creates a subscription firing for the validator set changes,
+// slashes and reward distributions of the imported canonical blocks.
+func (api *EventAPI) ParliaEvents(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	gopool.Submit(func() {
+		events := make(chan *Event, 16)
+		eventsSub := api.parlia.SubscribeEvents(events)
+		defer eventsSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				notifier.Notify(rpcSub.ID, ev)
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	})
+	return rpcSub, nil
+}
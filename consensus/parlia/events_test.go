@@ -0,0 +1,94 @@
+package parlia
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestEvents(t *testing.T) {
+	net := newSimNetwork(t, 3, 1, 10)
+
+	n := net.nodes[2]
+	events := make(chan *Event, 1024)
+	sub := n.engine.SubscribeEvents(events)
+	defer sub.Unsubscribe()
+
+	// Take a validator offline and rotate it out of the set
+	offline := net.nodes[0]
+	net.setOnline(offline.index, false)
+
+	// The validator set only accepts packages once initialised at block 1
+	net.run(2 * time.Second)
+
+	remaining := []common.Address{net.nodes[1].address, net.nodes[2].address}
+	tx := net.submit(common.HexToAddress(systemcontracts.CrossChainContract), systemcontracts.DevnetUpdateValidatorsData(remaining))
+	net.run(58 * time.Second)
+
+	var (
+		slashes     []*SlashEvent
+		transitions []*ValidatorSetTransition
+		rewards     []*RewardEvent
+	)
+	for done := false; !done; {
+		select {
+		case ev := <-events:
+			switch ev.Type {
+			case EventSlash:
+				slashes = append(slashes, ev.Slash)
+			case EventValidatorSetChange:
+				transitions = append(transitions, ev.Transition)
+			case EventReward:
+				rewards = append(rewards, ev.Reward)
+			default:
+				t.Fatalf("unexpected event type %q", ev.Type)
+			}
+		case <-time.After(100 * time.Millisecond):
+			done = true
+		}
+	}
+	// The slashes match the history of the chain
+	head := n.chain.CurrentHeader().Number.Uint64()
+	want, err := (&API{chain: n.chain, parlia: n.engine}).history(1, rpc.BlockNumber(head))
+	if err != nil {
+		t.Fatalf("failed to retrieve history: %v", err)
+	}
+	if len(slashes) == 0 || !reflect.DeepEqual(slashes, want.Slashes) {
+		t.Errorf("slash events mismatch: have %d, want %d", len(slashes), len(want.Slashes))
+	}
+	for _, slash := range slashes {
+		if slash.Validator != offline.address {
+			t.Errorf("block %d: slashed validator mismatch: have %x, want %x", slash.Number, slash.Validator, offline.address)
+		}
+	}
+	// The rotation shows up once the new set takes effect
+	if len(transitions) != 1 {
+		t.Fatalf("transition count mismatch: have %d, want 1", len(transitions))
+	}
+	if have := transitions[0]; len(have.Previous) != 3 || !reflect.DeepEqual(have.Removed, []common.Address{offline.address}) || len(have.Validators) != 2 {
+		t.Errorf("transition mismatch: previous %v, removed %v, validators %v", have.Previous, have.Removed, have.Validators)
+	}
+	// The fees of the transaction get distributed by its block
+	if len(rewards) != 1 {
+		t.Fatalf("reward count mismatch: have %d, want 1", len(rewards))
+	}
+	block := n.chain.GetBlockByHash(rewards[0].Hash)
+	if block == nil || block.Transaction(tx.Hash()) == nil {
+		t.Fatalf("reward not distributed by the block of the transaction")
+	}
+	receipts := n.chain.GetReceiptsByHash(block.Hash())
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(receipts[0].GasUsed), tx.GasPrice())
+
+	reward := rewards[0]
+	if total := new(big.Int).Add(reward.Deposit.ToInt(), reward.SystemReward.ToInt()); total.Cmp(fee) != 0 {
+		t.Errorf("reward mismatch: have %v, want %v", total, fee)
+	}
+	if reward.Validator != block.Coinbase() {
+		t.Errorf("rewarded validator mismatch: have %x, want %x", reward.Validator, block.Coinbase())
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ValidatorLiveness is the block production record of a validator.
+type ValidatorLiveness struct {
+	InTurn    uint64 `json:"inTurn"`    // Blocks produced in turn
+	OutOfTurn uint64 `json:"outOfTurn"` // Blocks produced out of turn
+	BackOff   uint64 `json:"backOff"`   // Sum of the back off delays of the out of turn blocks, in seconds
+
+	Missed            uint64 `json:"missed"`            // In turn slots produced by another validator
+	Slashed           uint64 `json:"slashed"`           // Missed slots which triggered a slash system transaction
+	RecentsViolations uint64 `json:"recentsViolations"` // Missed slots while still in the recents window, never slashed
+}
+
+// SlashEvent is a slash system transaction issued for a missed slot.
+type SlashEvent struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Hash      common.Hash    `json:"hash"`
+	Validator common.Address `json:"validator"` // Validator being slashed
+	Producer  common.Address `json:"producer"`  // Validator issuing the slash
+}
+
+// ValidatorSetTransition is a change of the validator set at an epoch.
+type ValidatorSetTransition struct {
+	Number     hexutil.Uint64   `json:"number"`
+	Hash       common.Hash      `json:"hash"`
+	Added      []common.Address `json:"added"`
+	Removed    []common.Address `json:"removed"`
+	Previous   []common.Address `json:"previous"`
+	Validators []common.Address `json:"validators"`
+}
+
+// LivenessReport summarizes the block production over a range of blocks.
+type LivenessReport struct {
+	From        hexutil.Uint64                        `json:"from"`
+	To          hexutil.Uint64                        `json:"to"`
+	Validators  map[common.Address]*ValidatorLiveness `json:"validators"`
+	Slashes     []*SlashEvent                         `json:"slashes"`
+	Transitions []*ValidatorSetTransition             `json:"transitions"`
+}
+
+// newLivenessReport creates an empty report of the given block range.
+func newLivenessReport(from, to uint64) *LivenessReport {
+	return &LivenessReport{
+		From:        hexutil.Uint64(from),
+		To:          hexutil.Uint64(to),
+		Validators:  make(map[common.Address]*ValidatorLiveness),
+		Slashes:     []*SlashEvent{},
+		Transitions: []*ValidatorSetTransition{},
+	}
+}
+
+// validator returns the record of the given validator, creating it if needed.
+func (r *LivenessReport) validator(address common.Address) *ValidatorLiveness {
+	liveness, ok := r.Validators[address]
+	if !ok {
+		liveness = new(ValidatorLiveness)
+		r.Validators[address] = liveness
+	}
+	return liveness
+}
+
+// record accounts the production of a header on top of the snapshot of its
+// parent, mirroring the slashing rules of Finalize.
+func (r *LivenessReport) record(snap *Snapshot, header *types.Header) {
+	producer := r.validator(header.Coinbase)
+	if header.Difficulty.Cmp(diffInTurn) == 0 {
+		producer.InTurn++
+		return
+	}
+	producer.OutOfTurn++
+	producer.BackOff += backOffTime(snap, header.Coinbase)
+
+	spoiled := snap.supposeValidator()
+	missed := r.validator(spoiled)
+	missed.Missed++
+	for _, recent := range snap.Recents {
+		if recent == spoiled {
+			missed.RecentsViolations++
+			return
+		}
+	}
+	missed.Slashed++
+	r.Slashes = append(r.Slashes, &SlashEvent{
+		Number:    hexutil.Uint64(header.Number.Uint64()),
+		Hash:      header.Hash(),
+		Validator: spoiled,
+		Producer:  header.Coinbase,
+	})
+}
+
+// transition returns the validator set change between two consecutive
+// snapshots, or nil if the set did not change.
+func transition(parent, snap *Snapshot) *ValidatorSetTransition {
+	added, removed := []common.Address{}, []common.Address{}
+	for _, val := range snap.validators() {
+		if _, ok := parent.Validators[val]; !ok {
+			added = append(added, val)
+		}
+	}
+	for _, val := range parent.validators() {
+		if _, ok := snap.Validators[val]; !ok {
+			removed = append(removed, val)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return &ValidatorSetTransition{
+		Number:     hexutil.Uint64(snap.Number),
+		Hash:       snap.Hash,
+		Added:      added,
+		Removed:    removed,
+		Previous:   parent.validators(),
+		Validators: snap.validators(),
+	}
+}
@@ -0,0 +1,69 @@
+package parlia
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestLivenessRecord(t *testing.T) {
+	vals := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+	snapAt := func(number uint64, recents map[uint64]common.Address) *Snapshot {
+		snap := newSnapshot(nil, nil, number, common.Hash{}, vals, nil)
+		for n, val := range recents {
+			snap.Recents[n] = val
+		}
+		return snap
+	}
+	header := func(number uint64, coinbase common.Address, difficulty *big.Int) *types.Header {
+		return &types.Header{Number: new(big.Int).SetUint64(number), Coinbase: coinbase, Difficulty: difficulty}
+	}
+	report := newLivenessReport(10, 12)
+
+	// Block 10 produced in turn by vals[1]
+	report.record(snapAt(9, nil), header(10, vals[1], diffInTurn))
+	// Block 11 taken over by vals[0] while vals[2] was free to sign: slash
+	report.record(snapAt(10, map[uint64]common.Address{10: vals[1]}), header(11, vals[0], diffNoTurn))
+	// Block 12 taken over by vals[2] while vals[0] was still in the recents window
+	report.record(snapAt(11, map[uint64]common.Address{11: vals[0]}), header(12, vals[2], diffNoTurn))
+
+	want := map[common.Address]ValidatorLiveness{
+		vals[0]: {OutOfTurn: 1, Missed: 1, RecentsViolations: 1},
+		vals[1]: {InTurn: 1},
+		vals[2]: {OutOfTurn: 1, Missed: 1, Slashed: 1},
+	}
+	for val, liveness := range want {
+		have := report.Validators[val]
+		if have == nil {
+			t.Fatalf("missing record of %x", val)
+		}
+		have.BackOff = 0 // Randomized, checked separately
+		if *have != liveness {
+			t.Errorf("record of %x mismatch: have %+v, want %+v", val, *have, liveness)
+		}
+	}
+	if len(report.Slashes) != 1 || report.Slashes[0].Validator != vals[2] || report.Slashes[0].Producer != vals[0] {
+		t.Errorf("slash events mismatch: %+v", report.Slashes)
+	}
+}
+
+func TestValidatorSetTransition(t *testing.T) {
+	var (
+		a, b, c = common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToAddress("0x0c")
+		parent  = newSnapshot(nil, nil, 99, common.Hash{}, []common.Address{a, b}, nil)
+		same    = newSnapshot(nil, nil, 100, common.Hash{}, []common.Address{b, a}, nil)
+		changed = newSnapshot(nil, nil, 100, common.Hash{}, []common.Address{b, c}, nil)
+	)
+	if tr := transition(parent, same); tr != nil {
+		t.Fatalf("unexpected transition: %+v", tr)
+	}
+	tr := transition(parent, changed)
+	if tr == nil {
+		t.Fatal("missing transition")
+	}
+	if uint64(tr.Number) != 100 || len(tr.Added) != 1 || tr.Added[0] != c || len(tr.Removed) != 1 || tr.Removed[0] != a || len(tr.Validators) != 2 {
+		t.Errorf("transition mismatch: %+v", tr)
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
@@ -199,6 +200,8 @@ type Parlia struct {
 
 	recentSnaps *lru.ARCCache // Snapshots for recent block to speed up
 	signatures  *lru.ARCCache // Signatures of recent blocks to speed up mining
+	sealed      *lru.ARCCache // Recently sealed headers to detect double signs
+	sealedLock  sync.Mutex    // Protects the sealed headers lookup and insertion
 
 	signer types.Signer
 
@@ -212,6 +215,14 @@ type Parlia struct {
 	validatorSetABI abi.ABI
 	slashABI        abi.ABI
 
+	clock clock // Source of time, simulated in tests
+
+	eventFeed  event.Feed // Consensus events of the imported canonical blocks
+	eventScope event.SubscriptionScope
+
+	closeCh   chan struct{} // Channel to terminate the background goroutines
+	closeOnce sync.Once
+
 	// The fields below are for testing only
 	fakeDiff bool // Skip difficulty verifications
 }
@@ -240,6 +251,10 @@ func New(
 	if err != nil {
 		panic(err)
 	}
+	sealed, err := lru.NewARC(inMemorySealedHeaders)
+	if err != nil {
+		panic(err)
+	}
 	vABI, err := abi.JSON(strings.NewReader(validatorSetABI))
 	if err != nil {
 		panic(err)
@@ -256,9 +271,12 @@ func New(
 		ethAPI:          ethAPI,
 		recentSnaps:     recentSnaps,
 		signatures:      signatures,
+		sealed:          sealed,
 		validatorSetABI: vABI,
 		slashABI:        sABI,
 		signer:          types.NewEIP155Signer(chainConfig.ChainID),
+		clock:           systemClock{},
+		closeCh:         make(chan struct{}),
 	}
 
 	return c
@@ -328,7 +346,7 @@ func (p *Parlia) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 	number := header.Number.Uint64()
 
 	// Don't waste time checking blocks from the future
-	if header.Time > uint64(time.Now().Unix()) {
+	if header.Time > uint64(p.clock.Now().Unix()) {
 		return consensus.ErrFutureBlock
 	}
 	// Check that the extra-data contains the vanity, validators and signature.
@@ -568,6 +586,7 @@ func (p *Parlia) verifySeal(chain consensus.ChainHeaderReader, header *types.Hea
 	if _, ok := snap.Validators[signer]; !ok {
 		return errUnauthorizedValidator
 	}
+	p.recordSeal(header, signer)
 
 	for seen, recent := range snap.Recents {
 		if recent == signer {
@@ -639,8 +658,8 @@ func (p *Parlia) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 		return consensus.ErrUnknownAncestor
 	}
 	header.Time = p.blockTimeForRamanujanFork(snap, header, parent)
-	if header.Time < uint64(time.Now().Unix()) {
-		header.Time = uint64(time.Now().Unix())
+	if now := uint64(p.clock.Now().Unix()); header.Time < now {
+		header.Time = now
 	}
 	return nil
 }
@@ -863,11 +882,12 @@ func (p *Parlia) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 
 	// Wait until sealing is terminated or delay timeout.
 	log.Trace("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
+	timeout := p.clock.After(delay)
 	go func() {
 		select {
 		case <-stop:
 			return
-		case <-time.After(delay):
+		case <-timeout:
 		}
 		if p.shouldWaitForCurrentBlockProcess(chain, header, snap) {
 			log.Info("Waiting for received in turn block to process")
@@ -875,7 +895,7 @@ func (p *Parlia) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 			case <-stop:
 				log.Info("Received block process finished, abort block seal")
 				return
-			case <-time.After(time.Duration(processBackOffTime) * time.Second):
+			case <-p.clock.After(time.Duration(processBackOffTime) * time.Second):
 				log.Info("Process backoff time exhausted, start to seal block")
 			}
 		}
@@ -930,7 +950,7 @@ func (p *Parlia) IsLocalBlock(header *types.Header) bool {
 }
 
 func (p *Parlia) SignRecently(chain consensus.ChainReader, parent *types.Header) (bool, error) {
-	snap, err := p.snapshot(chain, parent.Number.Uint64(), parent.ParentHash, nil)
+	snap, err := p.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
 	if err != nil {
 		return true, err
 	}
@@ -953,6 +973,16 @@ func (p *Parlia) SignRecently(chain consensus.ChainReader, parent *types.Header)
 	return false, nil
 }
 
+// NextInTurnValidator returns the validator expected to seal the block on top
+// of the given parent.
+func (p *Parlia) NextInTurnValidator(chain consensus.ChainHeaderReader, parent *types.Header) (common.Address, error) {
+	snap, err := p.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return snap.supposeValidator(), nil
+}
+
 // CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
 // that a new block should have based on the previous blocks in the chain and the
 // current signer.
@@ -986,14 +1016,36 @@ func (p *Parlia) APIs(chain consensus.ChainHeaderReader) []rpc.API {
 		Version:   "1.0",
 		Service:   &API{chain: chain, parlia: p},
 		Public:    false,
+	}, {
+		Namespace: "eth",
+		Version:   "1.0",
+		Service:   &EventAPI{parlia: p},
+		Public:    true,
 	}}
 }
 
-// Close implements consensus.Engine. It's a noop for parlia as there are no background threads.
+// Close implements consensus.Engine, terminating the chain watcher and the
+// event subscriptions.
 func (p *Parlia) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closeCh)
+		p.eventScope.Close()
+	})
 	return nil
 }
 
+// clock is the source of time of the engine.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is a clock using the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
 // ==========================  interaction with contract/account =========
 
 // getCurrentValidators get current validators
@@ -14,7 +14,7 @@ const (
 )
 
 func (p *Parlia) delayForRamanujanFork(snap *Snapshot, header *types.Header) time.Duration {
-	delay := time.Until(time.Unix(int64(header.Time), 0)) // nolint: gosimple
+	delay := time.Unix(int64(header.Time), 0).Sub(p.clock.Now())
 	if p.chainConfig.IsRamanujan(header.Number) {
 		return delay
 	}
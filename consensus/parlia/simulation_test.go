@@ -0,0 +1,813 @@
+package parlia
+
+import (
+	"container/heap"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// simGenesisTime is the timestamp of the genesis block of simulated networks.
+// It lies in the past so that the blockchain's own future block checks, using
+// the system time, never trigger.
+const simGenesisTime = 1600000000
+
+// simTimer is a pending event of the simulated clock, either an engine waiting
+// on a channel or a callback of the simulation.
+type simTimer struct {
+	deadline time.Time
+	seq      uint64
+	ch       chan time.Time
+	fn       func()
+}
+
+// simTimers is a heap of timers ordered by deadline, then by creation.
+type simTimers []*simTimer
+
+func (t simTimers) Len() int { return len(t) }
+func (t simTimers) Less(i, j int) bool {
+	if t[i].deadline.Equal(t[j].deadline) {
+		return t[i].seq < t[j].seq
+	}
+	return t[i].deadline.Before(t[j].deadline)
+}
+func (t simTimers) Swap(i, j int)       { t[i], t[j] = t[j], t[i] }
+func (t *simTimers) Push(x interface{}) { *t = append(*t, x.(*simTimer)) }
+func (t *simTimers) Pop() interface{} {
+	old := *t
+	timer := old[len(old)-1]
+	*t = old[:len(old)-1]
+	return timer
+}
+
+// simClock is a deterministic clock shared by the engines of a simulation. Time
+// only moves when the simulation advances it to the next timer.
+type simClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers simTimers
+	seq    uint64
+
+	registered chan struct{} // Signalled whenever an engine starts waiting
+}
+
+func newSimClock(now time.Time) *simClock {
+	return &simClock{now: now, registered: make(chan struct{}, 1024)}
+}
+
+func (c *simClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *simClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+
+	c.lock.Lock()
+	c.push(&simTimer{deadline: c.now.Add(d), ch: ch})
+	c.lock.Unlock()
+
+	c.registered <- struct{}{}
+	return ch
+}
+
+// schedule runs fn on the simulation goroutine once d elapsed.
+func (c *simClock) schedule(d time.Duration, fn func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.push(&simTimer{deadline: c.now.Add(d), fn: fn})
+}
+
+func (c *simClock) push(timer *simTimer) {
+	timer.seq = c.seq
+	c.seq++
+	heap.Push(&c.timers, timer)
+}
+
+// next pops the earliest timer due no later than end and moves the time to its
+// deadline. If there is none, the time is moved to end and nil returned.
+func (c *simClock) next(end time.Time) *simTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.timers) == 0 || c.timers[0].deadline.After(end) {
+		if end.After(c.now) {
+			c.now = end
+		}
+		return nil
+	}
+	timer := heap.Pop(&c.timers).(*simTimer)
+	if timer.deadline.After(c.now) {
+		c.now = timer.deadline
+	}
+	return timer
+}
+
+// simBackend is the minimal ethapi backend the engine needs to query the
+// system contracts of a simulated chain.
+type simBackend struct {
+	ethapi.Backend
+	chain *core.BlockChain
+}
+
+func (b *simBackend) RPCGasCap() uint64 { return 50000000 }
+
+func (b *simBackend) RPCEVMTimeout() time.Duration { return 5 * time.Second }
+
+func (b *simBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	var header *types.Header
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		header = b.chain.GetHeaderByHash(hash)
+	} else if number, ok := blockNrOrHash.Number(); ok && number >= 0 {
+		header = b.chain.GetHeaderByNumber(uint64(number))
+	} else {
+		header = b.chain.CurrentHeader()
+	}
+	if header == nil {
+		return nil, nil, errUnknownBlock
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *simBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config) (*vm.EVM, func() error, error) {
+	if vmConfig == nil {
+		vmConfig = new(vm.Config)
+	}
+	context := core.NewEVMBlockContext(header, b.chain, nil)
+	return vm.NewEVM(context, core.NewEVMTxContext(msg), state, b.chain.Config(), *vmConfig), func() error { return nil }, nil
+}
+
+// simNode is a validator of a simulated network, running the real engine on
+// top of its own in-memory chain.
+type simNode struct {
+	index   int
+	address common.Address
+	db      ethdb.Database
+	engine  *Parlia
+	chain   *core.BlockChain
+
+	online     bool
+	latency    time.Duration        // Delay until the peers receive the blocks of the node
+	doubleSign bool                 // Whether the node seals two conflicting blocks per height
+	pending    map[common.Hash]bool // Seal hashes of the blocks being sealed
+	reorgs     int                  // Number of times the node switched branches
+}
+
+// simNetwork is a deterministic simulation of a parlia network. All engines
+// share a fake clock which only advances once every engine is idle, making
+// the outcome of a run independent of the scheduling of the host.
+type simNetwork struct {
+	t       *testing.T
+	clock   *simClock
+	genesis *core.Genesis
+	nodes   []*simNode
+
+	faucet *ecdsa.PrivateKey    // Funded account, relaying the validator set packages
+	txs    []*types.Transaction // Transactions included by every proposer once executable
+
+	results chan *types.Block
+	waiting int // Number of engine events the simulation has to wait for
+
+	sealed map[common.Address]map[uint64][]*types.Block // Blocks sealed by each validator per height
+}
+
+func newSimNetwork(t *testing.T, validators int, period, epoch uint64) *simNetwork {
+	keys := make([]*ecdsa.PrivateKey, validators)
+	addresses := make([]common.Address, validators)
+	for i := range keys {
+		key, err := crypto.ToECDSA(crypto.Keccak256([]byte{byte(i + 1)}))
+		if err != nil {
+			t.Fatalf("failed to create key: %v", err)
+		}
+		keys[i], addresses[i] = key, crypto.PubkeyToAddress(key.PublicKey)
+	}
+	faucet, _ := crypto.ToECDSA(crypto.Keccak256([]byte("faucet")))
+	genesis := core.DeveloperParliaGenesisBlock(period, epoch, addresses, crypto.PubkeyToAddress(faucet.PublicKey))
+	genesis.Timestamp = simGenesisTime
+
+	net := &simNetwork{
+		t:       t,
+		clock:   newSimClock(time.Unix(simGenesisTime, 0)),
+		genesis: genesis,
+		faucet:  faucet,
+		results: make(chan *types.Block, 1024),
+		sealed:  make(map[common.Address]map[uint64][]*types.Block),
+	}
+	for i, key := range keys {
+		db := rawdb.NewMemoryDatabase()
+		block := genesis.MustCommit(db)
+
+		backend := new(simBackend)
+		engine := New(genesis.Config, db, ethapi.NewPublicBlockChainAPI(backend), block.Hash())
+		engine.clock = net.clock
+		engine.Authorize(addresses[i], simSignFn(key), simSignTxFn(key))
+
+		chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create chain: %v", err)
+		}
+		t.Cleanup(chain.Stop)
+		backend.chain = chain
+
+		engine.WatchChain(chain)
+		t.Cleanup(func() { engine.Close() })
+
+		net.nodes = append(net.nodes, &simNode{
+			index:   i,
+			address: addresses[i],
+			db:      db,
+			engine:  engine,
+			chain:   chain,
+			online:  true,
+			pending: make(map[common.Hash]bool),
+		})
+	}
+	return net
+}
+
+func simSignFn(key *ecdsa.PrivateKey) SignerFn {
+	return func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), key)
+	}
+}
+
+func simSignTxFn(key *ecdsa.PrivateKey) SignerTxFn {
+	return func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+	}
+}
+
+// run advances the simulation by d, letting every online validator propose
+// on its head whenever it changes.
+func (net *simNetwork) run(d time.Duration) {
+	for _, n := range net.nodes {
+		if len(n.pending) == 0 {
+			net.propose(n)
+		}
+	}
+	end := net.clock.Now().Add(d)
+	for {
+		net.settle()
+		timer := net.clock.next(end)
+		if timer == nil {
+			return
+		}
+		if timer.fn != nil {
+			timer.fn()
+			continue
+		}
+		timer.ch <- timer.deadline
+		net.waiting++
+	}
+}
+
+// settle waits until every engine goroutine woken up is idle again, either
+// waiting on the clock or having delivered its sealed block.
+func (net *simNetwork) settle() {
+	for net.waiting > 0 {
+		select {
+		case <-net.clock.registered:
+			net.waiting--
+		case block := <-net.results:
+			net.waiting--
+			net.deliverSealed(block)
+		case <-time.After(10 * time.Second):
+			net.t.Fatalf("simulation stalled with %d pending events", net.waiting)
+		}
+	}
+}
+
+// propose starts sealing a block on top of the head of the node.
+func (net *simNetwork) propose(n *simNode) {
+	if !n.online {
+		return
+	}
+	parent := n.chain.CurrentBlock()
+	if recent, err := n.engine.SignRecently(n.chain, parent.Header()); err != nil || recent {
+		return
+	}
+	block := net.assemble(n, parent)
+	blocks := []*types.Block{block}
+	if n.doubleSign {
+		// Change the vanity only, the conflicting block is equally valid
+		twin := block.Header()
+		twin.Extra[0] ^= 0xff
+		blocks = append(blocks, block.WithSeal(twin))
+	}
+	for _, block := range blocks {
+		n.pending[SealHash(block.Header(), net.genesis.Config.ChainID)] = true
+		if err := n.engine.Seal(n.chain, block, net.results, nil); err != nil {
+			net.t.Fatalf("node %d: failed to seal block %d: %v", n.index, block.Number(), err)
+		}
+		net.waiting++
+	}
+}
+
+// assemble creates an unsealed block of the node on top of parent.
+func (net *simNetwork) assemble(n *simNode, parent *types.Block) *types.Block {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+	}
+	if err := n.engine.Prepare(n.chain, header); err != nil {
+		net.t.Fatalf("node %d: failed to prepare block %d: %v", n.index, header.Number, err)
+	}
+	statedb, err := n.chain.StateAt(parent.Root())
+	if err != nil {
+		net.t.Fatalf("node %d: failed to open state: %v", n.index, err)
+	}
+	var (
+		txs      []*types.Transaction
+		receipts []*types.Receipt
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		signer   = types.NewEIP155Signer(net.genesis.Config.ChainID)
+	)
+	for _, tx := range net.txs {
+		if sender, _ := types.Sender(signer, tx); statedb.GetNonce(sender) != tx.Nonce() {
+			continue
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, len(txs))
+		receipt, err := core.ApplyTransaction(net.genesis.Config, n.chain, &header.Coinbase, gp, statedb, header, tx, &header.GasUsed, vm.Config{}, core.NewReceiptBloomGenerator())
+		if err != nil {
+			net.t.Fatalf("node %d: failed to apply transaction %x: %v", n.index, tx.Hash(), err)
+		}
+		txs, receipts = append(txs, tx), append(receipts, receipt)
+	}
+	block, _, err := n.engine.FinalizeAndAssemble(n.chain, header, statedb, txs, nil, receipts)
+	if err != nil {
+		net.t.Fatalf("node %d: failed to assemble block %d: %v", n.index, header.Number, err)
+	}
+	return block
+}
+
+// submit signs a call from the faucet account, to be included by the next
+// proposers.
+func (net *simNetwork) submit(to common.Address, data []byte) *types.Transaction {
+	nonce := uint64(len(net.txs))
+	tx := types.NewTransaction(nonce, to, new(big.Int), 1000000, big.NewInt(params.GWei), data)
+	tx, err := types.SignTx(tx, types.NewEIP155Signer(net.genesis.Config.ChainID), net.faucet)
+	if err != nil {
+		net.t.Fatalf("failed to sign transaction: %v", err)
+	}
+	net.txs = append(net.txs, tx)
+	return tx
+}
+
+// seal seals a block outside of a run, advancing the clock as far as needed.
+// It must not be used while engines are waiting for the clock.
+func (net *simNetwork) seal(n *simNode, block *types.Block) *types.Block {
+	results := make(chan *types.Block, 1)
+	if err := n.engine.Seal(n.chain, block, results, nil); err != nil {
+		net.t.Fatalf("node %d: failed to seal block %d: %v", n.index, block.NumberU64(), err)
+	}
+	for {
+		select {
+		case <-net.clock.registered:
+			timer := net.clock.next(time.Unix(1<<62, 0))
+			timer.ch <- timer.deadline
+		case sealed := <-results:
+			return sealed
+		case <-time.After(10 * time.Second):
+			net.t.Fatalf("node %d: sealing block %d stalled", n.index, block.NumberU64())
+		}
+	}
+}
+
+// deliverSealed imports a block sealed by an engine into the chain of its
+// validator and sends it to the peers, unless sealing was since abandoned.
+func (net *simNetwork) deliverSealed(block *types.Block) {
+	n := net.node(block.Coinbase())
+	hash := SealHash(block.Header(), net.genesis.Config.ChainID)
+	if !n.pending[hash] {
+		return
+	}
+	delete(n.pending, hash)
+
+	number := block.NumberU64()
+	if net.sealed[n.address] == nil {
+		net.sealed[n.address] = make(map[uint64][]*types.Block)
+	}
+	net.sealed[n.address][number] = append(net.sealed[n.address][number], block)
+	sibling := len(net.sealed[n.address][number]) - 1
+
+	if _, err := n.chain.InsertChain(types.Blocks{block}); err != nil {
+		net.t.Fatalf("node %d: failed to import own block %d: %v", n.index, number, err)
+	}
+	for _, peer := range net.nodes {
+		// Conflicting blocks of a double signer each reach half of the network
+		if peer == n || (n.doubleSign && half(n, peer) != sibling%2) {
+			continue
+		}
+		from, to := n, peer
+		net.clock.schedule(n.latency, func() { net.deliver(from, to, block) })
+	}
+	if len(n.pending) == 0 {
+		net.propose(n)
+	}
+}
+
+// half splits the peers of a node in two, each receiving one of the conflicting
+// blocks of a double signer.
+func half(n, peer *simNode) int {
+	if peer.index > n.index {
+		return (peer.index - 1) % 2
+	}
+	return peer.index % 2
+}
+
+// deliver imports a block received from a peer, fetching the missing ancestors
+// from it first.
+func (net *simNetwork) deliver(from, to *simNode, block *types.Block) {
+	if !to.online || to.chain.HasBlock(block.Hash(), block.NumberU64()) {
+		return
+	}
+	blocks := types.Blocks{block}
+	for parent := block; !to.chain.HasBlock(parent.ParentHash(), parent.NumberU64()-1); {
+		parent = from.chain.GetBlock(parent.ParentHash(), parent.NumberU64()-1)
+		blocks = append(types.Blocks{parent}, blocks...)
+	}
+	net.importBlocks(to, blocks)
+}
+
+// importBlocks inserts blocks into the chain of a node, restarting sealing if
+// the head changed.
+func (net *simNetwork) importBlocks(n *simNode, blocks types.Blocks) {
+	head := n.chain.CurrentBlock()
+	if _, err := n.chain.InsertChain(blocks); err != nil {
+		net.t.Fatalf("node %d: failed to import block %d: %v", n.index, blocks[len(blocks)-1].NumberU64(), err)
+	}
+	current := n.chain.CurrentBlock()
+	if current.Hash() == head.Hash() {
+		return
+	}
+	if ancestor := n.chain.GetBlockByNumber(head.NumberU64()); ancestor == nil || ancestor.Hash() != head.Hash() {
+		n.reorgs++
+	}
+	n.pending = make(map[common.Hash]bool)
+	net.propose(n)
+}
+
+// setOnline connects or disconnects a validator. A validator coming back online
+// first syncs with the best of its peers.
+func (net *simNetwork) setOnline(index int, online bool) {
+	n := net.nodes[index]
+	if n.online == online {
+		return
+	}
+	n.online = online
+	if !online {
+		n.pending = make(map[common.Hash]bool)
+		return
+	}
+	var best *simNode
+	for _, peer := range net.nodes {
+		if peer == n || !peer.online {
+			continue
+		}
+		if best == nil || net.td(peer).Cmp(net.td(best)) > 0 {
+			best = peer
+		}
+	}
+	if best != nil && net.td(best).Cmp(net.td(n)) > 0 {
+		net.deliver(best, n, best.chain.CurrentBlock())
+	}
+	if len(n.pending) == 0 {
+		net.propose(n)
+	}
+}
+
+func (net *simNetwork) node(address common.Address) *simNode {
+	for _, n := range net.nodes {
+		if n.address == address {
+			return n
+		}
+	}
+	net.t.Fatalf("unknown validator %x", address)
+	return nil
+}
+
+func (net *simNetwork) td(n *simNode) *big.Int {
+	head := n.chain.CurrentBlock()
+	return n.chain.GetTd(head.Hash(), head.NumberU64())
+}
+
+// slashes returns the number of times the validator was slashed on the chain
+// of the node.
+func (net *simNetwork) slashes(n *simNode, validator common.Address) uint64 {
+	statedb, err := n.chain.State()
+	if err != nil {
+		net.t.Fatalf("failed to open state: %v", err)
+	}
+	return statedb.GetState(common.HexToAddress(systemcontracts.SlashContract), systemcontracts.DevnetSlashKey(validator)).Big().Uint64()
+}
+
+// finality returns, for every canonical block of the node confirmed by more
+// than two thirds of the validators, the time until the block sealed by the
+// last of them.
+func (net *simNetwork) finality(n *simNode) []time.Duration {
+	head := n.chain.CurrentBlock().NumberU64()
+	quorum := 2*len(net.nodes)/3 + 1
+
+	var latencies []time.Duration
+	for number := uint64(1); number <= head; number++ {
+		block := n.chain.GetHeaderByNumber(number)
+		signers := make(map[common.Address]bool)
+
+		confirmed := false
+		for k := number; k <= head && !confirmed; k++ {
+			header := n.chain.GetHeaderByNumber(k)
+			if signers[header.Coinbase] = true; len(signers) >= quorum {
+				latencies = append(latencies, time.Duration(header.Time-block.Time)*time.Second)
+				confirmed = true
+			}
+		}
+		if !confirmed {
+			break
+		}
+	}
+	return latencies
+}
+
+// outOfTurn returns the number of canonical out-of-turn blocks of the node in
+// the given range.
+func outOfTurn(n *simNode, from, to uint64) int {
+	var count int
+	for number := from; number <= to; number++ {
+		if n.chain.GetHeaderByNumber(number).Difficulty.Cmp(diffInTurn) != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// checkConverged checks that all online nodes share the same head.
+func (net *simNetwork) checkConverged() *types.Block {
+	var head *types.Block
+	for _, n := range net.nodes {
+		if !n.online {
+			continue
+		}
+		if current := n.chain.CurrentBlock(); head == nil {
+			head = current
+		} else if current.Hash() != head.Hash() {
+			net.t.Fatalf("node %d: head mismatch: have %d (%x), want %d (%x)", n.index, current.NumberU64(), current.Hash(), head.NumberU64(), head.Hash())
+		}
+	}
+	return head
+}
+
+func TestSimulationHealthy(t *testing.T) {
+	const (
+		validators = 5
+		period     = 3
+	)
+	net := newSimNetwork(t, validators, period, 200)
+	net.run(120 * time.Second)
+
+	head := net.checkConverged()
+	if want := uint64(120 / period); head.NumberU64() != want {
+		t.Fatalf("head mismatch: have %d, want %d", head.NumberU64(), want)
+	}
+	n := net.nodes[0]
+	if count := outOfTurn(n, 1, head.NumberU64()); count != 0 {
+		t.Errorf("out-of-turn blocks: have %d, want 0", count)
+	}
+	for number := uint64(1); number <= head.NumberU64(); number++ {
+		if interval := n.chain.GetHeaderByNumber(number).Time - n.chain.GetHeaderByNumber(number-1).Time; interval != period {
+			t.Fatalf("block %d: interval mismatch: have %d, want %d", number, interval, period)
+		}
+	}
+	// Every block is confirmed once a quorum of validators built on it in turn
+	want := time.Duration((2*validators/3)*period) * time.Second
+	latencies := net.finality(n)
+	if len(latencies) == 0 {
+		t.Fatalf("no finalized blocks")
+	}
+	for i, latency := range latencies {
+		if latency != want {
+			t.Fatalf("block %d: finality latency mismatch: have %v, want %v", i+1, latency, want)
+		}
+	}
+}
+
+// Tests that the recent signers are checked against the snapshot of the parent
+// itself, so the signer of the parent waits while the signer of the block
+// before is allowed to propose again.
+func TestSignRecently(t *testing.T) {
+	net := newSimNetwork(t, 3, 3, 200)
+	net.run(30 * time.Second)
+
+	head := net.checkConverged()
+	if head.NumberU64() < 2 {
+		t.Fatalf("head too low: %d", head.NumberU64())
+	}
+	var (
+		parent   = head.Coinbase()
+		previous = net.nodes[0].chain.GetHeaderByNumber(head.NumberU64() - 1).Coinbase
+	)
+	for _, n := range net.nodes {
+		recent, err := n.engine.SignRecently(n.chain, head.Header())
+		if err != nil {
+			t.Fatalf("node %d: failed to check recent signers: %v", n.index, err)
+		}
+		switch n.address {
+		case parent:
+			if !recent {
+				t.Errorf("node %d: signer of the parent allowed to propose", n.index)
+			}
+		case previous:
+			if recent {
+				t.Errorf("node %d: signer of the block before the parent not allowed to propose", n.index)
+			}
+		default:
+			if recent {
+				t.Errorf("node %d: idle validator not allowed to propose", n.index)
+			}
+		}
+	}
+}
+
+func TestSimulationOfflineValidators(t *testing.T) {
+	tests := []struct {
+		validators int
+		offline    int
+	}{
+		{3, 1},
+		{5, 2},
+		{10, 4},
+		{21, 10},
+	}
+	for _, tt := range tests {
+		const period = 3
+		net := newSimNetwork(t, tt.validators, period, 200)
+		for i := 0; i < tt.offline; i++ {
+			net.setOnline(i, false)
+		}
+		down := time.Duration(10*tt.validators*period) * time.Second
+		net.run(down)
+
+		head := net.checkConverged()
+		n := net.nodes[len(net.nodes)-1]
+		if max := uint64(down / time.Second / period); head.NumberU64() == 0 || head.NumberU64() >= max {
+			t.Fatalf("%d/%d offline: head mismatch: have %d, want below %d", tt.offline, tt.validators, head.NumberU64(), max)
+		}
+		for i, node := range net.nodes {
+			slashes := net.slashes(n, node.address)
+			if i < tt.offline && slashes == 0 {
+				t.Errorf("%d/%d offline: offline validator %d not slashed", tt.offline, tt.validators, i)
+			}
+			if i >= tt.offline && slashes != 0 {
+				t.Errorf("%d/%d offline: online validator %d slashed %d times", tt.offline, tt.validators, i, slashes)
+			}
+		}
+		if quorum := 2*tt.validators/3 + 1; tt.validators-tt.offline < quorum {
+			if latencies := net.finality(n); len(latencies) != 0 {
+				t.Errorf("%d/%d offline: finalized %d blocks without quorum", tt.offline, tt.validators, len(latencies))
+			}
+		}
+		t.Logf("%d/%d offline: %d blocks in %v, %d out of turn", tt.offline, tt.validators, head.NumberU64(), down, outOfTurn(n, 1, head.NumberU64()))
+
+		// Bring the validators back, the network should return to in-turn blocks
+		for i := 0; i < tt.offline; i++ {
+			net.setOnline(i, true)
+		}
+		recovery := time.Duration(4*tt.validators*period) * time.Second
+		net.run(recovery)
+
+		recovered := net.checkConverged()
+		from := recovered.NumberU64() - uint64(tt.validators) + 1
+		if count := outOfTurn(n, from, recovered.NumberU64()); count != 0 {
+			t.Errorf("%d/%d offline: %d out-of-turn blocks after recovery", tt.offline, tt.validators, count)
+		}
+	}
+}
+
+func TestSimulationDelayedBlocks(t *testing.T) {
+	const period = 3
+
+	net := newSimNetwork(t, 3, period, 200)
+	slow := net.nodes[0]
+	slow.latency = 10 * time.Second
+	net.run(90 * time.Second)
+
+	// The delayed blocks lose against the out-of-turn ones built upon
+	if slow.reorgs == 0 {
+		t.Errorf("delayed validator never reorged")
+	}
+	n := net.nodes[1]
+	head := n.chain.CurrentBlock().NumberU64()
+	if count := outOfTurn(n, 1, head); count == 0 {
+		t.Errorf("no out-of-turn blocks despite the delayed validator")
+	}
+	// Once delivered in time again, everyone converges back to in-turn blocks
+	slow.latency = 0
+	net.run(60 * time.Second)
+
+	recovered := net.checkConverged()
+	if count := outOfTurn(n, recovered.NumberU64()-2, recovered.NumberU64()); count != 0 {
+		t.Errorf("%d out-of-turn blocks after recovery", count)
+	}
+}
+
+func TestSimulationDoubleSign(t *testing.T) {
+	run := func() (*simNetwork, *types.Block) {
+		net := newSimNetwork(t, 3, 3, 200)
+		net.nodes[1].doubleSign = true
+		net.run(60 * time.Second)
+		return net, net.checkConverged()
+	}
+	net, head := run()
+
+	// Both conflicting blocks get sealed and accepted by the peers they reach
+	signer := net.nodes[1]
+	var conflicts int
+	for _, blocks := range net.sealed[signer.address] {
+		if len(blocks) < 2 {
+			continue
+		}
+		conflicts++
+		for i, block := range blocks {
+			for _, peer := range net.nodes {
+				if peer != signer && half(signer, peer) == i%2 && !peer.chain.HasBlock(block.Hash(), block.NumberU64()) {
+					t.Errorf("node %d: conflicting block %d (%x) rejected", peer.index, block.NumberU64(), block.Hash())
+				}
+			}
+		}
+	}
+	if conflicts == 0 {
+		t.Fatalf("no conflicting blocks sealed")
+	}
+	// Validators seeing both branches record the evidence
+	var detected int
+	for _, n := range net.nodes {
+		if n == signer {
+			continue
+		}
+		evidences, err := n.engine.doubleSigns(0, head.NumberU64())
+		if err != nil {
+			t.Fatalf("node %d: failed to retrieve evidence: %v", n.index, err)
+		}
+		for _, evidence := range evidences {
+			if err := checkEvidence(n.engine, evidence); err != nil {
+				t.Errorf("node %d: invalid evidence: %v", n.index, err)
+			}
+			if evidence.Validator != signer.address {
+				t.Errorf("node %d: evidence validator mismatch: have %x, want %x", n.index, evidence.Validator, signer.address)
+			}
+		}
+		detected += len(evidences)
+	}
+	if detected == 0 {
+		t.Errorf("no double sign detected")
+	}
+	// The simulation is deterministic, a rerun ends up on the very same head
+	if _, rerun := run(); rerun.Hash() != head.Hash() {
+		t.Errorf("head mismatch on rerun: have %x, want %x", rerun.Hash(), head.Hash())
+	}
+}
+
+func TestSimulationForkChoice(t *testing.T) {
+	net := newSimNetwork(t, 3, 3, 200)
+
+	// Seal an in-turn and an out-of-turn sibling, the latter arriving first
+	genesis := net.nodes[0].chain.Genesis()
+	var inturn, outturn *types.Block
+	for _, n := range net.nodes {
+		block := net.seal(n, net.assemble(n, genesis))
+		if block.Difficulty().Cmp(diffInTurn) == 0 {
+			inturn = block
+		} else if outturn == nil {
+			outturn = block
+		}
+	}
+	if inturn == nil || outturn == nil {
+		t.Fatalf("missing siblings: in-turn %v, out-of-turn %v", inturn != nil, outturn != nil)
+	}
+	for _, n := range net.nodes {
+		net.importBlocks(n, types.Blocks{outturn})
+		net.importBlocks(n, types.Blocks{inturn})
+		if head := n.chain.CurrentBlock(); head.Hash() != inturn.Hash() {
+			t.Errorf("node %d: head mismatch: have %x, want in-turn %x", n.index, head.Hash(), inturn.Hash())
+		}
+	}
+}
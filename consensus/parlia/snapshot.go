@@ -21,6 +21,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"sort"
 
@@ -82,7 +83,7 @@ func (s validatorsAscending) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 // loadSnapshot loads an existing snapshot from the database.
 func loadSnapshot(config *params.ParliaConfig, sigCache *lru.ARCCache, db ethdb.Database, hash common.Hash, ethAPI *ethapi.PublicBlockChainAPI) (*Snapshot, error) {
-	blob, err := db.Get(append([]byte("parlia-"), hash[:]...))
+	blob, err := db.Get(snapshotKey(hash))
 	if err != nil {
 		return nil, err
 	}
@@ -90,6 +91,9 @@ func loadSnapshot(config *params.ParliaConfig, sigCache *lru.ARCCache, db ethdb.
 	if err := json.Unmarshal(blob, snap); err != nil {
 		return nil, err
 	}
+	if snap.Hash != hash {
+		return nil, fmt.Errorf("corrupt snapshot %x: stored under %x", snap.Hash, hash)
+	}
 	snap.config = config
 	snap.sigCache = sigCache
 	snap.ethAPI = ethAPI
@@ -103,7 +107,7 @@ func (s *Snapshot) store(db ethdb.Database) error {
 	if err != nil {
 		return err
 	}
-	return db.Put(append([]byte("parlia-"), s.Hash[:]...), blob)
+	return db.Put(snapshotKey(s.Hash), blob)
 }
 
 // copy creates a deep copy of the snapshot
@@ -0,0 +1,282 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// snapshotPrefix + hash -> Snapshot (json encoded)
+var snapshotPrefix = []byte("parlia-")
+
+func snapshotKey(hash common.Hash) []byte {
+	return append(append([]byte{}, snapshotPrefix...), hash[:]...)
+}
+
+// SnapshotRecord describes a snapshot stored in the database.
+type SnapshotRecord struct {
+	Number    uint64
+	Hash      common.Hash
+	Size      int
+	Canonical bool // Whether the snapshot belongs to the canonical chain
+}
+
+// ListSnapshots retrieves the snapshots stored in the database, ordered by
+// block number.
+func ListSnapshots(chain consensus.ChainHeaderReader, db ethdb.Iteratee) ([]*SnapshotRecord, error) {
+	it := db.NewIterator(snapshotPrefix, nil)
+	defer it.Release()
+
+	var records []*SnapshotRecord
+	for it.Next() {
+		// Other parlia records share the prefix, only snapshots are keyed by hash
+		if len(it.Key()) != len(snapshotPrefix)+common.HashLength {
+			continue
+		}
+		snap := new(Snapshot)
+		if err := json.Unmarshal(it.Value(), snap); err != nil {
+			return nil, fmt.Errorf("corrupt snapshot %x: %v", it.Key()[len(snapshotPrefix):], err)
+		}
+		hash := common.BytesToHash(it.Key()[len(snapshotPrefix):])
+		if snap.Hash != hash {
+			return nil, fmt.Errorf("corrupt snapshot %x: stored under %x", snap.Hash, hash)
+		}
+		header := chain.GetHeaderByNumber(snap.Number)
+		records = append(records, &SnapshotRecord{
+			Number:    snap.Number,
+			Hash:      hash,
+			Size:      len(it.Key()) + len(it.Value()),
+			Canonical: header != nil && header.Hash() == hash,
+		})
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Number < records[j].Number })
+	return records, nil
+}
+
+// PruneSnapshots deletes the stored snapshots which are not on the canonical
+// chain or more than retention blocks behind its head. The most recent
+// canonical checkpoint is always kept so the engine never has to recompute
+// snapshots from the genesis.
+func PruneSnapshots(chain consensus.ChainHeaderReader, db ethdb.Database, retention uint64) (int, error) {
+	records, err := ListSnapshots(chain, db)
+	if err != nil {
+		return 0, err
+	}
+	var latest *SnapshotRecord
+	for _, record := range records {
+		if record.Canonical && record.Number%checkpointInterval == 0 {
+			latest = record
+		}
+	}
+	head := chain.CurrentHeader().Number.Uint64()
+
+	batch := db.NewBatch()
+	var pruned int
+	for _, record := range records {
+		if record == latest || (record.Canonical && record.Number+retention >= head) {
+			continue
+		}
+		if err := batch.Delete(snapshotKey(record.Hash)); err != nil {
+			return 0, err
+		}
+		pruned++
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return 0, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	log.Info("Pruned parlia snapshots", "pruned", pruned, "kept", len(records)-pruned)
+	return pruned, nil
+}
+
+// RebuildSnapshots replaces the stored snapshots with ones recomputed from the
+// canonical headers, stored at every checkpoint as the engine would. The stale
+// snapshots are only deleted once the replay succeeded.
+func RebuildSnapshots(chain consensus.ChainHeaderReader, db ethdb.Database) (int, error) {
+	if err := checkReplayable(chain); err != nil {
+		return 0, err
+	}
+	records, err := ListSnapshots(chain, db)
+	if err != nil {
+		return 0, err
+	}
+	stored := make(map[common.Hash]bool)
+	err = replaySnapshots(chain, nil, func(snap *Snapshot) error {
+		stored[snap.Hash] = true
+		return snap.store(db)
+	})
+	if err != nil {
+		return 0, err
+	}
+	batch := db.NewBatch()
+	var deleted int
+	for _, record := range records {
+		if stored[record.Hash] {
+			continue
+		}
+		if err := batch.Delete(snapshotKey(record.Hash)); err != nil {
+			return 0, err
+		}
+		deleted++
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	log.Info("Rebuilt parlia snapshots", "stored", len(stored), "deleted", deleted)
+	return len(stored), nil
+}
+
+// checkReplayable returns an error if the headers the replay starts from are
+// missing, like in databases with pruned ancient blocks.
+func checkReplayable(chain consensus.ChainHeaderReader) error {
+	head := chain.CurrentHeader().Number.Uint64()
+	for number := uint64(0); number <= 1 && number <= head; number++ {
+		if chain.GetHeaderByNumber(number) == nil {
+			return fmt.Errorf("missing header #%d, snapshots are replayed from the genesis", number)
+		}
+	}
+	return nil
+}
+
+// SnapshotMismatch is a stored snapshot differing from the one recomputed from
+// the canonical headers.
+type SnapshotMismatch struct {
+	Number uint64
+	Hash   common.Hash
+	Stored []byte // JSON encoding of the stored snapshot
+	Want   []byte // JSON encoding of the recomputed snapshot
+}
+
+// VerifySnapshots compares every stored snapshot of the canonical chain with
+// the one recomputed from the headers, returning the number of snapshots
+// checked and the mismatching ones.
+func VerifySnapshots(chain consensus.ChainHeaderReader, db ethdb.Database) (int, []*SnapshotMismatch, error) {
+	records, err := ListSnapshots(chain, db)
+	if err != nil {
+		return 0, nil, err
+	}
+	stops := make(map[uint64]bool)
+	for _, record := range records {
+		if record.Canonical {
+			stops[record.Number] = true
+		}
+	}
+	var (
+		checked    int
+		mismatches []*SnapshotMismatch
+	)
+	err = replaySnapshots(chain, stops, func(snap *Snapshot) error {
+		if !stops[snap.Number] {
+			return nil
+		}
+		stored, err := db.Get(snapshotKey(snap.Hash))
+		if err != nil {
+			return err
+		}
+		want, err := json.Marshal(snap)
+		if err != nil {
+			return err
+		}
+		// Normalize the stored encoding, maps are marshalled in key order
+		have := new(Snapshot)
+		if err := json.Unmarshal(stored, have); err != nil {
+			return err
+		}
+		if normalized, err := json.Marshal(have); err != nil || !bytes.Equal(normalized, want) {
+			mismatches = append(mismatches, &SnapshotMismatch{Number: snap.Number, Hash: snap.Hash, Stored: stored, Want: want})
+		}
+		checked++
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return checked, mismatches, nil
+}
+
+// replaySnapshots recomputes the snapshots of the canonical chain from the
+// genesis header, calling fn with the snapshot of every checkpoint and every
+// requested block. Only headers are needed, no state is accessed.
+func replaySnapshots(chain consensus.ChainHeaderReader, stops map[uint64]bool, fn func(snap *Snapshot) error) error {
+	config := *chain.Config().Parlia
+	if config.Epoch == 0 {
+		config.Epoch = defaultEpochLength
+	}
+	sigCache, err := lru.NewARC(inMemorySignatures)
+	if err != nil {
+		return err
+	}
+	genesis := chain.GetHeaderByNumber(0)
+	if genesis == nil {
+		return errUnknownBlock
+	}
+	validators, err := ParseValidators(genesis.Extra[extraVanity : len(genesis.Extra)-extraSeal])
+	if err != nil {
+		return err
+	}
+	snap := newSnapshot(&config, sigCache, 0, genesis.Hash(), validators, nil)
+	if err := fn(snap); err != nil {
+		return err
+	}
+	var (
+		head    = chain.CurrentHeader().Number.Uint64()
+		headers []*types.Header
+		start   = time.Now()
+		logged  = time.Now()
+	)
+	for number := uint64(1); number <= head; number++ {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return fmt.Errorf("missing header #%d", number)
+		}
+		headers = append(headers, header)
+		if number%checkpointInterval != 0 && !stops[number] {
+			continue
+		}
+		if snap, err = snap.apply(headers, chain, nil, chain.Config().ChainID); err != nil {
+			return fmt.Errorf("failed to apply header #%d: %v", number, err)
+		}
+		headers = headers[:0]
+		if err := fn(snap); err != nil {
+			return err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Replaying parlia snapshots", "number", number, "head", head, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package parlia
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	net := newSimNetwork(t, 1, 1, 10)
+	net.run((checkpointInterval + 100) * time.Second)
+
+	n := net.nodes[0]
+	if head := n.chain.CurrentHeader().Number.Uint64(); head != checkpointInterval+100 {
+		t.Fatalf("head mismatch: have %d, want %d", head, checkpointInterval+100)
+	}
+	// The engine stored the genesis and first checkpoint, add a stale fork
+	stale, err := n.engine.snapshot(n.chain, 10, n.chain.GetHeaderByNumber(10).Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	stale = stale.copy()
+	stale.Hash = common.HexToHash("0xdead")
+	if err := stale.store(n.db); err != nil {
+		t.Fatalf("failed to store snapshot: %v", err)
+	}
+	records, err := ListSnapshots(n.chain, n.db)
+	if err != nil {
+		t.Fatalf("failed to list snapshots: %v", err)
+	}
+	var canonical []uint64
+	for _, record := range records {
+		if record.Canonical {
+			canonical = append(canonical, record.Number)
+		}
+	}
+	if len(records) != 3 || len(canonical) != 2 || canonical[0] != 0 || canonical[1] != checkpointInterval {
+		t.Fatalf("snapshot records mismatch: have %d records, canonical %v", len(records), canonical)
+	}
+	// Intact snapshots verify, a tampered one is reported
+	if checked, mismatches, err := VerifySnapshots(n.chain, n.db); err != nil || checked != 2 || len(mismatches) != 0 {
+		t.Fatalf("verification failed: checked %d, mismatches %d, err %v", checked, len(mismatches), err)
+	}
+	tampered, err := loadSnapshot(n.engine.config, n.engine.signatures, n.db, n.chain.GetHeaderByNumber(checkpointInterval).Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	tampered.Recents[1] = common.HexToAddress("0xdead")
+	if err := tampered.store(n.db); err != nil {
+		t.Fatalf("failed to store snapshot: %v", err)
+	}
+	_, mismatches, err := VerifySnapshots(n.chain, n.db)
+	if err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Number != checkpointInterval {
+		t.Fatalf("tampered snapshot not detected: %d mismatches", len(mismatches))
+	}
+	// Rebuilding without the headers to replay keeps the stored snapshots
+	hash := rawdb.ReadCanonicalHash(n.db, 1)
+	rawdb.DeleteCanonicalHash(n.db, 1)
+	if _, err := RebuildSnapshots(n.chain, n.db); err == nil {
+		t.Fatalf("rebuild succeeded without the replayed headers")
+	}
+	if records, _ := ListSnapshots(n.chain, n.db); len(records) != 3 {
+		t.Fatalf("snapshots deleted by the failed rebuild: %d records left", len(records))
+	}
+	rawdb.WriteCanonicalHash(n.db, hash, 1)
+
+	// Rebuilding replaces every snapshot with the recomputed ones
+	if stored, err := RebuildSnapshots(n.chain, n.db); err != nil || stored != 2 {
+		t.Fatalf("rebuild failed: stored %d, err %v", stored, err)
+	}
+	if checked, mismatches, err := VerifySnapshots(n.chain, n.db); err != nil || checked != 2 || len(mismatches) != 0 {
+		t.Fatalf("verification after rebuild failed: checked %d, mismatches %d, err %v", checked, len(mismatches), err)
+	}
+	if records, _ := ListSnapshots(n.chain, n.db); len(records) != 2 {
+		t.Fatalf("stale snapshot survived the rebuild: %d records", len(records))
+	}
+	// Pruning keeps the latest checkpoint, even beyond the retention
+	if pruned, err := PruneSnapshots(n.chain, n.db, 10); err != nil || pruned != 1 {
+		t.Fatalf("prune failed: pruned %d, err %v", pruned, err)
+	}
+	records, _ = ListSnapshots(n.chain, n.db)
+	if len(records) != 1 || records[0].Number != checkpointInterval {
+		t.Fatalf("pruned snapshots mismatch: %d records left", len(records))
+	}
+	// The engine keeps going on top of the remaining snapshots
+	net.run(10 * time.Second)
+	if head := n.chain.CurrentHeader().Number.Uint64(); head != checkpointInterval+110 {
+		t.Fatalf("head mismatch after pruning: have %d, want %d", head, checkpointInterval+110)
+	}
+}
@@ -77,6 +77,10 @@ var (
 	blockReorgDropMeter     = metrics.NewRegisteredMeter("chain/reorg/drop", nil)
 	blockReorgInvalidatedTx = metrics.NewRegisteredMeter("chain/reorg/invalidTx", nil)
 
+	diffVerifyMeter     = metrics.NewRegisteredMeter("chain/diff/verify", nil)
+	diffVerifySkipMeter = metrics.NewRegisteredMeter("chain/diff/verify/skip", nil)
+	diffMismatchMeter   = metrics.NewRegisteredMeter("chain/diff/mismatch", nil)
+
 	errInsertionInterrupted        = errors.New("insertion is interrupted")
 	errStateRootVerificationFailed = errors.New("state root verification failed")
 )
@@ -202,6 +206,7 @@ type BlockChain struct {
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
 	blockProcFeed event.Feed
+	badDiffFeed   event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -234,6 +239,7 @@ type BlockChain struct {
 	diffHashToPeers       map[common.Hash]map[string]struct{}              // map[diffHash]map[pid]
 	diffNumToBlockHashes  map[uint64]map[common.Hash]struct{}              // map[number]map[blockHash]
 	diffPeersToDiffHashes map[string]map[common.Hash]struct{}              // map[pid]map[diffHash]
+	diffVerifyRatio       float64                                          // Fraction of light processed blocks to re-execute
 
 	quit          chan struct{}  // blockchain quit channel
 	wg            sync.WaitGroup // chain processing wait group for shutting down
@@ -247,6 +253,13 @@ type BlockChain struct {
 	vmConfig   vm.Config
 	pipeCommit bool
 
+	// contractIndex enables indexing the creation of every deployed contract.
+	contractIndex bool
+
+	// parallelWorkers is the number of workers executing the transactions of a
+	// block speculatively in parallel, serial execution if at most 1.
+	parallelWorkers int
+
 	shouldPreserve  func(*types.Block) bool        // Function used to determine whether should preserve the given block.
 	terminateInsert func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
 }
@@ -445,6 +458,17 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	for _, option := range options {
 		bc = option(bc)
 	}
+	// The contract index needs the tracer slot of the EVM, never run without it
+	if bc.contractIndex && vmConfig.Debug {
+		return nil, errors.New("contract index cannot be combined with an EVM tracer")
+	}
+	// Blocks applied from diff layers run no EVM, their creations are unknown
+	if _, ok := bc.processor.(*LightStateProcessor); ok && bc.contractIndex {
+		return nil, errors.New("contract index cannot be combined with diff sync")
+	}
+	if bc.contractIndex && bc.parallelWorkers > 1 {
+		log.Warn("Parallel execution disabled by the contract index")
+	}
 	// Take ownership of this particular state
 	go bc.update()
 	if txLookupLimit != nil {
@@ -852,6 +876,16 @@ func (bc *BlockChain) StateCache() state.Database {
 	return bc.stateCache
 }
 
+// CommitState flushes the state trie with the given root from the trie database
+// to disk. The trie database is not safe for concurrent mutation, so the commit
+// is serialized with the block insertion, which maintains the tries in memory.
+func (bc *BlockChain) CommitState(root common.Hash) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	return bc.stateCache.TrieDB().Commit(root, false, nil)
+}
+
 // Reset purges the entire blockchain, restoring it to its genesis state.
 func (bc *BlockChain) Reset() error {
 	return bc.ResetWithGenesisBlock(bc.genesisBlock)
@@ -933,6 +967,9 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	batch := bc.db.NewBatch()
 	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
 	rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	if bc.contractIndex {
+		rawdb.WriteContractCreationsByBlock(batch, rawdb.ReadBlockContractCreations(bc.db, block.Hash(), block.NumberU64()))
+	}
 	rawdb.WriteHeadBlockHash(batch, block.Hash())
 
 	// If the block is better than our head or is on a different chain, force update heads
@@ -1680,6 +1717,22 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	return bc.writeBlockWithState(block, receipts, logs, state, emitHeadEvent)
 }
 
+// ContractIndexEnabled returns whether the contract creations are indexed.
+func (bc *BlockChain) ContractIndexEnabled() bool {
+	return bc.contractIndex
+}
+
+// WriteContractCreations records the contracts deployed by a block assembled
+// outside of the chain import, such as a mined one, as collected by a
+// CreationTracer while executing it. It has to be called before writing the
+// block for the contract index to pick them up, and is a noop if the index is
+// disabled.
+func (bc *BlockChain) WriteContractCreations(block *types.Block, creations []*rawdb.ContractCreation) {
+	if bc.contractIndex {
+		rawdb.WriteBlockContractCreations(bc.db, block.Hash(), block.NumberU64(), stampCreations(block, creations))
+	}
+}
+
 // writeBlockWithState writes the block and all associated state to the database,
 // but is expects the chain mutex to be held.
 func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, logs []*types.Log, state *state.StateDB, emitHeadEvent bool) (status WriteStatus, err error) {
@@ -2128,7 +2181,13 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 			statedb.EnablePipeCommit()
 		}
 		statedb.SetExpectedStateRoot(block.Root())
-		statedb, receipts, logs, usedGas, err := bc.processor.Process(block, statedb, bc.vmConfig)
+		vmConfig := bc.vmConfig
+		var creations *CreationTracer
+		if bc.contractIndex {
+			creations = NewCreationTracer()
+			vmConfig.Debug, vmConfig.Tracer = true, creations
+		}
+		statedb, receipts, logs, usedGas, err := bc.processor.Process(block, statedb, vmConfig)
 		atomic.StoreUint32(&followupInterrupt, 1)
 		activeState = statedb
 		if err != nil {
@@ -2156,6 +2215,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		}
 		bc.cacheReceipts(block.Hash(), receipts)
 		bc.cacheBlock(block.Hash(), block)
+		if creations != nil {
+			rawdb.WriteBlockContractCreations(bc.db, block.Hash(), block.NumberU64(), stampCreations(block, creations.creations))
+		}
 		proctime := time.Since(start)
 
 		// Update the metrics touched during block validation
@@ -2520,6 +2582,16 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	for _, tx := range types.TxDifference(deletedTxs, addedTxs) {
 		rawdb.DeleteTxLookupEntry(indexesBatch, tx.Hash())
 	}
+	// Delete the contract creations of the old chain not redone by the new one
+	if bc.contractIndex {
+		for _, block := range oldChain {
+			for _, creation := range rawdb.ReadBlockContractCreations(bc.db, block.Hash(), block.NumberU64()) {
+				if entry := rawdb.ReadContractCreation(bc.db, creation.Address); entry != nil && entry.BlockHash == block.Hash() {
+					rawdb.DeleteContractCreation(indexesBatch, creation.Address)
+				}
+			}
+		}
+	}
 	// Delete any canonical number assignments above the new head
 	number := bc.CurrentBlock().NumberU64()
 	for i := number + 1; ; i++ {
@@ -2682,6 +2754,19 @@ func (bc *BlockChain) GetUnTrustedDiffLayer(blockHash common.Hash, pid string) *
 	return nil
 }
 
+// diffPeers returns the peers which served the diff layer.
+func (bc *BlockChain) diffPeers(diffHash common.Hash) []string {
+	bc.diffMux.RLock()
+	defer bc.diffMux.RUnlock()
+
+	peers := make([]string, 0, len(bc.diffHashToPeers[diffHash]))
+	for pid := range bc.diffHashToPeers[diffHash] {
+		peers = append(peers, pid)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
 func (bc *BlockChain) removeDiffLayers(diffHash common.Hash) {
 	bc.diffMux.Lock()
 	defer bc.diffMux.Unlock()
@@ -3088,6 +3173,11 @@ func (bc *BlockChain) SubscribeBlockProcessingEvent(ch chan<- bool) event.Subscr
 	return bc.scope.Track(bc.blockProcFeed.Subscribe(ch))
 }
 
+// SubscribeBadDiffEvent registers a subscription of BadDiffEvent.
+func (bc *BlockChain) SubscribeBadDiffEvent(ch chan<- BadDiffEvent) event.Subscription {
+	return bc.scope.Track(bc.badDiffFeed.Subscribe(ch))
+}
+
 // Options
 func EnableLightProcessor(bc *BlockChain) *BlockChain {
 	bc.processor = NewLightStateProcessor(bc.Config(), bc, bc.engine)
@@ -3099,6 +3189,37 @@ func EnablePipelineCommit(bc *BlockChain) *BlockChain {
 	return bc
 }
 
+// EnableContractIndex indexes the transactions creating contracts, including
+// internal creations, for every canonical block executed or mined, following
+// reorgs. Mined blocks are indexed from the creations collected by the miner.
+// It cannot be combined with an EVM tracer or the light processor of diff sync,
+// and disables parallel execution since it takes the tracer slot of the EVM.
+func EnableContractIndex(bc *BlockChain) *BlockChain {
+	bc.contractIndex = true
+	return bc
+}
+
+// EnableDiffVerification re-executes the given fraction of the blocks imported
+// through diff layers in the background, reporting the peers which served diff
+// layers contradicted by the execution. It has no effect without the light
+// processor.
+func EnableDiffVerification(ratio float64) BlockChainOption {
+	return func(chain *BlockChain) *BlockChain {
+		chain.diffVerifyRatio = ratio
+		return chain
+	}
+}
+
+// EnableParallelExecution executes the transactions of the processed blocks
+// speculatively in parallel on the given number of workers, re-executing the
+// ones conflicting with the transactions before them.
+func EnableParallelExecution(workers int) BlockChainOption {
+	return func(chain *BlockChain) *BlockChain {
+		chain.parallelWorkers = workers
+		return chain
+	}
+}
+
 func EnablePersistDiff(limit uint64) BlockChainOption {
 	return func(chain *BlockChain) *BlockChain {
 		chain.diffLayerFreezerBlockLimit = limit
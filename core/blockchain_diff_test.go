@@ -360,6 +360,80 @@ func TestProcessDiffLayer(t *testing.T) {
 	}
 }
 
+func TestVerifyDiffLayer(t *testing.T) {
+	blockNum := 32
+	fullBackend := newTestBackend(blockNum, false)
+	defer fullBackend.close()
+
+	lightBackend := newTestBackend(0, true)
+	defer lightBackend.close()
+	EnableDiffVerification(1)(lightBackend.chain)
+	processor := lightBackend.chain.processor.(*LightStateProcessor)
+
+	badDiffs := make(chan BadDiffEvent, 1)
+	sub := lightBackend.chain.SubscribeBadDiffEvent(badDiffs)
+	defer sub.Unsubscribe()
+
+	// Wait for the background verifications by taking all their slots
+	waitVerifications := func() {
+		for i := 0; i < cap(processor.verifySlots); i++ {
+			processor.verifySlots <- struct{}{}
+		}
+		for i := 0; i < cap(processor.verifySlots); i++ {
+			<-processor.verifySlots
+		}
+	}
+	// Honest diff layers pass the verification
+	for i := 1; i <= blockNum; i++ {
+		block := fullBackend.chain.GetBlockByNumber(uint64(i))
+		if rawDiff := fullBackend.chain.GetDiffLayerRLP(block.Hash()); len(rawDiff) != 0 {
+			diff, err := rawDataToDiffLayer(rawDiff)
+			if err != nil {
+				t.Fatalf("failed to decode rawdata %v", err)
+			}
+			lightBackend.Chain().HandleDiffLayer(diff, "testpid", true)
+		}
+		if _, err := lightBackend.chain.insertChain([]*types.Block{block}, true); err != nil {
+			t.Fatalf("failed to insert block %v", err)
+		}
+		waitVerifications()
+	}
+	select {
+	case event := <-badDiffs:
+		t.Fatalf("honest diff layer of block %d reported", event.Block.NumberU64())
+	default:
+	}
+	// A diff layer contradicting the execution gets its peer reported
+	block := lightBackend.chain.CurrentBlock()
+	diff, _ := rawDataToDiffLayer(fullBackend.chain.GetDiffLayerRLP(block.Hash()))
+	account, _ := snapshot.FullAccount(diff.Accounts[0].Blob)
+	account.Balance = big.NewInt(0)
+	diff.Accounts[0].Blob, _ = rlp.EncodeToBytes(&account)
+
+	rawDiff, _ := rlp.EncodeToBytes(diff)
+	diff, _ = rawDataToDiffLayer(rawDiff)
+	lightBackend.Chain().HandleDiffLayer(diff, "badpid", true)
+
+	processor.sampleVerification(block, diff)
+	select {
+	case event := <-badDiffs:
+		if event.Block.Hash() != block.Hash() || event.DiffHash != diff.DiffHash {
+			t.Errorf("bad diff mismatch: have block %x diff %x, want block %x diff %x", event.Block.Hash(), event.DiffHash, block.Hash(), diff.DiffHash)
+		}
+		if len(event.Peers) != 1 || event.Peers[0] != "badpid" {
+			t.Errorf("reported peers mismatch: have %v, want [badpid]", event.Peers)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("bad diff layer not reported")
+	}
+	if _, exist := lightBackend.chain.diffPeersToDiffHashes["badpid"]; exist {
+		t.Error("diff layers of the reported peer not removed")
+	}
+	if _, exist := lightBackend.chain.diffPeersToDiffHashes["testpid"]; !exist {
+		t.Error("diff layers of the honest peer removed")
+	}
+}
+
 func TestFreezeDiffLayer(t *testing.T) {
 	blockNum := 1024
 	fullBackend := newTestBackend(blockNum, true)
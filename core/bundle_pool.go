@@ -0,0 +1,318 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// errBundleEmpty is returned if a bundle without transactions is submitted.
+	errBundleEmpty = errors.New("bundle has no transactions")
+
+	// errBundleTooLarge is returned if a bundle exceeds the per bundle
+	// transaction limit.
+	errBundleTooLarge = errors.New("bundle too large")
+
+	// errBundleStale is returned if a bundle targets a block which has already
+	// been imported.
+	errBundleStale = errors.New("bundle targets past block")
+
+	// errBundleTooFar is returned if a bundle targets a block too far in the
+	// future.
+	errBundleTooFar = errors.New("bundle targets block too far in the future")
+
+	// errBundleTimestamp is returned if the timestamp window of a bundle is
+	// empty.
+	errBundleTimestamp = errors.New("bundle min timestamp above max timestamp")
+
+	// errBundlePoolFull is returned if the bundle pool has no free slots, and
+	// the bundle does not pay more than any pooled one.
+	errBundlePoolFull = errors.New("bundle pool is full")
+
+	// errBundleSenderLimit is returned if the sender of a bundle already has
+	// the maximum number of bundles pooled.
+	errBundleSenderLimit = errors.New("too many bundles from sender")
+)
+
+var (
+	bundleGauge        = metrics.NewRegisteredGauge("bundlepool/bundles", nil)
+	bundleEvictedMeter = metrics.NewRegisteredMeter("bundlepool/evicted", nil)
+)
+
+// BundlePoolConfig are the configuration parameters of the bundle pool.
+type BundlePoolConfig struct {
+	GlobalSlots  uint64 // Maximum number of bundles kept in the pool
+	AccountSlots uint64 // Maximum number of bundles kept per sender
+	MaxTxs       uint64 // Maximum number of transactions in a single bundle
+	MaxAhead     uint64 // Maximum number of blocks a bundle may target ahead of the head
+}
+
+// DefaultBundlePoolConfig contains the default configurations for the bundle
+// pool.
+var DefaultBundlePoolConfig = BundlePoolConfig{
+	GlobalSlots:  1024,
+	AccountSlots: 16,
+	MaxTxs:       16,
+	MaxAhead:     64,
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *BundlePoolConfig) sanitize() BundlePoolConfig {
+	conf := *config
+	if conf.GlobalSlots < 1 {
+		log.Warn("Sanitizing invalid bundlepool global slots", "provided", conf.GlobalSlots, "updated", DefaultBundlePoolConfig.GlobalSlots)
+		conf.GlobalSlots = DefaultBundlePoolConfig.GlobalSlots
+	}
+	if conf.AccountSlots < 1 {
+		log.Warn("Sanitizing invalid bundlepool account slots", "provided", conf.AccountSlots, "updated", DefaultBundlePoolConfig.AccountSlots)
+		conf.AccountSlots = DefaultBundlePoolConfig.AccountSlots
+	}
+	if conf.MaxTxs < 1 {
+		log.Warn("Sanitizing invalid bundlepool max txs", "provided", conf.MaxTxs, "updated", DefaultBundlePoolConfig.MaxTxs)
+		conf.MaxTxs = DefaultBundlePoolConfig.MaxTxs
+	}
+	if conf.MaxAhead < 1 {
+		log.Warn("Sanitizing invalid bundlepool max ahead", "provided", conf.MaxAhead, "updated", DefaultBundlePoolConfig.MaxAhead)
+		conf.MaxAhead = DefaultBundlePoolConfig.MaxAhead
+	}
+	return conf
+}
+
+// BundlePool holds privately submitted transaction bundles until the block
+// they target is built. Bundles are never gossiped, they only ever reach the
+// local miner.
+//
+// Bundles are dropped as soon as the chain head passes their target block or
+// closes their timestamp window. Every bundle is accounted to the sender of its
+// first transaction, and once the pool is full the bundle offering the lowest
+// gas price is evicted for a better paying one.
+type BundlePool struct {
+	config BundlePoolConfig
+	chain  blockChain
+	signer types.Signer
+
+	mu       sync.RWMutex
+	head     uint64                         // Number of the current chain head
+	headTime uint64                         // Timestamp of the current chain head
+	bundles  map[common.Hash]*types.Bundle  // All bundles targeting future blocks
+	senders  map[common.Hash]common.Address // Sender each bundle is accounted to
+	accounts map[common.Address]int         // Number of bundles pooled per sender
+
+	chainHeadCh  chan ChainHeadEvent
+	chainHeadSub event.Subscription
+	wg           sync.WaitGroup
+}
+
+// NewBundlePool creates a new bundle pool tracking the head of the given chain.
+func NewBundlePool(config BundlePoolConfig, chainconfig *params.ChainConfig, chain blockChain) *BundlePool {
+	pool := &BundlePool{
+		config:      config.sanitize(),
+		chain:       chain,
+		signer:      types.LatestSigner(chainconfig),
+		head:        chain.CurrentBlock().NumberU64(),
+		headTime:    chain.CurrentBlock().Time(),
+		bundles:     make(map[common.Hash]*types.Bundle),
+		senders:     make(map[common.Hash]common.Address),
+		accounts:    make(map[common.Address]int),
+		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
+	}
+	pool.chainHeadSub = chain.SubscribeChainHeadEvent(pool.chainHeadCh)
+
+	pool.wg.Add(1)
+	go pool.loop()
+	return pool
+}
+
+// loop drops the bundles which can no longer be included whenever the chain
+// head changes.
+func (pool *BundlePool) loop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case ev := <-pool.chainHeadCh:
+			if ev.Block != nil {
+				pool.reset(ev.Block.NumberU64(), ev.Block.Time())
+			}
+		case <-pool.chainHeadSub.Err():
+			return
+		}
+	}
+}
+
+// reset moves the pool to a new head, discarding stale and expired bundles.
+func (pool *BundlePool) reset(head uint64, time uint64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.head, pool.headTime = head, time
+	for hash, bundle := range pool.bundles {
+		if bundle.BlockNumber.Uint64() <= head || pool.expired(bundle) {
+			pool.remove(hash)
+		}
+	}
+	bundleGauge.Update(int64(len(pool.bundles)))
+}
+
+// remove drops a bundle from the pool, releasing the slot of its sender. The
+// caller must hold the pool lock.
+func (pool *BundlePool) remove(hash common.Hash) {
+	sender := pool.senders[hash]
+	if pool.accounts[sender]--; pool.accounts[sender] <= 0 {
+		delete(pool.accounts, sender)
+	}
+	delete(pool.senders, hash)
+	delete(pool.bundles, hash)
+}
+
+// expired reports whether a bundle can no longer be included, its timestamp
+// window being closed by the current head already.
+func (pool *BundlePool) expired(bundle *types.Bundle) bool {
+	return bundle.MaxTimestamp != 0 && bundle.MaxTimestamp <= pool.headTime
+}
+
+// makeRoom frees a slot for a bundle offering the given gas price by evicting
+// the cheapest pooled bundle, if it offers less. It reports whether a slot was
+// freed. The caller must hold the pool lock.
+func (pool *BundlePool) makeRoom(price *big.Int) bool {
+	var (
+		cheapest common.Hash
+		lowest   *big.Int
+	)
+	for hash, bundle := range pool.bundles {
+		if have := bundlePrice(bundle); lowest == nil || have.Cmp(lowest) < 0 {
+			cheapest, lowest = hash, have
+		}
+	}
+	if lowest == nil || lowest.Cmp(price) >= 0 {
+		return false
+	}
+	log.Debug("Evicting underpriced bundle", "hash", cheapest, "price", lowest)
+	pool.remove(cheapest)
+	bundleEvictedMeter.Mark(1)
+	return true
+}
+
+// bundlePrice returns the gas price a bundle offers on average, the fees of all
+// its transactions over their gas limit. Payments made to the producer during
+// execution are not known before simulating the bundle.
+func bundlePrice(bundle *types.Bundle) *big.Int {
+	var (
+		fees = new(big.Int)
+		gas  uint64
+	)
+	for _, tx := range bundle.Txs {
+		fees.Add(fees, tx.Cost())
+		fees.Sub(fees, tx.Value())
+		gas += tx.Gas()
+	}
+	if gas == 0 {
+		return fees
+	}
+	return fees.Div(fees, new(big.Int).SetUint64(gas))
+}
+
+// Stop terminates the bundle pool.
+func (pool *BundlePool) Stop() {
+	pool.chainHeadSub.Unsubscribe()
+	pool.wg.Wait()
+
+	log.Info("Bundle pool stopped")
+}
+
+// AddBundle validates a bundle and adds it to the pool.
+func (pool *BundlePool) AddBundle(bundle *types.Bundle) error {
+	if len(bundle.Txs) == 0 {
+		return errBundleEmpty
+	}
+	if uint64(len(bundle.Txs)) > pool.config.MaxTxs {
+		return errBundleTooLarge
+	}
+	if bundle.MaxTimestamp != 0 && bundle.MinTimestamp > bundle.MaxTimestamp {
+		return errBundleTimestamp
+	}
+	var sender common.Address
+	for i, tx := range bundle.Txs {
+		from, err := types.Sender(pool.signer, tx)
+		if err != nil {
+			return fmt.Errorf("invalid transaction %d: %w", i, err)
+		}
+		if i == 0 {
+			sender = from
+		}
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if bundle.BlockNumber == nil {
+		bundle.BlockNumber = new(big.Int).SetUint64(pool.head + 1)
+	}
+	number := bundle.BlockNumber.Uint64()
+	if number <= pool.head {
+		return errBundleStale
+	}
+	if number > pool.head+pool.config.MaxAhead {
+		return errBundleTooFar
+	}
+	hash := bundle.Hash()
+	if _, ok := pool.bundles[hash]; ok {
+		return ErrAlreadyKnown
+	}
+	if pool.expired(bundle) {
+		return errBundleStale
+	}
+	if uint64(pool.accounts[sender]) >= pool.config.AccountSlots {
+		return errBundleSenderLimit
+	}
+	if uint64(len(pool.bundles)) >= pool.config.GlobalSlots && !pool.makeRoom(bundlePrice(bundle)) {
+		return errBundlePoolFull
+	}
+	pool.bundles[hash] = bundle
+	pool.senders[hash] = sender
+	pool.accounts[sender]++
+	bundleGauge.Update(int64(len(pool.bundles)))
+
+	log.Debug("Bundle added to pool", "hash", hash, "txs", len(bundle.Txs), "block", number)
+	return nil
+}
+
+// Bundles returns the bundles eligible for inclusion in a block with the given
+// number and timestamp.
+func (pool *BundlePool) Bundles(number *big.Int, timestamp uint64) []*types.Bundle {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var bundles []*types.Bundle
+	for _, bundle := range pool.bundles {
+		if bundle.Valid(number, timestamp) {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles
+}
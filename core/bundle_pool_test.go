@@ -0,0 +1,166 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that bundles are validated on admission and dropped once the block
+// they target has been imported.
+func TestBundlePoolLifecycle(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 10000000, new(event.Feed)}
+
+	config := DefaultBundlePoolConfig
+	config.MaxTxs = 2
+	config.MaxAhead = 4
+	pool := NewBundlePool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	bundle := func(number int64, nonces ...uint64) *types.Bundle {
+		b := &types.Bundle{BlockNumber: big.NewInt(number)}
+		for _, nonce := range nonces {
+			b.Txs = append(b.Txs, transaction(nonce, 100000, key))
+		}
+		return b
+	}
+	tests := []struct {
+		bundle *types.Bundle
+		err    error
+	}{
+		{bundle(1), errBundleEmpty},
+		{bundle(1, 0, 1, 2), errBundleTooLarge},
+		{bundle(0, 0), errBundleStale},
+		{bundle(5, 0), errBundleTooFar},
+		{&types.Bundle{Txs: types.Transactions{transaction(0, 100000, key)}, BlockNumber: big.NewInt(1), MinTimestamp: 2, MaxTimestamp: 1}, errBundleTimestamp},
+		{bundle(1, 0), nil},
+		{bundle(1, 0), ErrAlreadyKnown},
+		{bundle(2, 0, 1), nil},
+	}
+	for i, tt := range tests {
+		if err := pool.AddBundle(tt.bundle); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if have := len(pool.Bundles(big.NewInt(1), 0)); have != 1 {
+		t.Fatalf("bundles for block 1 mismatch: have %d, want 1", have)
+	}
+	// Import block 1 and ensure its bundles are dropped
+	blockchain.chainHeadFeed.Send(ChainHeadEvent{Block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})})
+	for i := 0; i < 100 && len(pool.Bundles(big.NewInt(1), 0)) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if have := len(pool.Bundles(big.NewInt(1), 0)); have != 0 {
+		t.Fatalf("stale bundles retained: %d", have)
+	}
+	if have := len(pool.Bundles(big.NewInt(2), 0)); have != 1 {
+		t.Fatalf("bundles for block 2 mismatch: have %d, want 1", have)
+	}
+}
+
+// Tests that the bundle pool limits the bundles of every sender, and evicts
+// expired and underpriced bundles to make room for better paying ones.
+func TestBundlePoolLimits(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 10000000, new(event.Feed)}
+
+	config := DefaultBundlePoolConfig
+	config.GlobalSlots = 2
+	config.AccountSlots = 1
+	pool := NewBundlePool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+	}
+	bundle := func(number int64, price int64, key *ecdsa.PrivateKey) *types.Bundle {
+		return &types.Bundle{
+			Txs:          types.Transactions{pricedTransaction(0, 100000, big.NewInt(price), key)},
+			BlockNumber:  big.NewInt(number),
+			MaxTimestamp: 10,
+		}
+	}
+	cheap, dear := bundle(1, 2, keys[0]), bundle(2, 3, keys[1])
+	tests := []struct {
+		bundle *types.Bundle
+		err    error
+	}{
+		{cheap, nil},
+		{bundle(2, 2, keys[0]), errBundleSenderLimit},
+		{dear, nil},
+		{bundle(1, 1, keys[2]), errBundlePoolFull},
+		{bundle(1, 5, keys[2]), nil},
+		{bundle(1, 3, keys[0]), errBundlePoolFull},
+	}
+	for i, tt := range tests {
+		if err := pool.AddBundle(tt.bundle); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if pool.bundles[cheap.Hash()] != nil || pool.bundles[dear.Hash()] == nil {
+		t.Fatalf("underpriced bundle not evicted")
+	}
+	if _, ok := pool.accounts[crypto.PubkeyToAddress(keys[0].PublicKey)]; ok {
+		t.Fatalf("slot of evicted bundle retained")
+	}
+	// Close the timestamp window of all bundles and ensure they are dropped
+	blockchain.chainHeadFeed.Send(ChainHeadEvent{Block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Time: 10})})
+	for i := 0; i < 100 && len(pool.Bundles(big.NewInt(2), 0)) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	if len(pool.bundles) != 0 || len(pool.accounts) != 0 {
+		t.Fatalf("expired bundles retained: %d bundles, %d senders", len(pool.bundles), len(pool.accounts))
+	}
+}
+
+// Tests that bundles of the same transactions targeting different blocks or
+// timestamp windows are distinct.
+func TestBundleHash(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	txs := types.Transactions{transaction(0, 100000, key)}
+
+	bundles := []*types.Bundle{
+		{Txs: txs, BlockNumber: big.NewInt(1)},
+		{Txs: txs, BlockNumber: big.NewInt(2)},
+		{Txs: txs, BlockNumber: big.NewInt(1), MinTimestamp: 1},
+		{Txs: txs, BlockNumber: big.NewInt(1), MaxTimestamp: 1},
+	}
+	seen := make(map[common.Hash]int)
+	for i, bundle := range bundles {
+		if j, ok := seen[bundle.Hash()]; ok {
+			t.Errorf("bundle %d: hash collides with bundle %d", i, j)
+		}
+		seen[bundle.Hash()] = i
+	}
+}
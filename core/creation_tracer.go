@@ -0,0 +1,137 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// CreationTracer is a vm.EVMLogger collecting the contracts deployed by the
+// transactions it follows, both directly and through internal CREATE and
+// CREATE2 calls. Creations in reverted call frames are discarded. The block
+// of the creations is only filled in once written to the contract index.
+type CreationTracer struct {
+	tx        common.Hash                 // Hash of the transaction currently executing
+	frames    [][]*rawdb.ContractCreation // Creations of the call frames currently executing
+	creations []*rawdb.ContractCreation   // Creations of the finished transactions
+}
+
+// NewCreationTracer creates a tracer collecting contract creations.
+func NewCreationTracer() *CreationTracer {
+	return &CreationTracer{}
+}
+
+// Creations returns the contracts deployed by the transactions followed so far.
+func (t *CreationTracer) Creations() []*rawdb.ContractCreation {
+	return append([]*rawdb.ContractCreation{}, t.creations...)
+}
+
+// Snapshot returns an identifier for the creations collected so far.
+func (t *CreationTracer) Snapshot() int {
+	return len(t.creations)
+}
+
+// RevertToSnapshot discards the creations collected since the given snapshot,
+// for transactions rolled back by the caller.
+func (t *CreationTracer) RevertToSnapshot(snapshot int) {
+	t.creations = t.creations[:snapshot]
+}
+
+// enter opens a new call frame, recording the contract it creates if any.
+func (t *CreationTracer) enter(create bool, from, to common.Address, input []byte) {
+	var frame []*rawdb.ContractCreation
+	if create {
+		frame = append(frame, &rawdb.ContractCreation{
+			Address: to,
+			Entry: rawdb.ContractCreationEntry{
+				TxHash:       t.tx,
+				Creator:      from,
+				InitCodeHash: crypto.Keccak256Hash(input),
+			},
+		})
+	}
+	t.frames = append(t.frames, frame)
+}
+
+// exit closes the current call frame, handing its creations to the parent
+// frame if it succeeded.
+func (t *CreationTracer) exit(failed bool) []*rawdb.ContractCreation {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	if failed {
+		return nil
+	}
+	if len(t.frames) > 0 {
+		t.frames[len(t.frames)-1] = append(t.frames[len(t.frames)-1], frame...)
+	}
+	return frame
+}
+
+// CaptureStart implements vm.EVMLogger. The transaction is resolved from the
+// hash the state was prepared with.
+func (t *CreationTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.tx = common.Hash{}
+	if statedb, ok := env.StateDB.(*state.StateDB); ok {
+		t.tx = statedb.TxHash()
+	}
+	t.enter(create, from, to, input)
+}
+
+// CaptureState implements vm.EVMLogger.
+func (t *CreationTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+
+// CaptureEnter implements vm.EVMLogger.
+func (t *CreationTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.enter(typ == vm.CREATE || typ == vm.CREATE2, from, to, input)
+}
+
+// CaptureExit implements vm.EVMLogger.
+func (t *CreationTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.exit(err != nil)
+}
+
+// CaptureFault implements vm.EVMLogger.
+func (t *CreationTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnd implements vm.EVMLogger.
+func (t *CreationTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) {
+	t.creations = append(t.creations, t.exit(err != nil)...)
+}
+
+// stampCreations returns copies of the creations located in the given block.
+func stampCreations(block *types.Block, creations []*rawdb.ContractCreation) []*rawdb.ContractCreation {
+	stamped := make([]*rawdb.ContractCreation, 0, len(creations))
+	for _, creation := range creations {
+		cpy := *creation
+		cpy.Entry.BlockHash, cpy.Entry.BlockNumber = block.Hash(), block.NumberU64()
+		stamped = append(stamped, &cpy)
+	}
+	return stamped
+}
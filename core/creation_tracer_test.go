@@ -0,0 +1,188 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the contract index covers direct and internal creations, but not
+// the ones of reverted call frames.
+func TestContractCreationIndex(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		reverter = common.HexToAddress("0xdead")
+
+		// Init code creating an empty child: CREATE(0, 0, 0) POP STOP
+		initcode = common.FromHex("0x600060006000f05000")
+
+		gspec = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				sender: {Balance: big.NewInt(params.Ether)},
+				// Creates an empty child, then reverts: CREATE(0, 0, 0) POP REVERT(0, 0)
+				reverter: {Balance: new(big.Int), Code: common.FromHex("0x600060006000f05060006000fd")},
+			},
+		}
+		signer  = types.LatestSigner(gspec.Config)
+		db      = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(db)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 1, func(i int, b *BlockGen) {
+		b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 200000, GasPrice: big.NewInt(1), Data: initcode}))
+		b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 1, To: &reverter, Gas: 100000, GasPrice: big.NewInt(1)}))
+	})
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil, EnableContractIndex)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	var (
+		deployTx = blocks[0].Transactions()[0].Hash()
+		parent   = crypto.CreateAddress(sender, 0)
+		child    = crypto.CreateAddress(parent, 1)
+	)
+	tests := []struct {
+		address common.Address
+		want    *rawdb.ContractCreationEntry
+	}{
+		{parent, &rawdb.ContractCreationEntry{TxHash: deployTx, BlockHash: blocks[0].Hash(), BlockNumber: 1, Creator: sender, InitCodeHash: crypto.Keccak256Hash(initcode)}},
+		{child, &rawdb.ContractCreationEntry{TxHash: deployTx, BlockHash: blocks[0].Hash(), BlockNumber: 1, Creator: parent, InitCodeHash: crypto.Keccak256Hash(nil)}},
+		{crypto.CreateAddress(reverter, 0), nil},
+		{reverter, nil},
+	}
+	for i, tt := range tests {
+		have := rawdb.ReadContractCreation(db, tt.address)
+		if (have == nil) != (tt.want == nil) || (have != nil && *have != *tt.want) {
+			t.Errorf("test %d: creation mismatch: have %+v, want %+v", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that the contract index follows the canonical chain across reorgs, and
+// covers the blocks written by the miner.
+func TestContractCreationIndexReorg(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+		gspec  = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+		}
+		signer   = types.LatestSigner(gspec.Config)
+		db       = rawdb.NewMemoryDatabase()
+		genesis  = gspec.MustCommit(db)
+		contract = crypto.CreateAddress(sender, 0)
+	)
+	// generate creates a chain of the given length, deploying the contract
+	// in the given block if any
+	generate := func(n int, deploy int, coinbase byte) []*types.Block {
+		blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, n, func(i int, b *BlockGen) {
+			b.SetCoinbase(common.Address{coinbase})
+			if i == deploy {
+				b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 100000, GasPrice: big.NewInt(1), Data: common.FromHex("0x00")}))
+			}
+		})
+		return blocks
+	}
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil, EnableContractIndex)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	check := func(want *types.Block) {
+		t.Helper()
+		entry := rawdb.ReadContractCreation(db, contract)
+		switch {
+		case want == nil && entry != nil:
+			t.Fatalf("stale creation indexed: %+v", entry)
+		case want != nil && (entry == nil || entry.BlockHash != want.Hash() || entry.TxHash != want.Transactions()[0].Hash()):
+			t.Fatalf("creation mismatch: have %+v, want block %x", entry, want.Hash())
+		}
+	}
+	// Deploy in the first block, then reorg to a chain deploying in the second
+	first := generate(2, 0, 0x01)
+	if _, err := chain.InsertChain(first); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	check(first[0])
+
+	second := generate(3, 1, 0x02)
+	if _, err := chain.InsertChain(second); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	check(second[1])
+
+	// Reorg to a chain without the deployment
+	third := generate(4, -1, 0x03)
+	if _, err := chain.InsertChain(third); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	check(nil)
+
+	// Write a block deploying the contract the way the miner does
+	mined, _ := GenerateChain(gspec.Config, third[3], ethash.NewFaker(), db, 1, func(i int, b *BlockGen) {
+		b.AddTx(types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: 0, Gas: 100000, GasPrice: big.NewInt(1), Data: common.FromHex("0x00")}))
+	})
+	statedb, err := state.New(third[3].Root(), chain.StateCache(), nil)
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	tracer := NewCreationTracer()
+	_, receipts, logs, _, err := chain.Processor().Process(mined[0], statedb, vm.Config{Debug: true, Tracer: tracer})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	statedb.SetExpectedStateRoot(mined[0].Root())
+	chain.WriteContractCreations(mined[0], tracer.Creations())
+	if _, err := chain.WriteBlockWithState(mined[0], receipts, logs, statedb, false); err != nil {
+		t.Fatalf("failed to write block: %v", err)
+	}
+	check(mined[0])
+}
+
+// Tests that the contract index refuses to run when the EVM tracer is taken or
+// blocks are applied from diff layers without execution.
+func TestContractCreationIndexTracer(t *testing.T) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &Genesis{Config: params.TestChainConfig}
+	)
+	gspec.MustCommit(db)
+	if _, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{Debug: true}, nil, nil, EnableContractIndex); err == nil {
+		t.Fatalf("contract index enabled with an EVM tracer")
+	}
+	if _, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil, EnableLightProcessor, EnableContractIndex); err == nil {
+		t.Fatalf("contract index enabled with diff sync")
+	}
+}
@@ -37,6 +37,10 @@ var (
 
 	// ErrKnownBadBlock is return when the block is a known bad block
 	ErrKnownBadBlock = errors.New("already known bad block")
+
+	// ErrExecutionAborted is returned if the EVM was cancelled while executing
+	// a transaction, leaving its outcome undefined.
+	ErrExecutionAborted = errors.New("execution aborted")
 )
 
 // List of evm-call-message pre-checking errors. All state transition messages will
@@ -44,3 +44,11 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// BadDiffEvent is posted when the full execution of a light processed block
+// contradicts the diff layer it was imported with.
+type BadDiffEvent struct {
+	Block    *types.Block
+	DiffHash common.Hash
+	Peers    []string // Peers which served the diff layer
+}
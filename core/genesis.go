@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -175,6 +176,7 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, override
 		if err != nil {
 			return genesis.Config, common.Hash{}, err
 		}
+		systemcontracts.GenesisHash = block.Hash()
 		return genesis.Config, block.Hash(), nil
 	}
 	// We have the genesis block in database(perhaps in ancient database)
@@ -318,6 +320,9 @@ func (g *Genesis) Commit(db ethdb.Database) (*types.Block, error) {
 	if err := config.CheckConfigForkOrder(); err != nil {
 		return nil, err
 	}
+	if err := systemcontracts.ValidateUpgrades(block.Hash(), config); err != nil {
+		return nil, err
+	}
 	rawdb.WriteTd(db, block.Hash(), block.NumberU64(), g.Difficulty)
 	rawdb.WriteBlock(db, block)
 	rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), nil)
@@ -432,6 +437,40 @@ func DeveloperGenesisBlock(period uint64, faucet common.Address) *Genesis {
 	}
 }
 
+// DeveloperParliaGenesisBlock returns the 'geth devnet parlia' genesis block
+// of a network sealed by the given validators. The system contracts set up the
+// validators once initialised at block 1, the faucet relaying the later validator
+// set packages in place of the cross chain contract.
+func DeveloperParliaGenesisBlock(period, epoch uint64, validators []common.Address, faucet common.Address) *Genesis {
+	config := *params.AllParliaProtocolChanges
+	config.Parlia = &params.ParliaConfig{Period: period, Epoch: epoch}
+
+	// Parlia expects the validators in ascending order
+	sorted := make([]common.Address, len(validators))
+	copy(sorted, validators)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+
+	extra := make([]byte, 32)
+	for _, validator := range sorted {
+		extra = append(extra, validator[:]...)
+	}
+	extra = append(extra, make([]byte, crypto.SignatureLength)...)
+
+	return &Genesis{
+		Config:     &config,
+		ExtraData:  extra,
+		GasLimit:   40000000,
+		Difficulty: big.NewInt(1),
+		Alloc: map[common.Address]GenesisAccount{
+			common.HexToAddress(systemcontracts.ValidatorContract):  {Balance: new(big.Int), Code: systemcontracts.DevnetValidatorSetCode()},
+			common.HexToAddress(systemcontracts.SlashContract):      {Balance: new(big.Int), Code: systemcontracts.DevnetSlashCode()},
+			common.HexToAddress(systemcontracts.TokenHubContract):   {Balance: new(big.Int), Code: systemcontracts.DevnetTokenHubCode()},
+			common.HexToAddress(systemcontracts.CrossChainContract): {Balance: new(big.Int), Code: systemcontracts.DevnetCrossChainCode(), Storage: systemcontracts.DevnetCrossChainStorage(faucet, sorted)},
+			faucet: {Balance: new(big.Int).Lsh(big.NewInt(1), 128)},
+		},
+	}
+}
+
 func decodePrealloc(data string) GenesisAlloc {
 	var p []struct{ Addr, Balance *big.Int }
 	if err := rlp.NewStream(strings.NewReader(data), 0).Decode(&p); err != nil {
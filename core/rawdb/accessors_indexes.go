@@ -93,6 +93,82 @@ func DeleteTxLookupEntries(db ethdb.KeyValueWriter, hashes []common.Hash) {
 	}
 }
 
+// ReadContractCreation retrieves the metadata of the transaction which created
+// the contract at the given address, or nil if the creation is not indexed.
+func ReadContractCreation(db ethdb.Reader, address common.Address) *ContractCreationEntry {
+	data, _ := db.Get(contractCreationKey(address))
+	if len(data) == 0 {
+		return nil
+	}
+	var entry ContractCreationEntry
+	if err := rlp.DecodeBytes(data, &entry); err != nil {
+		log.Error("Invalid contract creation entry RLP", "address", address, "blob", data, "err", err)
+		return nil
+	}
+	return &entry
+}
+
+// WriteContractCreation stores the creation metadata of a contract, replacing
+// any previous entry of a contract which self destructed at the same address.
+func WriteContractCreation(db ethdb.KeyValueWriter, address common.Address, entry *ContractCreationEntry) {
+	data, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		log.Crit("Failed to encode contract creation entry", "err", err)
+	}
+	if err := db.Put(contractCreationKey(address), data); err != nil {
+		log.Crit("Failed to store contract creation entry", "err", err)
+	}
+}
+
+// DeleteContractCreation removes the creation metadata of a contract.
+func DeleteContractCreation(db ethdb.KeyValueWriter, address common.Address) {
+	if err := db.Delete(contractCreationKey(address)); err != nil {
+		log.Crit("Failed to delete contract creation entry", "err", err)
+	}
+}
+
+// ReadBlockContractCreations retrieves the contracts deployed by the transactions
+// of a block, or nil if the block has not been indexed.
+func ReadBlockContractCreations(db ethdb.Reader, hash common.Hash, number uint64) []*ContractCreation {
+	data, _ := db.Get(blockCreationsKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	var creations []*ContractCreation
+	if err := rlp.DecodeBytes(data, &creations); err != nil {
+		log.Error("Invalid block contract creations RLP", "hash", hash, "blob", data, "err", err)
+		return nil
+	}
+	return creations
+}
+
+// WriteBlockContractCreations stores the contracts deployed by the transactions
+// of a block, to be indexed whenever the block becomes canonical.
+func WriteBlockContractCreations(db ethdb.KeyValueWriter, hash common.Hash, number uint64, creations []*ContractCreation) {
+	data, err := rlp.EncodeToBytes(creations)
+	if err != nil {
+		log.Crit("Failed to encode block contract creations", "err", err)
+	}
+	if err := db.Put(blockCreationsKey(number, hash), data); err != nil {
+		log.Crit("Failed to store block contract creations", "err", err)
+	}
+}
+
+// DeleteBlockContractCreations removes the contracts deployed by a block.
+func DeleteBlockContractCreations(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Delete(blockCreationsKey(number, hash)); err != nil {
+		log.Crit("Failed to delete block contract creations", "err", err)
+	}
+}
+
+// WriteContractCreationsByBlock stores the creation metadata of all the contracts
+// deployed by a block, replacing the entries of any other chain.
+func WriteContractCreationsByBlock(db ethdb.KeyValueWriter, creations []*ContractCreation) {
+	for _, creation := range creations {
+		WriteContractCreation(db, creation.Address, &creation.Entry)
+	}
+}
+
 // ReadTransaction retrieves a specific transaction from the database, along with
 // its added positional metadata.
 func ReadTransaction(db ethdb.Reader, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
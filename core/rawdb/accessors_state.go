@@ -94,3 +94,26 @@ func DeleteTrieNode(db ethdb.KeyValueWriter, hash common.Hash) {
 		log.Crit("Failed to delete trie node", "err", err)
 	}
 }
+
+// ReadOnlinePruningMarker retrieves the position of the online state pruner
+// in the key space, as saved by the last sweep batch.
+func ReadOnlinePruningMarker(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(onlinePruningKey)
+	return data
+}
+
+// WriteOnlinePruningMarker stores the position of the online state pruner in
+// the key space to resume the sweep after a restart.
+func WriteOnlinePruningMarker(db ethdb.KeyValueWriter, marker []byte) {
+	if err := db.Put(onlinePruningKey, marker); err != nil {
+		log.Crit("Failed to store online pruning marker", "err", err)
+	}
+}
+
+// DeleteOnlinePruningMarker deletes the online pruning marker once a sweep is
+// finished.
+func DeleteOnlinePruningMarker(db ethdb.KeyValueWriter) {
+	if err := db.Delete(onlinePruningKey); err != nil {
+		log.Crit("Failed to remove online pruning marker", "err", err)
+	}
+}
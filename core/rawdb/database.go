@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -338,6 +339,53 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+const (
+	// DBLeveldb is the name of the leveldb database engine.
+	DBLeveldb = "leveldb"
+
+	// DBPebble is the name of the pebble database engine.
+	DBPebble = "pebble"
+)
+
+// PreexistingDatabase checks the given data directory whether a database is
+// already instantiated at that location, and if so, returns the type of the
+// database (or the empty string).
+func PreexistingDatabase(path string) string {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
+		return "" // No pre-existing db
+	}
+	if matches, err := filepath.Glob(filepath.Join(path, "OPTIONS*")); len(matches) > 0 || err != nil {
+		if err != nil {
+			panic(err) // only possible if the pattern is malformed
+		}
+		return DBPebble
+	}
+	return DBLeveldb
+}
+
+// NewKeyValueStore opens a persistent key-value store with the given database
+// engine. If no engine is specified, the engine of a pre-existing database at
+// the location is used, falling back to leveldb for a new one.
+func NewKeyValueStore(engine string, file string, cache int, handles int, namespace string, readonly bool) (ethdb.KeyValueStore, error) {
+	existing := PreexistingDatabase(file)
+	if engine != "" && existing != "" && engine != existing {
+		return nil, fmt.Errorf("db.engine choice was %v but found pre-existing %v database in specified data directory", engine, existing)
+	}
+	if engine == "" {
+		engine = existing
+	}
+	switch engine {
+	case DBPebble:
+		log.Info("Using pebble as the backing database")
+		return newPebbleStore(file, cache, handles, namespace, readonly)
+	case DBLeveldb, "":
+		log.Info("Using leveldb as the backing database")
+		return leveldb.New(file, cache, handles, namespace, readonly)
+	default:
+		return nil, fmt.Errorf("unknown db.engine %v", engine)
+	}
+}
+
 type counter uint64
 
 func (c counter) String() string {
@@ -418,12 +466,14 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		tries           stat
 		codes           stat
 		txLookups       stat
+		creations       stat
 		accountSnaps    stat
 		storageSnaps    stat
 		preimages       stat
 		bloomBits       stat
 		cliqueSnaps     stat
 		parliaSnaps     stat
+		parliaEvidence  stat
 
 		// Ancient store statistics
 		ancientHeadersSize  common.StorageSize
@@ -470,6 +520,10 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			codes.Add(size)
 		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
 			txLookups.Add(size)
+		case bytes.HasPrefix(key, contractCreationPrefix) && len(key) == (len(contractCreationPrefix)+common.AddressLength):
+			creations.Add(size)
+		case bytes.HasPrefix(key, blockCreationsPrefix) && len(key) == (len(blockCreationsPrefix)+8+common.HashLength):
+			creations.Add(size)
 		case bytes.HasPrefix(key, SnapshotAccountPrefix) && len(key) == (len(SnapshotAccountPrefix)+common.HashLength):
 			accountSnaps.Add(size)
 		case bytes.HasPrefix(key, SnapshotStoragePrefix) && len(key) == (len(SnapshotStoragePrefix)+2*common.HashLength):
@@ -484,6 +538,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			cliqueSnaps.Add(size)
 		case bytes.HasPrefix(key, []byte("parlia-")) && len(key) == 7+common.HashLength:
 			parliaSnaps.Add(size)
+		case bytes.HasPrefix(key, []byte("parlia-evidence-")) && len(key) == 16+8+common.AddressLength:
+			parliaEvidence.Add(size)
 
 		case bytes.HasPrefix(key, []byte("cht-")) ||
 			bytes.HasPrefix(key, []byte("chtIndexV2-")) ||
@@ -501,7 +557,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
 				fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
 				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
-				uncleanShutdownKey, badBlockKey,
+				uncleanShutdownKey, badBlockKey, onlinePruningKey,
 			} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
@@ -542,6 +598,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		{"Key-Value store", "Block number->hash", numHashPairings.Size(), numHashPairings.Count()},
 		{"Key-Value store", "Block hash->number", hashNumPairings.Size(), hashNumPairings.Count()},
 		{"Key-Value store", "Transaction index", txLookups.Size(), txLookups.Count()},
+		{"Key-Value store", "Contract creation index", creations.Size(), creations.Count()},
 		{"Key-Value store", "Bloombit index", bloomBits.Size(), bloomBits.Count()},
 		{"Key-Value store", "Contract codes", codes.Size(), codes.Count()},
 		{"Key-Value store", "Trie nodes", tries.Size(), tries.Count()},
@@ -550,6 +607,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		{"Key-Value store", "Storage snapshot", storageSnaps.Size(), storageSnaps.Count()},
 		{"Key-Value store", "Clique snapshots", cliqueSnaps.Size(), cliqueSnaps.Count()},
 		{"Key-Value store", "Parlia snapshots", parliaSnaps.Size(), parliaSnaps.Count()},
+		{"Key-Value store", "Parlia double sign evidence", parliaEvidence.Size(), parliaEvidence.Count()},
 		{"Key-Value store", "Singleton metadata", metadata.Size(), metadata.Count()},
 		{"Key-Value store", "Shutdown metadata", shutdownInfo.Size(), shutdownInfo.Count()},
 		{"Ancient store", "Headers", ancientHeadersSize.String(), ancients.String()},
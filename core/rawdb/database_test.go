@@ -15,3 +15,51 @@
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
 package rawdb
+
+import (
+	"testing"
+)
+
+// Tests that the engine of an existing database is detected and that opening
+// it with another engine is refused.
+func TestKeyValueStoreEngine(t *testing.T) {
+	engines := []string{DBLeveldb}
+	if PebbleEnabled {
+		engines = append(engines, DBPebble)
+	}
+	for _, engine := range engines {
+		dir := t.TempDir()
+		if have := PreexistingDatabase(dir); have != "" {
+			t.Fatalf("%s: empty directory detected as %q", engine, have)
+		}
+		db, err := NewKeyValueStore(engine, dir, 0, 0, "", false)
+		if err != nil {
+			t.Fatalf("%s: failed to create database: %v", engine, err)
+		}
+		if err := db.Put([]byte("key"), []byte("value")); err != nil {
+			t.Fatalf("%s: failed to write: %v", engine, err)
+		}
+		db.Close()
+
+		if have := PreexistingDatabase(dir); have != engine {
+			t.Fatalf("%s: engine mismatch: have %q, want %q", engine, have, engine)
+		}
+		db, err = NewKeyValueStore("", dir, 0, 0, "", false)
+		if err != nil {
+			t.Fatalf("%s: failed to reopen database: %v", engine, err)
+		}
+		if val, err := db.Get([]byte("key")); err != nil || string(val) != "value" {
+			t.Fatalf("%s: value mismatch: have %q (%v), want %q", engine, val, err, "value")
+		}
+		db.Close()
+
+		for _, other := range engines {
+			if other == engine {
+				continue
+			}
+			if _, err := NewKeyValueStore(other, dir, 0, 0, "", false); err == nil {
+				t.Fatalf("%s: database opened as %s", engine, other)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !arm64,!amd64
+
+package rawdb
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// PebbleEnabled reports whether the pebble database engine is available on
+// this platform, it is unsupported on 32bit architectures.
+const PebbleEnabled = false
+
+// errPebbleUnsupported is returned when a pebble database is requested on an
+// architecture it does not support.
+var errPebbleUnsupported = errors.New("pebble is not supported on this platform")
+
+// newPebbleStore opens a pebble backed key-value store.
+func newPebbleStore(file string, cache int, handles int, namespace string, readonly bool) (ethdb.KeyValueStore, error) {
+	return nil, errPebbleUnsupported
+}
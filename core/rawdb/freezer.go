@@ -87,6 +87,8 @@ type freezer struct {
 	closeOnce sync.Once
 
 	offset uint64 // Starting BlockNumber in current freezer
+
+	history HistoryProvider // Provider of the ancient data pruned below the offset
 }
 
 // newFreezer creates a chain freezer that moves ancient chain data into
@@ -155,6 +157,11 @@ func (f *freezer) Close() error {
 		if err := f.instanceLock.Release(); err != nil {
 			errs = append(errs, err)
 		}
+		if f.history != nil {
+			if err := f.history.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	})
 	if errs != nil {
 		return fmt.Errorf("%v", errs)
@@ -165,6 +172,10 @@ func (f *freezer) Close() error {
 // HasAncient returns an indicator whether the specified ancient data exists
 // in the freezer.
 func (f *freezer) HasAncient(kind string, number uint64) (bool, error) {
+	if f.history != nil && number < f.offset {
+		_, err := f.history.Ancient(kind, number)
+		return err == nil, nil
+	}
 	if table := f.tables[kind]; table != nil {
 		return table.has(number - f.offset), nil
 	}
@@ -172,7 +183,13 @@ func (f *freezer) HasAncient(kind string, number uint64) (bool, error) {
 }
 
 // Ancient retrieves an ancient binary blob from the append-only immutable files.
+//
+// The data pruned below the offset is retrieved from the history provider, if
+// any.
 func (f *freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if f.history != nil && number < f.offset {
+		return f.history.Ancient(kind, number)
+	}
 	if table := f.tables[kind]; table != nil {
 		return table.Retrieve(number - f.offset)
 	}
@@ -202,6 +219,12 @@ func (f *freezer) AncientSize(kind string) (uint64, error) {
 	return 0, errUnknownTable
 }
 
+// setHistory sets the provider of the ancient data pruned below the offset. It
+// must be set before the freezer is used.
+func (f *freezer) setHistory(history HistoryProvider) {
+	f.history = history
+}
+
 // AppendAncient injects all binary blobs belong to block at the end of the
 // append-only immutable table files.
 //
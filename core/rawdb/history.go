@@ -0,0 +1,252 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// historyFileLimit is the maximum number of history files kept open.
+	historyFileLimit = 16
+
+	// historyBlockCacheLimit is the number of blocks read from the history files
+	// kept in memory, serving the items of the blocks read together.
+	historyBlockCacheLimit = 256
+)
+
+var (
+	historyReadMeter = metrics.NewRegisteredMeter("ancient/history/read", nil)
+	historyHitMeter  = metrics.NewRegisteredMeter("ancient/history/hit", nil)
+
+	// errHistoryNotFound is returned if the history doesn't hold a block.
+	errHistoryNotFound = errors.New("block not in history")
+)
+
+// HistoryProvider serves the ancient chain data missing from the freezer, pruned
+// below its offset, from an external store of the chain history.
+type HistoryProvider interface {
+	// Ancient retrieves an ancient item of the given kind, encoded as stored in
+	// the freezer.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Close releases the resources of the provider.
+	Close() error
+}
+
+// SetHistoryProvider sets the provider the freezer of the database falls back to
+// for the ancient data pruned from it. The database must have a freezer.
+func SetHistoryProvider(db ethdb.Database, provider HistoryProvider) error {
+	frdb, ok := db.(*freezerdb)
+	if !ok {
+		return errors.New("database without freezer")
+	}
+	f, ok := frdb.AncientStore.(*freezer)
+	if !ok {
+		return errors.New("database without freezer")
+	}
+	f.setHistory(provider)
+	return nil
+}
+
+// historyDir is a history provider serving the files exported by export-history
+// into a directory.
+type historyDir struct {
+	dir     string
+	network string
+	files   map[uint64]string       // Names of the files by epoch
+	hasher  func() types.TrieHasher // Constructor of the hasher of the block roots
+
+	open  map[uint64]*era.Era // Open files by epoch
+	order []uint64            // Epochs of the open files, in the order they were opened
+	lock  sync.RWMutex        // Lock protecting the open files
+
+	blocks *lru.Cache // Blocks recently read, by number
+}
+
+// NewHistoryDir creates a history provider serving the files of the network of
+// the given genesis in the directory, as written by export-history. The blocks
+// read are checked against their headers, with the roots derived by hashers
+// of the given constructor.
+func NewHistoryDir(dir string, genesis common.Hash, hasher func() types.TrieHasher) (HistoryProvider, error) {
+	network := era.Network(genesis)
+	names, err := era.ReadDir(dir, network)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no history files of %s in %s", network, dir)
+	}
+	blocks, _ := lru.New(historyBlockCacheLimit)
+	h := &historyDir{
+		dir:     dir,
+		network: network,
+		files:   make(map[uint64]string),
+		hasher:  hasher,
+		open:    make(map[uint64]*era.Era),
+		blocks:  blocks,
+	}
+	epochRegexp := regexp.MustCompile(`-([0-9]+)-[0-9a-f]{8}\.era$`)
+	for _, name := range names {
+		epoch, _ := strconv.ParseUint(epochRegexp.FindStringSubmatch(name)[1], 10, 64)
+		h.files[epoch] = name
+	}
+	log.Info("Serving pruned history from files", "dir", dir, "network", network, "files", len(names))
+	return h, nil
+}
+
+// Ancient implements HistoryProvider, retrieving an item of a block from the
+// history files.
+func (h *historyDir) Ancient(kind string, number uint64) ([]byte, error) {
+	if _, ok := h.files[era.Epoch(number)]; !ok {
+		return nil, errHistoryNotFound
+	}
+	var block *era.Block
+	if cached, ok := h.blocks.Get(number); ok {
+		historyHitMeter.Mark(1)
+		block = cached.(*era.Block)
+	} else {
+		historyReadMeter.Mark(1)
+		var err error
+		if block, err = h.readBlock(number); err != nil {
+			return nil, err
+		}
+		if err := verifyHistoryBlock(block, h.hasher()); err != nil {
+			return nil, err
+		}
+		h.blocks.Add(number, block)
+	}
+	switch kind {
+	case freezerHashTable:
+		return block.Hash.Bytes(), nil
+	case freezerHeaderTable:
+		return block.Header, nil
+	case freezerBodiesTable:
+		return block.Body, nil
+	case freezerReceiptTable:
+		return block.Receipts, nil
+	case freezerDifficultyTable:
+		return rlp.EncodeToBytes(block.TD)
+	default:
+		return nil, errUnknownTable
+	}
+}
+
+// readBlock reads a block from its history file, opening it if needed.
+func (h *historyDir) readBlock(number uint64) (*era.Block, error) {
+	epoch := era.Epoch(number)
+
+	h.lock.RLock()
+	e := h.open[epoch]
+	if e != nil {
+		defer h.lock.RUnlock()
+		return e.Block(number)
+	}
+	h.lock.RUnlock()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if e = h.open[epoch]; e == nil {
+		name := h.files[epoch]
+		var err error
+		if e, err = era.Open(filepath.Join(h.dir, name)); err != nil {
+			return nil, err
+		}
+		if era.Filename(h.network, epoch, e.Accumulator()) != name {
+			e.Close()
+			return nil, fmt.Errorf("history file %s mismatches its accumulator %x", name, e.Accumulator())
+		}
+		if err := e.Verify(); err != nil {
+			e.Close()
+			return nil, fmt.Errorf("history file %s: %v", name, err)
+		}
+		// Close the file opened first if too many are open
+		if len(h.order) >= historyFileLimit {
+			h.open[h.order[0]].Close()
+			delete(h.open, h.order[0])
+			h.order = h.order[1:]
+		}
+		h.open[epoch], h.order = e, append(h.order, epoch)
+	}
+	return e.Block(number)
+}
+
+// verifyHistoryBlock checks that the body and receipts of a block read from the
+// history files match its header, and the header its hash.
+func verifyHistoryBlock(block *era.Block, hasher types.TrieHasher) error {
+	var (
+		header   = new(types.Header)
+		body     = new(types.Body)
+		receipts []*types.ReceiptForStorage
+	)
+	if err := rlp.DecodeBytes(block.Header, header); err != nil {
+		return fmt.Errorf("invalid header of block #%d: %v", block.Number, err)
+	}
+	if header.Number.Uint64() != block.Number {
+		return fmt.Errorf("header number mismatch: have %d, want %d", header.Number, block.Number)
+	}
+	if hash := header.Hash(); hash != block.Hash {
+		return fmt.Errorf("header hash mismatch of block #%d: have %x, want %x", block.Number, hash, block.Hash)
+	}
+	if err := rlp.DecodeBytes(block.Body, body); err != nil {
+		return fmt.Errorf("invalid body of block #%d: %v", block.Number, err)
+	}
+	if hash := types.DeriveSha(types.Transactions(body.Transactions), hasher); hash != header.TxHash {
+		return fmt.Errorf("transactions root mismatch of block #%d: have %x, want %x", block.Number, hash, header.TxHash)
+	}
+	if hash := types.CalcUncleHash(body.Uncles); hash != header.UncleHash {
+		return fmt.Errorf("uncles hash mismatch of block #%d: have %x, want %x", block.Number, hash, header.UncleHash)
+	}
+	if err := rlp.DecodeBytes(block.Receipts, &receipts); err != nil {
+		return fmt.Errorf("invalid receipts of block #%d: %v", block.Number, err)
+	}
+	blockReceipts := make(types.Receipts, len(receipts))
+	for i, receipt := range receipts {
+		blockReceipts[i] = (*types.Receipt)(receipt)
+	}
+	if hash := types.DeriveSha(blockReceipts, hasher); hash != header.ReceiptHash {
+		return fmt.Errorf("receipts root mismatch of block #%d: have %x, want %x", block.Number, hash, header.ReceiptHash)
+	}
+	return nil
+}
+
+// Close implements HistoryProvider, closing the open history files.
+func (h *historyDir) Close() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, e := range h.open {
+		e.Close()
+	}
+	h.open, h.order = make(map[uint64]*era.Era), nil
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// writeHistory exports the blocks into a history file of the directory,
+// returning its path.
+func writeHistory(t *testing.T, dir string, genesis common.Hash, blocks []*types.Block, receipts []types.Receipts) string {
+	f, err := os.Create(filepath.Join(dir, "tmp.era"))
+	if err != nil {
+		t.Fatalf("failed to create history file: %v", err)
+	}
+	builder := era.NewBuilder(f)
+	for i, block := range blocks {
+		header, _ := rlp.EncodeToBytes(block.Header())
+		body, _ := rlp.EncodeToBytes(block.Body())
+		storage := make([]*types.ReceiptForStorage, len(receipts[i]))
+		for j, receipt := range receipts[i] {
+			storage[j] = (*types.ReceiptForStorage)(receipt)
+		}
+		encoded, _ := rlp.EncodeToBytes(storage)
+		td := new(big.Int).SetUint64(2 * (block.NumberU64() + 1))
+		if err := builder.Add(block.NumberU64(), header, body, encoded, td); err != nil {
+			t.Fatalf("failed to add block #%d: %v", block.NumberU64(), err)
+		}
+	}
+	accumulator, err := builder.Finalize()
+	if err != nil {
+		t.Fatalf("failed to finalize history file: %v", err)
+	}
+	f.Close()
+	path := filepath.Join(dir, era.Filename(era.Network(genesis), 0, accumulator))
+	if err := os.Rename(filepath.Join(dir, "tmp.era"), path); err != nil {
+		t.Fatalf("failed to rename history file: %v", err)
+	}
+	return path
+}
+
+// makeHistoryBlocks creates a chain of blocks with a transaction and receipt
+// each.
+func makeHistoryBlocks(n int) ([]*types.Block, []types.Receipts) {
+	var (
+		blocks   []*types.Block
+		receipts []types.Receipts
+	)
+	for number := 0; number < n; number++ {
+		header := &types.Header{
+			Number:     big.NewInt(int64(number)),
+			Difficulty: big.NewInt(2),
+			Extra:      []byte("history"),
+		}
+		if number > 0 {
+			header.ParentHash = blocks[number-1].Hash()
+		}
+		tx := types.NewTransaction(uint64(number), common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil)
+		receipt := types.Receipts{{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: 21000 * uint64(number+1),
+			Logs:              []*types.Log{},
+		}}
+		blocks = append(blocks, types.NewBlock(header, []*types.Transaction{tx}, nil, receipt, newHasher()))
+		receipts = append(receipts, receipt)
+	}
+	return blocks, receipts
+}
+
+// newHistoryDatabase creates a database with a freezer pruned below the given
+// block, serving the history files of the directory.
+func newHistoryDatabase(t *testing.T, dir string, genesis common.Hash, pruned uint64) ethdb.Database {
+	kvdb := memorydb.New()
+	WriteOffSetOfCurrentAncientFreezer(kvdb, pruned)
+	db, err := NewDatabaseWithFreezer(kvdb, t.TempDir(), "", false, true, false)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	history, err := NewHistoryDir(dir, genesis, func() types.TrieHasher { return newHasher() })
+	if err != nil {
+		t.Fatalf("failed to open history: %v", err)
+	}
+	if err := SetHistoryProvider(db, history); err != nil {
+		t.Fatalf("failed to set history provider: %v", err)
+	}
+	return db
+}
+
+// Tests that the ancient data pruned below the freezer offset is served from
+// the history files once a history provider is set.
+func TestHistoryProvider(t *testing.T) {
+	var (
+		genesis          = common.Hash{0x01}
+		pruned           = uint64(8)
+		blocks, receipts = makeHistoryBlocks(int(pruned))
+		dir              = t.TempDir()
+	)
+	writeHistory(t, dir, genesis, blocks, receipts)
+
+	// Create a database with a freezer pruned below the exported blocks
+	kvdb := memorydb.New()
+	WriteOffSetOfCurrentAncientFreezer(kvdb, pruned)
+	db, err := NewDatabaseWithFreezer(kvdb, t.TempDir(), "", false, true, false)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if hash := ReadCanonicalHash(db, 3); hash != (common.Hash{}) {
+		t.Fatalf("pruned block served without history: %x", hash)
+	}
+	history, err := NewHistoryDir(dir, genesis, func() types.TrieHasher { return newHasher() })
+	if err != nil {
+		t.Fatalf("failed to open history: %v", err)
+	}
+	if err := SetHistoryProvider(db, history); err != nil {
+		t.Fatalf("failed to set history provider: %v", err)
+	}
+	for i, block := range blocks {
+		number := block.NumberU64()
+		if hash := ReadCanonicalHash(db, number); hash != block.Hash() {
+			t.Fatalf("block #%d: hash mismatch: have %x, want %x", number, hash, block.Hash())
+		}
+		if have := ReadBlock(db, block.Hash(), number); have == nil || have.Hash() != block.Hash() {
+			t.Fatalf("block #%d: block mismatch: have %v", number, have)
+		}
+		if td := ReadTd(db, block.Hash(), number); td == nil || td.Uint64() != 2*(number+1) {
+			t.Fatalf("block #%d: td mismatch: have %v, want %d", number, td, 2*(number+1))
+		}
+		have := ReadRawReceipts(db, block.Hash(), number)
+		if len(have) != 1 || have[0].CumulativeGasUsed != receipts[i][0].CumulativeGasUsed {
+			t.Fatalf("block #%d: receipts mismatch: have %v", number, have)
+		}
+	}
+	// Blocks neither pruned nor frozen are not served
+	if hash := ReadCanonicalHash(db, pruned); hash != (common.Hash{}) {
+		t.Fatalf("block #%d: unexpected hash %x", pruned, hash)
+	}
+	// History of another network is refused
+	if _, err := NewHistoryDir(dir, common.Hash{0x02}, func() types.TrieHasher { return newHasher() }); err == nil {
+		t.Fatalf("history of another network opened")
+	}
+}
+
+// Tests that blocks of history files not matching their headers, or files not
+// matching their accumulator, are not served.
+func TestHistoryProviderCorrupt(t *testing.T) {
+	var (
+		genesis          = common.Hash{0x01}
+		pruned           = uint64(8)
+		blocks, receipts = makeHistoryBlocks(int(pruned))
+	)
+	// Swap the receipts of a block for ones not matching its header
+	dir := t.TempDir()
+	tampered := append([]types.Receipts{}, receipts...)
+	tampered[3] = types.Receipts{{Status: types.ReceiptStatusFailed, CumulativeGasUsed: 1, Logs: []*types.Log{}}}
+	writeHistory(t, dir, genesis, blocks, tampered)
+
+	db := newHistoryDatabase(t, dir, genesis, pruned)
+	if hash := ReadCanonicalHash(db, 2); hash != blocks[2].Hash() {
+		t.Fatalf("intact block not served: %x", hash)
+	}
+	if hash := ReadCanonicalHash(db, 3); hash != (common.Hash{}) {
+		t.Fatalf("block with mismatching receipts served: %x", hash)
+	}
+	// Corrupt the total difficulty of the last block, stored right before the
+	// accumulator and the block index
+	dir = t.TempDir()
+	path := writeHistory(t, dir, genesis, blocks, receipts)
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read history file: %v", err)
+	}
+	blob[len(blob)-(8+16+8*len(blocks))-(8+common.HashLength)-1] ^= 0xff
+	if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+		t.Fatalf("failed to write history file: %v", err)
+	}
+	db = newHistoryDatabase(t, dir, genesis, pruned)
+	if hash := ReadCanonicalHash(db, 2); hash != (common.Hash{}) {
+		t.Fatalf("block of a file mismatching its accumulator served: %x", hash)
+	}
+}
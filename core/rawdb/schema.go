@@ -63,6 +63,9 @@ var (
 	// snapshotSyncStatusKey tracks the snapshot sync status across restarts.
 	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
 
+	// onlinePruningKey tracks the sweep progress of the online state pruner across restarts.
+	onlinePruningKey = []byte("OnlinePruning")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
@@ -90,11 +93,13 @@ var (
 	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 
-	txLookupPrefix        = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
-	bloomBitsPrefix       = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
-	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
-	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
-	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
+	txLookupPrefix         = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
+	contractCreationPrefix = []byte("C") // contractCreationPrefix + address -> contract creation metadata
+	blockCreationsPrefix   = []byte("D") // blockCreationsPrefix + num (uint64 big endian) + hash -> contracts deployed by the block
+	bloomBitsPrefix        = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
+	SnapshotAccountPrefix  = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
+	SnapshotStoragePrefix  = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
+	CodePrefix             = []byte("c") // CodePrefix + code hash -> account code
 
 	// difflayer database
 	diffLayerPrefix = []byte("d") // diffLayerPrefix + hash  -> diffLayer
@@ -144,6 +149,22 @@ type LegacyTxLookupEntry struct {
 	Index      uint64
 }
 
+// ContractCreationEntry is the positional metadata of the transaction which
+// created a contract, either directly or through an internal CREATE/CREATE2.
+type ContractCreationEntry struct {
+	TxHash       common.Hash
+	BlockHash    common.Hash
+	BlockNumber  uint64
+	Creator      common.Address // Account executing the creation
+	InitCodeHash common.Hash    // Hash of the executed init code
+}
+
+// ContractCreation is a contract deployed by the transactions of a block.
+type ContractCreation struct {
+	Address common.Address
+	Entry   ContractCreationEntry
+}
+
 // encodeBlockNumber encodes a block number as big endian uint64
 func encodeBlockNumber(number uint64) []byte {
 	enc := make([]byte, 8)
@@ -196,6 +217,16 @@ func txLookupKey(hash common.Hash) []byte {
 	return append(txLookupPrefix, hash.Bytes()...)
 }
 
+// contractCreationKey = contractCreationPrefix + address
+func contractCreationKey(address common.Address) []byte {
+	return append(contractCreationPrefix, address.Bytes()...)
+}
+
+// blockCreationsKey = blockCreationsPrefix + num (uint64 big endian) + hash
+func blockCreationsKey(number uint64, hash common.Hash) []byte {
+	return append(append(blockCreationsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
 // accountSnapshotKey = SnapshotAccountPrefix + hash
 func accountSnapshotKey(hash common.Hash) []byte {
 	return append(SnapshotAccountPrefix, hash.Bytes()...)
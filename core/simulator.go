@@ -0,0 +1,420 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// errNoBaseState is returned when forking a simulator that has no base
+// state available, e.g. because the head state could not be opened.
+var errNoBaseState = errors.New("simulator base state unavailable")
+
+// proposerPredictor is implemented by consensus engines able to tell which
+// signer is expected to seal the block following a given parent.
+type proposerPredictor interface {
+	NextInTurnValidator(chain consensus.ChainHeaderReader, parent *types.Header) (common.Address, error)
+}
+
+// Simulator executes transactions speculatively on top of the current chain
+// head. It keeps a single base state per head, refreshed on every head event,
+// and hands out cheap isolated forks of it which share the storage cache of the
+// base but never write back to it.
+type Simulator struct {
+	chain    *BlockChain
+	vmConfig vm.Config
+
+	lock   sync.RWMutex
+	parent *types.Header  // Head block the base state belongs to
+	base   *state.StateDB // Pristine state of the head, only ever copied
+	header *types.Header  // Template of the next block's header
+
+	headSub event.Subscription
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewSimulator creates a simulator tracking the head of the given chain.
+func NewSimulator(chain *BlockChain, vmConfig vm.Config) *Simulator {
+	s := &Simulator{
+		chain:    chain,
+		vmConfig: vmConfig,
+		quit:     make(chan struct{}),
+	}
+	if err := s.refresh(chain.CurrentBlock().Header()); err != nil {
+		log.Warn("Failed to initialise simulator state", "err", err)
+	}
+	headCh := make(chan ChainHeadEvent, 10)
+	s.headSub = chain.SubscribeChainHeadEvent(headCh)
+
+	s.wg.Add(1)
+	go s.loop(headCh)
+	return s
+}
+
+// Stop terminates the head tracking loop.
+func (s *Simulator) Stop() {
+	s.headSub.Unsubscribe()
+	close(s.quit)
+	s.wg.Wait()
+}
+
+// loop refreshes the base state whenever the chain head changes.
+func (s *Simulator) loop(headCh chan ChainHeadEvent) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case ev := <-headCh:
+			if err := s.refresh(ev.Block.Header()); err != nil {
+				log.Debug("Failed to refresh simulator state", "number", ev.Block.Number(), "hash", ev.Block.Hash(), "err", err)
+			}
+		case <-s.headSub.Err():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// refresh replaces the base state with the one of the given head.
+func (s *Simulator) refresh(head *types.Header) error {
+	base, err := s.chain.StateAtWithSharedPool(head.Root)
+	if err != nil {
+		return err
+	}
+	header := s.NextHeader(head)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.parent, s.base, s.header = head, base, header
+	return nil
+}
+
+// Head returns the header the current base state belongs to.
+func (s *Simulator) Head() *types.Header {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.parent
+}
+
+// NextHeader assembles the header of the block following the given parent the
+// way the local consensus engine would: number+1, the parent timestamp plus
+// the configured block period and the in-turn proposer as coinbase if the
+// engine can predict it.
+func (s *Simulator) NextHeader(parent *types.Header) *types.Header {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + blockPeriod(s.chain.Config()),
+		Coinbase:   parent.Coinbase,
+		Difficulty: new(big.Int).Set(parent.Difficulty),
+	}
+	if predictor, ok := s.chain.Engine().(proposerPredictor); ok {
+		if coinbase, err := predictor.NextInTurnValidator(s.chain, parent); err == nil {
+			header.Coinbase = coinbase
+		}
+	}
+	return header
+}
+
+// Fork returns an isolated simulation environment on top of the current head.
+func (s *Simulator) Fork() (*SimFork, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.base == nil {
+		return nil, errNoBaseState
+	}
+	statedb := s.base.Copy()
+	statedb.EnableWriteOnSharedStorage()
+	return s.newFork(s.parent, types.CopyHeader(s.header), statedb), nil
+}
+
+// ForkAt returns an isolated simulation environment on top of the given block.
+// The cached base state is used if the block is the tracked head, otherwise the
+// state is opened from the database.
+func (s *Simulator) ForkAt(parent *types.Header) (*SimFork, error) {
+	if head := s.Head(); head != nil && head.Hash() == parent.Hash() {
+		return s.Fork()
+	}
+	statedb, err := s.chain.StateAtWithSharedPool(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	return s.newFork(parent, s.NextHeader(parent), statedb), nil
+}
+
+// ForkWith returns an isolated simulation environment executing the block with
+// the given header on top of the given parent state. It bypasses the cached
+// base state and is meant for simulations with overridden block contexts or
+// states. The state diff of the fork is relative to the given state.
+func (s *Simulator) ForkWith(parent *types.Header, header *types.Header, statedb *state.StateDB) *SimFork {
+	fork := s.newFork(parent, types.CopyHeader(header), statedb)
+	fork.pre = statedb.Copy()
+	return fork
+}
+
+func (s *Simulator) newFork(parent *types.Header, header *types.Header, statedb *state.StateDB) *SimFork {
+	header.GasUsed = 0
+	return &SimFork{
+		chain:    s.chain,
+		config:   s.chain.Config(),
+		vmConfig: s.vmConfig,
+		parent:   parent,
+		header:   header,
+		state:    statedb,
+		gasPool:  new(GasPool).AddGas(math.MaxUint64),
+	}
+}
+
+// blockPeriod returns the expected number of seconds between two blocks.
+func blockPeriod(config *params.ChainConfig) uint64 {
+	switch {
+	case config.Parlia != nil:
+		return config.Parlia.Period
+	case config.Clique != nil && config.Clique.Period > 0:
+		return config.Clique.Period
+	default:
+		return 1
+	}
+}
+
+// ProducerBalance returns the funds attributable to the producer of a block.
+// On parlia chains transaction fees are collected by the system address and
+// only credited to the validator when the block is finalised, so they are
+// counted here as well.
+func ProducerBalance(config *params.ChainConfig, statedb *state.StateDB, coinbase common.Address) *big.Int {
+	balance := new(big.Int).Set(statedb.GetBalance(coinbase))
+	if config.Parlia != nil && coinbase != consensus.SystemAddress {
+		balance.Add(balance, statedb.GetBalance(consensus.SystemAddress))
+	}
+	return balance
+}
+
+// SimResult is the outcome of a single simulated transaction.
+type SimResult struct {
+	Receipt    *types.Receipt
+	ReturnData []byte // Data returned by the top level call, or the revert reason
+	Err        error  // EVM level failure (e.g. revert), the state changes were discarded
+}
+
+// AccountDiff is the change of a single account caused by a simulation.
+type AccountDiff struct {
+	BalanceBefore *big.Int
+	BalanceAfter  *big.Int
+	NonceBefore   uint64
+	NonceAfter    uint64
+	CodeBefore    common.Hash // Code hash prior to the simulation
+	CodeAfter     common.Hash // Code hash after the simulation
+	Storage       map[common.Hash]StorageDiff
+}
+
+// StorageDiff is the change of a single storage slot caused by a simulation.
+type StorageDiff struct {
+	Before common.Hash
+	After  common.Hash
+}
+
+// SimFork is an isolated simulation environment. Transactions applied to it
+// are executed in order with state carried forward. A fork is not safe for
+// concurrent use.
+type SimFork struct {
+	chain    *BlockChain
+	config   *params.ChainConfig
+	vmConfig vm.Config
+
+	parent   *types.Header
+	header   *types.Header
+	pre      *state.StateDB // State the diff is computed against, the parent state if nil
+	state    *state.StateDB
+	gasPool  *GasPool
+	txs      types.Transactions
+	receipts types.Receipts
+}
+
+// Parent returns the header of the block the simulation is built upon.
+func (f *SimFork) Parent() *types.Header { return f.parent }
+
+// Header returns the header of the simulated block. GasUsed reflects the
+// transactions applied so far.
+func (f *SimFork) Header() *types.Header { return f.header }
+
+// FeeRecipient returns the account credited with the transaction fees of the
+// simulated block, the system address on parlia chains.
+func (f *SimFork) FeeRecipient() common.Address {
+	if f.config.Parlia != nil {
+		return consensus.SystemAddress
+	}
+	return f.header.Coinbase
+}
+
+// Signer returns the transaction signer valid for the simulated block.
+func (f *SimFork) Signer() types.Signer { return types.MakeSigner(f.config, f.header.Number) }
+
+// State returns the state of the fork after the transactions applied so far.
+func (f *SimFork) State() *state.StateDB { return f.state }
+
+// Receipts returns the receipts of the transactions applied so far.
+func (f *SimFork) Receipts() types.Receipts { return f.receipts }
+
+// Logs returns the logs emitted by the transactions applied so far.
+func (f *SimFork) Logs() []*types.Log { return f.state.Logs() }
+
+// Copy returns an independent copy of the fork, allowing to branch off
+// alternative transaction orderings from a common prefix.
+func (f *SimFork) Copy() *SimFork {
+	cpy := *f
+	cpy.header = types.CopyHeader(f.header)
+	cpy.state = f.state.Copy()
+	cpy.gasPool = new(GasPool).AddGas(f.gasPool.Gas())
+	cpy.txs = append(types.Transactions{}, f.txs...)
+	cpy.receipts = append(types.Receipts{}, f.receipts...)
+	return &cpy
+}
+
+// ApplyTransaction executes the transaction on top of the fork. Consensus
+// errors (e.g. nonce too low) are returned as error and leave the fork
+// untouched, whereas EVM failures are reported in the result.
+func (f *SimFork) ApplyTransaction(tx *types.Transaction) (*SimResult, error) {
+	msg, err := tx.AsMessage(f.Signer())
+	if err != nil {
+		return nil, err
+	}
+	return f.applyTransaction(context.Background(), msg, tx, f.vmConfig)
+}
+
+// ApplyMessage is like ApplyTransaction, but executes an unsigned transaction
+// as if sent by the given account, sparing the signing of transactions which
+// are only simulated. The transaction is recorded as is, so its hash differs
+// from the one of the signed transaction.
+func (f *SimFork) ApplyMessage(from common.Address, tx *types.Transaction) (*SimResult, error) {
+	msg := types.NewMessage(from, tx.To(), tx.Nonce(), tx.Value(), tx.Gas(), tx.GasPrice(), tx.Data(), tx.AccessList(), true)
+	return f.applyTransaction(context.Background(), msg, tx, f.vmConfig)
+}
+
+// ApplyTransactionContext is like ApplyTransaction, but aborts the execution
+// once the context is done, leaving the fork untouched and returning the error
+// of the context.
+func (f *SimFork) ApplyTransactionContext(ctx context.Context, tx *types.Transaction) (*SimResult, error) {
+	msg, err := tx.AsMessage(f.Signer())
+	if err != nil {
+		return nil, err
+	}
+	return f.applyTransaction(ctx, msg, tx, f.vmConfig)
+}
+
+// ApplyTransactionWithTracer is like ApplyTransaction, but runs the EVM with the
+// given tracer attached.
+func (f *SimFork) ApplyTransactionWithTracer(tx *types.Transaction, tracer vm.EVMLogger) (*SimResult, error) {
+	msg, err := tx.AsMessage(f.Signer())
+	if err != nil {
+		return nil, err
+	}
+	vmConfig := f.vmConfig
+	vmConfig.Debug, vmConfig.Tracer = true, tracer
+	return f.applyTransaction(context.Background(), msg, tx, vmConfig)
+}
+
+// LimitGas caps the gas available to all the transactions applied to the fork
+// from now on. Transactions exceeding it fail as if the block was full.
+func (f *SimFork) LimitGas(gas uint64) {
+	if gas < f.gasPool.Gas() {
+		*f.gasPool = GasPool(gas)
+	}
+}
+
+func (f *SimFork) applyTransaction(ctx context.Context, msg types.Message, tx *types.Transaction, vmConfig vm.Config) (*SimResult, error) {
+	var (
+		snap    = f.state.Snapshot()
+		gas     = f.gasPool.Gas()
+		gasUsed = f.header.GasUsed
+		vmenv   = vm.NewEVM(NewEVMBlockContext(f.header, f.chain, &f.header.Coinbase), vm.TxContext{}, f.state, f.config, vmConfig)
+	)
+	defer func() {
+		vm.EVMInterpreterPool.Put(vmenv.Interpreter())
+		vm.EvmPool.Put(vmenv)
+	}()
+	// Cancel the EVM once the context is done, making sure it is not cancelled
+	// anymore after being returned to the pool
+	if done := ctx.Done(); done != nil {
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+				vmenv.Cancel()
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+	}
+	f.state.Prepare(tx.Hash(), common.Hash{}, len(f.txs))
+	receipt, result, err := applyTransactionWithResult(msg, f.config, f.chain, &f.header.Coinbase, f.gasPool, f.state, f.header, tx, &f.header.GasUsed, vmenv)
+	if errors.Is(err, ErrExecutionAborted) && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		f.state.RevertToSnapshot(snap)
+		*f.gasPool = GasPool(gas)
+		f.header.GasUsed = gasUsed
+		return nil, err
+	}
+	f.txs = append(f.txs, tx)
+	f.receipts = append(f.receipts, receipt)
+
+	return &SimResult{Receipt: receipt, ReturnData: result.ReturnData, Err: result.Err}, nil
+}
+
+// StateDiff computes the changes of all accounts touched by the transactions
+// applied so far, relative to the state of the parent block or the state the
+// fork was created with.
+func (f *SimFork) StateDiff() (map[common.Address]*AccountDiff, error) {
+	pre := f.pre
+	if pre == nil {
+		var err error
+		if pre, err = f.chain.StateAt(f.parent.Root); err != nil {
+			return nil, err
+		}
+	}
+	diff := make(map[common.Address]*AccountDiff)
+	for _, addr := range f.state.GetDirtyAccounts() {
+		account := &AccountDiff{
+			BalanceBefore: pre.GetBalance(addr),
+			BalanceAfter:  f.state.GetBalance(addr),
+			NonceBefore:   pre.GetNonce(addr),
+			NonceAfter:    f.state.GetNonce(addr),
+			CodeBefore:    pre.GetCodeHash(addr),
+			CodeAfter:     f.state.GetCodeHash(addr),
+			Storage:       make(map[common.Hash]StorageDiff),
+		}
+		for key, value := range f.state.GetDirtyStorage(addr) {
+			if before := pre.GetState(addr, key); before != value {
+				account.Storage[key] = StorageDiff{Before: before, After: value}
+			}
+		}
+		unchanged := account.BalanceBefore.Cmp(account.BalanceAfter) == 0 && account.NonceBefore == account.NonceAfter &&
+			account.CodeBefore == account.CodeAfter && len(account.Storage) == 0
+		if !unchanged {
+			diff[addr] = account
+		}
+	}
+	return diff, nil
+}
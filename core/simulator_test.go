@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSimulatorFork(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		dest    = common.Address{0xde, 0xad}
+		funds   = big.NewInt(1000000000000000)
+		signer  = types.HomesteadSigner{}
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr: {Balance: funds}}}
+		genesis = gspec.MustCommit(db)
+		engine  = ethash.NewFaker()
+	)
+	chain, _ := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	sim := NewSimulator(chain, vm.Config{})
+	defer sim.Stop()
+
+	transfer := func(nonce uint64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, dest, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		return tx
+	}
+	fork, err := sim.Fork()
+	if err != nil {
+		t.Fatalf("failed to fork simulator: %v", err)
+	}
+	if fork.Header().Number.Uint64() != 1 || fork.Header().ParentHash != genesis.Hash() {
+		t.Fatalf("unexpected simulated header: number %d, parent %x", fork.Header().Number, fork.Header().ParentHash)
+	}
+	// Apply two transactions in order, the second one depends on the first
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		res, err := fork.ApplyTransaction(transfer(nonce))
+		if err != nil {
+			t.Fatalf("failed to apply transaction %d: %v", nonce, err)
+		}
+		if res.Receipt.Status != types.ReceiptStatusSuccessful || res.Receipt.CumulativeGasUsed != (nonce+1)*params.TxGas {
+			t.Fatalf("unexpected receipt %d: status %d, cumulative gas %d", nonce, res.Receipt.Status, res.Receipt.CumulativeGasUsed)
+		}
+	}
+	// Invalid transactions must leave the fork untouched
+	if _, err := fork.ApplyTransaction(transfer(0)); err == nil {
+		t.Fatalf("stale nonce accepted")
+	}
+	if have := fork.Header().GasUsed; have != 2*params.TxGas {
+		t.Fatalf("gas used mismatch: have %d, want %d", have, 2*params.TxGas)
+	}
+	diff, err := fork.StateDiff()
+	if err != nil {
+		t.Fatalf("failed to compute state diff: %v", err)
+	}
+	if account := diff[dest]; account == nil || account.BalanceAfter.Cmp(big.NewInt(2000)) != 0 || account.BalanceBefore.Sign() != 0 {
+		t.Fatalf("unexpected destination diff: %+v", account)
+	}
+	if account := diff[addr]; account == nil || account.NonceBefore != 0 || account.NonceAfter != 2 {
+		t.Fatalf("unexpected sender diff: %+v", account)
+	}
+	// Forks must be isolated from each other
+	other, err := sim.Fork()
+	if err != nil {
+		t.Fatalf("failed to fork simulator: %v", err)
+	}
+	if balance := other.State().GetBalance(dest); balance.Sign() != 0 {
+		t.Fatalf("fork leaked state: balance %v", balance)
+	}
+	// Import a block and ensure the base state follows the head
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 1, func(i int, b *BlockGen) {
+		b.AddTx(transfer(0))
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	for i := 0; i < 100 && sim.Head().Hash() != blocks[0].Hash(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sim.Head().Hash() != blocks[0].Hash() {
+		t.Fatalf("simulator did not follow the head")
+	}
+	fork, err = sim.Fork()
+	if err != nil {
+		t.Fatalf("failed to fork simulator: %v", err)
+	}
+	if fork.Header().Number.Uint64() != 2 {
+		t.Fatalf("unexpected simulated block number: %d", fork.Header().Number)
+	}
+	if balance := fork.State().GetBalance(dest); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("unexpected base balance: %v", balance)
+	}
+	// Unsigned transactions are executed as sent by the given account
+	unsigned := types.NewTransaction(1, dest, big.NewInt(1000), params.TxGas, big.NewInt(1), nil)
+	if res, err := fork.ApplyMessage(addr, unsigned); err != nil || res.Receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("failed to apply unsigned transaction: %v", err)
+	}
+	if _, err := fork.ApplyMessage(addr, unsigned); err == nil {
+		t.Fatalf("stale nonce accepted from unsigned transaction")
+	}
+	if balance := fork.State().GetBalance(dest); balance.Cmp(big.NewInt(2000)) != 0 {
+		t.Fatalf("unexpected balance after unsigned transaction: %v", balance)
+	}
+}
+
+// Tests that a fork aborts transactions once the context is done and limits
+// the gas of the transactions applied to it.
+func TestSimulatorForkLimits(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		loop   = common.Address{0x10, 0x0f}
+		signer = types.HomesteadSigner{}
+		db     = rawdb.NewMemoryDatabase()
+		gspec  = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{
+			addr: {Balance: big.NewInt(params.Ether)},
+			loop: {Balance: big.NewInt(0), Code: hexutil.MustDecode("0x5b600056")}, // JUMPDEST PUSH1 0 JUMP
+		}}
+	)
+	gspec.MustCommit(db)
+	chain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	sim := NewSimulator(chain, vm.Config{})
+	defer sim.Stop()
+
+	fork, err := sim.Fork()
+	if err != nil {
+		t.Fatalf("failed to fork simulator: %v", err)
+	}
+	// An endless loop is aborted by the deadline, not by running out of gas
+	tx, _ := types.SignTx(types.NewTransaction(0, loop, new(big.Int), 1000000000, big.NewInt(1), nil), signer, key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := fork.ApplyTransactionContext(ctx, tx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("execution not aborted in time: %v", elapsed)
+	}
+	if nonce := fork.State().GetNonce(addr); nonce != 0 || fork.Header().GasUsed != 0 {
+		t.Fatalf("aborted transaction applied: nonce %d, gas used %d", nonce, fork.Header().GasUsed)
+	}
+	// Transactions beyond the gas limit are refused
+	fork.LimitGas(params.TxGas)
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{0xde, 0xad}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+		_, err := fork.ApplyTransaction(tx)
+		if nonce == 0 && err != nil {
+			t.Fatalf("failed to apply transaction within the limit: %v", err)
+		}
+		if nonce == 1 && !errors.Is(err, ErrGasLimitReached) {
+			t.Fatalf("error mismatch: have %v, want %v", err, ErrGasLimitReached)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// onlinePruneBatchSize is the maximum number of stale entries deleted by
+	// the online pruner in one go, before yielding to the chain again.
+	onlinePruneBatchSize = 4096
+
+	// onlinePruneRetryDelay is the time to wait before retrying a pruning round
+	// which couldn't be started or failed midway.
+	onlinePruneRetryDelay = time.Minute
+)
+
+var (
+	// errPruningAborted is returned if the pruning was interrupted by a shutdown.
+	errPruningAborted = errors.New("pruning aborted")
+
+	onlinePruneNodesMeter = metrics.NewRegisteredMeter("state/prune/online/nodes", nil)
+	onlinePruneSizeMeter  = metrics.NewRegisteredMeter("state/prune/online/size", nil)
+)
+
+// OnlineConfig contains the settings of the online state pruner.
+type OnlineConfig struct {
+	BloomSize uint64        // Megabytes of memory allocated to the bloom filter of a round
+	Throttle  time.Duration // Pause between two deletion batches
+	Interval  time.Duration // Pause between two pruning rounds
+}
+
+// DefaultOnlineConfig contains the default settings of the online state pruner.
+var DefaultOnlineConfig = OnlineConfig{
+	BloomSize: 2048,
+	Throttle:  100 * time.Millisecond,
+	Interval:  24 * time.Hour,
+}
+
+// OnlinePruner is the in-process counterpart of Pruner, deleting the stale
+// state while the node keeps importing blocks. It works in rounds:
+//
+//   - all the trie nodes persisted by the trie database while the round runs are
+//     marked in a bloom filter, so resurrected nodes can never be deleted
+//   - the most recent snapshot layer whose state is fully persisted is picked as
+//     the base, persisting the head state if there is none
+//   - the diff layers on top of the base are marked by proving the paths of all
+//     the accounts and storage slots they modify, before they are flattened
+//   - all the trie nodes and codes of the base are marked
+//   - the database is swept in small batches, deleting unmarked trie nodes and
+//     persisting the sweep position, so that the round resumes after a restart
+//
+// Contract codes with the new key scheme are never deleted, since they are
+// written outside of the trie database.
+type OnlinePruner struct {
+	config OnlineConfig
+	db     ethdb.Database
+	chain  *core.BlockChain
+	triedb *trie.Database
+
+	bloom *stateBloom // Live state filter of the running round, nil between rounds
+	lock  sync.Mutex  // Lock serializing node resurrection and deletion batches
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewOnlinePruner creates an online state pruner operating on the state of the
+// given chain. The chain must maintain a snapshot.
+func NewOnlinePruner(db ethdb.Database, chain *core.BlockChain, config OnlineConfig) (*OnlinePruner, error) {
+	if chain.Snapshots() == nil {
+		return nil, errors.New("online pruning requires the snapshot")
+	}
+	// Sanitize the bloom filter size if it's too small.
+	if config.BloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", config.BloomSize, "updated(MB)", 256)
+		config.BloomSize = 256
+	}
+	return &OnlinePruner{
+		config: config,
+		db:     db,
+		chain:  chain,
+		triedb: chain.StateCache().TrieDB(),
+		quit:   make(chan struct{}),
+	}, nil
+}
+
+// Start hooks the pruner into the trie database and starts pruning rounds in
+// the background.
+func (p *OnlinePruner) Start() {
+	p.triedb.SetWriteHook(p.resurrect)
+
+	p.wg.Add(1)
+	go p.loop()
+}
+
+// Stop terminates the pruner. An interrupted round resumes sweeping from the
+// last persisted position on the next start.
+func (p *OnlinePruner) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+
+	p.triedb.SetWriteHook(nil)
+}
+
+// resurrect marks a trie node persisted by the trie database as live, so the
+// running round doesn't delete it.
+func (p *OnlinePruner) resurrect(hash common.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.bloom != nil {
+		p.bloom.Put(hash.Bytes(), nil)
+	}
+}
+
+// loop runs the pruning rounds until the pruner is stopped.
+func (p *OnlinePruner) loop() {
+	defer p.wg.Done()
+
+	for {
+		wait := p.config.Interval
+		if err := p.prune(); err != nil {
+			if err == errPruningAborted {
+				return
+			}
+			log.Warn("Online state pruning failed", "err", err)
+			wait = onlinePruneRetryDelay
+		}
+		select {
+		case <-time.After(wait):
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// prune runs a single pruning round.
+func (p *OnlinePruner) prune() error {
+	// Snapshot generation proves its ranges against the state of the disk layer,
+	// which might be older than the base, don't interfere with it.
+	snaptree := p.chain.Snapshots()
+	it, err := snaptree.AccountIterator(snaptree.DiskRoot(), common.Hash{})
+	if err != nil {
+		return err
+	}
+	it.Release()
+
+	bloom, err := newStateBloomWithSize(p.config.BloomSize)
+	if err != nil {
+		return err
+	}
+	// Start tracking the persisted nodes before picking the base, any node written
+	// afterwards might be referenced by the layers above it or the upcoming blocks.
+	p.lock.Lock()
+	p.bloom = bloom
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		p.bloom = nil
+		p.lock.Unlock()
+	}()
+	layers, base, err := p.base(snaptree)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := p.mark(layers, base, bloom); err != nil {
+		return err
+	}
+	if err := extractGenesis(p.db, bloom); err != nil {
+		return err
+	}
+	log.Info("Marked live state for online pruning", "elapsed", common.PrettyDuration(time.Since(start)))
+
+	return p.sweep(bloom, start)
+}
+
+// base retrieves all snapshot layers from the disk layer up to the chain head,
+// along with the index of the most recent one with fully persisted state. If
+// none of them has, the state of the head layer is persisted.
+func (p *OnlinePruner) base(snaptree *snapshot.Tree) ([]snapshot.Snapshot, int, error) {
+	// The snapshot tree maintains one more diff layer than its cap on top of the
+	// disk layer, retrieve all of them.
+	layers := snaptree.Snapshots(p.chain.CurrentBlock().Root(), snaptree.CapLimit()+2, false)
+	if len(layers) == 0 {
+		return nil, 0, errors.New("head snapshot missing")
+	}
+	// Tries are persisted bottom up, so the presence of the root indicates the
+	// presence of the entire trie.
+	for i, layer := range layers {
+		if blob := rawdb.ReadTrieNode(p.db, layer.Root()); len(blob) != 0 {
+			return layers, i, nil
+		}
+	}
+	// The chain only persists a whole trie every once in a while, far below the
+	// head, and the layer it belongs to is flattened soon after. Persist the
+	// head state instead, its layer is the last one to be flattened.
+	root := layers[0].Root()
+	if err := p.chain.CommitState(root); err != nil {
+		return nil, 0, err
+	}
+	if blob := rawdb.ReadTrieNode(p.db, root); len(blob) == 0 {
+		return nil, 0, errors.New("no snapshot paired state")
+	}
+	log.Info("Persisted state for online pruning", "root", root)
+	return layers, 0, nil
+}
+
+// mark commits the state of the snapshot layers from the persisted base up to
+// the chain head into the given bloom filter.
+func (p *OnlinePruner) mark(layers []snapshot.Snapshot, base int, bloom *stateBloom) error {
+	log.Info("Marking live state for online pruning", "root", layers[base].Root(), "depth", base)
+
+	// The tries of the layers above the base only differ from their parents on
+	// the paths they modify. Mark them first, the bottom ones are flattened as
+	// the chain progresses. A flattened layer can't tell its paths anymore, and
+	// nodes flushed before the round started would go unmarked, so the round
+	// has to be retried.
+	for i := base - 1; i >= 0; i-- {
+		if err := p.markDiff(layers[i], bloom); err != nil {
+			return fmt.Errorf("failed to mark layer %x: %v", layers[i].Root(), err)
+		}
+	}
+	return extractState(p.db, layers[base].Root(), bloom, p.quit)
+}
+
+// markDiff commits the trie nodes along the paths modified by the given diff
+// layer into the bloom filter.
+func (p *OnlinePruner) markDiff(layer snapshot.Snapshot, bloom *stateBloom) error {
+	diff, ok := layer.(interface {
+		AccountList() []common.Hash
+		StorageList(accountHash common.Hash) ([]common.Hash, bool)
+		Stale() bool
+	})
+	if !ok {
+		return errors.New("not a diff layer")
+	}
+	accTrie, err := trie.New(layer.Root(), p.triedb)
+	if err != nil {
+		return err
+	}
+	for _, accHash := range diff.AccountList() {
+		if err := accTrie.Prove(accHash.Bytes(), 0, bloom); err != nil {
+			return err
+		}
+		acc, err := layer.Account(accHash)
+		if err != nil {
+			return err
+		}
+		if acc == nil {
+			continue // Deleted account
+		}
+		if len(acc.CodeHash) != 0 && !bytes.Equal(acc.CodeHash, emptyCode) {
+			bloom.Put(acc.CodeHash, nil)
+		}
+		slots, _ := diff.StorageList(accHash)
+		if len(slots) == 0 {
+			continue
+		}
+		storageTrie, err := trie.New(common.BytesToHash(acc.Root), p.triedb)
+		if err != nil {
+			return err
+		}
+		for _, slot := range slots {
+			if err := storageTrie.Prove(slot.Bytes(), 0, bloom); err != nil {
+				return err
+			}
+		}
+	}
+	// The layer might have been flattened into while being marked
+	if diff.Stale() {
+		return snapshot.ErrSnapshotStale
+	}
+	return nil
+}
+
+// sweep deletes all the trie nodes not marked in the bloom filter, resuming
+// from the position persisted by an interrupted round.
+func (p *OnlinePruner) sweep(bloom *stateBloom, start time.Time) error {
+	var (
+		count  int
+		size   common.StorageSize
+		logged = time.Now()
+		keys   [][]byte
+		sizes  []common.StorageSize
+		marker = rawdb.ReadOnlinePruningMarker(p.db)
+		iter   = p.db.NewIterator(nil, marker)
+	)
+	if len(marker) > 0 {
+		log.Info("Resuming online state pruning", "marker", common.BytesToHash(marker))
+	}
+	defer func() { iter.Release() }()
+
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if ok, _ := bloom.Contain(key); ok {
+			continue
+		}
+		keys = append(keys, common.CopyBytes(key))
+		sizes = append(sizes, common.StorageSize(len(key)+len(iter.Value())))
+		if len(keys) < onlinePruneBatchSize {
+			continue
+		}
+		// Release the iterator while deleting to allow the compactor to drop
+		// the entries, and yield to the chain for a while.
+		iter.Release()
+
+		n, s := p.delete(bloom, keys, sizes)
+		count, size = count+n, size+s
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		select {
+		case <-time.After(p.config.Throttle):
+		case <-p.quit:
+			return errPruningAborted
+		}
+		iter = p.db.NewIterator(nil, keys[len(keys)-1])
+		keys, sizes = keys[:0], sizes[:0]
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	n, s := p.delete(bloom, keys, sizes)
+	count, size = count+n, size+s
+
+	rawdb.DeleteOnlinePruningMarker(p.db)
+	log.Info("Online state pruning successful", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// delete removes the given trie nodes from the database, skipping the ones
+// resurrected since they were collected, and persists the sweep position.
+func (p *OnlinePruner) delete(bloom *stateBloom, keys [][]byte, sizes []common.StorageSize) (int, common.StorageSize) {
+	if len(keys) == 0 {
+		return 0, 0
+	}
+	// The deletion must not interleave with the resurrection of a node, otherwise
+	// a node flushed between the check and the write would be lost.
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var (
+		batch = p.db.NewBatch()
+		count int
+		size  common.StorageSize
+	)
+	for i, key := range keys {
+		if ok, _ := bloom.Contain(key); ok {
+			continue
+		}
+		batch.Delete(key)
+		count++
+		size += sizes[i]
+	}
+	rawdb.WriteOnlinePruningMarker(batch, keys[len(keys)-1])
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to delete stale state", "err", err)
+	}
+	for _, key := range keys {
+		p.triedb.EvictClean(common.BytesToHash(key))
+	}
+	onlinePruneNodesMeter.Mark(int64(count))
+	onlinePruneSizeMeter.Mark(int64(size))
+	return count, size
+}
+
+// RecoverOnlinePruning drops the clean trie cache journal if the online pruner
+// was interrupted midway, since it might reference already deleted nodes.
+func RecoverOnlinePruning(db ethdb.Database, trieCachePath string) {
+	if rawdb.ReadOnlinePruningMarker(db) != nil {
+		deleteCleanTrieCache(trieCachePath)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+func TestOnlinePruning(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		db      = rawdb.NewMemoryDatabase()
+		gendb   = rawdb.NewMemoryDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{addr: {Balance: big.NewInt(1000000000000000000)}}}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.HomesteadSigner{}
+	)
+	gspec.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), gendb, 10, func(i int, block *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		block.AddTx(tx)
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Persist two states, the older one becomes stale and the newer one is the
+	// base the layers on top are built upon.
+	triedb := chain.StateCache().TrieDB()
+	stale, base := blocks[2].Root(), blocks[5].Root()
+	for _, root := range []common.Hash{stale, base} {
+		if err := triedb.Commit(root, false, nil); err != nil {
+			t.Fatalf("failed to commit state %x: %v", root, err)
+		}
+	}
+	config := OnlineConfig{BloomSize: 256}
+	pruner, err := NewOnlinePruner(db, chain, config)
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	// An interrupted round resumes from the persisted position
+	rawdb.WriteOnlinePruningMarker(db, bytes.Repeat([]byte{0xff}, common.HashLength))
+	if err := pruner.prune(); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if len(rawdb.ReadTrieNode(db, stale)) == 0 {
+		t.Fatalf("state before the resume position pruned")
+	}
+	if rawdb.ReadOnlinePruningMarker(db) != nil {
+		t.Fatalf("pruning marker not deleted")
+	}
+	// A full round deletes the stale state only
+	if err := pruner.prune(); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if len(rawdb.ReadTrieNode(db, stale)) != 0 {
+		t.Fatalf("stale state not pruned")
+	}
+	if len(rawdb.ReadTrieNode(db, base)) == 0 {
+		t.Fatalf("base state pruned")
+	}
+	// Nodes persisted while pruning are marked live, and the head state is
+	// complete once flushed on top of the pruned database.
+	bloom, _ := newStateBloomWithSize(256)
+	pruner.bloom = bloom
+	triedb.SetWriteHook(pruner.resurrect)
+
+	head := chain.CurrentBlock().Root()
+	if err := triedb.Commit(head, false, nil); err != nil {
+		t.Fatalf("failed to commit head state: %v", err)
+	}
+	if ok, _ := bloom.Contain(head.Bytes()); !ok {
+		t.Fatalf("persisted node not marked")
+	}
+	if err := extractState(db, head, bloom, nil); err != nil {
+		t.Fatalf("head state incomplete: %v", err)
+	}
+	if extractState(db, stale, bloom, nil) == nil {
+		t.Fatalf("stale state still complete")
+	}
+}
+
+// Tests that a round finds a base on a live chain, where the persisted tries
+// are too old to pair with any snapshot layer.
+func TestOnlinePruningUnpairedState(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		db      = rawdb.NewMemoryDatabase()
+		gendb   = rawdb.NewMemoryDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{addr: {Balance: big.NewInt(1000000000000000000)}}}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.HomesteadSigner{}
+	)
+	gspec.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Import more blocks than the snapshot tree keeps layers, so that the disk
+	// layer moves past the genesis state.
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), gendb, 160, func(i int, block *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		block.AddTx(tx)
+	})
+	if _, err := chain.InsertChain(blocks[:150]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	snaptree := chain.Snapshots()
+	for _, layer := range snaptree.Snapshots(chain.CurrentBlock().Root(), snaptree.CapLimit()+2, false) {
+		if len(rawdb.ReadTrieNode(db, layer.Root())) != 0 {
+			t.Fatalf("state of layer %x persisted", layer.Root())
+		}
+	}
+	stale := common.Hash{0xde, 0xad}
+	rawdb.WriteTrieNode(db, stale, []byte{0xc0})
+
+	pruner, err := NewOnlinePruner(db, chain, OnlineConfig{BloomSize: 256})
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if err := pruner.prune(); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if len(rawdb.ReadTrieNode(db, stale)) != 0 {
+		t.Fatalf("stale node not pruned")
+	}
+	bloom, _ := newStateBloomWithSize(256)
+	if err := extractState(db, chain.CurrentBlock().Root(), bloom, nil); err != nil {
+		t.Fatalf("head state incomplete: %v", err)
+	}
+	// The chain keeps importing on top of the pruned state
+	if _, err := chain.InsertChain(blocks[150:]); err != nil {
+		t.Fatalf("failed to insert chain after pruning: %v", err)
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	if nonce := statedb.GetNonce(addr); nonce != uint64(len(blocks)) {
+		t.Fatalf("nonce mismatch: have %d, want %d", nonce, len(blocks))
+	}
+}
+
+// Tests that a round never deletes the nodes of the layers above the base which
+// were flushed before it started, even if the layers are flattened meanwhile.
+func TestOnlinePruningFlattenedLayers(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		db      = rawdb.NewMemoryDatabase()
+		gendb   = rawdb.NewMemoryDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{addr: {Balance: big.NewInt(1000000000000000000)}}}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.HomesteadSigner{}
+	)
+	gspec.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// The first block creates all the accounts, so that the leaves of the ones
+	// it doesn't modify later are shared with the head.
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), gendb, 10, func(i int, block *core.BlockGen) {
+		for _, to := range []common.Address{{0x01}, {0x02}} {
+			if i > 0 && to == (common.Address{0x01}) {
+				continue
+			}
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(addr), to, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+			block.AddTx(tx)
+		}
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Flush the oldest dirty nodes one by one, until a node of the trie of the
+	// first block still referenced by the head is persisted. The genesis state
+	// remains the base.
+	triedb := chain.StateCache().TrieDB()
+	nodes := func(root common.Hash) map[common.Hash]bool {
+		tr, err := trie.New(root, triedb)
+		if err != nil {
+			t.Fatalf("failed to open state %x: %v", root, err)
+		}
+		hashes := make(map[common.Hash]bool)
+		for it := tr.NodeIterator(nil); it.Next(true); {
+			hashes[it.Hash()] = true
+		}
+		return hashes
+	}
+	var (
+		dirty []common.Hash
+		live  = nodes(chain.CurrentBlock().Root())
+	)
+	for hash := range nodes(blocks[0].Root()) {
+		if hash != (common.Hash{}) && hash != blocks[0].Root() && live[hash] && len(rawdb.ReadTrieNode(db, hash)) == 0 {
+			dirty = append(dirty, hash)
+		}
+	}
+	if len(dirty) == 0 {
+		t.Fatalf("no node of the first block referenced by the head")
+	}
+	persisted := func() bool {
+		for _, hash := range dirty {
+			if len(rawdb.ReadTrieNode(db, hash)) != 0 {
+				return true
+			}
+		}
+		return false
+	}
+	for limit := common.StorageSize(1024 * 1024); !persisted(); limit -= 32 {
+		if limit <= 0 {
+			t.Fatalf("live node of the first block not flushed")
+		}
+		if err := triedb.Cap(limit); err != nil {
+			t.Fatalf("failed to flush state: %v", err)
+		}
+	}
+	if len(rawdb.ReadTrieNode(db, blocks[0].Root())) != 0 {
+		t.Fatalf("state of the first block persisted")
+	}
+	pruner, err := NewOnlinePruner(db, chain, OnlineConfig{BloomSize: 256})
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	snaptree := chain.Snapshots()
+	layers, base, err := pruner.base(snaptree)
+	if err != nil {
+		t.Fatalf("failed to pick base: %v", err)
+	}
+	if layers[base].Root() != genesis.Root() {
+		t.Fatalf("base mismatch: have %x, want %x", layers[base].Root(), genesis.Root())
+	}
+	// The layer of the first block is flattened into while marking, which aborts
+	// the round
+	if err := snaptree.Cap(chain.CurrentBlock().Root(), 8); err != nil {
+		t.Fatalf("failed to flatten layers: %v", err)
+	}
+	bloom, _ := newStateBloomWithSize(256)
+	if err := pruner.mark(layers, base, bloom); err == nil {
+		t.Fatalf("flattened layer marked")
+	}
+	// The next round keeps the flushed nodes, the head state is complete once
+	// flushed on top of the pruned database.
+	if err := pruner.prune(); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if !persisted() {
+		t.Fatalf("flushed live node of the first block pruned")
+	}
+	head := chain.CurrentBlock().Root()
+	if err := triedb.Commit(head, false, nil); err != nil {
+		t.Fatalf("failed to commit head state: %v", err)
+	}
+	bloom, _ = newStateBloomWithSize(256)
+	if err := extractState(db, head, bloom, nil); err != nil {
+		t.Fatalf("head state incomplete: %v", err)
+	}
+}
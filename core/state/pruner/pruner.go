@@ -633,7 +633,14 @@ func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
 	if genesis == nil {
 		return errors.New("missing genesis block")
 	}
-	t, err := trie.NewSecure(genesis.Root(), trie.NewDatabase(db))
+	return extractState(db, genesis.Root(), stateBloom, nil)
+}
+
+// extractState traverses the state with the given root and commits all the
+// trie nodes and contract codes into the given bloomfilter. The traversal is
+// aborted once the abort channel is closed.
+func extractState(db ethdb.Database, root common.Hash, stateBloom *stateBloom, abort chan struct{}) error {
+	t, err := trie.NewSecure(root, trie.NewDatabase(db))
 	if err != nil {
 		return err
 	}
@@ -648,6 +655,11 @@ func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
 		// If it's a leaf node, yes we are touching an account,
 		// dig into the storage trie further.
 		if accIter.Leaf() {
+			select {
+			case <-abort:
+				return errPruningAborted
+			default:
+			}
 			var acc state.Account
 			if err := rlp.DecodeBytes(accIter.LeafBlob(), &acc); err != nil {
 				return err
@@ -0,0 +1,231 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ReadWriteSet records the state read and written while executing transactions,
+// allowing transactions executed speculatively on a copy of the state to be
+// checked for conflicts and merged back.
+//
+// Reads are tracked at account granularity for the balance, nonce, code and
+// existence of an account, and at slot granularity for the storage. Accessing
+// the storage of an account reads its existence too. Accounts only credited
+// through AddBalance are not read, so that the fee recipient paid by every
+// transaction doesn't make them conflict; the credits are merged as deltas.
+type ReadWriteSet struct {
+	accounts map[common.Address]struct{}                 // Accounts read
+	slots    map[common.Address]map[common.Hash]struct{} // Storage slots read
+	credited map[common.Address]*big.Int                 // Balances of unread accounts before their first credit
+	replaced map[common.Address]*StateObject             // State objects before the accounts were first (re)created
+	writes   map[common.Address]*accountWrite            // Final state of the accounts written
+}
+
+// accountWrite is the state of an account written by the transactions, as of
+// the last finalisation.
+type accountWrite struct {
+	created bool // Whether the account was (re)created, dropping its storage
+	deleted bool // Whether the account was self-destructed or deleted as empty
+
+	nonce    uint64
+	balance  *big.Int
+	codeHash []byte
+	code     []byte // Non-nil only if the code was updated
+	storage  map[common.Hash]common.Hash
+}
+
+func newReadWriteSet() *ReadWriteSet {
+	return &ReadWriteSet{
+		accounts: make(map[common.Address]struct{}),
+		slots:    make(map[common.Address]map[common.Hash]struct{}),
+		credited: make(map[common.Address]*big.Int),
+		replaced: make(map[common.Address]*StateObject),
+		writes:   make(map[common.Address]*accountWrite),
+	}
+}
+
+// readAccount marks the balance, nonce, code and existence of an account read.
+func (rw *ReadWriteSet) readAccount(addr common.Address) {
+	rw.accounts[addr] = struct{}{}
+}
+
+// readSlot marks a storage slot, as well as the existence of its account, read.
+func (rw *ReadWriteSet) readSlot(addr common.Address, key common.Hash) {
+	rw.accounts[addr] = struct{}{}
+
+	slots := rw.slots[addr]
+	if slots == nil {
+		slots = make(map[common.Hash]struct{})
+		rw.slots[addr] = slots
+	}
+	slots[key] = struct{}{}
+}
+
+// credit tracks the balance of an account about to be credited, unless it was
+// already read or credited before.
+func (rw *ReadWriteSet) credit(addr common.Address, balance *big.Int) {
+	if _, ok := rw.accounts[addr]; ok {
+		return
+	}
+	if _, ok := rw.credited[addr]; !ok {
+		rw.credited[addr] = new(big.Int).Set(balance)
+	}
+}
+
+// replace tracks the state object of an account about to be (re)created, unless
+// it was already replaced before.
+func (rw *ReadWriteSet) replace(addr common.Address, prev *StateObject) {
+	if _, ok := rw.replaced[addr]; !ok {
+		rw.replaced[addr] = prev
+	}
+}
+
+// write records the state of an account modified since the last finalisation.
+// It must be called before the dirty storage of the object is finalised.
+func (rw *ReadWriteSet) write(obj *StateObject) {
+	w := rw.writes[obj.address]
+	if w == nil {
+		w = &accountWrite{storage: make(map[common.Hash]common.Hash)}
+		rw.writes[obj.address] = w
+	}
+	// Reverted recreations restore the previous object, so only an object other
+	// than the original one means the account was recreated.
+	if prev, ok := rw.replaced[obj.address]; ok && prev != obj {
+		w.created = true
+	}
+	w.deleted = obj.deleted
+	w.nonce = obj.data.Nonce
+	w.balance = new(big.Int).Set(obj.data.Balance)
+	w.codeHash = common.CopyBytes(obj.data.CodeHash)
+	if obj.dirtyCode {
+		w.code = common.CopyBytes(obj.code)
+	}
+	for key, value := range obj.dirtyStorage {
+		w.storage[key] = value
+	}
+}
+
+// Conflicts reports whether any of the state read was written by the given set
+// of transactions.
+func (rw *ReadWriteSet) Conflicts(written *WriteSet) bool {
+	for addr := range rw.accounts {
+		if _, ok := written.accounts[addr]; ok {
+			return true
+		}
+	}
+	for addr, slots := range rw.slots {
+		if dirty := written.slots[addr]; len(dirty) > 0 {
+			for key := range slots {
+				if _, ok := dirty[key]; ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// WriteSet accumulates the state written by a sequence of transactions.
+type WriteSet struct {
+	accounts map[common.Address]struct{}
+	slots    map[common.Address]map[common.Hash]struct{}
+}
+
+// NewWriteSet creates an empty write set.
+func NewWriteSet() *WriteSet {
+	return &WriteSet{
+		accounts: make(map[common.Address]struct{}),
+		slots:    make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// Add marks the state written by the given transactions written.
+func (w *WriteSet) Add(rw *ReadWriteSet) {
+	for addr, write := range rw.writes {
+		w.accounts[addr] = struct{}{}
+		if len(write.storage) == 0 {
+			continue
+		}
+		slots := w.slots[addr]
+		if slots == nil {
+			slots = make(map[common.Hash]struct{})
+			w.slots[addr] = slots
+		}
+		for key := range write.storage {
+			slots[key] = struct{}{}
+		}
+	}
+}
+
+// StartReadWriteSet starts recording the state read and written, until the set
+// is retrieved by StopReadWriteSet. Only the writes finalised are recorded.
+func (s *StateDB) StartReadWriteSet() {
+	s.rwSet = newReadWriteSet()
+}
+
+// StopReadWriteSet stops recording the state accessed and returns it.
+func (s *StateDB) StopReadWriteSet() *ReadWriteSet {
+	rw := s.rwSet
+	s.rwSet = nil
+	return rw
+}
+
+// ApplyReadWriteSet applies the writes of transactions executed on another copy
+// of the state. It must be called between transactions, and the writes are
+// finalised with the next call to Finalise.
+//
+// The outcome is the same as executing the transactions on this state, given
+// that nothing they read was modified between the two copies. The balances of
+// accounts only credited are increased by the credits, the other accounts are
+// overwritten.
+func (s *StateDB) ApplyReadWriteSet(rw *ReadWriteSet) {
+	for addr, w := range rw.writes {
+		if _, read := rw.accounts[addr]; !read {
+			balance, origin := w.balance, rw.credited[addr]
+			if w.deleted {
+				balance = common.Big0
+			}
+			if origin == nil {
+				origin = common.Big0
+			}
+			s.AddBalance(addr, new(big.Int).Sub(balance, origin))
+			continue
+		}
+		var obj *StateObject
+		if w.created {
+			obj, _ = s.createObject(addr)
+		} else {
+			obj = s.GetOrNewStateObject(addr)
+		}
+		if w.deleted {
+			s.Suicide(addr)
+			continue
+		}
+		obj.SetNonce(w.nonce)
+		obj.SetBalance(w.balance)
+		if w.code != nil {
+			obj.SetCode(common.BytesToHash(w.codeHash), w.code)
+		}
+		for key, value := range w.storage {
+			obj.SetState(s.db, key, value)
+		}
+	}
+}
@@ -124,6 +124,9 @@ type StateDB struct {
 	// Per-transaction access list
 	accessList *accessList
 
+	// State read and written, recorded for speculative execution
+	rwSet *ReadWriteSet
+
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
 	journal        *journal
@@ -345,18 +348,27 @@ func (s *StateDB) SubRefund(gas uint64) {
 // Exist reports whether the given account address exists in the state.
 // Notably this also returns true for suicided accounts.
 func (s *StateDB) Exist(addr common.Address) bool {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	return s.getStateObject(addr) != nil
 }
 
 // Empty returns whether the state object is either non-existent
 // or empty according to the EIP161 specification (balance = nonce = code = 0)
 func (s *StateDB) Empty(addr common.Address) bool {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	so := s.getStateObject(addr)
 	return so == nil || so.empty()
 }
 
 // GetBalance retrieves the balance from the given address or 0 if object not found
 func (s *StateDB) GetBalance(addr common.Address) *big.Int {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.Balance()
@@ -365,6 +377,9 @@ func (s *StateDB) GetBalance(addr common.Address) *big.Int {
 }
 
 func (s *StateDB) GetNonce(addr common.Address) uint64 {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.Nonce()
@@ -378,12 +393,20 @@ func (s *StateDB) TxIndex() int {
 	return s.txIndex
 }
 
+// TxHash returns the current transaction hash set by Prepare.
+func (s *StateDB) TxHash() common.Hash {
+	return s.thash
+}
+
 // BlockHash returns the current block hash set by Prepare.
 func (s *StateDB) BlockHash() common.Hash {
 	return s.bhash
 }
 
 func (s *StateDB) GetCode(addr common.Address) []byte {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.Code(s.db)
@@ -392,6 +415,9 @@ func (s *StateDB) GetCode(addr common.Address) []byte {
 }
 
 func (s *StateDB) GetCodeSize(addr common.Address) int {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.CodeSize(s.db)
@@ -400,6 +426,9 @@ func (s *StateDB) GetCodeSize(addr common.Address) int {
 }
 
 func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject == nil {
 		return common.Hash{}
@@ -409,6 +438,9 @@ func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
 
 // GetState retrieves a value from the given account's storage trie.
 func (s *StateDB) GetState(addr common.Address, hash common.Hash) common.Hash {
+	if s.rwSet != nil {
+		s.rwSet.readSlot(addr, hash)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.GetState(s.db, hash)
@@ -455,6 +487,9 @@ func (s *StateDB) GetStorageProofByHash(a common.Address, key common.Hash) ([][]
 
 // GetCommittedState retrieves a value from the given account's committed storage trie.
 func (s *StateDB) GetCommittedState(addr common.Address, hash common.Hash) common.Hash {
+	if s.rwSet != nil {
+		s.rwSet.readSlot(addr, hash)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.GetCommittedState(s.db, hash)
@@ -480,6 +515,9 @@ func (s *StateDB) StorageTrie(addr common.Address) Trie {
 }
 
 func (s *StateDB) HasSuicided(addr common.Address) bool {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.suicided
@@ -495,12 +533,18 @@ func (s *StateDB) HasSuicided(addr common.Address) bool {
 func (s *StateDB) AddBalance(addr common.Address, amount *big.Int) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
+		if s.rwSet != nil {
+			s.rwSet.credit(addr, stateObject.Balance())
+		}
 		stateObject.AddBalance(amount)
 	}
 }
 
 // SubBalance subtracts amount from the account associated with addr.
 func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SubBalance(amount)
@@ -508,6 +552,9 @@ func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
 }
 
 func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetBalance(amount)
@@ -515,6 +562,9 @@ func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
 }
 
 func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetNonce(nonce)
@@ -522,6 +572,9 @@ func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
 }
 
 func (s *StateDB) SetCode(addr common.Address, code []byte) {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetCode(crypto.Keccak256Hash(code), code)
@@ -529,6 +582,9 @@ func (s *StateDB) SetCode(addr common.Address, code []byte) {
 }
 
 func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
+	if s.rwSet != nil {
+		s.rwSet.readSlot(addr, key)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetState(s.db, key, value)
@@ -538,6 +594,9 @@ func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
 // SetStorage replaces the entire storage for the specified account with given
 // storage. This function should only be used for debugging.
 func (s *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetStorage(storage)
@@ -550,6 +609,9 @@ func (s *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common
 // The account's state object is still available until the state is committed,
 // getStateObject will return a non-nil account after Suicide.
 func (s *StateDB) Suicide(addr common.Address) bool {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	stateObject := s.getStateObject(addr)
 	if stateObject == nil {
 		return false
@@ -700,6 +762,9 @@ func (s *StateDB) GetOrNewStateObject(addr common.Address) *StateObject {
 // the given address, it is overwritten and returned as the second return value.
 func (s *StateDB) createObject(addr common.Address) (newobj, prev *StateObject) {
 	prev = s.getDeletedStateObject(addr) // Note, prev might have been deleted, we need that!
+	if s.rwSet != nil {
+		s.rwSet.replace(addr, prev)
+	}
 
 	var prevdestruct bool
 	if s.snap != nil && prev != nil {
@@ -733,6 +798,9 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *StateObject)
 //
 // Carrying over the balance ensures that Ether doesn't disappear.
 func (s *StateDB) CreateAccount(addr common.Address) {
+	if s.rwSet != nil {
+		s.rwSet.readAccount(addr)
+	}
 	newObj, prev := s.createObject(addr)
 	if prev != nil {
 		newObj.setBalance(prev.data.Balance)
@@ -939,7 +1007,13 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 				delete(s.snapAccounts, obj.address)       // Clear out any previously updated account data (may be recreated via a ressurrect)
 				delete(s.snapStorage, obj.address)        // Clear out any previously updated storage data (may be recreated via a ressurrect)
 			}
+			if s.rwSet != nil {
+				s.rwSet.write(obj)
+			}
 		} else {
+			if s.rwSet != nil {
+				s.rwSet.write(obj)
+			}
 			obj.finalise(true) // Prefetch slots in the background
 		}
 		if _, exist := s.stateObjectsPending[addr]; !exist {
@@ -1650,6 +1724,23 @@ func (s *StateDB) GetDirtyAccounts() []common.Address {
 	return accounts
 }
 
+// GetDirtyStorage returns the storage slots of the given account modified since
+// the state was opened, including the ones of already finalised transactions.
+func (s *StateDB) GetDirtyStorage(addr common.Address) map[common.Hash]common.Hash {
+	obj, exist := s.stateObjects[addr]
+	if !exist {
+		return nil
+	}
+	storage := make(map[common.Hash]common.Hash, len(obj.pendingStorage)+len(obj.dirtyStorage))
+	for key, value := range obj.pendingStorage {
+		storage[key] = value
+	}
+	for key, value := range obj.dirtyStorage {
+		storage[key] = value
+	}
+	return storage
+}
+
 func (s *StateDB) GetStorage(address common.Address) *sync.Map {
 	return s.storagePool.getStorage(address)
 }
@@ -17,8 +17,11 @@
 package core
 
 import (
+	"errors"
+	"sync"
 	"sync/atomic"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -29,6 +32,15 @@ import (
 const prefetchThread = 3
 const checkInterval = 10
 
+var (
+	// ErrPreExecutionMissing is returned if a transaction was not pre-executed.
+	ErrPreExecutionMissing = errors.New("transaction not pre-executed")
+
+	// ErrPreExecutionStale is returned if the state a pre-executed transaction
+	// read was modified since.
+	ErrPreExecutionStale = errors.New("pre-executed transaction stale")
+)
+
 // statePrefetcher is a basic Prefetcher, which blindly executes a block on top
 // of an arbitrary state with the goal of prefetching potentially useful state
 // data from disk before the main block processor start executing.
@@ -91,19 +103,25 @@ func (p *statePrefetcher) Prefetch(block *types.Block, statedb *state.StateDB, c
 }
 
 // PrefetchMining processes the state changes according to the Ethereum rules by running
-// the transaction messages using the statedb, but any changes are discarded. The
-// only goal is to pre-cache transaction signatures and snapshot clean state. Only used for mining stage
-func (p *statePrefetcher) PrefetchMining(txs *types.TransactionsByPriceAndNonce, header *types.Header, gasLimit uint64, statedb *state.StateDB, cfg vm.Config, interruptCh <-chan struct{}, txCurr **types.Transaction) {
+// the transaction messages using the statedb, pre-caching transaction signatures and
+// snapshot clean state. Only used for mining stage.
+//
+// Each transaction is executed on its own copy of the statedb, and if preExecuted is
+// not nil the results are kept in it for the miner to reuse the ones whose pre-state
+// is unchanged when it gets to them.
+func (p *statePrefetcher) PrefetchMining(txs *types.TransactionsByPriceAndNonce, header *types.Header, gasLimit uint64, statedb *state.StateDB, cfg vm.Config, interruptCh <-chan struct{}, txCurr **types.Transaction, preExecuted *PreExecutedTxs) {
 	var signer = types.MakeSigner(p.config, header.Number)
 
+	// Receipts before Byzantium require the intermediate state roots
+	if !p.config.IsByzantium(header.Number) {
+		preExecuted = nil
+	}
 	txCh := make(chan *types.Transaction, 2*prefetchThread)
 	for i := 0; i < prefetchThread; i++ {
 		go func(startCh <-chan *types.Transaction, stopCh <-chan struct{}) {
 			idx := 0
-			newStatedb := statedb.Copy()
-			newStatedb.EnableWriteOnSharedStorage()
-			gaspool := new(GasPool).AddGas(gasLimit)
-			blockContext := NewEVMBlockContext(header, p.bc, nil)
+			// The coinbase is not sealed in the header yet, take it as is
+			blockContext := NewEVMBlockContext(header, p.bc, &header.Coinbase)
 			evm := vm.NewEVM(blockContext, vm.TxContext{}, statedb, p.config, cfg)
 			// Iterate over and process the individual transactions
 			for {
@@ -115,9 +133,9 @@ func (p *statePrefetcher) PrefetchMining(txs *types.TransactionsByPriceAndNonce,
 						return // Also invalid block, bail out
 					}
 					idx++
-					newStatedb.Prepare(tx.Hash(), header.Hash(), idx)
-					precacheTransaction(msg, p.config, gaspool, newStatedb, header, evm)
-					gaspool = new(GasPool).AddGas(gasLimit)
+					spec := &speculativeTx{index: idx, tx: tx, msg: msg}
+					speculate(statedb, evm, gasLimit, spec)
+					preExecuted.add(spec)
 				case <-stopCh:
 					return
 				}
@@ -148,6 +166,55 @@ func (p *statePrefetcher) PrefetchMining(txs *types.TransactionsByPriceAndNonce,
 	}(txs)
 }
 
+// PreExecutedTxs holds the transactions executed ahead of time by PrefetchMining
+// on a copy of the pending state.
+type PreExecutedTxs struct {
+	txs  map[common.Hash]*speculativeTx
+	lock sync.Mutex
+}
+
+// NewPreExecutedTxs creates an empty set of pre-executed transactions.
+func NewPreExecutedTxs() *PreExecutedTxs {
+	return &PreExecutedTxs{txs: make(map[common.Hash]*speculativeTx)}
+}
+
+// add keeps the result of a pre-executed transaction, unless it failed.
+func (p *PreExecutedTxs) add(spec *speculativeTx) {
+	if p == nil || spec.err != nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.txs[spec.tx.Hash()] = spec
+}
+
+// Apply merges the result of a pre-executed transaction into the state, the same
+// way ApplyTransaction would execute it, and returns its receipt. The transaction
+// must read none of the written state, which Apply extends with its writes.
+//
+// ErrPreExecutionMissing is returned if the transaction wasn't pre-executed (yet),
+// ErrPreExecutionStale if its pre-state changed since. Either way the state is
+// untouched and the transaction has to be executed anew.
+func (p *PreExecutedTxs) Apply(statedb *state.StateDB, written *state.WriteSet, gp *GasPool, header *types.Header, tx *types.Transaction, usedGas *uint64, receiptProcessors ...ReceiptProcessor) (*types.Receipt, error) {
+	p.lock.Lock()
+	spec := p.txs[tx.Hash()]
+	delete(p.txs, tx.Hash())
+	p.lock.Unlock()
+
+	if spec == nil {
+		return nil, ErrPreExecutionMissing
+	}
+	// The nonce was not checked ahead of time, but the sender is unchanged if the
+	// transaction doesn't conflict.
+	if gp.Gas() < spec.msg.Gas() || spec.rwSet.Conflicts(written) || statedb.GetNonce(spec.msg.From()) != spec.msg.Nonce() {
+		return nil, ErrPreExecutionStale
+	}
+	receipt := applySpeculativeTx(spec, statedb, header, gp, usedGas, receiptProcessors...)
+	written.Add(spec.rwSet)
+	return receipt, nil
+}
+
 // precacheTransaction attempts to apply a transaction to the given state database
 // and uses the input parameters for its environment. The goal is not to execute
 // the transaction successfully, rather to warm up touched data slots.
@@ -0,0 +1,169 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the transactions pre-executed during mining are reused if their
+// pre-state is unchanged, with the same outcome as executing them anew.
+func TestPrefetchMiningReuse(t *testing.T) {
+	var (
+		signer   = types.LatestSigner(params.TestChainConfig)
+		coinbase = common.Address{0xcb}
+		counter  = common.Address{0xc1}
+		keys     = make([]*ecdsa.PrivateKey, 4)
+	)
+	alloc := GenesisAlloc{
+		counter: {Balance: big.NewInt(0), Code: hexutil.MustDecode("0x60005460010160005500")},
+	}
+	for i := range keys {
+		keys[i], _ = crypto.ToECDSA(common.BigToHash(big.NewInt(int64(i + 1))).Bytes())
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesis := (&Genesis{Config: params.TestChainConfig, GasLimit: 30000000, Alloc: alloc}).MustCommit(db)
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Transfers of distinct senders, a second transfer of one of them and calls
+	// to the counter, of which only the first one is independent.
+	sign := func(key *ecdsa.PrivateKey, nonce uint64, to common.Address, gasPrice int64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(1), 100000, big.NewInt(gasPrice), nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		return tx
+	}
+	var (
+		hits  = make(map[common.Hash]bool)
+		pools = make(map[common.Address]types.Transactions)
+	)
+	for i, key := range keys {
+		from := crypto.PubkeyToAddress(key.PublicKey)
+		if i < 2 {
+			tx := sign(key, 0, common.Address{0xee, byte(i)}, int64(10-i))
+			pools[from], hits[tx.Hash()] = append(pools[from], tx), true
+		} else {
+			tx := sign(key, 0, counter, int64(10-i))
+			pools[from], hits[tx.Hash()] = append(pools[from], tx), i == 2
+		}
+	}
+	from := crypto.PubkeyToAddress(keys[0].PublicKey)
+	pools[from] = append(pools[from], sign(keys[0], 1, common.Address{0xee, 0xff}, 10))
+
+	header := &types.Header{
+		ParentHash: genesis.Hash(),
+		Number:     big.NewInt(1),
+		GasLimit:   genesis.GasLimit(),
+		Time:       genesis.Time() + 10,
+		Difficulty: big.NewInt(1),
+		Coinbase:   coinbase,
+	}
+	base, _ := state.New(genesis.Root(), chain.StateCache(), nil)
+
+	// Pre-execute all the transactions and wait for them to finish
+	var (
+		preExecuted = NewPreExecutedTxs()
+		txs         = types.NewTransactionsByPriceAndNonce(signer, pools)
+		first       = txs.Peek()
+		interruptCh = make(chan struct{})
+	)
+	defer close(interruptCh)
+
+	NewStatePrefetcher(params.TestChainConfig, chain, chain.Engine()).PrefetchMining(txs.Copy(), header, header.GasLimit, base.Copy(), vm.Config{}, interruptCh, &first, preExecuted)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		preExecuted.lock.Lock()
+		done := len(preExecuted.txs) == len(hits)+1
+		preExecuted.lock.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transactions not pre-executed in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Commit the transactions reusing the pre-executed ones, and compare with
+	// executing all of them
+	var (
+		statedb = base.Copy()
+		serial  = base.Copy()
+		written = state.NewWriteSet()
+
+		gp, serialGp           = new(GasPool).AddGas(header.GasLimit), new(GasPool).AddGas(header.GasLimit)
+		usedGas, serialUsedGas uint64
+	)
+	for i := 0; ; i++ {
+		tx := txs.Peek()
+		if tx == nil {
+			break
+		}
+		txs.Shift()
+
+		statedb.Prepare(tx.Hash(), common.Hash{}, i)
+		have, err := preExecuted.Apply(statedb, written, gp, header, tx, &usedGas)
+		if hit := hits[tx.Hash()]; (err == nil) != hit {
+			t.Fatalf("tx %d: reuse mismatch: have %v, want hit %v", i, err, hit)
+		}
+		if err != nil {
+			if !errors.Is(err, ErrPreExecutionStale) {
+				t.Fatalf("tx %d: unexpected error: %v", i, err)
+			}
+			statedb.StartReadWriteSet()
+			have, err = ApplyTransaction(params.TestChainConfig, chain, &coinbase, gp, statedb, header, tx, &usedGas, vm.Config{})
+			if err != nil {
+				t.Fatalf("tx %d: failed to apply: %v", i, err)
+			}
+			written.Add(statedb.StopReadWriteSet())
+		}
+		serial.Prepare(tx.Hash(), common.Hash{}, i)
+		want, err := ApplyTransaction(params.TestChainConfig, chain, &coinbase, serialGp, serial, header, tx, &serialUsedGas, vm.Config{})
+		if err != nil {
+			t.Fatalf("tx %d: failed to apply serially: %v", i, err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("tx %d: receipt mismatch: have %+v, want %+v", i, have, want)
+		}
+	}
+	if have, want := statedb.IntermediateRoot(true), serial.IntermediateRoot(true); have != want {
+		t.Errorf("root mismatch: have %x, want %x", have, want)
+	}
+	if usedGas != serialUsedGas {
+		t.Errorf("gas mismatch: have %d, want %d", usedGas, serialUsedGas)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"math/big"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -39,6 +40,7 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 const (
@@ -46,6 +48,7 @@ const (
 	recentTime             = 1024 * 3
 	recentDiffLayerTimeout = 5
 	farDiffLayerTimeout    = 2
+	maxDiffVerifications   = 4 // Maximum number of light processed blocks re-executed concurrently
 )
 
 // StateProcessor is a basic Processor, which takes care of transitioning
@@ -68,7 +71,9 @@ func NewStateProcessor(config *params.ChainConfig, bc *BlockChain, engine consen
 }
 
 type LightStateProcessor struct {
-	check int64
+	check       int64
+	verifySlots chan struct{} // Semaphore limiting the background verifications
+	processed   uint64        // Number of blocks processed from their diff layer (atomic access)
 	StateProcessor
 }
 
@@ -77,10 +82,17 @@ func NewLightStateProcessor(config *params.ChainConfig, bc *BlockChain, engine c
 	check := randomGenerator.Int63n(fullProcessCheck)
 	return &LightStateProcessor{
 		check:          check,
+		verifySlots:    make(chan struct{}, maxDiffVerifications),
 		StateProcessor: *NewStateProcessor(config, bc, engine),
 	}
 }
 
+// LightProcessed returns the number of blocks processed from their diff layer
+// rather than executed.
+func (p *LightStateProcessor) LightProcessed() uint64 {
+	return atomic.LoadUint64(&p.processed)
+}
+
 func (p *LightStateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (*state.StateDB, types.Receipts, []*types.Log, uint64, error) {
 	allowLightProcess := true
 	if posa, ok := p.engine.(consensus.PoSA); ok {
@@ -115,6 +127,8 @@ func (p *LightStateProcessor) Process(block *types.Block, statedb *state.StateDB
 			receipts, logs, gasUsed, err := p.LightProcess(diffLayer, block, statedb)
 			if err == nil {
 				log.Info("do light process success at block", "num", block.NumberU64())
+				p.sampleVerification(block, diffLayer)
+				atomic.AddUint64(&p.processed, 1)
 				return statedb, receipts, logs, gasUsed, nil
 			}
 			log.Error("do light process err at block", "num", block.NumberU64(), "err", err)
@@ -370,6 +384,88 @@ func (p *LightStateProcessor) LightProcess(diffLayer *types.DiffLayer, block *ty
 	return diffLayer.Receipts, allLogs, gasUsed, nil
 }
 
+// sampleVerification re-executes a light processed block in the background with
+// the probability configured on the chain, cross checking the diff layer it was
+// imported with. The peers which served a contradicted diff layer are reported
+// through a BadDiffEvent.
+func (p *LightStateProcessor) sampleVerification(block *types.Block, diffLayer *types.DiffLayer) {
+	if p.bc.diffVerifyRatio <= 0 || rand.Float64() >= p.bc.diffVerifyRatio {
+		return
+	}
+	select {
+	case p.verifySlots <- struct{}{}:
+	default:
+		diffVerifySkipMeter.Mark(1)
+		return
+	}
+	// The diff layer gets reused by the commit, copy what is checked beforehand
+	var (
+		diffHash = diffLayer.DiffHash
+		peers    = p.bc.diffPeers(diffHash)
+		accounts = make(map[common.Address][]byte, len(diffLayer.Accounts))
+		parent   = p.bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	)
+	for _, account := range diffLayer.Accounts {
+		accounts[account.Account] = account.Blob
+	}
+	p.bc.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.verifySlots
+			p.bc.wg.Done()
+		}()
+		statedb, err := state.New(parent.Root, p.bc.stateCache, p.bc.snaps)
+		if err != nil {
+			log.Debug("Skipped diff layer verification", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+			diffVerifySkipMeter.Mark(1)
+			return
+		}
+		diffVerifyMeter.Mark(1)
+
+		_, receipts, _, gasUsed, err := p.StateProcessor.Process(block, statedb, vm.Config{})
+		if err == nil {
+			err = p.checkDiffLayer(block, statedb, receipts, gasUsed, accounts)
+		}
+		if err == nil {
+			return
+		}
+		diffMismatchMeter.Mark(1)
+		log.Error("Diff layer contradicted by full execution", "number", block.NumberU64(), "hash", block.Hash(), "diff", diffHash, "peers", peers, "err", err)
+
+		p.bc.removeDiffLayers(diffHash)
+		p.bc.badDiffFeed.Send(BadDiffEvent{Block: block, DiffHash: diffHash, Peers: peers})
+	}()
+}
+
+// checkDiffLayer compares the result of the full execution of a block with the
+// diff layer it was light processed with. The accounts of the diff layer are
+// only checked if the execution tracked its changes in the snapshot.
+func (p *LightStateProcessor) checkDiffLayer(block *types.Block, statedb *state.StateDB, receipts types.Receipts, gasUsed uint64, accounts map[common.Address][]byte) error {
+	if gasUsed != block.GasUsed() {
+		return fmt.Errorf("gas used mismatch (diff: %d full: %d)", block.GasUsed(), gasUsed)
+	}
+	if hash := types.DeriveSha(receipts, trie.NewStackTrie(nil)); hash != block.ReceiptHash() {
+		return fmt.Errorf("receipt root mismatch (diff: %x full: %x)", block.ReceiptHash(), hash)
+	}
+	if root := statedb.IntermediateRoot(p.config.IsEIP158(block.Number())); root != block.Root() {
+		return fmt.Errorf("state root mismatch (diff: %x full: %x)", block.Root(), root)
+	}
+	_, changes, _ := statedb.SnapToDiffLayer()
+	if len(changes) == 0 {
+		return nil
+	}
+	executed := make(map[common.Address][]byte, len(changes))
+	for _, account := range changes {
+		executed[account.Account] = account.Blob
+	}
+	for account, blob := range accounts {
+		if want, ok := executed[account]; !ok || !bytes.Equal(blob, want) {
+			return fmt.Errorf("account %x mismatch (diff: %x full: %x)", account, blob, want)
+		}
+	}
+	return nil
+}
+
 // Process processes the state changes according to the Ethereum rules by running
 // the transaction messages using the statedb and applying any rewards to both
 // the processor (coinbase) and any included uncles.
@@ -391,7 +487,9 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		misc.ApplyDAOHardFork(statedb)
 	}
 	// Handle upgrade build-in system contract code
-	systemcontracts.UpgradeBuildInSystemContract(p.config, block.Number(), statedb)
+	if err := systemcontracts.UpgradeBuildInSystemContract(p.config, block.Number(), statedb); err != nil {
+		return statedb, nil, nil, 0, err
+	}
 
 	blockContext := NewEVMBlockContext(header, p.bc, nil)
 	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, p.config, cfg)
@@ -407,28 +505,36 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 
 	// usually do have two tx, one for validator set contract, another for system reward contract.
 	systemTxs := make([]*types.Transaction, 0, 2)
-	for i, tx := range block.Transactions() {
-		if isPoSA {
-			if isSystemTx, err := posa.IsSystemTransaction(tx, block.Header()); err != nil {
-				return statedb, nil, nil, 0, err
-			} else if isSystemTx {
-				systemTxs = append(systemTxs, tx)
-				continue
-			}
-		}
-
-		msg, err := tx.AsMessage(signer)
+	if p.parallel(block, cfg) {
+		var err error
+		commonTxs, systemTxs, receipts, err = p.applyTransactionsParallel(block, statedb, cfg, vmenv, gp, usedGas, bloomProcessors)
 		if err != nil {
 			return statedb, nil, nil, 0, err
 		}
-		statedb.Prepare(tx.Hash(), block.Hash(), i)
-		receipt, err := applyTransaction(msg, p.config, p.bc, nil, gp, statedb, header, tx, usedGas, vmenv, bloomProcessors)
-		if err != nil {
-			return statedb, nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
-		}
+	} else {
+		for i, tx := range block.Transactions() {
+			if isPoSA {
+				if isSystemTx, err := posa.IsSystemTransaction(tx, block.Header()); err != nil {
+					return statedb, nil, nil, 0, err
+				} else if isSystemTx {
+					systemTxs = append(systemTxs, tx)
+					continue
+				}
+			}
+
+			msg, err := tx.AsMessage(signer)
+			if err != nil {
+				return statedb, nil, nil, 0, err
+			}
+			statedb.Prepare(tx.Hash(), block.Hash(), i)
+			receipt, err := applyTransaction(msg, p.config, p.bc, nil, gp, statedb, header, tx, usedGas, vmenv, bloomProcessors)
+			if err != nil {
+				return statedb, nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
+			}
 
-		commonTxs = append(commonTxs, tx)
-		receipts = append(receipts, receipt)
+			commonTxs = append(commonTxs, tx)
+			receipts = append(receipts, receipt)
+		}
 	}
 	bloomProcessors.Close()
 
@@ -501,6 +607,10 @@ func applyTransactionWithResult(msg types.Message, config *params.ChainConfig, b
 	if err != nil {
 		return nil, nil, err
 	}
+	// A cancelled EVM stops silently, don't finalise its partial state.
+	if evm.Cancelled() {
+		return nil, nil, ErrExecutionAborted
+	}
 
 	// Update the state with pending changes.
 	var root []byte
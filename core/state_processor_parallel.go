@@ -0,0 +1,226 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	parallelMergeMeter     = metrics.NewRegisteredMeter("chain/parallel/merge", nil)
+	parallelReexecuteMeter = metrics.NewRegisteredMeter("chain/parallel/reexecute", nil)
+)
+
+// speculativeTx is a transaction executed speculatively on a copy of the state
+// ahead of its turn, at the start of the block or of the mining work.
+type speculativeTx struct {
+	index int
+	tx    *types.Transaction
+	msg   types.Message
+
+	statedb *state.StateDB      // Copy of the state the transaction was executed on
+	rwSet   *state.ReadWriteSet // State read and written by the transaction
+	result  *ExecutionResult
+	err     error
+	done    chan struct{} // Closed when the speculative execution finished
+}
+
+// parallel returns whether the transactions of the block are to be executed in
+// parallel. Receipts before Byzantium require the intermediate state roots, and
+// tracers can't follow transactions executed concurrently.
+func (p *StateProcessor) parallel(block *types.Block, cfg vm.Config) bool {
+	return p.bc.parallelWorkers > 1 && len(block.Transactions()) > 1 &&
+		p.config.IsByzantium(block.Number()) && !cfg.Debug
+}
+
+// applyTransactionsParallel executes the transactions of the block speculatively
+// in parallel, each on a copy of the state at the start of the block, and then
+// merges them into the state in order. Transactions reading any state written
+// by the ones before them are re-executed on the merged state, the outcome is
+// the same as executing all of them serially.
+//
+// The system transactions are skipped and returned to be applied by the
+// consensus engine.
+func (p *StateProcessor) applyTransactionsParallel(block *types.Block, statedb *state.StateDB, cfg vm.Config, vmenv *vm.EVM, gp *GasPool, usedGas *uint64, receiptProcessors ...ReceiptProcessor) ([]*types.Transaction, []*types.Transaction, types.Receipts, error) {
+	var (
+		header = block.Header()
+		signer = types.MakeSigner(p.config, header.Number)
+
+		posa, isPoSA = p.engine.(consensus.PoSA)
+		commonTxs    = make([]*types.Transaction, 0, len(block.Transactions()))
+		systemTxs    = make([]*types.Transaction, 0, 2)
+		receipts     = make(types.Receipts, 0, len(block.Transactions()))
+
+		specs   []*speculativeTx
+		failErr error // Error of the first transaction failing before execution
+	)
+	for i, tx := range block.Transactions() {
+		if isPoSA {
+			if isSystemTx, err := posa.IsSystemTransaction(tx, header); err != nil {
+				failErr = err
+				break
+			} else if isSystemTx {
+				systemTxs = append(systemTxs, tx)
+				continue
+			}
+		}
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			failErr = err
+			break
+		}
+		specs = append(specs, &speculativeTx{index: i, tx: tx, msg: msg, done: make(chan struct{})})
+	}
+	// Execute the transactions speculatively in the background, the workers pick
+	// them up in order so that the merging can start as soon as possible.
+	var (
+		base      = statedb.Copy()
+		jobs      = make(chan *speculativeTx, len(specs))
+		interrupt int32
+		pend      sync.WaitGroup
+	)
+	for _, spec := range specs {
+		jobs <- spec
+	}
+	close(jobs)
+
+	workers := p.bc.parallelWorkers
+	if workers > len(specs) {
+		workers = len(specs)
+	}
+	for i := 0; i < workers; i++ {
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+
+			evm := vm.NewEVM(NewEVMBlockContext(header, p.bc, nil), vm.TxContext{}, base, p.config, cfg)
+			defer func() {
+				vm.EVMInterpreterPool.Put(evm.Interpreter())
+				vm.EvmPool.Put(evm)
+			}()
+			for spec := range jobs {
+				if atomic.LoadInt32(&interrupt) == 1 {
+					return
+				}
+				speculate(base, evm, block.GasLimit(), spec)
+				close(spec.done)
+			}
+		}()
+	}
+	defer func() {
+		atomic.StoreInt32(&interrupt, 1)
+		pend.Wait()
+	}()
+
+	// Merge the transactions in order, re-executing the ones which read state
+	// that was modified after the start of the block.
+	written := state.NewWriteSet()
+	for _, spec := range specs {
+		<-spec.done
+
+		statedb.Prepare(spec.tx.Hash(), block.Hash(), spec.index)
+		if spec.err != nil || gp.Gas() < spec.msg.Gas() || spec.rwSet.Conflicts(written) {
+			parallelReexecuteMeter.Mark(1)
+
+			statedb.StartReadWriteSet()
+			receipt, err := applyTransaction(spec.msg, p.config, p.bc, nil, gp, statedb, header, spec.tx, usedGas, vmenv, receiptProcessors...)
+			rwSet := statedb.StopReadWriteSet()
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("could not apply tx %d [%v]: %w", spec.index, spec.tx.Hash().Hex(), err)
+			}
+			written.Add(rwSet)
+
+			commonTxs = append(commonTxs, spec.tx)
+			receipts = append(receipts, receipt)
+			continue
+		}
+		parallelMergeMeter.Mark(1)
+
+		receipt := applySpeculativeTx(spec, statedb, header, gp, usedGas, receiptProcessors...)
+		written.Add(spec.rwSet)
+
+		commonTxs = append(commonTxs, spec.tx)
+		receipts = append(receipts, receipt)
+	}
+	if failErr != nil {
+		return nil, nil, nil, failErr
+	}
+	return commonTxs, systemTxs, receipts, nil
+}
+
+// applySpeculativeTx merges a transaction executed speculatively into the state
+// and creates its receipt, the same way applyTransaction does after executing it
+// on the state. The transaction must not conflict with the ones merged before.
+func applySpeculativeTx(spec *speculativeTx, statedb *state.StateDB, header *types.Header, gp *GasPool, usedGas *uint64, receiptProcessors ...ReceiptProcessor) *types.Receipt {
+	statedb.ApplyReadWriteSet(spec.rwSet)
+	for _, l := range spec.statedb.GetLogs(spec.tx.Hash()) {
+		statedb.AddLog(l)
+	}
+	for hash, preimage := range spec.statedb.Preimages() {
+		statedb.AddPreimage(hash, preimage)
+	}
+	statedb.Finalise(true)
+
+	gp.SubGas(spec.result.UsedGas)
+	*usedGas += spec.result.UsedGas
+
+	receipt := &types.Receipt{Type: spec.tx.Type(), CumulativeGasUsed: *usedGas}
+	if spec.result.Failed() {
+		receipt.Status = types.ReceiptStatusFailed
+	} else {
+		receipt.Status = types.ReceiptStatusSuccessful
+	}
+	receipt.TxHash = spec.tx.Hash()
+	receipt.GasUsed = spec.result.UsedGas
+	if spec.msg.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(spec.msg.From(), spec.tx.Nonce())
+	}
+	receipt.Logs = statedb.GetLogs(spec.tx.Hash())
+	receipt.BlockHash = statedb.BlockHash()
+	receipt.BlockNumber = header.Number
+	receipt.TransactionIndex = uint(statedb.TxIndex())
+	for _, receiptProcessor := range receiptProcessors {
+		receiptProcessor.Apply(receipt)
+	}
+	return receipt
+}
+
+// speculate executes a transaction on a copy of the given state, recording the
+// state it reads and writes.
+func speculate(base *state.StateDB, evm *vm.EVM, gasLimit uint64, spec *speculativeTx) {
+	statedb := base.Copy()
+	statedb.EnableWriteOnSharedStorage()
+	statedb.Prepare(spec.tx.Hash(), common.Hash{}, spec.index)
+	statedb.StartReadWriteSet()
+
+	evm.Reset(NewEVMTxContext(spec.msg), statedb)
+	spec.result, spec.err = ApplyMessage(evm, spec.msg, new(GasPool).AddGas(gasLimit))
+	if spec.err == nil {
+		statedb.Finalise(true)
+	}
+	spec.statedb, spec.rwSet = statedb, statedb.StopReadWriteSet()
+}
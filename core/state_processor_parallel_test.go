@@ -0,0 +1,188 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that executing the transactions in parallel yields the same state and
+// receipts as executing them serially, over chains mixing transactions which
+// do and do not conflict with each other.
+func TestParallelExecution(t *testing.T) {
+	var (
+		engine   = ethash.NewFaker()
+		signer   = types.LatestSigner(params.TestChainConfig)
+		coinbase = common.Address{0xcb}
+
+		// Contracts incrementing a shared counter, a counter of the caller,
+		// storing the balance of the coinbase, logging the caller, reverting
+		// a storage write and self-destructing.
+		counter     = common.Address{0xc1}
+		perCaller   = common.Address{0xc2}
+		balance     = common.Address{0xc3}
+		logger      = common.Address{0xc4}
+		reverter    = common.Address{0xc5}
+		destructors = []common.Address{{0xd1}, {0xd2}, {0xd3}, {0xd4}}
+
+		// Init code deploying the counter of the caller
+		deployer = hexutil.MustDecode("0x67335460010133550060005260086018f3")
+	)
+	alloc := GenesisAlloc{
+		counter:   {Balance: big.NewInt(0), Code: hexutil.MustDecode("0x60005460010160005500")},
+		perCaller: {Balance: big.NewInt(0), Code: hexutil.MustDecode("0x3354600101335500")},
+		balance:   {Balance: big.NewInt(0), Code: hexutil.MustDecode("0x413160005500")},
+		logger:    {Balance: big.NewInt(0), Code: hexutil.MustDecode("0x3360006000a100")},
+		reverter:  {Balance: big.NewInt(0), Code: hexutil.MustDecode("0x600160005560006000fd")},
+	}
+	for _, addr := range destructors {
+		alloc[addr] = GenesisAccount{Balance: big.NewInt(1000), Code: hexutil.MustDecode("0x33ff"), Storage: map[common.Hash]common.Hash{{}: {0x01}}}
+	}
+	keys := make([]*ecdsa.PrivateKey, 32)
+	for i := range keys {
+		keys[i], _ = crypto.ToECDSA(common.BigToHash(big.NewInt(int64(i + 1))).Bytes())
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	gspec := &Genesis{Config: params.TestChainConfig, GasLimit: 30000000, Alloc: alloc}
+
+	gendb := rawdb.NewMemoryDatabase()
+	genesis := gspec.MustCommit(gendb)
+
+	rand := rand.New(rand.NewSource(1))
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, gendb, 16, func(i int, block *BlockGen) {
+		block.SetCoinbase(coinbase)
+
+		var created []common.Address
+		for j := 0; j < 32; j++ {
+			var (
+				key   = keys[rand.Intn(len(keys))]
+				from  = crypto.PubkeyToAddress(key.PublicKey)
+				nonce = block.TxNonce(from)
+				value = big.NewInt(0)
+				gas   = uint64(100000)
+				to    *common.Address
+				data  []byte
+			)
+			switch rand.Intn(12) {
+			case 0: // Transfer to another sender
+				recipient := crypto.PubkeyToAddress(keys[rand.Intn(len(keys))].PublicKey)
+				to, value = &recipient, big.NewInt(rand.Int63n(1000))
+			case 1: // Transfer to a new account
+				recipient := common.Address{0xee, byte(i), byte(j)}
+				to, value = &recipient, big.NewInt(rand.Int63n(1000)+1)
+			case 2: // Touch of an empty account, deleting it
+				recipient := common.Address{0xef, byte(i), byte(j)}
+				to = &recipient
+			case 3:
+				to = &counter
+			case 4:
+				to = &perCaller
+			case 5:
+				to = &balance
+			case 6:
+				to, value = &logger, big.NewInt(1)
+			case 7:
+				to = &reverter
+			case 8:
+				to = &destructors[rand.Intn(len(destructors))]
+			case 9: // Running out of gas
+				to, gas = &counter, params.TxGas+100
+			case 10:
+				created = append(created, crypto.CreateAddress(from, nonce))
+				data = deployer
+			case 11: // Call to a contract created in the same block
+				if len(created) == 0 {
+					to = &perCaller
+				} else {
+					to = &created[rand.Intn(len(created))]
+				}
+			}
+			var tx *types.Transaction
+			if to == nil {
+				tx = types.NewContractCreation(nonce, value, gas, big.NewInt(1), data)
+			} else {
+				tx = types.NewTransaction(nonce, *to, value, gas, big.NewInt(1), data)
+			}
+			tx, err := types.SignTx(tx, signer, key)
+			if err != nil {
+				t.Fatalf("failed to sign transaction: %v", err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	newChain := func(options ...BlockChainOption) *BlockChain {
+		db := rawdb.NewMemoryDatabase()
+		gspec.MustCommit(db)
+
+		chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil, options...)
+		if err != nil {
+			t.Fatalf("failed to create chain: %v", err)
+		}
+		return chain
+	}
+	serial := newChain()
+	defer serial.Stop()
+	parallel := newChain(EnableParallelExecution(4))
+	defer parallel.Stop()
+
+	// The blocks generated by serial execution are valid under parallel one
+	if _, err := serial.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain serially: %v", err)
+	}
+	if _, err := parallel.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain in parallel: %v", err)
+	}
+	// The results of executing the blocks in parallel match the serial ones
+	for _, block := range blocks {
+		parent := serial.GetHeaderByHash(block.ParentHash())
+
+		serialdb, _ := state.New(parent.Root, serial.StateCache(), nil)
+		paralleldb, _ := state.New(parent.Root, parallel.StateCache(), nil)
+
+		_, want, _, wantGas, err := serial.Processor().Process(block, serialdb, vm.Config{})
+		if err != nil {
+			t.Fatalf("block %d: failed to execute serially: %v", block.NumberU64(), err)
+		}
+		_, have, _, haveGas, err := parallel.Processor().Process(block, paralleldb, vm.Config{})
+		if err != nil {
+			t.Fatalf("block %d: failed to execute in parallel: %v", block.NumberU64(), err)
+		}
+		if root := paralleldb.IntermediateRoot(true); root != block.Root() {
+			t.Errorf("block %d: root mismatch: have %x, want %x", block.NumberU64(), root, block.Root())
+		}
+		if haveGas != wantGas {
+			t.Errorf("block %d: gas mismatch: have %d, want %d", block.NumberU64(), haveGas, wantGas)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("block %d: receipts mismatch", block.NumberU64())
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package systemcontracts
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Names of the hard forks system contract upgrades can be scheduled at.
+const (
+	RamanujanFork  = "ramanujan"
+	NielsFork      = "niels"
+	MirrorSyncFork = "mirrorSync"
+	BrunoFork      = "bruno"
+)
+
+// forkBlocks maps the schedulable hard forks to their activation block.
+var forkBlocks = map[string]func(config *params.ChainConfig) *big.Int{
+	RamanujanFork:  func(config *params.ChainConfig) *big.Int { return config.RamanujanBlock },
+	NielsFork:      func(config *params.ChainConfig) *big.Int { return config.NielsBlock },
+	MirrorSyncFork: func(config *params.ChainConfig) *big.Int { return config.MirrorSyncBlock },
+	BrunoFork:      func(config *params.ChainConfig) *big.Int { return config.BrunoBlock },
+}
+
+// systemContracts is the set of contracts an upgrade may replace.
+var systemContracts = map[common.Address]bool{
+	common.HexToAddress(ValidatorContract):          true,
+	common.HexToAddress(SlashContract):              true,
+	common.HexToAddress(SystemRewardContract):       true,
+	common.HexToAddress(LightClientContract):        true,
+	common.HexToAddress(TokenHubContract):           true,
+	common.HexToAddress(RelayerIncentivizeContract): true,
+	common.HexToAddress(RelayerHubContract):         true,
+	common.HexToAddress(GovHubContract):             true,
+	common.HexToAddress(TokenManagerContract):       true,
+	common.HexToAddress(CrossChainContract):         true,
+}
+
+var (
+	hooksLock sync.RWMutex
+	hooks     = make(map[string]upgradeHook)
+)
+
+// RegisterUpgradeHook makes a hook available to configured upgrades under the
+// given name. Hooks run before or after the code of a contract is replaced and
+// may migrate its storage.
+func RegisterUpgradeHook(name string, hook func(blockNumber *big.Int, contractAddr common.Address, statedb *state.StateDB) error) {
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+
+	if _, exist := hooks[name]; exist {
+		panic(fmt.Sprintf("upgrade hook %s registered twice", name))
+	}
+	hooks[name] = hook
+}
+
+// lookupHook returns the hook registered under name, nil if name is empty.
+func lookupHook(name string) (upgradeHook, error) {
+	if name == "" {
+		return nil, nil
+	}
+	hooksLock.RLock()
+	defer hooksLock.RUnlock()
+
+	hook, ok := hooks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown upgrade hook %q", name)
+	}
+	return hook, nil
+}
+
+// networkOf returns the network the genesis hash belongs to.
+func networkOf(genesis common.Hash) string {
+	switch genesis {
+	case params.BSCGenesisHash:
+		return mainNet
+	case params.ChapelGenesisHash:
+		return chapelNet
+	case params.RialtoGenesisHash:
+		return rialtoNet
+	default:
+		return defaultNet
+	}
+}
+
+// ValidateUpgrades checks the system contract upgrades configured in the chain
+// config of the network with the given genesis.
+func ValidateUpgrades(genesis common.Hash, config *params.ChainConfig) error {
+	if config == nil || config.Parlia == nil || len(config.Parlia.Upgrades) == 0 {
+		return nil
+	}
+	if network := networkOf(genesis); network != defaultNet {
+		return fmt.Errorf("system contract upgrades cannot be configured on %s", network)
+	}
+	type key struct {
+		fork     string
+		contract common.Address
+	}
+	seen := make(map[key]bool)
+	for i, upgrade := range config.Parlia.Upgrades {
+		if upgrade == nil {
+			return fmt.Errorf("upgrade %d: empty definition", i)
+		}
+		forkBlock, ok := forkBlocks[upgrade.Fork]
+		if !ok {
+			return fmt.Errorf("upgrade %d: unknown fork %q", i, upgrade.Fork)
+		}
+		if forkBlock(config) == nil {
+			return fmt.Errorf("upgrade %d: fork %s is not scheduled", i, upgrade.Fork)
+		}
+		if !systemContracts[upgrade.Contract] {
+			return fmt.Errorf("upgrade %d: %s is not a system contract", i, upgrade.Contract.Hex())
+		}
+		if len(upgrade.Code) == 0 {
+			return fmt.Errorf("upgrade %d: empty contract code", i)
+		}
+		if _, err := lookupHook(upgrade.BeforeUpgrade); err != nil {
+			return fmt.Errorf("upgrade %d: %v", i, err)
+		}
+		if _, err := lookupHook(upgrade.AfterUpgrade); err != nil {
+			return fmt.Errorf("upgrade %d: %v", i, err)
+		}
+		k := key{upgrade.Fork, upgrade.Contract}
+		if seen[k] {
+			return fmt.Errorf("upgrade %d: duplicate upgrade of %s at %s", i, upgrade.Contract.Hex(), upgrade.Fork)
+		}
+		seen[k] = true
+	}
+	return nil
+}
+
+// LoadUpgrades reads the system contract upgrades of a side file, a JSON list in
+// the format of the chain config's parlia upgrades. The upgrades replace the ones
+// of the chain config and are validated with it.
+func LoadUpgrades(path string) ([]*params.SystemContractUpgrade, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var upgrades []*params.SystemContractUpgrade
+	if err := json.Unmarshal(blob, &upgrades); err != nil {
+		return nil, fmt.Errorf("invalid system contract upgrades file %s: %v", path, err)
+	}
+	return upgrades, nil
+}
+
+// configuredUpgrade assembles the upgrades the chain config schedules at the
+// given fork, nil if there are none. Hooks not registered in this binary are
+// reported as an error rather than skipped, the block can't be built without them.
+func configuredUpgrade(config *params.ChainConfig, fork string) (*Upgrade, error) {
+	if config.Parlia == nil {
+		return nil, nil
+	}
+	var configs []*UpgradeConfig
+	for _, upgrade := range config.Parlia.Upgrades {
+		if upgrade.Fork != fork {
+			continue
+		}
+		before, err := lookupHook(upgrade.BeforeUpgrade)
+		if err != nil {
+			return nil, fmt.Errorf("system contract upgrade of %s at %s: %v", upgrade.Contract.Hex(), fork, err)
+		}
+		after, err := lookupHook(upgrade.AfterUpgrade)
+		if err != nil {
+			return nil, fmt.Errorf("system contract upgrade of %s at %s: %v", upgrade.Contract.Hex(), fork, err)
+		}
+		configs = append(configs, &UpgradeConfig{
+			BeforeUpgrade: before,
+			AfterUpgrade:  after,
+			ContractAddr:  upgrade.Contract,
+			CommitUrl:     upgrade.CommitURL,
+			Code:          hex.EncodeToString(upgrade.Code),
+		})
+	}
+	if len(configs) == 0 {
+		return nil, nil
+	}
+	return &Upgrade{UpgradeName: fork, Configs: configs}, nil
+}
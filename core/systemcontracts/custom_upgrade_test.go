@@ -0,0 +1,149 @@
+package systemcontracts
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func testUpgradeConfig(upgrades ...*params.SystemContractUpgrade) *params.ChainConfig {
+	return &params.ChainConfig{
+		ChainID:        big.NewInt(714),
+		RamanujanBlock: big.NewInt(0),
+		NielsBlock:     big.NewInt(0),
+		BrunoBlock:     big.NewInt(5),
+		Parlia:         &params.ParliaConfig{Period: 3, Epoch: 200, Upgrades: upgrades},
+	}
+}
+
+func TestConfiguredUpgrade(t *testing.T) {
+	var (
+		validator = common.HexToAddress(ValidatorContract)
+		slash     = common.HexToAddress(SlashContract)
+		hooked    []common.Address
+	)
+	RegisterUpgradeHook("test-after", func(blockNumber *big.Int, contractAddr common.Address, statedb *state.StateDB) error {
+		hooked = append(hooked, contractAddr)
+		return nil
+	})
+	config := testUpgradeConfig(
+		&params.SystemContractUpgrade{Fork: BrunoFork, Contract: validator, Code: []byte{0x60, 0x01}, AfterUpgrade: "test-after"},
+		&params.SystemContractUpgrade{Fork: BrunoFork, Contract: slash, Code: []byte{0x60, 0x02}},
+	)
+	genesis := common.Hash{0x01}
+	if err := ValidateUpgrades(genesis, config); err != nil {
+		t.Fatalf("valid upgrades rejected: %v", err)
+	}
+	defer func(hash common.Hash) { GenesisHash = hash }(GenesisHash)
+	GenesisHash = genesis
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	for i := int64(0); i < 5; i++ {
+		if err := UpgradeBuildInSystemContract(config, big.NewInt(i), statedb); err != nil {
+			t.Fatalf("block %d: failed to apply upgrades: %v", i, err)
+		}
+		if code := statedb.GetCode(validator); len(code) != 0 {
+			t.Fatalf("block %d: contract upgraded before the fork: %x", i, code)
+		}
+	}
+	if err := UpgradeBuildInSystemContract(config, big.NewInt(5), statedb); err != nil {
+		t.Fatalf("failed to apply upgrades: %v", err)
+	}
+	if code := statedb.GetCode(validator); !bytes.Equal(code, []byte{0x60, 0x01}) {
+		t.Fatalf("validator code mismatch: have %x", code)
+	}
+	if code := statedb.GetCode(slash); !bytes.Equal(code, []byte{0x60, 0x02}) {
+		t.Fatalf("slash code mismatch: have %x", code)
+	}
+	if len(hooked) != 1 || hooked[0] != validator {
+		t.Fatalf("after upgrade hook mismatch: have %v", hooked)
+	}
+}
+
+func TestValidateUpgrades(t *testing.T) {
+	validator := common.HexToAddress(ValidatorContract)
+	tests := []struct {
+		genesis  common.Hash
+		upgrade  *params.SystemContractUpgrade
+		upgrades int
+	}{
+		// Built-in networks
+		{params.BSCGenesisHash, &params.SystemContractUpgrade{Fork: BrunoFork, Contract: validator, Code: []byte{1}}, 1},
+		{params.ChapelGenesisHash, &params.SystemContractUpgrade{Fork: BrunoFork, Contract: validator, Code: []byte{1}}, 1},
+		// Unknown and unscheduled forks
+		{common.Hash{}, &params.SystemContractUpgrade{Fork: "london", Contract: validator, Code: []byte{1}}, 1},
+		{common.Hash{}, &params.SystemContractUpgrade{Fork: MirrorSyncFork, Contract: validator, Code: []byte{1}}, 1},
+		// Not a system contract
+		{common.Hash{}, &params.SystemContractUpgrade{Fork: BrunoFork, Contract: common.Address{0x01}, Code: []byte{1}}, 1},
+		// Missing code
+		{common.Hash{}, &params.SystemContractUpgrade{Fork: BrunoFork, Contract: validator}, 1},
+		// Unregistered hook
+		{common.Hash{}, &params.SystemContractUpgrade{Fork: BrunoFork, Contract: validator, Code: []byte{1}, BeforeUpgrade: "missing"}, 1},
+		// Duplicate upgrade
+		{common.Hash{}, &params.SystemContractUpgrade{Fork: BrunoFork, Contract: validator, Code: []byte{1}}, 2},
+	}
+	for i, tt := range tests {
+		var upgrades []*params.SystemContractUpgrade
+		for j := 0; j < tt.upgrades; j++ {
+			upgrades = append(upgrades, tt.upgrade)
+		}
+		if err := ValidateUpgrades(tt.genesis, testUpgradeConfig(upgrades...)); err == nil {
+			t.Errorf("test %d: invalid upgrades accepted", i)
+		}
+	}
+}
+
+func TestLoadUpgrades(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgrades.json")
+	blob := `[{"fork": "bruno", "contract": "` + ValidatorContract + `", "code": "0x6003", "commitUrl": "local"}]`
+	if err := ioutil.WriteFile(path, []byte(blob), 0644); err != nil {
+		t.Fatal(err)
+	}
+	upgrades, err := LoadUpgrades(path)
+	if err != nil {
+		t.Fatalf("failed to load upgrades: %v", err)
+	}
+	config := testUpgradeConfig(upgrades...)
+	if err := ValidateUpgrades(common.Hash{0x01}, config); err != nil {
+		t.Fatalf("loaded upgrades rejected: %v", err)
+	}
+	defer func(hash common.Hash) { GenesisHash = hash }(GenesisHash)
+	GenesisHash = common.Hash{0x01}
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err := UpgradeBuildInSystemContract(config, big.NewInt(5), statedb); err != nil {
+		t.Fatalf("failed to apply upgrades: %v", err)
+	}
+	if code := statedb.GetCode(common.HexToAddress(ValidatorContract)); !bytes.Equal(code, []byte{0x60, 0x03}) {
+		t.Fatalf("validator code mismatch: have %x", code)
+	}
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUpgrades(path); err == nil {
+		t.Fatalf("malformed upgrades file accepted")
+	}
+}
+
+func TestUnvalidatedUpgrade(t *testing.T) {
+	config := testUpgradeConfig(&params.SystemContractUpgrade{
+		Fork: BrunoFork, Contract: common.HexToAddress(ValidatorContract), Code: []byte{1}, BeforeUpgrade: "missing",
+	})
+	defer func(hash common.Hash) { GenesisHash = hash }(GenesisHash)
+	GenesisHash = common.Hash{0x01}
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err := UpgradeBuildInSystemContract(config, big.NewInt(5), statedb); err == nil {
+		t.Fatalf("upgrade with an unregistered hook applied")
+	}
+	if code := statedb.GetCode(common.HexToAddress(ValidatorContract)); len(code) != 0 {
+		t.Fatalf("contract upgraded despite the error: %x", code)
+	}
+}
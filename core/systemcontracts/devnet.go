@@ -0,0 +1,257 @@
+package systemcontracts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Parlia devnets run the real validator set, slash indicator and token hub
+// contracts of the niels upgrade of chapel, set up at block 1 by the init
+// calls of the consensus engine. Their cross chain counterpart does not exist
+// on a devnet, hence the cross chain contract is replaced by a relay letting
+// the faucet deliver the validator set packages instead. The relay starts with
+// the package of the genesis validators in its storage, delivering it when
+// initialised, which replaces the chapel validators the validator set contract
+// initialises itself with.
+
+const (
+	devnetStakingChannel = 8              // Channel of the validator set packages
+	devnetVotingPower    = 0x048c27395000 // Voting power of the devnet validators
+	devnetIndicatorsSlot = 2              // Slot of the slash indicator mapping of the slash contract
+	devnetRelayAdminSlot = 0              // Slot of the account allowed to relay packages
+	devnetRelayInitSlot  = 1              // Slot of the length of the pending genesis delivery
+	devnetRelayDataSlot  = 2              // First slot of the pending genesis delivery
+)
+
+// devnetRelaySource is the EVM assembly of the contract standing in for the
+// cross chain contract on parlia devnets. Calls of the admin are forwarded to
+// the validator set contract, so the admin may deliver the validator set
+// packages of the staking channel. The first other call, the init call of the
+// engine, forwards the delivery of the genesis validators held in storage. Any
+// later call, like the packages sent by the slash indicator and the token hub,
+// is accepted and dropped.
+const devnetRelaySource = `
+	CALLER
+	PUSH %[1]d
+	SLOAD
+	EQ
+	JUMPI @forward
+	PUSH %[3]d
+	SLOAD
+	DUP1
+	JUMPI @deliver
+	STOP
+
+deliver:
+	PUSH 0
+	PUSH %[3]d
+	SSTORE
+	PUSH 0
+
+load:
+	DUP2
+	DUP2
+	PUSH 32
+	MUL
+	LT
+	ISZERO
+	JUMPI @send
+	DUP1
+	PUSH %[4]d
+	ADD
+	SLOAD
+	DUP2
+	PUSH 32
+	MUL
+	MSTORE
+	PUSH 1
+	ADD
+	JUMP @load
+
+send:
+	POP
+	PUSH 0
+	PUSH 0
+	DUP3
+	PUSH 0
+	PUSH 0
+	PUSH %[2]s
+	GAS
+	CALL
+	JUMPI @delivered
+	RETURNDATASIZE
+	PUSH 0
+	PUSH 0
+	RETURNDATACOPY
+	RETURNDATASIZE
+	PUSH 0
+	REVERT
+
+delivered:
+	STOP
+
+forward:
+	CALLDATASIZE
+	PUSH 0
+	PUSH 0
+	CALLDATACOPY
+	PUSH 0
+	PUSH 0
+	CALLDATASIZE
+	PUSH 0
+	PUSH 0
+	PUSH %[2]s
+	GAS
+	CALL
+	RETURNDATASIZE
+	PUSH 0
+	PUSH 0
+	RETURNDATACOPY
+	JUMPI @return
+	RETURNDATASIZE
+	PUSH 0
+	REVERT
+
+return:
+	RETURNDATASIZE
+	PUSH 0
+	RETURN
+`
+
+var (
+	devnetRelayCode     []byte
+	devnetRelayCodeOnce sync.Once
+)
+
+// devnetValidator is a validator of the staking channel packages.
+type devnetValidator struct {
+	ConsensusAddress common.Address
+	FeeAddress       common.Address
+	BBCFeeAddress    common.Address
+	VotingPower      uint64
+}
+
+// devnetValidatorSetPackage returns the staking channel package replacing the
+// current validators.
+func devnetValidatorSetPackage(validators []common.Address) []byte {
+	pkg := struct {
+		Type       uint8
+		Validators []devnetValidator
+	}{}
+	for _, validator := range validators {
+		pkg.Validators = append(pkg.Validators, devnetValidator{
+			ConsensusAddress: validator,
+			FeeAddress:       validator,
+			BBCFeeAddress:    validator,
+			VotingPower:      devnetVotingPower,
+		})
+	}
+	blob, err := rlp.EncodeToBytes(pkg)
+	if err != nil {
+		panic(fmt.Sprintf("invalid validator set package: %v", err))
+	}
+	return blob
+}
+
+// chapelCode returns the code of a system contract after the niels upgrade of
+// chapel.
+func chapelCode(contract string) []byte {
+	for _, config := range nielsUpgrade[chapelNet].Configs {
+		if config.ContractAddr == common.HexToAddress(contract) {
+			code, err := hex.DecodeString(config.Code)
+			if err != nil {
+				panic(fmt.Sprintf("invalid code of %s: %v", contract, err))
+			}
+			return code
+		}
+	}
+	panic(fmt.Sprintf("no code of %s", contract))
+}
+
+// DevnetValidatorSetCode returns the code of the validator set contract of a
+// parlia devnet.
+func DevnetValidatorSetCode() []byte {
+	return chapelCode(ValidatorContract)
+}
+
+// roundup32 rounds n up to a multiple of 32, the size of a memory word.
+func roundup32(n int) int {
+	return (n + 31) &^ 31
+}
+
+// DevnetSlashCode returns the code of the slash indicator contract of a parlia
+// devnet.
+func DevnetSlashCode() []byte {
+	return chapelCode(SlashContract)
+}
+
+// DevnetTokenHubCode returns the code of the token hub contract of a parlia
+// devnet, receiving the incoming of the validators above the dust limit.
+func DevnetTokenHubCode() []byte {
+	return chapelCode(TokenHubContract)
+}
+
+// DevnetCrossChainCode returns the code of the relay replacing the cross chain
+// contract on parlia devnets.
+func DevnetCrossChainCode() []byte {
+	devnetRelayCodeOnce.Do(func() {
+		source := fmt.Sprintf(devnetRelaySource, devnetRelayAdminSlot, common.HexToAddress(ValidatorContract).Hash().Big(), devnetRelayInitSlot, devnetRelayDataSlot)
+
+		compiler := asm.NewCompiler(false)
+		compiler.Feed(asm.Lex([]byte(source), false))
+
+		code, errs := compiler.Compile()
+		if len(errs) > 0 {
+			panic(fmt.Sprintf("invalid devnet relay: %v", errs))
+		}
+		devnetRelayCode = common.FromHex(strings.TrimSpace(code))
+	})
+	return common.CopyBytes(devnetRelayCode)
+}
+
+// DevnetCrossChainStorage returns the storage of the devnet relay allowing
+// admin to deliver validator set packages, the package of the given genesis
+// validators pending until the relay is initialised.
+func DevnetCrossChainStorage(admin common.Address, validators []common.Address) map[common.Hash]common.Hash {
+	data := DevnetUpdateValidatorsData(validators)
+	storage := map[common.Hash]common.Hash{
+		common.BigToHash(big.NewInt(devnetRelayAdminSlot)): admin.Hash(),
+		common.BigToHash(big.NewInt(devnetRelayInitSlot)):  common.BigToHash(big.NewInt(int64(len(data)))),
+	}
+	for i := 0; i < len(data); i += common.HashLength {
+		var word common.Hash
+		copy(word[:], data[i:])
+		storage[common.BigToHash(big.NewInt(int64(devnetRelayDataSlot+i/common.HashLength)))] = word
+	}
+	return storage
+}
+
+// DevnetSlashKey returns the storage slot of the slash indicator contract
+// holding the slash count of the validator, which the contract decreases
+// whenever the validators change.
+func DevnetSlashKey(validator common.Address) common.Hash {
+	indicator := crypto.Keccak256Hash(validator.Hash().Bytes(), common.BigToHash(big.NewInt(devnetIndicatorsSlot)).Bytes())
+	return common.BigToHash(new(big.Int).Add(indicator.Big(), common.Big1))
+}
+
+// DevnetUpdateValidatorsData returns the input of the devnet relay call
+// delivering a validator set package, the validators taking over at the next
+// epoch.
+func DevnetUpdateValidatorsData(validators []common.Address) []byte {
+	pkg := devnetValidatorSetPackage(validators)
+
+	data := crypto.Keccak256([]byte("handleSynPackage(uint8,bytes)"))[:4]
+	data = append(data, common.BigToHash(big.NewInt(devnetStakingChannel)).Bytes()...)
+	data = append(data, common.BigToHash(big.NewInt(64)).Bytes()...)
+	data = append(data, common.BigToHash(big.NewInt(int64(len(pkg)))).Bytes()...)
+	data = append(data, pkg...)
+	return append(data, make([]byte, roundup32(len(pkg))-len(pkg))...)
+}
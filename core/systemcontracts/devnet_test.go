@@ -0,0 +1,147 @@
+package systemcontracts
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const devnetABI = `[
+	{"type": "function", "name": "init", "inputs": [], "outputs": []},
+	{"type": "function", "name": "getValidators", "inputs": [], "outputs": [{"name": "", "type": "address[]"}]},
+	{"type": "function", "name": "deposit", "inputs": [{"name": "valAddr", "type": "address"}], "outputs": []},
+	{"type": "function", "name": "slash", "inputs": [{"name": "validator", "type": "address"}], "outputs": []},
+	{"type": "function", "name": "getSlashIndicator", "inputs": [{"name": "validator", "type": "address"}], "outputs": [{"name": "", "type": "uint256"}, {"name": "", "type": "uint256"}]},
+	{"type": "function", "name": "handleSynPackage", "inputs": [{"name": "channelId", "type": "uint8"}, {"name": "msgBytes", "type": "bytes"}], "outputs": [{"name": "", "type": "bytes"}]}
+]`
+
+func TestDevnetContracts(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(devnetABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		validatorSet = common.HexToAddress(ValidatorContract)
+		slash        = common.HexToAddress(SlashContract)
+		relay        = common.HexToAddress(CrossChainContract)
+		admin        = common.HexToAddress("0xad")
+		validators   = []common.Address{{0x01}, {0x02}, {0x03}}
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(validatorSet, DevnetValidatorSetCode())
+	statedb.SetCode(slash, DevnetSlashCode())
+	statedb.SetCode(common.HexToAddress(TokenHubContract), DevnetTokenHubCode())
+	statedb.SetCode(relay, DevnetCrossChainCode())
+	for key, value := range DevnetCrossChainStorage(admin, validators) {
+		statedb.SetState(relay, key, value)
+	}
+	statedb.AddBalance(validators[0], big.NewInt(params.Ether))
+
+	number := int64(1)
+	call := func(from, to common.Address, input []byte, value *big.Int) ([]byte, error) {
+		evm := vm.NewEVM(vm.BlockContext{
+			CanTransfer: func(db vm.StateDB, addr common.Address, amount *big.Int) bool {
+				return db.GetBalance(addr).Cmp(amount) >= 0
+			},
+			Transfer: func(db vm.StateDB, sender, recipient common.Address, amount *big.Int) {
+				db.SubBalance(sender, amount)
+				db.AddBalance(recipient, amount)
+			},
+			Coinbase:    validators[0],
+			BlockNumber: big.NewInt(number),
+			Time:        big.NewInt(number),
+			Difficulty:  big.NewInt(2),
+			GasLimit:    40000000,
+		}, vm.TxContext{Origin: from, GasPrice: new(big.Int)}, statedb, params.TestChainConfig, vm.Config{})
+		ret, _, err := evm.Call(vm.AccountRef(from), to, input, 10000000, value)
+		return ret, err
+	}
+	pack := func(method string, args ...interface{}) []byte {
+		input, err := parsed.Pack(method, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return input
+	}
+	getValidators := func() []common.Address {
+		ret, err := call(admin, validatorSet, pack("getValidators"), new(big.Int))
+		if err != nil {
+			t.Fatalf("getValidators failed: %v", err)
+		}
+		var have []common.Address
+		if err := parsed.UnpackIntoInterface(&have, "getValidators", ret); err != nil {
+			t.Fatalf("invalid getValidators result: %v", err)
+		}
+		return have
+	}
+	// Initialise the contracts as the engine does at block 1, the relay replacing
+	// the chapel validators by the genesis ones
+	for _, contract := range []string{ValidatorContract, SlashContract, LightClientContract, RelayerHubContract, TokenHubContract, RelayerIncentivizeContract} {
+		if _, err := call(validators[0], common.HexToAddress(contract), pack("init"), new(big.Int)); err != nil {
+			t.Fatalf("failed to init %s: %v", contract, err)
+		}
+	}
+	if have := getValidators(); len(have) == 0 || reflect.DeepEqual(have, validators) {
+		t.Fatalf("validator set not initialised with the chapel validators: %v", have)
+	}
+	if _, err := call(validators[0], relay, pack("init"), new(big.Int)); err != nil {
+		t.Fatalf("failed to init relay: %v", err)
+	}
+	if have := getValidators(); !reflect.DeepEqual(have, validators) {
+		t.Fatalf("validators mismatch: have %v, want %v", have, validators)
+	}
+	if pending := statedb.GetState(relay, common.BigToHash(big.NewInt(devnetRelayInitSlot))); pending != (common.Hash{}) {
+		t.Fatalf("genesis validators still pending: %x", pending)
+	}
+	if _, err := call(validators[0], validatorSet, pack("deposit", validators[0]), big.NewInt(params.GWei)); err != nil {
+		t.Fatalf("deposit failed: %v", err)
+	}
+	// Only the coinbase may slash, once per block
+	if _, err := call(admin, slash, pack("slash", validators[1]), new(big.Int)); err == nil {
+		t.Fatalf("slash accepted from non coinbase")
+	}
+	for ; number <= 3; number++ {
+		if _, err := call(validators[0], slash, pack("slash", validators[1]), new(big.Int)); err != nil {
+			t.Fatalf("slash failed: %v", err)
+		}
+	}
+	ret, err := call(admin, slash, pack("getSlashIndicator", validators[1]), new(big.Int))
+	if err != nil {
+		t.Fatalf("getSlashIndicator failed: %v", err)
+	}
+	if count := new(big.Int).SetBytes(ret[32:64]); count.Uint64() != 3 {
+		t.Fatalf("slash count mismatch: have %v, want 3", count)
+	}
+	if count := statedb.GetState(slash, DevnetSlashKey(validators[1])); count.Big().Uint64() != 3 {
+		t.Fatalf("slash slot mismatch: have %x", count)
+	}
+	// Only the admin may deliver validator set packages through the relay
+	replaced := []common.Address{{0x04}, {0x05}}
+	if input := pack("handleSynPackage", uint8(devnetStakingChannel), devnetValidatorSetPackage(replaced)); !bytes.Equal(input, DevnetUpdateValidatorsData(replaced)) {
+		t.Fatalf("validator update encoding mismatch: have %x, want %x", DevnetUpdateValidatorsData(replaced), input)
+	}
+	if _, err := call(validators[0], relay, DevnetUpdateValidatorsData(replaced), new(big.Int)); err != nil {
+		t.Fatalf("relay call failed: %v", err)
+	}
+	if have := getValidators(); !reflect.DeepEqual(have, validators) {
+		t.Fatalf("validators replaced by non admin: %v", have)
+	}
+	if _, err := call(admin, relay, DevnetUpdateValidatorsData(replaced), new(big.Int)); err != nil {
+		t.Fatalf("validator update failed: %v", err)
+	}
+	if have := getValidators(); !reflect.DeepEqual(have, replaced) {
+		t.Fatalf("updated validators mismatch: have %v, want %v", have, replaced)
+	}
+	if _, err := call(admin, validatorSet, DevnetUpdateValidatorsData(validators), new(big.Int)); err == nil {
+		t.Fatalf("validator update accepted from non cross chain contract")
+	}
+}
@@ -311,43 +311,58 @@ func init() {
 	}
 }
 
-func UpgradeBuildInSystemContract(config *params.ChainConfig, blockNumber *big.Int, statedb *state.StateDB) {
+func UpgradeBuildInSystemContract(config *params.ChainConfig, blockNumber *big.Int, statedb *state.StateDB) error {
 	if config == nil || blockNumber == nil || statedb == nil {
-		return
-	}
-	var network string
-	switch GenesisHash {
-	/* Add mainnet genesis hash */
-	case params.BSCGenesisHash:
-		network = mainNet
-	case params.ChapelGenesisHash:
-		network = chapelNet
-	case params.RialtoGenesisHash:
-		network = rialtoNet
-	default:
-		network = defaultNet
+		return nil
 	}
+	network := networkOf(GenesisHash)
 
 	logger := log.New("system-contract-upgrade", network)
 	if config.IsOnRamanujan(blockNumber) {
-		applySystemContractUpgrade(ramanujanUpgrade[network], blockNumber, statedb, logger)
+		upgrade, err := upgradeOf(ramanujanUpgrade, network, config, RamanujanFork)
+		if err != nil {
+			return err
+		}
+		applySystemContractUpgrade(upgrade, blockNumber, statedb, logger)
 	}
 
 	if config.IsOnNiels(blockNumber) {
-		applySystemContractUpgrade(nielsUpgrade[network], blockNumber, statedb, logger)
+		upgrade, err := upgradeOf(nielsUpgrade, network, config, NielsFork)
+		if err != nil {
+			return err
+		}
+		applySystemContractUpgrade(upgrade, blockNumber, statedb, logger)
 	}
 
 	if config.IsOnMirrorSync(blockNumber) {
-		applySystemContractUpgrade(mirrorUpgrade[network], blockNumber, statedb, logger)
+		upgrade, err := upgradeOf(mirrorUpgrade, network, config, MirrorSyncFork)
+		if err != nil {
+			return err
+		}
+		applySystemContractUpgrade(upgrade, blockNumber, statedb, logger)
 	}
 
 	if config.IsOnBruno(blockNumber) {
-		applySystemContractUpgrade(brunoUpgrade[network], blockNumber, statedb, logger)
+		upgrade, err := upgradeOf(brunoUpgrade, network, config, BrunoFork)
+		if err != nil {
+			return err
+		}
+		applySystemContractUpgrade(upgrade, blockNumber, statedb, logger)
 	}
 
 	/*
 		apply other upgrades
 	*/
+	return nil
+}
+
+// upgradeOf returns the upgrade of the network at a fork. Networks without
+// built-in upgrades use the ones configured in their chain config.
+func upgradeOf(builtin map[string]*Upgrade, network string, config *params.ChainConfig, fork string) (*Upgrade, error) {
+	if network == defaultNet {
+		return configuredUpgrade(config, fork)
+	}
+	return builtin[network], nil
 }
 
 func applySystemContractUpgrade(upgrade *Upgrade, blockNumber *big.Int, statedb *state.StateDB, logger log.Logger) {
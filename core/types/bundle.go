@@ -0,0 +1,88 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/binary"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Bundle is an ordered list of transactions which must be included atomically
+// at the top of a specific block, or not at all.
+type Bundle struct {
+	Txs               Transactions
+	BlockNumber       *big.Int      // Block the bundle targets
+	MinTimestamp      uint64        // Earliest block timestamp the bundle is valid at, 0 if unbounded
+	MaxTimestamp      uint64        // Latest block timestamp the bundle is valid at, 0 if unbounded
+	RevertingTxHashes []common.Hash // Transactions allowed to revert without invalidating the bundle
+
+	// caches
+	hash atomic.Value
+}
+
+// Hash returns the bundle hash, the keccak256 of the concatenated transaction
+// hashes followed by the target block number and the timestamp window, each
+// as a big endian uint64.
+func (b *Bundle) Hash() common.Hash {
+	if hash := b.hash.Load(); hash != nil {
+		return hash.(common.Hash)
+	}
+	hasher := crypto.NewKeccakState()
+	for _, tx := range b.Txs {
+		hasher.Write(tx.Hash().Bytes())
+	}
+	var enc [24]byte
+	if b.BlockNumber != nil {
+		binary.BigEndian.PutUint64(enc[:8], b.BlockNumber.Uint64())
+	}
+	binary.BigEndian.PutUint64(enc[8:16], b.MinTimestamp)
+	binary.BigEndian.PutUint64(enc[16:], b.MaxTimestamp)
+	hasher.Write(enc[:])
+	h := common.BytesToHash(hasher.Sum(nil))
+	b.hash.Store(h)
+	return h
+}
+
+// Valid reports whether the bundle may be included in a block with the given
+// number and timestamp.
+func (b *Bundle) Valid(number *big.Int, timestamp uint64) bool {
+	if b.BlockNumber.Cmp(number) != 0 {
+		return false
+	}
+	if b.MinTimestamp != 0 && timestamp < b.MinTimestamp {
+		return false
+	}
+	if b.MaxTimestamp != 0 && timestamp > b.MaxTimestamp {
+		return false
+	}
+	return true
+}
+
+// MayRevert reports whether the transaction with the given hash is allowed to
+// revert without invalidating the bundle.
+func (b *Bundle) MayRevert(hash common.Hash) bool {
+	for _, h := range b.RevertingTxHashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/downloader"
@@ -57,6 +58,7 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 // Config contains the configuration options of the ETH protocol.
@@ -69,7 +71,10 @@ type Ethereum struct {
 
 	// Handlers
 	txPool             *core.TxPool
+	bundlePool         *core.BundlePool
 	blockchain         *core.BlockChain
+	simulator          *core.Simulator
+	pruner             *pruner.OnlinePruner
 	handler            *handler
 	ethDialCandidates  enode.Iterator
 	snapDialCandidates enode.Iterator
@@ -138,11 +143,35 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
 	}
+	if config.HistoryDir != "" {
+		history, err := rawdb.NewHistoryDir(config.HistoryDir, genesisHash, func() types.TrieHasher { return trie.NewStackTrie(nil) })
+		if err != nil {
+			return nil, err
+		}
+		if err := rawdb.SetHistoryProvider(chainDb, history); err != nil {
+			history.Close()
+			return nil, err
+		}
+	}
+	if len(config.OverrideUpgrades) > 0 {
+		if chainConfig.Parlia == nil {
+			return nil, errors.New("system contract upgrades require the parlia engine")
+		}
+		parlia := *chainConfig.Parlia
+		parlia.Upgrades = config.OverrideUpgrades
+		overridden := *chainConfig
+		overridden.Parlia = &parlia
+		chainConfig = &overridden
+	}
+	if err := systemcontracts.ValidateUpgrades(genesisHash, chainConfig); err != nil {
+		return nil, err
+	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
 	if err := pruner.RecoverPruning(stack.ResolvePath(""), chainDb, stack.ResolvePath(config.TrieCleanCacheJournal), config.TriesInMemory); err != nil {
 		log.Error("Failed to recover state", "error", err)
 	}
+	pruner.RecoverOnlinePruning(chainDb, stack.ResolvePath(config.TrieCleanCacheJournal))
 	eth := &Ethereum{
 		config:            config,
 		chainDb:           chainDb,
@@ -203,10 +232,19 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	// TODO diffsync performance is not as expected, disable it when pipecommit is enabled for now
 	if config.DiffSync && !config.PipeCommit {
 		bcOps = append(bcOps, core.EnableLightProcessor)
+		if config.DiffVerifyRatio > 0 {
+			bcOps = append(bcOps, core.EnableDiffVerification(config.DiffVerifyRatio))
+		}
 	}
 	if config.PipeCommit {
 		bcOps = append(bcOps, core.EnablePipelineCommit)
 	}
+	if config.ContractIndex {
+		bcOps = append(bcOps, core.EnableContractIndex)
+	}
+	if config.ParallelExecution {
+		bcOps = append(bcOps, core.EnableParallelExecution(runtime.NumCPU()))
+	}
 	if config.PersistDiff {
 		bcOps = append(bcOps, core.EnablePersistDiff(config.DiffBlock))
 	}
@@ -221,11 +259,23 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
+	if parlia, ok := eth.engine.(*parlia.Parlia); ok {
+		parlia.WatchChain(eth.blockchain)
+	}
+	eth.simulator = core.NewSimulator(eth.blockchain, vm.Config{})
+	if config.OnlinePruning {
+		onlineConfig := pruner.DefaultOnlineConfig
+		onlineConfig.Throttle = config.OnlinePruningThrottle
+		if eth.pruner, err = pruner.NewOnlinePruner(chainDb, eth.blockchain, onlineConfig); err != nil {
+			return nil, err
+		}
+	}
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
 	eth.txPool = core.NewTxPool(config.TxPool, chainConfig, eth.blockchain)
+	eth.bundlePool = core.NewBundlePool(config.BundlePool, chainConfig, eth.blockchain)
 
 	// Permit the downloader to use the trie cache allowance during fast sync
 	cacheLimit := cacheConfig.TrieCleanLimit + cacheConfig.TrieDirtyLimit + cacheConfig.SnapshotLimit
@@ -535,7 +585,9 @@ func (s *Ethereum) Miner() *miner.Miner { return s.miner }
 
 func (s *Ethereum) AccountManager() *accounts.Manager  { return s.accountManager }
 func (s *Ethereum) BlockChain() *core.BlockChain       { return s.blockchain }
+func (s *Ethereum) Simulator() *core.Simulator         { return s.simulator }
 func (s *Ethereum) TxPool() *core.TxPool               { return s.txPool }
+func (s *Ethereum) BundlePool() *core.BundlePool       { return s.bundlePool }
 func (s *Ethereum) EventMux() *event.TypeMux           { return s.eventMux }
 func (s *Ethereum) Engine() consensus.Engine           { return s.engine }
 func (s *Ethereum) ChainDb() ethdb.Database            { return s.chainDb }
@@ -575,6 +627,11 @@ func (s *Ethereum) Start() error {
 	}
 	// Start the networking layer and the light server if requested
 	s.handler.Start(maxPeers)
+
+	// Start pruning the stale state in the background if requested
+	if s.pruner != nil {
+		s.pruner.Start()
+	}
 	return nil
 }
 
@@ -589,11 +646,16 @@ func (s *Ethereum) Stop() error {
 	// Then stop everything else.
 	s.bloomIndexer.Close()
 	close(s.closeBloomHandler)
+	s.simulator.Stop()
 	s.txPool.Stop()
+	s.bundlePool.Stop()
 	s.miner.Stop()
 	s.miner.Close()
 	// TODO this is a hotfix for https://github.com/ethereum/go-ethereum/issues/22892, need a better solution
 	time.Sleep(5 * time.Second)
+	if s.pruner != nil {
+		s.pruner.Stop()
+	}
 	s.blockchain.Stop()
 	s.engine.Close()
 	rawdb.PopUncleanShutdownMarker(s.chainDb)
@@ -53,8 +53,11 @@ var (
 	ttlScaling       = 3                // Constant scaling factor for RTT -> TTL conversion
 	ttlLimit         = time.Minute      // Maximum TTL allowance to prevent reaching crazy timeouts
 
-	diffFetchTick  = 10 * time.Millisecond
-	diffFetchLimit = 5
+	diffFetchTick       = 10 * time.Millisecond
+	diffFetchLimit      = 5               // Distance from the chain head at which to request a diff layer by hash
+	diffRangeFetchLimit = 128             // Distance from the chain head at which to request diff layers by range
+	diffRangeBatch      = 32              // Number of blocks to request diff layers for in a range request
+	diffRangeBytes      = 2 * 1024 * 1024 // Soft limit of the size of a range response
 
 	qosTuningPeers   = 5    // Number of peers to tune based on (best peers)
 	qosConfidenceCap = 10   // Number of peers above which not to modify RTT confidence
@@ -229,6 +232,13 @@ type IDiffPeer interface {
 	RequestDiffLayers([]common.Hash) error
 }
 
+// IDiffRangePeer is a diff peer which may serve diff layers by block range.
+type IDiffRangePeer interface {
+	IDiffPeer
+	SupportsRange() bool
+	RequestDiffLayersByRange(from uint64, count uint64, bytes uint64) error
+}
+
 type IPeerSet interface {
 	GetDiffPeer(string) IDiffPeer
 }
@@ -240,24 +250,47 @@ func EnableDiffFetchOp(peers IPeerSet) DownloadOption {
 				go func() {
 					ticker := time.NewTicker(diffFetchTick)
 					defer ticker.Stop()
-					for _, r := range results {
+					for i := 0; i < len(results); {
+						// Peers serving ranges get asked for a batch of blocks further
+						// ahead, the others for one diff layer at a time as it turns out
+						// a diff layer is 5x larger than block
+						r := results[i]
+						ep := peers.GetDiffPeer(r.pid)
+						rp, ranged := ep.(IDiffRangePeer)
+						ranged = ranged && rp.SupportsRange()
+
+						limit := int64(diffFetchLimit)
+						if ranged {
+							limit = int64(diffRangeFetchLimit)
+						}
 					Wait:
 						for {
 							select {
 							case <-stop:
 								return
 							case <-ticker.C:
-								if dl.blockchain.CurrentHeader().Number.Int64()+int64(diffFetchLimit) > r.Header.Number.Int64() {
+								if dl.blockchain.CurrentHeader().Number.Int64()+limit > r.Header.Number.Int64() {
 									break Wait
 								}
 							}
 						}
-						if ep := peers.GetDiffPeer(r.pid); ep != nil {
-							// It turns out a diff layer is 5x larger than block, we just request one diffLayer each time
-							err := ep.RequestDiffLayers([]common.Hash{r.Header.Hash()})
-							if err != nil {
-								return
+						var err error
+						switch {
+						case ranged:
+							count := len(results) - i
+							if count > diffRangeBatch {
+								count = diffRangeBatch
 							}
+							err = rp.RequestDiffLayersByRange(r.Header.Number.Uint64(), uint64(count), uint64(diffRangeBytes))
+							i += count
+						case ep != nil:
+							err = ep.RequestDiffLayers([]common.Hash{r.Header.Hash()})
+							i++
+						default:
+							i++
+						}
+						if err != nil {
+							return
 						}
 					}
 				}()
@@ -1711,3 +1711,93 @@ func testCheckpointEnforcement(t *testing.T, protocol uint, mode SyncMode) {
 		assertOwnChain(t, tester, chain.len())
 	}
 }
+
+// diffTesterPeer records the diff layer requests issued to a peer.
+type diffTesterPeer struct {
+	ranged   bool
+	requests chan string
+}
+
+func (p *diffTesterPeer) RequestDiffLayers(hashes []common.Hash) error {
+	p.requests <- fmt.Sprintf("hash %x", hashes[0])
+	return nil
+}
+
+func (p *diffTesterPeer) SupportsRange() bool { return p.ranged }
+
+func (p *diffTesterPeer) RequestDiffLayersByRange(from uint64, count uint64, bytes uint64) error {
+	p.requests <- fmt.Sprintf("range %d-%d", from, from+count-1)
+	return nil
+}
+
+type diffTesterPeerSet map[string]*diffTesterPeer
+
+func (ps diffTesterPeerSet) GetDiffPeer(id string) IDiffPeer {
+	if p, ok := ps[id]; ok {
+		return p
+	}
+	return nil
+}
+
+// Tests that diff layers are requested by range ahead of the chain head from the
+// peers supporting it, and one by one close to the head from the others.
+func TestDiffFetch(t *testing.T) {
+	t.Parallel()
+
+	results := func(pid string, count int) []*fetchResult {
+		results := make([]*fetchResult, count)
+		for i := range results {
+			results[i] = &fetchResult{pid: pid, Header: testChainBase.headerm[testChainBase.chain[i+1]]}
+		}
+		return results
+	}
+	tests := []struct {
+		ranged bool
+		expect []string
+	}{
+		{
+			ranged: true,
+			expect: []string{"range 1-32", "range 33-64", "range 65-96", "range 97-100"},
+		},
+		{
+			ranged: false,
+			expect: []string{
+				fmt.Sprintf("hash %x", testChainBase.chain[1]),
+				fmt.Sprintf("hash %x", testChainBase.chain[2]),
+				fmt.Sprintf("hash %x", testChainBase.chain[3]),
+				fmt.Sprintf("hash %x", testChainBase.chain[4]),
+			},
+		},
+	}
+	for i, tt := range tests {
+		tester := newTester()
+		peer := &diffTesterPeer{ranged: tt.ranged, requests: make(chan string, 100)}
+		EnableDiffFetchOp(diffTesterPeerSet{"peer": peer})(tester.downloader)
+
+		// The local chain stays at the genesis, so only the blocks close enough
+		// to it get their diff layers requested
+		stop := make(chan struct{})
+		tester.downloader.chainInsertHook(results("peer", 100), stop)
+
+		var have []string
+		for len(have) < len(tt.expect) {
+			select {
+			case req := <-peer.requests:
+				have = append(have, req)
+			case <-time.After(time.Second):
+				t.Fatalf("test %d: requests timed out, have %v", i, have)
+			}
+		}
+		select {
+		case req := <-peer.requests:
+			t.Errorf("test %d: unexpected request %s", i, req)
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(stop)
+		tester.terminate()
+
+		if fmt.Sprint(have) != fmt.Sprint(tt.expect) {
+			t.Errorf("test %d: requests mismatch: have %v, want %v", i, have, tt.expect)
+		}
+	}
+}
@@ -81,6 +81,7 @@ var Defaults = Config{
 	TriesInMemory:           128,
 	SnapshotCache:           102,
 	DiffBlock:               uint64(86400),
+	OnlinePruningThrottle:   100 * time.Millisecond,
 	Miner: miner.Config{
 		GasFloor:      8000000,
 		GasCeil:       8000000,
@@ -88,10 +89,12 @@ var Defaults = Config{
 		Recommit:      3 * time.Second,
 		DelayLeftOver: 50 * time.Millisecond,
 	},
-	TxPool:      core.DefaultTxPoolConfig,
-	RPCGasCap:   25000000,
-	GPO:         FullNodeGPO,
-	RPCTxFeeCap: 1, // 1 ether
+	TxPool:        core.DefaultTxPoolConfig,
+	BundlePool:    core.DefaultBundlePoolConfig,
+	RPCGasCap:     25000000,
+	RPCEVMTimeout: 5 * time.Second,
+	GPO:           FullNodeGPO,
+	RPCTxFeeCap:   1, // 1 ether
 }
 
 func init() {
@@ -135,12 +138,17 @@ type Config struct {
 
 	NoPruning           bool // Whether to disable pruning and flush everything to disk
 	DirectBroadcast     bool
-	DisableSnapProtocol bool //Whether disable snap protocol
-	DiffSync            bool // Whether support diff sync
+	DisableSnapProtocol bool    //Whether disable snap protocol
+	DiffSync            bool    // Whether support diff sync
+	DiffVerifyRatio     float64 // Fraction of the diff synced blocks to re-execute for verification
 	PipeCommit          bool
 	RangeLimit          bool
 
-	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	TxLookupLimit         uint64        `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	ContractIndex         bool          `toml:",omitempty"` // Whether to index the transactions creating contracts
+	OnlinePruning         bool          `toml:",omitempty"` // Whether to prune the stale state in the background
+	OnlinePruningThrottle time.Duration `toml:",omitempty"` // Pause between two deletion batches of the online pruner
+	ParallelExecution     bool          `toml:",omitempty"` // Whether to execute the transactions of blocks speculatively in parallel
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
@@ -165,6 +173,7 @@ type Config struct {
 	DatabaseCache      int
 	DatabaseFreezer    string
 	DatabaseDiff       string
+	HistoryDir         string `toml:",omitempty"` // Directory of the history files serving the pruned ancient data
 	PersistDiff        bool
 	DiffBlock          uint64
 
@@ -186,6 +195,9 @@ type Config struct {
 	// Transaction pool options
 	TxPool core.TxPoolConfig
 
+	// Bundle pool options
+	BundlePool core.BundlePoolConfig
+
 	// Gas Price Oracle options
 	GPO gasprice.Config
 
@@ -204,6 +216,9 @@ type Config struct {
 	// RPCGasCap is the global gas cap for eth-call variants.
 	RPCGasCap uint64
 
+	// RPCEVMTimeout is the global timeout for bundle simulations.
+	RPCEVMTimeout time.Duration
+
 	// RPCTxFeeCap is the global transaction fee(price * gaslimit) cap for
 	// send-transction variants. The unit is ether.
 	RPCTxFeeCap float64
@@ -216,6 +231,10 @@ type Config struct {
 
 	// Berlin block override (TODO: remove after the fork)
 	OverrideBerlin *big.Int `toml:",omitempty"`
+
+	// System contract upgrades of private parlia networks, replacing the ones
+	// in the chain config
+	OverrideUpgrades []*params.SystemContractUpgrade `toml:",omitempty"`
 }
 
 // CreateConsensusEngine creates a consensus engine for the given chain configuration.
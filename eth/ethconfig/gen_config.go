@@ -26,6 +26,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		NoPruning               bool
 		NoPrefetch              bool
 		TxLookupLimit           uint64                 `toml:",omitempty"`
+		ContractIndex           bool                   `toml:",omitempty"`
+		OnlinePruning           bool                   `toml:",omitempty"`
+		OnlinePruningThrottle   time.Duration          `toml:",omitempty"`
+		ParallelExecution       bool                   `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               int                    `toml:",omitempty"`
 		LightIngress            int                    `toml:",omitempty"`
@@ -42,6 +46,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		DatabaseCache           int
 		DatabaseFreezer         string
 		DatabaseDiff            string
+		HistoryDir              string `toml:",omitempty"`
 		TrieCleanCache          int
 		TrieCleanCacheJournal   string        `toml:",omitempty"`
 		TrieCleanCacheRejournal time.Duration `toml:",omitempty"`
@@ -55,12 +60,14 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Miner                   miner.Config
 		Ethash                  ethash.Config
 		TxPool                  core.TxPoolConfig
+		BundlePool              core.BundlePoolConfig
 		GPO                     gasprice.Config
 		EnablePreimageRecording bool
 		DocRoot                 string `toml:"-"`
 		EWASMInterpreter        string
 		EVMInterpreter          string
 		RPCGasCap               uint64                         `toml:",omitempty"`
+		RPCEVMTimeout           time.Duration                  `toml:",omitempty"`
 		RPCTxFeeCap             float64                        `toml:",omitempty"`
 		Checkpoint              *params.TrustedCheckpoint      `toml:",omitempty"`
 		CheckpointOracle        *params.CheckpointOracleConfig `toml:",omitempty"`
@@ -74,6 +81,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.SnapDiscoveryURLs = c.SnapDiscoveryURLs
 	enc.NoPruning = c.NoPruning
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.ContractIndex = c.ContractIndex
+	enc.OnlinePruning = c.OnlinePruning
+	enc.OnlinePruningThrottle = c.OnlinePruningThrottle
+	enc.ParallelExecution = c.ParallelExecution
 	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -90,6 +101,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.DatabaseCache = c.DatabaseCache
 	enc.DatabaseFreezer = c.DatabaseFreezer
 	enc.DatabaseDiff = c.DatabaseDiff
+	enc.HistoryDir = c.HistoryDir
 	enc.TrieCleanCache = c.TrieCleanCache
 	enc.TrieCleanCacheJournal = c.TrieCleanCacheJournal
 	enc.TrieCleanCacheRejournal = c.TrieCleanCacheRejournal
@@ -103,12 +115,14 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Miner = c.Miner
 	enc.Ethash = c.Ethash
 	enc.TxPool = c.TxPool
+	enc.BundlePool = c.BundlePool
 	enc.GPO = c.GPO
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
 	enc.DocRoot = c.DocRoot
 	enc.EWASMInterpreter = c.EWASMInterpreter
 	enc.EVMInterpreter = c.EVMInterpreter
 	enc.RPCGasCap = c.RPCGasCap
+	enc.RPCEVMTimeout = c.RPCEVMTimeout
 	enc.RPCTxFeeCap = c.RPCTxFeeCap
 	enc.Checkpoint = c.Checkpoint
 	enc.CheckpointOracle = c.CheckpointOracle
@@ -127,6 +141,10 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		NoPruning               *bool
 		NoPrefetch              *bool
 		TxLookupLimit           *uint64                `toml:",omitempty"`
+		ContractIndex           *bool                  `toml:",omitempty"`
+		OnlinePruning           *bool                  `toml:",omitempty"`
+		OnlinePruningThrottle   *time.Duration         `toml:",omitempty"`
+		ParallelExecution       *bool                  `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               *int                   `toml:",omitempty"`
 		LightIngress            *int                   `toml:",omitempty"`
@@ -143,6 +161,7 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		DatabaseCache           *int
 		DatabaseFreezer         *string
 		DatabaseDiff            *string
+		HistoryDir              *string `toml:",omitempty"`
 		PersistDiff             *bool
 		DiffBlock               *uint64 `toml:",omitempty"`
 		TrieCleanCache          *int
@@ -156,12 +175,14 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Miner                   *miner.Config
 		Ethash                  *ethash.Config
 		TxPool                  *core.TxPoolConfig
+		BundlePool              *core.BundlePoolConfig
 		GPO                     *gasprice.Config
 		EnablePreimageRecording *bool
 		DocRoot                 *string `toml:"-"`
 		EWASMInterpreter        *string
 		EVMInterpreter          *string
 		RPCGasCap               *uint64                        `toml:",omitempty"`
+		RPCEVMTimeout           *time.Duration                 `toml:",omitempty"`
 		RPCTxFeeCap             *float64                       `toml:",omitempty"`
 		Checkpoint              *params.TrustedCheckpoint      `toml:",omitempty"`
 		CheckpointOracle        *params.CheckpointOracleConfig `toml:",omitempty"`
@@ -194,6 +215,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.ContractIndex != nil {
+		c.ContractIndex = *dec.ContractIndex
+	}
+	if dec.OnlinePruning != nil {
+		c.OnlinePruning = *dec.OnlinePruning
+	}
+	if dec.OnlinePruningThrottle != nil {
+		c.OnlinePruningThrottle = *dec.OnlinePruningThrottle
+	}
+	if dec.ParallelExecution != nil {
+		c.ParallelExecution = *dec.ParallelExecution
+	}
 	if dec.Whitelist != nil {
 		c.Whitelist = dec.Whitelist
 	}
@@ -242,6 +275,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseDiff != nil {
 		c.DatabaseDiff = *dec.DatabaseDiff
 	}
+	if dec.HistoryDir != nil {
+		c.HistoryDir = *dec.HistoryDir
+	}
 	if dec.PersistDiff != nil {
 		c.PersistDiff = *dec.PersistDiff
 	}
@@ -281,6 +317,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TxPool != nil {
 		c.TxPool = *dec.TxPool
 	}
+	if dec.BundlePool != nil {
+		c.BundlePool = *dec.BundlePool
+	}
 	if dec.GPO != nil {
 		c.GPO = *dec.GPO
 	}
@@ -299,6 +338,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.RPCGasCap != nil {
 		c.RPCGasCap = *dec.RPCGasCap
 	}
+	if dec.RPCEVMTimeout != nil {
+		c.RPCEVMTimeout = *dec.RPCEVMTimeout
+	}
 	if dec.RPCTxFeeCap != nil {
 		c.RPCTxFeeCap = *dec.RPCTxFeeCap
 	}
@@ -46,6 +46,9 @@ const (
 	// txChanSize is the size of channel listening to NewTxsEvent.
 	// The number is referenced from the size of tx pool.
 	txChanSize = 4096
+
+	// badDiffChanSize is the size of channel listening to BadDiffEvent.
+	badDiffChanSize = 16
 )
 
 var (
@@ -127,6 +130,8 @@ type handler struct {
 	reannoTxsCh   chan core.ReannoTxsEvent
 	reannoTxsSub  event.Subscription
 	minedBlockSub *event.TypeMuxSubscription
+	badDiffCh     chan core.BadDiffEvent
+	badDiffSub    event.Subscription
 
 	whitelist map[uint64]common.Hash
 
@@ -449,6 +454,14 @@ func (h *handler) Start(maxPeers int) {
 	h.minedBlockSub = h.eventMux.Subscribe(core.NewMinedBlockEvent{})
 	go h.minedBroadcastLoop()
 
+	// disconnect peers serving bad diff layers
+	if h.diffSync {
+		h.wg.Add(1)
+		h.badDiffCh = make(chan core.BadDiffEvent, badDiffChanSize)
+		h.badDiffSub = h.chain.SubscribeBadDiffEvent(h.badDiffCh)
+		go h.badDiffLoop()
+	}
+
 	// start sync handlers
 	h.wg.Add(2)
 	go h.chainSync.loop()
@@ -459,6 +472,9 @@ func (h *handler) Stop() {
 	h.txsSub.Unsubscribe()        // quits txBroadcastLoop
 	h.reannoTxsSub.Unsubscribe()  // quits txReannounceLoop
 	h.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+	if h.badDiffSub != nil {
+		h.badDiffSub.Unsubscribe() // quits badDiffLoop
+	}
 
 	// Quit chainSync and txsync64.
 	// After this is done, no new peers will be accepted.
@@ -605,6 +621,25 @@ func (h *handler) txBroadcastLoop() {
 	}
 }
 
+// badDiffLoop disconnects the peers which served diff layers contradicted by the
+// full execution of their blocks.
+func (h *handler) badDiffLoop() {
+	defer h.wg.Done()
+	for {
+		select {
+		case event := <-h.badDiffCh:
+			for _, id := range event.Peers {
+				if h.peers.peer(id) != nil {
+					log.Warn("Dropping peer serving bad diff layer", "peer", id, "number", event.Block.NumberU64(), "hash", event.Block.Hash(), "diff", event.DiffHash)
+					h.removePeer(id)
+				}
+			}
+		case <-h.badDiffSub.Err():
+			return
+		}
+	}
+}
+
 // txReannounceLoop announces local pending transactions to connected peers again.
 func (h *handler) txReannounceLoop() {
 	defer h.wg.Done()
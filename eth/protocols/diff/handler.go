@@ -18,6 +18,10 @@ const (
 
 	// maxDiffLayerServe is the maximum number of diff layers to serve.
 	maxDiffLayerServe = 128
+
+	// maxDiffRangeLookups is the maximum number of blocks looked up to serve a
+	// range request, blocks without transactions having no diff layer.
+	maxDiffRangeLookups = 2 * maxDiffLayerServe
 )
 
 var requestTracker = NewTracker(time.Minute)
@@ -128,6 +132,18 @@ func handleMessage(backend Backend, peer *Peer) error {
 		})
 		return nil
 
+	case msg.Code == GetDiffLayersByRangeMsg && peer.version >= Diff2:
+		req := new(GetDiffLayersByRangePacket)
+		if err := msg.Decode(req); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		diffs := answerDiffLayersByRangeQuery(backend, req)
+
+		return p2p.Send(peer.rw, FullDiffLayerMsg, &FullDiffLayersPacket{
+			RequestId:        req.RequestId,
+			DiffLayersPacket: diffs,
+		})
+
 	case msg.Code == DiffLayerMsg:
 		// A batch of trie nodes arrived to one of our previous requests
 		res := new(DiffLayersPacket)
@@ -170,6 +186,31 @@ func answerDiffLayersQuery(backend Backend, query *GetDiffLayersPacket) []rlp.Ra
 	return diffLayers
 }
 
+func answerDiffLayersByRangeQuery(backend Backend, query *GetDiffLayersByRangePacket) []rlp.RawValue {
+	limit := uint64(softResponseLimit)
+	if query.Bytes < limit {
+		limit = query.Bytes
+	}
+	var (
+		chain      = backend.Chain()
+		head       = chain.CurrentBlock().NumberU64()
+		bytes      uint64
+		diffLayers []rlp.RawValue
+	)
+	for lookups := uint64(0); lookups < query.Count && lookups < maxDiffRangeLookups; lookups++ {
+		number := query.From + lookups
+		if number > head || number < query.From || bytes >= limit || len(diffLayers) >= maxDiffLayerServe {
+			break
+		}
+		hash := chain.GetCanonicalHash(number)
+		if data := chain.GetDiffLayerRLP(hash); len(data) != 0 {
+			diffLayers = append(diffLayers, data)
+			bytes += uint64(len(data))
+		}
+	}
+	return diffLayers
+}
+
 // NodeInfo represents a short summary of the `diff` sub-protocol metadata
 // known about the host peer.
 type NodeInfo struct{}
@@ -115,7 +115,8 @@ func (b *testBackend) Handle(*Peer, Packet) error {
 	panic("data processing tests should be done in the handler package")
 }
 
-func TestGetDiffLayers(t *testing.T) { testGetDiffLayers(t, Diff1) }
+func TestGetDiffLayers(t *testing.T)  { testGetDiffLayers(t, Diff1) }
+func TestGetDiffLayers2(t *testing.T) { testGetDiffLayers(t, Diff2) }
 
 func testGetDiffLayers(t *testing.T, protocol uint) {
 	t.Parallel()
@@ -190,3 +191,50 @@ func testGetDiffLayers(t *testing.T, protocol uint) {
 		t.Errorf("test: diff layer mismatch: %v", err)
 	}
 }
+
+func TestGetDiffLayersByRange(t *testing.T) {
+	t.Parallel()
+
+	blockNum := 512
+	backend := newTestBackend(blockNum)
+	defer backend.close()
+
+	peer, _ := newTestPeer("peer", Diff2, backend)
+	defer peer.close()
+
+	diffs := func(from, count uint64) []rlp.RawValue {
+		var diffs []rlp.RawValue
+		for number := from; number < from+count && number <= uint64(blockNum); number++ {
+			if data := backend.chain.GetDiffLayerRLP(backend.chain.GetCanonicalHash(number)); len(data) != 0 {
+				diffs = append(diffs, data)
+			}
+		}
+		return diffs
+	}
+	tests := []struct {
+		from, count, bytes uint64
+		expect             []rlp.RawValue
+	}{
+		// A range within the recent chain is served entirely
+		{from: 400, count: 16, bytes: softResponseLimit, expect: diffs(400, 16)},
+		// A range beyond the head is served up to the head
+		{from: 500, count: 32, bytes: softResponseLimit, expect: diffs(500, 13)},
+		{from: 600, count: 32, bytes: softResponseLimit, expect: nil},
+		// The number of diff layers served is capped
+		{from: 1, count: 1024, bytes: softResponseLimit, expect: diffs(1, maxDiffLayerServe)},
+		// The response is cut once the requested size is reached
+		{from: 400, count: 16, bytes: 1, expect: diffs(400, 1)},
+	}
+	for i, tt := range tests {
+		if len(tt.expect) == 0 && tt.from <= uint64(blockNum) {
+			t.Fatalf("test %d: no diff layers in range", i)
+		}
+		p2p.Send(peer.app, GetDiffLayersByRangeMsg, GetDiffLayersByRangePacket{RequestId: uint64(i), From: tt.from, Count: tt.count, Bytes: tt.bytes})
+		if err := p2p.ExpectMsg(peer.app, FullDiffLayerMsg, FullDiffLayersPacket{
+			RequestId:        uint64(i),
+			DiffLayersPacket: tt.expect,
+		}); err != nil {
+			t.Errorf("test %d: diff layers mismatch: %v", i, err)
+		}
+	}
+}
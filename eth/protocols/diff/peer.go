@@ -94,6 +94,28 @@ func (p *Peer) RequestDiffLayers(hashes []common.Hash) error {
 	})
 }
 
+// SupportsRange returns whether the peer serves diff layers by block range.
+func (p *Peer) SupportsRange() bool {
+	return p.version >= Diff2
+}
+
+// RequestDiffLayersByRange fetches the diff layers of count canonical blocks
+// starting at from, the response being capped to roughly bytes.
+func (p *Peer) RequestDiffLayersByRange(from uint64, count uint64, bytes uint64) error {
+	if !p.SupportsRange() {
+		return errNoRangeSupport
+	}
+	id := rand.Uint64()
+
+	requestTracker.Track(p.id, p.version, GetDiffLayersByRangeMsg, FullDiffLayerMsg, id)
+	return p2p.Send(p.rw, GetDiffLayersByRangeMsg, GetDiffLayersByRangePacket{
+		RequestId: id,
+		From:      from,
+		Count:     count,
+		Bytes:     bytes,
+	})
+}
+
 func (p *Peer) SendDiffLayers(diffs []rlp.RawValue) error {
 	return p2p.Send(p.rw, DiffLayerMsg, diffs)
 }
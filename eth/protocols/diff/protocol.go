@@ -30,6 +30,7 @@ import (
 // Constants to match up protocol versions and messages
 const (
 	Diff1 = 1
+	Diff2 = 2
 )
 
 // ProtocolName is the official short name of the `diff` protocol used during
@@ -38,11 +39,11 @@ const ProtocolName = "diff"
 
 // ProtocolVersions are the supported versions of the `diff` protocol (first
 // is primary).
-var ProtocolVersions = []uint{Diff1}
+var ProtocolVersions = []uint{Diff2, Diff1}
 
 // protocolLengths are the number of implemented message corresponding to
 // different protocol versions.
-var protocolLengths = map[uint]uint64{Diff1: 4}
+var protocolLengths = map[uint]uint64{Diff2: 5, Diff1: 4}
 
 // maxMessageSize is the maximum cap on the size of a protocol message.
 const maxMessageSize = 10 * 1024 * 1024
@@ -52,6 +53,9 @@ const (
 	GetDiffLayerMsg  = 0x01
 	DiffLayerMsg     = 0x02
 	FullDiffLayerMsg = 0x03
+
+	// Protocol messages introduced in diff/2
+	GetDiffLayersByRangeMsg = 0x04
 )
 
 var defaultExtra = []byte{0x00}
@@ -62,6 +66,7 @@ var (
 	errInvalidMsgCode = errors.New("invalid message code")
 	errUnexpectedMsg  = errors.New("unexpected message code")
 	errNoCapMsg       = errors.New("miss cap message during handshake")
+	errNoRangeSupport = errors.New("peer does not support range requests")
 )
 
 // Packet represents a p2p message in the `diff` protocol.
@@ -75,6 +80,16 @@ type GetDiffLayersPacket struct {
 	BlockHashes []common.Hash
 }
 
+// GetDiffLayersByRangePacket requests the diff layers of a range of canonical
+// blocks. Blocks without a diff layer are skipped, the answer is a
+// FullDiffLayersPacket.
+type GetDiffLayersByRangePacket struct {
+	RequestId uint64
+	From      uint64 // Number of the first block of the range
+	Count     uint64 // Number of blocks in the range
+	Bytes     uint64 // Soft limit at which to stop returning data
+}
+
 func (p *DiffLayersPacket) Unpack() ([]*types.DiffLayer, error) {
 	diffLayers := make([]*types.DiffLayer, 0, len(*p))
 	hasher := sha3.NewLegacyKeccak256()
@@ -112,6 +127,9 @@ type FullDiffLayersPacket struct {
 func (*GetDiffLayersPacket) Name() string { return "GetDiffLayers" }
 func (*GetDiffLayersPacket) Kind() byte   { return GetDiffLayerMsg }
 
+func (*GetDiffLayersByRangePacket) Name() string { return "GetDiffLayersByRange" }
+func (*GetDiffLayersByRangePacket) Kind() byte   { return GetDiffLayersByRangeMsg }
+
 func (*DiffLayersPacket) Name() string { return "DiffLayers" }
 func (*DiffLayersPacket) Kind() byte   { return DiffLayerMsg }
 
@@ -0,0 +1,240 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers/balance"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// defaultOracleSignature is the oracle method used if none is configured. It
+	// matches the 1inch offchain oracle: getRateToEth(token, useSrcWrappers).
+	defaultOracleSignature = "getRateToEth(address,bool)"
+
+	// oracleGasLimit is the gas allowance of a single oracle price query.
+	oracleGasLimit = 5000000
+)
+
+// BalanceChangesConfig are the arguments of the balance change tracing methods.
+type BalanceChangesConfig struct {
+	Reexec *uint64
+
+	// Oracle is the contract used to value the changes in the native currency,
+	// no valuation is done if unset. OracleSignature is the method returning
+	// the native value of 10^18 base units of a token. Its first parameter is
+	// the token address, any further ones must be bools and are passed as true.
+	Oracle          *common.Address
+	OracleSignature string
+}
+
+// BalanceChangesResult is the outcome of a balance change trace. Deltas are
+// net changes per account; values are denominated in the native currency.
+type BalanceChangesResult struct {
+	Gas    uint64                                             `json:"gas"`
+	Failed bool                                               `json:"failed"`
+	Native map[common.Address]*hexutil.Big                    `json:"native"`
+	Tokens map[common.Address]map[common.Address]*hexutil.Big `json:"tokens"`
+	Rates  map[common.Address]*hexutil.Big                    `json:"rates,omitempty"`
+	Values map[common.Address]*hexutil.Big                    `json:"values,omitempty"`
+}
+
+// TraceBalanceChanges replays a mined transaction and returns the net native
+// and token balance changes it caused, optionally valued through a price
+// oracle.
+func (api *API) TraceBalanceChanges(ctx context.Context, hash common.Hash, config *BalanceChangesConfig) (*BalanceChangesResult, error) {
+	_, blockHash, blockNumber, index, err := api.backend.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// It shouldn't happen in practice.
+	if blockNumber == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	block, err := api.blockByNumberAndHash(ctx, rpc.BlockNumber(blockNumber), blockHash)
+	if err != nil {
+		return nil, err
+	}
+	msg, vmctx, statedb, err := api.backend.StateAtTransaction(ctx, block, int(index), reexec)
+	if err != nil {
+		return nil, err
+	}
+	txctx := &Context{
+		BlockHash: blockHash,
+		TxIndex:   int(index),
+		TxHash:    hash,
+	}
+	return api.traceBalanceChanges(msg, txctx, vmctx, statedb, config)
+}
+
+// TraceCallBalanceChanges executes the given call on top of the provided block
+// and returns the net native and token balance changes it would cause,
+// optionally valued through a price oracle.
+func (api *API) TraceCallBalanceChanges(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *BalanceChangesConfig) (*BalanceChangesResult, error) {
+	// Try to retrieve the specified block
+	var (
+		err   error
+		block *types.Block
+	)
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		block, err = api.blockByHash(ctx, hash)
+	} else if number, ok := blockNrOrHash.Number(); ok {
+		block, err = api.blockByNumber(ctx, number)
+	} else {
+		return nil, errors.New("invalid arguments; neither block nor hash specified")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// try to recompute the state
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	statedb, err := api.backend.StateAtBlock(ctx, block, reexec, nil, true, false)
+	if err != nil {
+		return nil, err
+	}
+	msg := args.ToMessage(api.backend.RPCGasCap())
+	vmctx := core.NewEVMBlockContext(block.Header(), api.chainContext(ctx), nil)
+
+	return api.traceBalanceChanges(msg, new(Context), vmctx, statedb, config)
+}
+
+// traceBalanceChanges executes the message with a balance tracer attached and
+// assembles the balance changes it caused.
+func (api *API) traceBalanceChanges(message core.Message, txctx *Context, vmctx vm.BlockContext, statedb *state.StateDB, config *BalanceChangesConfig) (*BalanceChangesResult, error) {
+	var (
+		chainConfig = api.backend.ChainConfig()
+		tracer      = balance.NewTracer()
+		vmenv       = vm.NewEVM(vmctx, core.NewEVMTxContext(message), statedb, chainConfig, vm.Config{Debug: true, Tracer: tracer})
+	)
+	api.prepareSystemTx(message, vmctx, statedb)
+	statedb.Prepare(txctx.TxHash, txctx.BlockHash, txctx.TxIndex)
+
+	result, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()))
+	if err != nil {
+		return nil, fmt.Errorf("tracing failed: %w", err)
+	}
+	// Fees are collected by the system address on parlia chains
+	feeRecipient := vmctx.Coinbase
+	if chainConfig.Parlia != nil {
+		feeRecipient = consensus.SystemAddress
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(result.UsedGas), message.GasPrice())
+	changes := balance.Analyze(tracer, statedb.GetLogs(txctx.TxHash), message.From(), feeRecipient, fee)
+
+	res := &BalanceChangesResult{
+		Gas:    result.UsedGas,
+		Failed: result.Failed(),
+		Native: formatDeltas(changes.Native),
+		Tokens: make(map[common.Address]map[common.Address]*hexutil.Big, len(changes.Tokens)),
+	}
+	for token, deltas := range changes.Tokens {
+		res.Tokens[token] = formatDeltas(deltas)
+	}
+	if config != nil && config.Oracle != nil {
+		// Value the changes on top of the post transaction state
+		oracle, err := newEVMOracle(vm.NewEVM(vmctx, vm.TxContext{}, statedb, chainConfig, vm.Config{}), *config.Oracle, config.OracleSignature)
+		if err != nil {
+			return nil, err
+		}
+		valuation := changes.Value(oracle)
+		res.Rates = formatDeltas(valuation.Rates)
+		res.Values = formatDeltas(valuation.Values)
+	}
+	return res, nil
+}
+
+// formatDeltas converts balance changes into their RPC representation.
+func formatDeltas(deltas map[common.Address]*big.Int) map[common.Address]*hexutil.Big {
+	fields := make(map[common.Address]*hexutil.Big, len(deltas))
+	for account, delta := range deltas {
+		fields[account] = (*hexutil.Big)(delta)
+	}
+	return fields
+}
+
+// evmOracle is a balance.Oracle querying a price oracle contract.
+type evmOracle struct {
+	evm      *vm.EVM
+	address  common.Address
+	selector []byte
+	bools    int // Number of trailing bool parameters, all passed as true
+}
+
+// newEVMOracle creates an oracle calling the method with the given signature
+// on the contract at address.
+func newEVMOracle(evm *vm.EVM, address common.Address, signature string) (*evmOracle, error) {
+	if signature == "" {
+		signature = defaultOracleSignature
+	}
+	lp, rp := strings.Index(signature, "("), strings.LastIndex(signature, ")")
+	if lp <= 0 || rp != len(signature)-1 {
+		return nil, fmt.Errorf("invalid oracle signature %q", signature)
+	}
+	params := strings.Split(signature[lp+1:rp], ",")
+	if params[0] != "address" {
+		return nil, fmt.Errorf("oracle signature %q must take the token address first", signature)
+	}
+	for _, param := range params[1:] {
+		if param != "bool" {
+			return nil, fmt.Errorf("oracle signature %q has unsupported parameter %q", signature, param)
+		}
+	}
+	return &evmOracle{
+		evm:      evm,
+		address:  address,
+		selector: crypto.Keccak256([]byte(signature))[:4],
+		bools:    len(params) - 1,
+	}, nil
+}
+
+// Rate implements balance.Oracle.
+func (o *evmOracle) Rate(token common.Address) (*big.Int, error) {
+	input := append(common.CopyBytes(o.selector), common.LeftPadBytes(token.Bytes(), 32)...)
+	for i := 0; i < o.bools; i++ {
+		input = append(input, common.LeftPadBytes([]byte{1}, 32)...)
+	}
+	ret, _, err := o.evm.StaticCall(vm.AccountRef(common.Address{}), o.address, input, oracleGasLimit)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) < 32 {
+		return nil, fmt.Errorf("invalid oracle response for %s", token.Hex())
+	}
+	return new(big.Int).SetBytes(ret[:32]), nil
+}
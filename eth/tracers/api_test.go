@@ -39,6 +39,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers/balance"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/params"
@@ -579,3 +580,94 @@ func newStates(keys []common.Hash, vals []common.Hash) *map[common.Hash]common.H
 	}
 	return &m
 }
+
+func TestTraceBalanceChanges(t *testing.T) {
+	t.Parallel()
+
+	// Initialize test accounts and a token which, when called, mints 100 units
+	// from the caller to the recipient and forwards the call value to it.
+	accounts := newAccounts(3)
+	recipient := accounts[2].addr
+
+	code := append([]byte{0x60, 0x64, 0x60, 0x00, 0x52, 0x73}, recipient.Bytes()...) // MSTORE(0, 100) PUSH20 recipient
+	code = append(code, 0x33, 0x7f)                                                  // CALLER PUSH32
+	code = append(code, balance.TransferTopic.Bytes()...)                            // Transfer topic
+	code = append(code, 0x60, 0x20, 0x60, 0x00, 0xa3)                                // LOG3(0, 32)
+	code = append(code, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x34, 0x73)  // CALLVALUE PUSH20
+	code = append(code, recipient.Bytes()...)                                        // recipient
+	code = append(code, 0x5a, 0xf1, 0x50, 0x00)                                      // GAS CALL POP STOP
+
+	var (
+		token  = common.HexToAddress("0x70ce2")
+		oracle = common.HexToAddress("0x0ac1e")
+	)
+	genesis := &core.Genesis{Alloc: core.GenesisAlloc{
+		accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+		accounts[1].addr: {Balance: big.NewInt(params.Ether)},
+		token:            {Code: code, Balance: new(big.Int)},
+		// Oracle pricing every token at 2 native coins
+		oracle: {Code: common.FromHex("0x671bc16d674ec8000060005260206000f3"), Balance: new(big.Int)},
+	}}
+	target := common.Hash{}
+	signer := types.HomesteadSigner{}
+	api := NewAPI(newTestBackend(t, 1, genesis, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(uint64(i), token, big.NewInt(1000), 100000, big.NewInt(1), nil), signer, accounts[0].key)
+		b.AddTx(tx)
+		target = tx.Hash()
+	}))
+	// Trace the mined transaction, fees are credited to the zero coinbase
+	result, err := api.TraceBalanceChanges(context.Background(), target, nil)
+	if err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	fee := int64(result.Gas)
+	want := &BalanceChangesResult{
+		Gas: result.Gas,
+		Native: map[common.Address]*hexutil.Big{
+			accounts[0].addr: (*hexutil.Big)(big.NewInt(-1000 - fee)),
+			recipient:        (*hexutil.Big)(big.NewInt(1000)),
+			{}:               (*hexutil.Big)(big.NewInt(fee)),
+		},
+		Tokens: map[common.Address]map[common.Address]*hexutil.Big{
+			token: {
+				accounts[0].addr: (*hexutil.Big)(big.NewInt(-100)),
+				recipient:        (*hexutil.Big)(big.NewInt(100)),
+			},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("transaction balance changes mismatch: have %+v, want %+v", result, want)
+	}
+	// Trace a call on top of the head and value it through the oracle
+	result, err = api.TraceCallBalanceChanges(context.Background(), ethapi.CallArgs{
+		From:  &accounts[1].addr,
+		To:    &token,
+		Value: (*hexutil.Big)(big.NewInt(10)),
+	}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), &BalanceChangesConfig{Oracle: &oracle})
+	if err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	want = &BalanceChangesResult{
+		Gas: result.Gas,
+		Native: map[common.Address]*hexutil.Big{
+			accounts[1].addr: (*hexutil.Big)(big.NewInt(-10)),
+			recipient:        (*hexutil.Big)(big.NewInt(10)),
+		},
+		Tokens: map[common.Address]map[common.Address]*hexutil.Big{
+			token: {
+				accounts[1].addr: (*hexutil.Big)(big.NewInt(-100)),
+				recipient:        (*hexutil.Big)(big.NewInt(100)),
+			},
+		},
+		Rates: map[common.Address]*hexutil.Big{
+			token: (*hexutil.Big)(new(big.Int).Mul(big.NewInt(2), big.NewInt(params.Ether))),
+		},
+		Values: map[common.Address]*hexutil.Big{
+			accounts[1].addr: (*hexutil.Big)(big.NewInt(-210)),
+			recipient:        (*hexutil.Big)(big.NewInt(210)),
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("call balance changes mismatch: have %+v, want %+v", result, want)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package balance analyses the net balance changes caused by a transaction,
+// both in the native currency and in ERC20/BEP20 tokens.
+package balance
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TransferTopic is the topic of the ERC20 Transfer(address,address,uint256) event.
+var TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// ether is the number of base units in a whole native coin, the fixed point
+// precision of oracle rates.
+var ether = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+// Deltas maps accounts to their net balance change.
+type Deltas map[common.Address]*big.Int
+
+// Add adjusts the balance change of the account by the given amount.
+func (d Deltas) Add(account common.Address, amount *big.Int) {
+	if delta, ok := d[account]; ok {
+		delta.Add(delta, amount)
+		return
+	}
+	d[account] = new(big.Int).Set(amount)
+}
+
+// Sub adjusts the balance change of the account by the negated amount.
+func (d Deltas) Sub(account common.Address, amount *big.Int) {
+	d.Add(account, new(big.Int).Neg(amount))
+}
+
+// prune drops the accounts whose balance did not change in total.
+func (d Deltas) prune() {
+	for account, delta := range d {
+		if delta.Sign() == 0 {
+			delete(d, account)
+		}
+	}
+}
+
+// Changes are the net balance changes caused by a transaction.
+type Changes struct {
+	Native Deltas                    // Native currency, including internal calls and fees
+	Tokens map[common.Address]Deltas // Tokens, keyed by token contract
+}
+
+// TokenDeltas aggregates the ERC20 Transfer events in the logs into per token
+// and per holder balance changes.
+func TokenDeltas(logs []*types.Log) map[common.Address]Deltas {
+	tokens := make(map[common.Address]Deltas)
+	for _, log := range logs {
+		if len(log.Topics) != 3 || log.Topics[0] != TransferTopic || len(log.Data) != 32 {
+			continue
+		}
+		deltas, ok := tokens[log.Address]
+		if !ok {
+			deltas = make(Deltas)
+			tokens[log.Address] = deltas
+		}
+		amount := new(big.Int).SetBytes(log.Data)
+		deltas.Sub(common.BytesToAddress(log.Topics[1].Bytes()), amount)
+		deltas.Add(common.BytesToAddress(log.Topics[2].Bytes()), amount)
+	}
+	return tokens
+}
+
+// Analyze combines the native transfers collected by the tracer with the token
+// transfers in the logs. Transaction fees are not visible to the tracer, they
+// are charged to the sender and credited to the fee recipient here.
+func Analyze(tracer *Tracer, logs []*types.Log, sender, feeRecipient common.Address, fee *big.Int) *Changes {
+	native := make(Deltas)
+	for account, delta := range tracer.Deltas() {
+		native.Add(account, delta)
+	}
+	if fee != nil && fee.Sign() > 0 {
+		native.Sub(sender, fee)
+		native.Add(feeRecipient, fee)
+	}
+	native.prune()
+
+	tokens := TokenDeltas(logs)
+	for token, deltas := range tokens {
+		deltas.prune()
+		if len(deltas) == 0 {
+			delete(tokens, token)
+		}
+	}
+	return &Changes{Native: native, Tokens: tokens}
+}
+
+// Oracle prices tokens in the native currency.
+type Oracle interface {
+	// Rate returns the native value of 10^18 base units of the token.
+	Rate(token common.Address) (*big.Int, error)
+}
+
+// Valuation is the native currency value of balance changes.
+type Valuation struct {
+	Rates  map[common.Address]*big.Int // Rates of the valued tokens, see Oracle
+	Values Deltas                      // Net value change per account
+}
+
+// Value prices all balance changes through the oracle. Tokens the oracle can
+// not price are left out of the valuation.
+func (c *Changes) Value(oracle Oracle) *Valuation {
+	val := &Valuation{
+		Rates:  make(map[common.Address]*big.Int),
+		Values: make(Deltas),
+	}
+	for account, delta := range c.Native {
+		val.Values.Add(account, delta)
+	}
+	for token, deltas := range c.Tokens {
+		rate, err := oracle.Rate(token)
+		if err != nil || rate == nil || rate.Sign() == 0 {
+			continue
+		}
+		val.Rates[token] = rate
+		for account, delta := range deltas {
+			value := new(big.Int).Mul(delta, rate)
+			val.Values.Add(account, value.Quo(value, ether))
+		}
+	}
+	val.Values.prune()
+	return val
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package balance
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+var (
+	alice = common.HexToAddress("0xa11ce")
+	bob   = common.HexToAddress("0xb0b")
+	carol = common.HexToAddress("0xca201")
+)
+
+// Tests that transfers of reverted frames are discarded, while the ones of
+// their successful siblings are kept.
+func TestTracerReverts(t *testing.T) {
+	tracer := NewTracer()
+	tracer.CaptureStart(nil, alice, bob, false, nil, 0, big.NewInt(100))
+
+	tracer.CaptureEnter(vm.CALL, bob, carol, nil, 0, big.NewInt(10))
+	tracer.CaptureEnter(vm.CALL, carol, alice, nil, 0, big.NewInt(5))
+	tracer.CaptureExit(nil, 0, nil)
+	tracer.CaptureExit(nil, 0, errors.New("reverted"))
+
+	tracer.CaptureEnter(vm.DELEGATECALL, bob, carol, nil, 0, big.NewInt(100))
+	tracer.CaptureExit(nil, 0, nil)
+	tracer.CaptureEnter(vm.SELFDESTRUCT, bob, carol, nil, 0, big.NewInt(40))
+	tracer.CaptureExit(nil, 0, nil)
+	tracer.CaptureEnd(nil, 0, 0, nil)
+
+	deltas := tracer.Deltas()
+	deltas.prune()
+	want := map[common.Address]int64{alice: -100, bob: 60, carol: 40}
+	if len(deltas) != len(want) {
+		t.Fatalf("delta count mismatch: have %d, want %d", len(deltas), len(want))
+	}
+	for account, delta := range want {
+		if deltas[account] == nil || deltas[account].Int64() != delta {
+			t.Errorf("delta of %x mismatch: have %v, want %d", account, deltas[account], delta)
+		}
+	}
+}
+
+type testOracle map[common.Address]*big.Int
+
+func (o testOracle) Rate(token common.Address) (*big.Int, error) {
+	if rate, ok := o[token]; ok {
+		return rate, nil
+	}
+	return nil, errors.New("unknown token")
+}
+
+// Tests that valuation skips the tokens the oracle can't price.
+func TestValuation(t *testing.T) {
+	var (
+		priced   = common.HexToAddress("0x01")
+		unpriced = common.HexToAddress("0x02")
+	)
+	changes := &Changes{
+		Native: Deltas{alice: big.NewInt(-1), bob: big.NewInt(1)},
+		Tokens: map[common.Address]Deltas{
+			priced:   {alice: big.NewInt(10), bob: big.NewInt(-10)},
+			unpriced: {alice: big.NewInt(-1000), carol: big.NewInt(1000)},
+		},
+	}
+	val := changes.Value(testOracle{priced: new(big.Int).Div(ether, big.NewInt(2))})
+	if len(val.Rates) != 1 || val.Rates[priced] == nil {
+		t.Fatalf("rates mismatch: %v", val.Rates)
+	}
+	want := map[common.Address]int64{alice: 4, bob: -4}
+	if len(val.Values) != len(want) {
+		t.Fatalf("value count mismatch: have %d, want %d", len(val.Values), len(want))
+	}
+	for account, value := range want {
+		if val.Values[account] == nil || val.Values[account].Int64() != value {
+			t.Errorf("value of %x mismatch: have %v, want %d", account, val.Values[account], value)
+		}
+	}
+}
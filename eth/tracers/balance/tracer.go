@@ -0,0 +1,116 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package balance
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// transfer is a movement of native currency between two accounts.
+type transfer struct {
+	from, to common.Address
+	value    *big.Int
+}
+
+// Tracer is a vm.EVMLogger collecting the native currency moved by a
+// transaction, including internal calls, creations and self destructs.
+// Transfers of reverted call frames are discarded. A tracer must only be used
+// for a single transaction.
+type Tracer struct {
+	frames    [][]transfer // Transfers of the call frames currently executing
+	transfers []transfer   // Transfers of the successfully finished transaction
+}
+
+// NewTracer creates a tracer for a single transaction.
+func NewTracer() *Tracer {
+	return new(Tracer)
+}
+
+// enter opens a new call frame, moving the given value.
+func (t *Tracer) enter(from, to common.Address, value *big.Int) {
+	var frame []transfer
+	if value != nil && value.Sign() > 0 {
+		frame = append(frame, transfer{from: from, to: to, value: new(big.Int).Set(value)})
+	}
+	t.frames = append(t.frames, frame)
+}
+
+// exit closes the current call frame, handing its transfers to the parent
+// frame if it succeeded.
+func (t *Tracer) exit(failed bool) []transfer {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	if failed {
+		return nil
+	}
+	if len(t.frames) > 0 {
+		t.frames[len(t.frames)-1] = append(t.frames[len(t.frames)-1], frame...)
+	}
+	return frame
+}
+
+// CaptureStart implements vm.EVMLogger.
+func (t *Tracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.enter(from, to, value)
+}
+
+// CaptureState implements vm.EVMLogger.
+func (t *Tracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+
+// CaptureEnter implements vm.EVMLogger. Only calls and creations move funds
+// to another account, the value of callcodes stays with the caller.
+func (t *Tracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	switch typ {
+	case vm.CALL, vm.CREATE, vm.CREATE2, vm.SELFDESTRUCT:
+		t.enter(from, to, value)
+	default:
+		t.enter(from, to, nil)
+	}
+}
+
+// CaptureExit implements vm.EVMLogger.
+func (t *Tracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.exit(err != nil)
+}
+
+// CaptureFault implements vm.EVMLogger.
+func (t *Tracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnd implements vm.EVMLogger.
+func (t *Tracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) {
+	t.transfers = t.exit(err != nil)
+}
+
+// Deltas returns the net native balance changes caused by the traced
+// transaction, excluding fees.
+func (t *Tracer) Deltas() Deltas {
+	deltas := make(Deltas)
+	for _, tr := range t.transfers {
+		deltas.Sub(tr.from, tr.value)
+		deltas.Add(tr.to, tr.value)
+	}
+	return deltas
+}
@@ -27,6 +27,7 @@ import (
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -374,6 +375,9 @@ func TestEthClient(t *testing.T) {
 		"TestDiffAccounts": {
 			func(t *testing.T) { testDiffAccounts(t, client) },
 		},
+		"TestCallBundle": {
+			func(t *testing.T) { testCallBundle(t, client) },
+		},
 		// DO not have TestAtFunctions now, because we do not have pending block now
 	}
 
@@ -600,6 +604,76 @@ func testCallContract(t *testing.T, client *rpc.Client) {
 	}
 }
 
+func testCallBundle(t *testing.T, client *rpc.Client) {
+	ec := NewClient(client)
+	ctx := context.Background()
+
+	nonce, err := ec.NonceAt(ctx, testAddr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Two dependent transfers, the second one only valid after the first
+	var txs []hexutil.Bytes
+	for i := uint64(0); i < 2; i++ {
+		tx, err := types.SignTx(types.NewTransaction(nonce+i, common.Address{0x04}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		blob, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to encode transaction: %v", err)
+		}
+		txs = append(txs, blob)
+	}
+	var res struct {
+		Results []struct {
+			TxHash  common.Hash `json:"txHash"`
+			GasUsed uint64      `json:"gasUsed"`
+			Error   string      `json:"error"`
+		} `json:"results"`
+		TotalGasUsed uint64 `json:"totalGasUsed"`
+	}
+	if err := client.CallContext(ctx, &res, "eth_callBundle", map[string]interface{}{"txs": txs}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Results) != 2 {
+		t.Fatalf("unexpected result count: have %d, want 2", len(res.Results))
+	}
+	for i, result := range res.Results {
+		if result.GasUsed != params.TxGas || result.Error != "" {
+			t.Fatalf("unexpected result %d: gas %d, error %q", i, result.GasUsed, result.Error)
+		}
+	}
+	if res.TotalGasUsed != 2*params.TxGas {
+		t.Fatalf("unexpected total gas: have %d, want %d", res.TotalGasUsed, 2*params.TxGas)
+	}
+	// A bundle with a nonce gap must be rejected as a whole
+	if err := client.CallContext(ctx, &res, "eth_callBundle", map[string]interface{}{"txs": txs[1:]}); err == nil {
+		t.Fatalf("bundle with nonce gap accepted")
+	}
+	// The state diff is relative to the overridden state
+	var detailed struct {
+		StateDiff map[common.Address]struct {
+			Balance struct {
+				From *hexutil.Big `json:"from"`
+			} `json:"balance"`
+		} `json:"stateDiff"`
+	}
+	overrides := map[common.Address]interface{}{
+		testAddr:          map[string]interface{}{"balance": (*hexutil.Big)(big.NewInt(params.Ether))},
+		common.Address{5}: map[string]interface{}{"balance": (*hexutil.Big)(big.NewInt(1))},
+	}
+	if err := client.CallContext(ctx, &detailed, "eth_simulateBundle", map[string]interface{}{"txs": txs, "stateOverrides": overrides}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := detailed.StateDiff[common.Address{5}]; ok {
+		t.Fatalf("overridden account reported as changed by the bundle")
+	}
+	if sender, ok := detailed.StateDiff[testAddr]; !ok || sender.Balance.From.ToInt().Cmp(big.NewInt(params.Ether)) != 0 {
+		t.Fatalf("sender diff not relative to the overridden balance: %+v", sender)
+	}
+}
+
 func testDiffAccounts(t *testing.T, client *rpc.Client) {
 	ec := NewClient(client)
 	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
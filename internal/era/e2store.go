@@ -0,0 +1,83 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// headerSize is the size of the header of an entry: the type, the length of the
+// value and two reserved bytes.
+const headerSize = 8
+
+// entry is a type-length-value record, the unit the files are made of.
+type entry struct {
+	typ   uint16
+	value []byte
+}
+
+// writeEntry writes an entry to the writer, returning the number of bytes written.
+func writeEntry(w io.Writer, typ uint16, value []byte) (int, error) {
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint16(header[:2], typ)
+	binary.LittleEndian.PutUint32(header[2:6], uint32(len(value)))
+
+	n, err := w.Write(header[:])
+	if err != nil {
+		return n, err
+	}
+	m, err := w.Write(value)
+	return n + m, err
+}
+
+// readEntry reads the entry at the offset, returning it along with its size.
+func readEntry(r io.ReaderAt, off int64) (*entry, int64, error) {
+	var header [headerSize]byte
+	if _, err := r.ReadAt(header[:], off); err != nil {
+		return nil, 0, err
+	}
+	if header[6] != 0 || header[7] != 0 {
+		return nil, 0, errors.New("reserved bytes of entry non-zero")
+	}
+	var (
+		typ    = binary.LittleEndian.Uint16(header[:2])
+		length = binary.LittleEndian.Uint32(header[2:6])
+		value  = make([]byte, length)
+	)
+	if _, err := r.ReadAt(value, off+headerSize); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	return &entry{typ: typ, value: value}, headerSize + int64(length), nil
+}
+
+// readEntryOf reads the entry at the offset, checking it is of the given type.
+func readEntryOf(r io.ReaderAt, off int64, typ uint16) (*entry, int64, error) {
+	e, n, err := readEntry(r, off)
+	if err != nil {
+		return nil, 0, err
+	}
+	if e.typ != typ {
+		return nil, 0, fmt.Errorf("entry at offset %d of type %#x, want %#x", off, e.typ, typ)
+	}
+	return e, n, nil
+}
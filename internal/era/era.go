@@ -0,0 +1,375 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package era implements an archive format for the chain history, storing the
+// blocks and receipts of fixed size epochs in seekable files.
+//
+// A file is a sequence of type-length-value entries:
+//
+//	Version | (Header | Body | Receipts | TotalDifficulty)* | Accumulator | BlockIndex
+//
+// The header, body and receipts are the snappy compressed RLP encodings stored in
+// the freezer, the total difficulty a 32 byte big endian integer. The accumulator
+// is the keccak256 hash of the hashes and total difficulties of the blocks, which
+// the files are named after. The block index, at the end of the file, holds the
+// number of the first block, the offsets of the blocks and their count.
+package era
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+)
+
+// Types of the entries of the files.
+const (
+	TypeVersion         uint16 = 0x3265
+	TypeHeader          uint16 = 0x03
+	TypeBody            uint16 = 0x04
+	TypeReceipts        uint16 = 0x05
+	TypeTotalDifficulty uint16 = 0x06
+	TypeAccumulator     uint16 = 0x07
+	TypeBlockIndex      uint16 = 0x3266
+)
+
+// BlocksPerFile is the number of blocks of an epoch, a file holds the blocks of
+// a single epoch. Files of full epochs are deterministic.
+const BlocksPerFile = 8192
+
+var (
+	errEmptyFile   = errors.New("no blocks in file")
+	errFullFile    = errors.New("file full")
+	errOutOfBounds = errors.New("block out of file bounds")
+)
+
+// Epoch returns the epoch of the block number.
+func Epoch(number uint64) uint64 {
+	return number / BlocksPerFile
+}
+
+// Network returns the name the files of a network are prefixed with, given its
+// genesis hash.
+func Network(genesis common.Hash) string {
+	switch genesis {
+	case params.BSCGenesisHash:
+		return "bsc"
+	case params.ChapelGenesisHash:
+		return "chapel"
+	case params.RialtoGenesisHash:
+		return "rialto"
+	case params.MainnetGenesisHash:
+		return "mainnet"
+	default:
+		return fmt.Sprintf("%x", genesis[:4])
+	}
+}
+
+// Filename returns the name of the file of an epoch of the network, with the
+// given accumulator.
+func Filename(network string, epoch uint64, accumulator common.Hash) string {
+	return fmt.Sprintf("%s-%05d-%x.era", network, epoch, accumulator[:4])
+}
+
+var filenameRegexp = regexp.MustCompile(`^(.+)-([0-9]{5,})-([0-9a-f]{8})\.era$`)
+
+// ReadDir returns the names of the files of the network in the directory, in the
+// order of their epochs.
+func ReadDir(dir string, network string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		names  []string
+		epochs = make(map[uint64]string)
+	)
+	for _, entry := range entries {
+		match := filenameRegexp.FindStringSubmatch(entry.Name())
+		if match == nil || match[1] != network || entry.IsDir() {
+			continue
+		}
+		epoch, err := strconv.ParseUint(match[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid epoch in %s: %v", entry.Name(), err)
+		}
+		if prev, ok := epochs[epoch]; ok {
+			return nil, fmt.Errorf("duplicate files of epoch %d: %s, %s", epoch, prev, entry.Name())
+		}
+		epochs[epoch] = entry.Name()
+		names = append(names, entry.Name())
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ei, _ := strconv.ParseUint(filenameRegexp.FindStringSubmatch(names[i])[2], 10, 64)
+		ej, _ := strconv.ParseUint(filenameRegexp.FindStringSubmatch(names[j])[2], 10, 64)
+		return ei < ej
+	})
+	return names, nil
+}
+
+// Builder writes the blocks of an epoch into a file.
+type Builder struct {
+	w       *bufio.Writer
+	written int64
+
+	start   uint64
+	offsets []int64
+	hasher  crypto.KeccakState
+}
+
+// NewBuilder creates a builder writing into the writer.
+func NewBuilder(w io.Writer) *Builder {
+	return &Builder{
+		w:      bufio.NewWriter(w),
+		hasher: crypto.NewKeccakState(),
+	}
+}
+
+// Add appends a block with its receipts, given as stored in the freezer. The
+// blocks must be consecutive and of the same epoch.
+func (b *Builder) Add(number uint64, header, body, receipts rlp.RawValue, td *big.Int) error {
+	if len(b.offsets) == 0 {
+		if err := b.write(TypeVersion, nil); err != nil {
+			return err
+		}
+		b.start = number
+	} else if number != b.start+uint64(len(b.offsets)) {
+		return fmt.Errorf("non contiguous block #%d, want #%d", number, b.start+uint64(len(b.offsets)))
+	} else if Epoch(number) != Epoch(b.start) {
+		return errFullFile
+	}
+	if td.BitLen() > 256 {
+		return fmt.Errorf("total difficulty of block #%d too large", number)
+	}
+	b.offsets = append(b.offsets, b.written)
+
+	if err := b.write(TypeHeader, snappy.Encode(nil, header)); err != nil {
+		return err
+	}
+	if err := b.write(TypeBody, snappy.Encode(nil, body)); err != nil {
+		return err
+	}
+	if err := b.write(TypeReceipts, snappy.Encode(nil, receipts)); err != nil {
+		return err
+	}
+	tdBytes := common.BigToHash(td).Bytes()
+	if err := b.write(TypeTotalDifficulty, tdBytes); err != nil {
+		return err
+	}
+	b.hasher.Write(crypto.Keccak256(header))
+	b.hasher.Write(tdBytes)
+	return nil
+}
+
+// Finalize writes the accumulator and the block index, and flushes the file.
+// It returns the accumulator.
+func (b *Builder) Finalize() (common.Hash, error) {
+	if len(b.offsets) == 0 {
+		return common.Hash{}, errEmptyFile
+	}
+	var accumulator common.Hash
+	b.hasher.Read(accumulator[:])
+	if err := b.write(TypeAccumulator, accumulator[:]); err != nil {
+		return common.Hash{}, err
+	}
+	index := make([]byte, 16+8*len(b.offsets))
+	binary.LittleEndian.PutUint64(index, b.start)
+	for i, offset := range b.offsets {
+		binary.LittleEndian.PutUint64(index[8+8*i:], uint64(offset))
+	}
+	binary.LittleEndian.PutUint64(index[len(index)-8:], uint64(len(b.offsets)))
+	if err := b.write(TypeBlockIndex, index); err != nil {
+		return common.Hash{}, err
+	}
+	return accumulator, b.w.Flush()
+}
+
+func (b *Builder) write(typ uint16, value []byte) error {
+	n, err := writeEntry(b.w, typ, value)
+	b.written += int64(n)
+	return err
+}
+
+// Block is a block of a file, in the encodings stored in the freezer.
+type Block struct {
+	Number   uint64
+	Hash     common.Hash
+	Header   rlp.RawValue
+	Body     rlp.RawValue
+	Receipts rlp.RawValue
+	TD       *big.Int
+}
+
+// Era is a file of the blocks of an epoch, open for reading.
+type Era struct {
+	f           *os.File
+	start       uint64
+	offsets     []int64
+	accumulator common.Hash
+}
+
+// Open opens a file for reading, checking its structure.
+func Open(path string) (*Era, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newEra(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	return e, nil
+}
+
+func newEra(f *os.File) (*Era, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
+	if _, _, err := readEntryOf(f, 0, TypeVersion); err != nil {
+		return nil, err
+	}
+	// Locate the block index by the count of blocks at the end
+	var buf [8]byte
+	if size < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if _, err := f.ReadAt(buf[:], size-8); err != nil {
+		return nil, err
+	}
+	count := binary.LittleEndian.Uint64(buf[:])
+	if count == 0 || count > BlocksPerFile {
+		return nil, fmt.Errorf("invalid block count %d", count)
+	}
+	indexOffset := size - headerSize - int64(16+8*count)
+	index, _, err := readEntryOf(f, indexOffset, TypeBlockIndex)
+	if err != nil {
+		return nil, err
+	}
+	e := &Era{
+		f:       f,
+		start:   binary.LittleEndian.Uint64(index.value),
+		offsets: make([]int64, count),
+	}
+	if Epoch(e.start) != Epoch(e.start+count-1) {
+		return nil, fmt.Errorf("blocks #%d-#%d span epochs", e.start, e.start+count-1)
+	}
+	for i := range e.offsets {
+		e.offsets[i] = int64(binary.LittleEndian.Uint64(index.value[8+8*i:]))
+		if e.offsets[i] < 0 || e.offsets[i] >= indexOffset {
+			return nil, fmt.Errorf("invalid offset of block #%d", e.start+uint64(i))
+		}
+	}
+	accumulator, _, err := readEntryOf(f, indexOffset-headerSize-common.HashLength, TypeAccumulator)
+	if err != nil {
+		return nil, err
+	}
+	copy(e.accumulator[:], accumulator.value)
+	return e, nil
+}
+
+// Start returns the number of the first block of the file.
+func (e *Era) Start() uint64 {
+	return e.start
+}
+
+// Count returns the number of blocks of the file.
+func (e *Era) Count() uint64 {
+	return uint64(len(e.offsets))
+}
+
+// Accumulator returns the accumulator of the file.
+func (e *Era) Accumulator() common.Hash {
+	return e.accumulator
+}
+
+// Close closes the file.
+func (e *Era) Close() error {
+	return e.f.Close()
+}
+
+// Block reads a block of the file.
+func (e *Era) Block(number uint64) (*Block, error) {
+	if number < e.start || number-e.start >= uint64(len(e.offsets)) {
+		return nil, errOutOfBounds
+	}
+	var (
+		block  = &Block{Number: number}
+		offset = e.offsets[number-e.start]
+	)
+	for _, item := range []struct {
+		typ   uint16
+		value *rlp.RawValue
+	}{
+		{TypeHeader, &block.Header},
+		{TypeBody, &block.Body},
+		{TypeReceipts, &block.Receipts},
+	} {
+		entry, n, err := readEntryOf(e.f, offset, item.typ)
+		if err != nil {
+			return nil, fmt.Errorf("block #%d: %v", number, err)
+		}
+		if *item.value, err = snappy.Decode(nil, entry.value); err != nil {
+			return nil, fmt.Errorf("block #%d: %v", number, err)
+		}
+		offset += n
+	}
+	td, _, err := readEntryOf(e.f, offset, TypeTotalDifficulty)
+	if err != nil {
+		return nil, fmt.Errorf("block #%d: %v", number, err)
+	}
+	if len(td.value) != common.HashLength {
+		return nil, fmt.Errorf("block #%d: invalid total difficulty", number)
+	}
+	block.Hash = crypto.Keccak256Hash(block.Header)
+	block.TD = new(big.Int).SetBytes(td.value)
+	return block, nil
+}
+
+// Verify reads all the blocks of the file, checking they match the accumulator.
+func (e *Era) Verify() error {
+	hasher := crypto.NewKeccakState()
+	for number := e.start; number < e.start+e.Count(); number++ {
+		block, err := e.Block(number)
+		if err != nil {
+			return err
+		}
+		hasher.Write(block.Hash[:])
+		hasher.Write(common.BigToHash(block.TD).Bytes())
+	}
+	var accumulator common.Hash
+	hasher.Read(accumulator[:])
+	if accumulator != e.accumulator {
+		return fmt.Errorf("accumulator mismatch: have %x, want %x", accumulator, e.accumulator)
+	}
+	return nil
+}
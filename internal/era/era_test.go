@@ -0,0 +1,201 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func makeBlock(number uint64) *Block {
+	header := bytes.Repeat([]byte{byte(number)}, 100+int(number))
+	return &Block{
+		Number:   number,
+		Hash:     crypto.Keccak256Hash(header),
+		Header:   header,
+		Body:     bytes.Repeat([]byte{0xb0}, int(number)),
+		Receipts: bytes.Repeat([]byte{0xc0}, 2*int(number)),
+		TD:       new(big.Int).SetUint64(number * 1000),
+	}
+}
+
+func writeFile(t *testing.T, path string, blocks []*Block) common.Hash {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	builder := NewBuilder(f)
+	for _, block := range blocks {
+		if err := builder.Add(block.Number, block.Header, block.Body, block.Receipts, block.TD); err != nil {
+			t.Fatalf("failed to add block #%d: %v", block.Number, err)
+		}
+	}
+	accumulator, err := builder.Finalize()
+	if err != nil {
+		t.Fatalf("failed to finalize file: %v", err)
+	}
+	return accumulator
+}
+
+// Tests that the blocks written into a file can be read back in any order.
+func TestReadWrite(t *testing.T) {
+	var (
+		path   = filepath.Join(t.TempDir(), "test.era")
+		blocks []*Block
+	)
+	for number := uint64(BlocksPerFile + 10); number < BlocksPerFile+42; number++ {
+		blocks = append(blocks, makeBlock(number))
+	}
+	accumulator := writeFile(t, path, blocks)
+
+	e, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	defer e.Close()
+
+	if e.Start() != blocks[0].Number || e.Count() != uint64(len(blocks)) {
+		t.Fatalf("range mismatch: have #%d+%d, want #%d+%d", e.Start(), e.Count(), blocks[0].Number, len(blocks))
+	}
+	if e.Accumulator() != accumulator {
+		t.Fatalf("accumulator mismatch: have %x, want %x", e.Accumulator(), accumulator)
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block, err := e.Block(blocks[i].Number)
+		if err != nil {
+			t.Fatalf("failed to read block #%d: %v", blocks[i].Number, err)
+		}
+		if !reflect.DeepEqual(block, blocks[i]) {
+			t.Fatalf("block #%d mismatch: have %v, want %v", blocks[i].Number, block, blocks[i])
+		}
+	}
+	for _, number := range []uint64{blocks[0].Number - 1, blocks[len(blocks)-1].Number + 1} {
+		if _, err := e.Block(number); err != errOutOfBounds {
+			t.Errorf("block #%d: error mismatch: have %v, want %v", number, err, errOutOfBounds)
+		}
+	}
+	if err := e.Verify(); err != nil {
+		t.Fatalf("failed to verify file: %v", err)
+	}
+}
+
+// Tests that the builder refuses blocks beyond the epoch or out of order.
+func TestBuilderBounds(t *testing.T) {
+	builder := NewBuilder(ioutil.Discard)
+	if _, err := builder.Finalize(); err != errEmptyFile {
+		t.Fatalf("error mismatch: have %v, want %v", err, errEmptyFile)
+	}
+	for _, number := range []uint64{BlocksPerFile - 2, BlocksPerFile - 1} {
+		block := makeBlock(number)
+		if err := builder.Add(number, block.Header, block.Body, block.Receipts, block.TD); err != nil {
+			t.Fatalf("failed to add block #%d: %v", number, err)
+		}
+	}
+	block := makeBlock(BlocksPerFile + 1)
+	if err := builder.Add(block.Number, block.Header, block.Body, block.Receipts, block.TD); err == nil {
+		t.Fatalf("non contiguous block added")
+	}
+	block = makeBlock(BlocksPerFile)
+	if err := builder.Add(block.Number, block.Header, block.Body, block.Receipts, block.TD); err != errFullFile {
+		t.Fatalf("error mismatch: have %v, want %v", err, errFullFile)
+	}
+}
+
+// Tests that corrupted files are detected.
+func TestCorruption(t *testing.T) {
+	var (
+		path   = filepath.Join(t.TempDir(), "test.era")
+		blocks []*Block
+	)
+	for number := uint64(0); number < 8; number++ {
+		blocks = append(blocks, makeBlock(number))
+	}
+	writeFile(t, path, blocks)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	// Flip a byte of the receipts of a block, failing the decompression or
+	// the accumulator.
+	e, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	offset := e.offsets[3] + headerSize + 10
+	e.Close()
+
+	data[offset] ^= 0xff
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if e, err = Open(path); err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	defer e.Close()
+	if err := e.Verify(); err == nil {
+		t.Fatalf("corruption not detected")
+	}
+	// Truncated files can't be opened
+	if err := ioutil.WriteFile(path, data[:len(data)-1], 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatalf("truncated file opened")
+	}
+}
+
+// Tests that the files of a network are listed in the order of their epochs.
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		Filename("bsc", 10, common.Hash{0x0a}),
+		Filename("bsc", 2, common.Hash{0x02}),
+		Filename("chapel", 1, common.Hash{0x01}),
+		Filename("bsc", 100000, common.Hash{0x03}),
+		"checksums.txt",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	names, err := ReadDir(dir, "bsc")
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	want := []string{"bsc-00002-02000000.era", "bsc-00010-0a000000.era", "bsc-100000-03000000.era"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("files mismatch: have %v, want %v", names, want)
+	}
+	// Two files of the same epoch are ambiguous
+	if err := ioutil.WriteFile(filepath.Join(dir, Filename("bsc", 10, common.Hash{0x0b})), nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := ReadDir(dir, "bsc"); err == nil {
+		t.Fatalf("duplicate epoch not detected")
+	}
+}
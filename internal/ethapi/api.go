@@ -752,6 +752,40 @@ func (s *PublicBlockChainAPI) GetCode(ctx context.Context, address common.Addres
 	return code, state.Error()
 }
 
+// ContractCreationResult is the creation metadata of a contract.
+type ContractCreationResult struct {
+	TransactionHash common.Hash    `json:"transactionHash"`
+	BlockHash       common.Hash    `json:"blockHash"`
+	BlockNumber     hexutil.Uint64 `json:"blockNumber"`
+	Creator         common.Address `json:"creator"`
+	InitCodeHash    common.Hash    `json:"initCodeHash"`
+}
+
+// GetContractCreation returns the transaction which created the contract at the
+// given address. Creations are only known if the node indexes them, nil is
+// returned for unknown contracts.
+func (s *PublicBlockChainAPI) GetContractCreation(ctx context.Context, address common.Address) (*ContractCreationResult, error) {
+	entry := rawdb.ReadContractCreation(s.b.ChainDb(), address)
+	if entry == nil {
+		return nil, nil
+	}
+	// Creations of side chain blocks are indexed too, only report canonical ones
+	header, err := s.b.HeaderByNumber(ctx, rpc.BlockNumber(entry.BlockNumber))
+	if header == nil || err != nil {
+		return nil, err
+	}
+	if header.Hash() != entry.BlockHash {
+		return nil, nil
+	}
+	return &ContractCreationResult{
+		TransactionHash: entry.TxHash,
+		BlockHash:       entry.BlockHash,
+		BlockNumber:     hexutil.Uint64(entry.BlockNumber),
+		Creator:         entry.Creator,
+		InitCodeHash:    entry.InitCodeHash,
+	}, nil
+}
+
 // GetStorageAt returns the storage from the state at the given address, key and
 // block number. The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta block
 // numbers are also allowed.
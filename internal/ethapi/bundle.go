@@ -0,0 +1,272 @@
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PublicBundleAPI provides an API to simulate ordered lists of signed
+// transactions on top of a block.
+type PublicBundleAPI struct {
+	b Backend
+}
+
+// NewPublicBundleAPI creates a new bundle simulation API.
+func NewPublicBundleAPI(b Backend) *PublicBundleAPI {
+	return &PublicBundleAPI{b}
+}
+
+// CallBundleArgs represents the arguments for a bundle simulation. The shape
+// follows the flashbots eth_callBundle request.
+type CallBundleArgs struct {
+	Txs              []hexutil.Bytes        `json:"txs"`              // Signed raw transactions, applied in order
+	BlockNumber      rpc.BlockNumber        `json:"blockNumber"`      // Number of the simulated block, parent+1 if zero
+	StateBlockNumber *rpc.BlockNumberOrHash `json:"stateBlockNumber"` // Block whose state the bundle runs on, latest if nil
+	Coinbase         *common.Address        `json:"coinbase"`         // Overrides the predicted block producer
+	Timestamp        *hexutil.Uint64        `json:"timestamp"`        // Overrides the predicted block timestamp
+	GasLimit         *hexutil.Uint64        `json:"gasLimit"`         // Overrides the parent's gas limit
+	Difficulty       *hexutil.Big           `json:"difficulty"`       // Overrides the parent's difficulty
+	Timeout          *int64                 `json:"timeout"`          // Simulation timeout in milliseconds, capped by the node
+	StateOverrides   *StateOverride         `json:"stateOverrides"`   // Account overrides applied before the bundle
+}
+
+// CallBundle simulates the given signed transactions in order on top of the
+// requested state, carrying state forward between them, and reports per
+// transaction gas usage, coinbase payments and results.
+func (s *PublicBundleAPI) CallBundle(ctx context.Context, args CallBundleArgs) (map[string]interface{}, error) {
+	return s.simulate(ctx, args, false)
+}
+
+// SimulateBundle is like CallBundle, but additionally reports the logs of every
+// transaction and the state diff of the whole bundle.
+func (s *PublicBundleAPI) SimulateBundle(ctx context.Context, args CallBundleArgs) (map[string]interface{}, error) {
+	return s.simulate(ctx, args, true)
+}
+
+func (s *PublicBundleAPI) simulate(ctx context.Context, args CallBundleArgs, detailed bool) (map[string]interface{}, error) {
+	defer func(start time.Time) { log.Debug("Executing bundle simulation finished", "runtime", time.Since(start)) }(time.Now())
+
+	if len(args.Txs) == 0 {
+		return nil, errors.New("bundle missing txs")
+	}
+	sim := s.b.Simulator()
+	if sim == nil {
+		return nil, errors.New("bundle simulation not supported by this node")
+	}
+	txs := make(types.Transactions, 0, len(args.Txs))
+	for i, encoded := range args.Txs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(encoded); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		txs = append(txs, tx)
+	}
+	stateBlockNumber := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	if args.StateBlockNumber != nil {
+		stateBlockNumber = *args.StateBlockNumber
+	}
+	statedb, parent, err := s.b.StateAndHeaderByNumberOrHash(ctx, stateBlockNumber)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	if err := args.StateOverrides.Apply(statedb); err != nil {
+		return nil, err
+	}
+	// Assemble the simulated block's header, applying any overrides
+	header := sim.NextHeader(parent)
+	if args.BlockNumber > 0 {
+		header.Number = big.NewInt(args.BlockNumber.Int64())
+	}
+	if args.Coinbase != nil {
+		header.Coinbase = *args.Coinbase
+	}
+	if args.Timestamp != nil {
+		header.Time = uint64(*args.Timestamp)
+	}
+	if args.GasLimit != nil {
+		header.GasLimit = uint64(*args.GasLimit)
+	}
+	if args.Difficulty != nil {
+		header.Difficulty = new(big.Int).Set(args.Difficulty.ToInt())
+	}
+	// Run the bundle for no longer than the node allows eth_call to run. The
+	// caller can only shorten it.
+	timeout := s.b.RPCEVMTimeout()
+	if args.Timeout != nil && *args.Timeout > 0 {
+		if requested := time.Duration(*args.Timeout) * time.Millisecond; timeout == 0 || requested < timeout {
+			timeout = requested
+		}
+	}
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	var (
+		config = s.b.ChainConfig()
+		signer = types.MakeSigner(config, header.Number)
+		fork   = sim.ForkWith(parent, header, statedb)
+
+		coinbase       = header.Coinbase
+		coinbaseBefore = core.ProducerBalance(config, fork.State(), coinbase)
+		totalGasUsed   uint64
+		gasFees        = new(big.Int)
+		bundleHash     = crypto.NewKeccakState()
+		results        = make([]map[string]interface{}, 0, len(txs))
+	)
+	// The whole bundle shares the gas allowance of a single call
+	if gasCap := s.b.RPCGasCap(); gasCap != 0 {
+		fork.LimitGas(gasCap)
+	}
+	for i, tx := range txs {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		bundleHash.Write(tx.Hash().Bytes())
+
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		balanceBefore := core.ProducerBalance(config, fork.State(), coinbase)
+		res, err := fork.ApplyTransactionContext(ctx, tx)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("err: %w; txhash %s", err, tx.Hash())
+		}
+		var (
+			gasUsed      = res.Receipt.GasUsed
+			txGasFees    = new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), tx.GasPrice())
+			coinbaseDiff = new(big.Int).Sub(core.ProducerBalance(config, fork.State(), coinbase), balanceBefore)
+		)
+		totalGasUsed += gasUsed
+		gasFees.Add(gasFees, txGasFees)
+
+		result := map[string]interface{}{
+			"txHash":            tx.Hash(),
+			"gasUsed":           gasUsed,
+			"fromAddress":       from,
+			"toAddress":         tx.To(),
+			"gasPrice":          (*hexutil.Big)(tx.GasPrice()),
+			"gasFees":           (*hexutil.Big)(txGasFees),
+			"coinbaseDiff":      (*hexutil.Big)(coinbaseDiff),
+			"ethSentToCoinbase": (*hexutil.Big)(new(big.Int).Sub(coinbaseDiff, txGasFees)),
+		}
+		if res.Err != nil {
+			result["error"] = res.Err.Error()
+			if reason, err := abi.UnpackRevert(res.ReturnData); err == nil {
+				result["revert"] = reason
+			} else {
+				result["revert"] = hexutil.Encode(res.ReturnData)
+			}
+		} else {
+			result["value"] = hexutil.Bytes(res.ReturnData)
+		}
+		if detailed {
+			result["status"] = hexutil.Uint64(res.Receipt.Status)
+			result["logs"] = res.Receipt.Logs
+			if res.Receipt.ContractAddress != (common.Address{}) {
+				result["contractAddress"] = res.Receipt.ContractAddress
+			}
+		}
+		results = append(results, result)
+	}
+	coinbaseDiff := new(big.Int).Sub(core.ProducerBalance(config, fork.State(), coinbase), coinbaseBefore)
+
+	ret := map[string]interface{}{
+		"results":           results,
+		"coinbaseDiff":      (*hexutil.Big)(coinbaseDiff),
+		"gasFees":           (*hexutil.Big)(gasFees),
+		"ethSentToCoinbase": (*hexutil.Big)(new(big.Int).Sub(coinbaseDiff, gasFees)),
+		"bundleGasPrice":    (*hexutil.Big)(new(big.Int).Div(coinbaseDiff, new(big.Int).SetUint64(totalGasUsed))),
+		"totalGasUsed":      totalGasUsed,
+		"stateBlockNumber":  parent.Number.Int64(),
+		"bundleHash":        common.BytesToHash(bundleHash.Sum(nil)),
+	}
+	if detailed {
+		diff, err := fork.StateDiff()
+		if err != nil {
+			return nil, err
+		}
+		ret["stateDiff"] = formatStateDiff(diff)
+		ret["blockNumber"] = (*hexutil.Big)(header.Number)
+		ret["coinbase"] = header.Coinbase
+		ret["timestamp"] = hexutil.Uint64(header.Time)
+	}
+	return ret, nil
+}
+
+// SendBundleArgs represents the arguments for submitting a bundle to the
+// local miner.
+type SendBundleArgs struct {
+	Txs               []hexutil.Bytes `json:"txs"`               // Signed raw transactions, included in order
+	BlockNumber       rpc.BlockNumber `json:"blockNumber"`       // Target block, the next one if zero
+	MinTimestamp      *uint64         `json:"minTimestamp"`      // Earliest timestamp the bundle is valid at
+	MaxTimestamp      *uint64         `json:"maxTimestamp"`      // Latest timestamp the bundle is valid at
+	RevertingTxHashes []common.Hash   `json:"revertingTxHashes"` // Transactions allowed to revert
+}
+
+// SendBundle adds a bundle to the bundle pool. The bundle is only ever included
+// atomically at the top of the target block by the local miner, it is not
+// propagated to the network. It returns the bundle hash.
+func (s *PublicBundleAPI) SendBundle(ctx context.Context, args SendBundleArgs) (common.Hash, error) {
+	bundle := &types.Bundle{
+		Txs:               make(types.Transactions, 0, len(args.Txs)),
+		RevertingTxHashes: args.RevertingTxHashes,
+	}
+	for i, encoded := range args.Txs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(encoded); err != nil {
+			return common.Hash{}, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		bundle.Txs = append(bundle.Txs, tx)
+	}
+	if args.BlockNumber > 0 {
+		bundle.BlockNumber = big.NewInt(args.BlockNumber.Int64())
+	}
+	if args.MinTimestamp != nil {
+		bundle.MinTimestamp = *args.MinTimestamp
+	}
+	if args.MaxTimestamp != nil {
+		bundle.MaxTimestamp = *args.MaxTimestamp
+	}
+	if err := s.b.SendBundle(ctx, bundle); err != nil {
+		return common.Hash{}, err
+	}
+	return bundle.Hash(), nil
+}
+
+// formatStateDiff converts a simulation state diff into its RPC representation.
+func formatStateDiff(diff map[common.Address]*core.AccountDiff) map[common.Address]interface{} {
+	fields := make(map[common.Address]interface{}, len(diff))
+	for addr, account := range diff {
+		storage := make(map[common.Hash]interface{}, len(account.Storage))
+		for key, slot := range account.Storage {
+			storage[key] = map[string]interface{}{"from": slot.Before, "to": slot.After}
+		}
+		fields[addr] = map[string]interface{}{
+			"balance": map[string]interface{}{"from": (*hexutil.Big)(account.BalanceBefore), "to": (*hexutil.Big)(account.BalanceAfter)},
+			"nonce":   map[string]interface{}{"from": hexutil.Uint64(account.NonceBefore), "to": hexutil.Uint64(account.NonceAfter)},
+			"code":    map[string]interface{}{"from": account.CodeBefore, "to": account.CodeAfter},
+			"storage": storage,
+		}
+	}
+	return fields
+}
@@ -27,6 +27,7 @@ var Modules = map[string]string{
 	"eth":        EthJs,
 	"miner":      MinerJs,
 	"net":        NetJs,
+	"parlia":     ParliaJs,
 	"personal":   PersonalJs,
 	"rpc":        RpcJs,
 	"shh":        ShhJs,
@@ -118,6 +119,60 @@ web3._extend({
 });
 `
 
+const ParliaJs = `
+web3._extend({
+	property: 'parlia',
+	methods: [
+		new web3._extend.Method({
+			name: 'getSnapshot',
+			call: 'parlia_getSnapshot',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSnapshotAtHash',
+			call: 'parlia_getSnapshotAtHash',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getValidators',
+			call: 'parlia_getValidators',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getValidatorsAtHash',
+			call: 'parlia_getValidatorsAtHash',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getLiveness',
+			call: 'parlia_getLiveness',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSlashes',
+			call: 'parlia_getSlashes',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getValidatorSetHistory',
+			call: 'parlia_getValidatorSetHistory',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getDoubleSigns',
+			call: 'parlia_getDoubleSigns',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+	]
+});
+`
+
 const EthashJs = `
 web3._extend({
 	property: 'ethash',
@@ -455,6 +510,18 @@ web3._extend({
 			params: 3,
 			inputFormatter: [null, null, null]
 		}),
+		new web3._extend.Method({
+			name: 'traceBalanceChanges',
+			call: 'debug_traceBalanceChanges',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'traceCallBalanceChanges',
+			call: 'debug_traceCallBalanceChanges',
+			params: 3,
+			inputFormatter: [null, null, null]
+		}),
 		new web3._extend.Method({
 			name: 'preimage',
 			call: 'debug_preimage',
@@ -581,12 +648,33 @@ web3._extend({
 			params: 3,
 			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'getContractCreation',
+			call: 'eth_getContractCreation',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'createAccessList',
 			call: 'eth_createAccessList',
 			params: 2,
 			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter],
 		}),
+		new web3._extend.Method({
+			name: 'callBundle',
+			call: 'eth_callBundle',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'sendBundle',
+			call: 'eth_sendBundle',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'simulateBundle',
+			call: 'eth_simulateBundle',
+			params: 1
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -0,0 +1,52 @@
+package mev
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common/gopool"
+	"github.com/ethereum/go-ethereum/mev/detector"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// alertChanSize is the size of channel listening to detector alerts.
+const alertChanSize = 128
+
+// PublicDetectorAPI exposes the alerts of the exploit detector.
+type PublicDetectorAPI struct {
+	detector *detector.Detector
+}
+
+// NewPublicDetectorAPI creates a new API serving the alerts of the detector.
+func NewPublicDetectorAPI(detector *detector.Detector) *PublicDetectorAPI {
+	return &PublicDetectorAPI{detector: detector}
+}
+
+// Alerts creates a subscription fired for every alert the exploit detector
+// raises, both for simulated pending transactions and for mined ones.
+func (api *PublicDetectorAPI) Alerts(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	gopool.Submit(func() {
+		alerts := make(chan *detector.Alert, alertChanSize)
+		alertSub := api.detector.SubscribeAlerts(alerts)
+		defer alertSub.Unsubscribe()
+
+		for {
+			select {
+			case alert := <-alerts:
+				notifier.Notify(rpcSub.ID, alert)
+			case <-alertSub.Err():
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	})
+	return rpcSub, nil
+}
@@ -0,0 +1,50 @@
+package mev
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Config contains the settings of the pending transaction strategy service.
+type Config struct {
+	Enabled    bool          // Whether the strategy service should be started at all
+	Strategies []string      // Names of the registered strategies to run
+	Workers    int           // Number of goroutines executing strategy callbacks
+	QueueSize  int           // Maximum number of callbacks waiting for a free worker
+	Timeout    time.Duration // Upper bound on a single strategy callback
+
+	// Sender is the account strategy transactions are signed with. It must be
+	// available through the account manager (keystore, usb wallet or external
+	// signer); strategies submitting transactions refuse to start without it.
+	Sender common.Address `toml:",omitempty"`
+
+	DetectorRules string `toml:",omitempty"` // JSON file with the exploit detector rules, built-in ones if empty
+	DetectorSink  string `toml:",omitempty"` // File the detector alerts are appended to as JSON lines
+}
+
+// DefaultConfig contains the default settings of the strategy service.
+var DefaultConfig = Config{
+	Workers:   4,
+	QueueSize: 4096,
+	Timeout:   2 * time.Second,
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *Config) sanitize() Config {
+	conf := *config
+	if conf.Workers < 1 {
+		logger.Warn("Sanitizing invalid mev worker count", "provided", conf.Workers, "updated", DefaultConfig.Workers)
+		conf.Workers = DefaultConfig.Workers
+	}
+	if conf.QueueSize < 1 {
+		logger.Warn("Sanitizing invalid mev queue size", "provided", conf.QueueSize, "updated", DefaultConfig.QueueSize)
+		conf.QueueSize = DefaultConfig.QueueSize
+	}
+	if conf.Timeout <= 0 {
+		logger.Warn("Sanitizing invalid mev strategy timeout", "provided", conf.Timeout, "updated", DefaultConfig.Timeout)
+		conf.Timeout = DefaultConfig.Timeout
+	}
+	return conf
+}
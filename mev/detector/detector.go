@@ -0,0 +1,223 @@
+// Package detector implements a rule based detector of exploits and flashloan
+// attacks, evaluated on simulated pending transactions and on mined ones.
+package detector
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/tracers/balance"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	logger = log.New("module", "mev")
+
+	inspectTimer = metrics.NewRegisteredTimer("mev/detector/inspect", nil)
+	alertMeter   = metrics.NewRegisteredMeter("mev/detector/alerts", nil)
+)
+
+// Observation is an executed transaction handed to the detector.
+type Observation struct {
+	Tx          *types.Transaction
+	From        common.Address
+	Receipt     *types.Receipt
+	Trace       *Tracer                     // Call tree features, nil if the transaction was not traced
+	NativeDelta map[common.Address]*big.Int // Native balance changes of all accounts, including fees
+
+	Pending     bool        // Whether the transaction was simulated on top of the head
+	BlockNumber uint64      // Number of the block the transaction was (or would be) included in
+	BlockHash   common.Hash // Hash of the including block, zero if pending
+}
+
+// Alert is emitted for every rule an observed transaction matches.
+type Alert struct {
+	Rule        string          `json:"rule"`
+	Severity    string          `json:"severity,omitempty"`
+	Pending     bool            `json:"pending"`
+	TxHash      common.Hash     `json:"txHash"`
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	BlockNumber uint64          `json:"blockNumber"`
+	BlockHash   *common.Hash    `json:"blockHash,omitempty"`
+	Reasons     []string        `json:"reasons"`
+	Time        time.Time       `json:"time"`
+}
+
+// Sink persists or forwards alerts.
+type Sink interface {
+	Write(alert *Alert) error
+	Close() error
+}
+
+// Detector evaluates rules against observed transactions, publishing matches
+// to its subscribers and sinks.
+type Detector struct {
+	rules []*Rule
+	sinks []Sink
+
+	feed  event.Feed
+	scope event.SubscriptionScope
+}
+
+// New creates a detector evaluating the given rules.
+func New(rules []*Rule, sinks ...Sink) *Detector {
+	return &Detector{rules: rules, sinks: sinks}
+}
+
+// SubscribeAlerts registers a subscription for all alerts raised.
+func (d *Detector) SubscribeAlerts(ch chan<- *Alert) event.Subscription {
+	return d.scope.Track(d.feed.Subscribe(ch))
+}
+
+// Close terminates all subscriptions and closes the sinks.
+func (d *Detector) Close() error {
+	d.scope.Close()
+
+	var errs []error
+	for _, sink := range d.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close alert sinks: %v", errs)
+	}
+	return nil
+}
+
+// Inspect evaluates all rules against the observation, publishing and
+// returning the raised alerts.
+func (d *Detector) Inspect(obs *Observation) []*Alert {
+	defer inspectTimer.UpdateSince(time.Now())
+
+	var (
+		alerts []*Alert
+		deltas map[common.Address]balance.Deltas
+	)
+	for _, rule := range d.rules {
+		if len(rule.Balances) > 0 && deltas == nil {
+			deltas = balance.TokenDeltas(obs.Receipt.Logs)
+		}
+		reasons, ok := rule.match(obs, deltas)
+		if !ok {
+			continue
+		}
+		alert := &Alert{
+			Rule:        rule.Name,
+			Severity:    rule.Severity,
+			Pending:     obs.Pending,
+			TxHash:      obs.Tx.Hash(),
+			From:        obs.From,
+			To:          obs.Tx.To(),
+			BlockNumber: obs.BlockNumber,
+			Reasons:     reasons,
+			Time:        time.Now(),
+		}
+		if !obs.Pending {
+			hash := obs.BlockHash
+			alert.BlockHash = &hash
+		}
+		alerts = append(alerts, alert)
+	}
+	for _, alert := range alerts {
+		logger.Warn("Exploit detector alert", "rule", alert.Rule, "severity", alert.Severity, "tx", alert.TxHash, "pending", alert.Pending, "number", alert.BlockNumber)
+		metrics.GetOrRegisterMeter("mev/detector/rule/"+alert.Rule, nil).Mark(1)
+		alertMeter.Mark(1)
+		for _, sink := range d.sinks {
+			if err := sink.Write(alert); err != nil {
+				logger.Warn("Failed to write detector alert", "rule", alert.Rule, "tx", alert.TxHash, "err", err)
+			}
+		}
+		d.feed.Send(alert)
+	}
+	return alerts
+}
+
+// match checks every condition of the rule, returning the reasons the
+// observation matched.
+func (r *Rule) match(obs *Observation, deltas map[common.Address]balance.Deltas) ([]string, bool) {
+	var reasons []string
+	for _, event := range r.Events {
+		matched := false
+		for _, log := range obs.Receipt.Logs {
+			if len(log.Topics) == 0 || log.Topics[0] != event.Topic {
+				continue
+			}
+			if event.Address != nil && *event.Address != log.Address {
+				continue
+			}
+			reasons = append(reasons, fmt.Sprintf("event %s emitted by %s", event.name(), log.Address.Hex()))
+			matched = true
+			break
+		}
+		if !matched {
+			return nil, false
+		}
+	}
+	for _, balance := range r.Balances {
+		holder, ok := balance.holder(obs)
+		if !ok {
+			return nil, false
+		}
+		var delta *big.Int
+		if balance.Token == (common.Address{}) {
+			delta = obs.NativeDelta[holder]
+		} else {
+			delta = deltas[balance.Token][holder]
+		}
+		if delta == nil || delta.Cmp((*big.Int)(balance.MinDelta)) < 0 {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("balance of %s in %s grew by %v", holder.Hex(), balance.token(), delta))
+	}
+	if r.MinCallDepth > 0 {
+		if obs.Trace == nil || obs.Trace.MaxDepth < r.MinCallDepth {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("call depth %d", obs.Trace.MaxDepth))
+	}
+	if r.SelfDestruct {
+		if obs.Trace == nil || len(obs.Trace.SelfDestructs) == 0 {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("self destruct of %s", obs.Trace.SelfDestructs[0].Hex()))
+	}
+	return reasons, true
+}
+
+// name returns the human readable identifier of the event.
+func (e *EventRule) name() string {
+	if e.Signature != "" {
+		return e.Signature
+	}
+	return e.Topic.Hex()
+}
+
+// holder resolves the account the balance rule refers to.
+func (b *BalanceRule) holder(obs *Observation) (common.Address, bool) {
+	switch b.Holder {
+	case HolderSender:
+		return obs.From, true
+	case HolderRecipient:
+		if to := obs.Tx.To(); to != nil {
+			return *to, true
+		}
+		return obs.Receipt.ContractAddress, obs.Receipt.ContractAddress != (common.Address{})
+	default:
+		return common.HexToAddress(b.Holder), true
+	}
+}
+
+// token returns the human readable identifier of the tracked token.
+func (b *BalanceRule) token() string {
+	if b.Token == (common.Address{}) {
+		return "native"
+	}
+	return b.Token.Hex()
+}
@@ -0,0 +1,155 @@
+package detector
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers/balance"
+)
+
+var (
+	attacker = common.HexToAddress("0xa77ac4e5")
+	victim   = common.HexToAddress("0x71c71a")
+	token    = common.HexToAddress("0x70ce2")
+	lender   = common.HexToAddress("0x1e2de2")
+)
+
+const testRules = `[
+	{
+		"name": "flashloan-drain",
+		"severity": "critical",
+		"events": [{"signature": "FlashLoan(address,uint256)", "address": "0x00000000000000000000000000000000001e2de2"}],
+		"balances": [{"token": "0x0000000000000000000000000000000000070ce2", "holder": "sender", "minDelta": "1000"}]
+	},
+	{
+		"name": "deep-selfdestruct",
+		"minCallDepth": 4,
+		"selfDestruct": true
+	},
+	{
+		"name": "native-gain",
+		"balances": [{"holder": "recipient", "minDelta": "0x10"}]
+	}
+]`
+
+func transferLog(from, to common.Address, amount int64) *types.Log {
+	return &types.Log{
+		Address: token,
+		Topics:  []common.Hash{balance.TransferTopic, from.Hash(), to.Hash()},
+		Data:    common.LeftPadBytes(big.NewInt(amount).Bytes(), 32),
+	}
+}
+
+func TestDetectorRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "detector-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "rules.json")
+	if err := ioutil.WriteFile(path, []byte(testRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("failed to load rules: %v", err)
+	}
+	sink, err := NewFileSink(filepath.Join(dir, "alerts.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to open sink: %v", err)
+	}
+	d := New(rules, sink)
+
+	alerts := make(chan *Alert, 10)
+	sub := d.SubscribeAlerts(alerts)
+	defer sub.Unsubscribe()
+
+	tx := types.NewTransaction(0, victim, big.NewInt(0), 100000, big.NewInt(1), []byte{0x01})
+	flashloan := &types.Log{Address: lender, Topics: []common.Hash{crypto.Keccak256Hash([]byte("FlashLoan(address,uint256)"))}}
+
+	tests := []struct {
+		obs  *Observation
+		want []string
+	}{
+		// Flashloan without enough profit
+		{&Observation{Tx: tx, From: attacker, Receipt: &types.Receipt{Logs: []*types.Log{flashloan, transferLog(victim, attacker, 999)}}}, nil},
+		// Flashloan draining the victim
+		{&Observation{Tx: tx, From: attacker, Receipt: &types.Receipt{Logs: []*types.Log{flashloan, transferLog(victim, attacker, 600), transferLog(victim, attacker, 600)}}}, []string{"flashloan-drain"}},
+		// Profit without flashloan
+		{&Observation{Tx: tx, From: attacker, Receipt: &types.Receipt{Logs: []*types.Log{transferLog(victim, attacker, 5000)}}}, nil},
+		// Deep call tree with self destruct, funds moved to the recipient
+		{&Observation{
+			Tx:          tx,
+			From:        attacker,
+			Receipt:     &types.Receipt{},
+			Trace:       &Tracer{MaxDepth: 5, SelfDestructs: []common.Address{victim}},
+			NativeDelta: map[common.Address]*big.Int{victim: big.NewInt(16)},
+			Pending:     true,
+		}, []string{"deep-selfdestruct", "native-gain"}},
+		// Shallow call tree
+		{&Observation{Tx: tx, From: attacker, Receipt: &types.Receipt{}, Trace: &Tracer{MaxDepth: 3, SelfDestructs: []common.Address{victim}}}, nil},
+	}
+	var raised int
+	for i, tt := range tests {
+		have := d.Inspect(tt.obs)
+		if len(have) != len(tt.want) {
+			t.Fatalf("test %d: alert count mismatch: have %d, want %d", i, len(have), len(tt.want))
+		}
+		for j, alert := range have {
+			if alert.Rule != tt.want[j] {
+				t.Errorf("test %d: alert %d rule mismatch: have %s, want %s", i, j, alert.Rule, tt.want[j])
+			}
+			if alert.Pending != tt.obs.Pending || (alert.BlockHash == nil) != tt.obs.Pending {
+				t.Errorf("test %d: alert %d pending flag mismatch", i, j)
+			}
+		}
+		raised += len(have)
+	}
+	for i := 0; i < raised; i++ {
+		<-alerts
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("failed to close detector: %v", err)
+	}
+	// Ensure every alert was persisted as a separate JSON line
+	file, err := os.Open(filepath.Join(dir, "alerts.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var lines int
+	for scanner := bufio.NewScanner(file); scanner.Scan(); lines++ {
+		var alert Alert
+		if err := json.Unmarshal(scanner.Bytes(), &alert); err != nil {
+			t.Fatalf("invalid alert line %d: %v", lines, err)
+		}
+	}
+	if lines != raised {
+		t.Fatalf("persisted alert count mismatch: have %d, want %d", lines, raised)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	tests := []*Rule{
+		{Severity: "high", SelfDestruct: true},
+		{Name: "empty"},
+		{Name: "no-topic", Events: []EventRule{{}}},
+		{Name: "bad-holder", Balances: []BalanceRule{{Holder: "attacker"}}},
+		{Name: "mismatch", Events: []EventRule{{Signature: "Foo()", Topic: common.Hash{0x01}}}},
+	}
+	for i, rule := range tests {
+		if err := rule.init(); err == nil {
+			t.Errorf("test %d: invalid rule accepted", i)
+		}
+	}
+}
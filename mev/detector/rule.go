@@ -0,0 +1,112 @@
+package detector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Holders a balance rule can refer to without naming an address.
+const (
+	HolderSender    = "sender"    // The account which signed the transaction
+	HolderRecipient = "recipient" // The account the transaction was sent to
+)
+
+// Rule describes a suspicious transaction pattern. A transaction matches the
+// rule if every condition the rule specifies holds; unset conditions are
+// ignored.
+type Rule struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity,omitempty"`
+
+	Events       []EventRule   `json:"events,omitempty"`       // Events which must all be emitted
+	Balances     []BalanceRule `json:"balances,omitempty"`     // Balance gains which must all be reached
+	MinCallDepth int           `json:"minCallDepth,omitempty"` // Minimum depth of the call tree
+	SelfDestruct bool          `json:"selfDestruct,omitempty"` // Whether a contract must self destruct
+}
+
+// EventRule matches a log by its first topic and optionally its emitter.
+type EventRule struct {
+	Signature string          `json:"signature,omitempty"` // Event signature, e.g. Transfer(address,address,uint256)
+	Topic     common.Hash     `json:"topic,omitempty"`     // Event topic, derived from the signature if unset
+	Address   *common.Address `json:"address,omitempty"`   // Emitting contract, any if unset
+}
+
+// BalanceRule matches if the balance of a holder grows by at least MinDelta
+// during the transaction. The zero token denotes the native currency, any
+// other token is tracked through its ERC20 Transfer events.
+type BalanceRule struct {
+	Token    common.Address        `json:"token,omitempty"`
+	Holder   string                `json:"holder"`
+	MinDelta *math.HexOrDecimal256 `json:"minDelta"`
+}
+
+// DefaultRules are the rules used if no rule file is configured.
+var DefaultRules = []*Rule{
+	{
+		Name:     "dodo-flashloan",
+		Severity: "high",
+		Events:   []EventRule{{Topic: common.HexToHash("0x0b82e93068db15abd9fbb2682c65462ea8a0a10582dce93a5664818e296f54eb")}},
+	},
+	{
+		Name:     "valas-flashloan",
+		Severity: "high",
+		Events:   []EventRule{{Topic: common.HexToHash("0x631042c832b07452973831137f2d73e395028b44b250dedc5abb0ee766e168ac")}},
+	},
+}
+
+// LoadRules reads a JSON array of rules from the given file.
+func LoadRules(path string) ([]*Rule, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*Rule
+	if err := json.Unmarshal(blob, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rule file %s: %v", path, err)
+	}
+	for i, rule := range rules {
+		if err := rule.init(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %v", i, err)
+		}
+	}
+	return rules, nil
+}
+
+// init validates the rule and fills in derived fields.
+func (r *Rule) init() error {
+	if r.Name == "" {
+		return errors.New("missing name")
+	}
+	if len(r.Events) == 0 && len(r.Balances) == 0 && r.MinCallDepth == 0 && !r.SelfDestruct {
+		return fmt.Errorf("rule %s has no conditions", r.Name)
+	}
+	for i := range r.Events {
+		event := &r.Events[i]
+		if event.Signature != "" {
+			topic := crypto.Keccak256Hash([]byte(event.Signature))
+			if event.Topic != (common.Hash{}) && event.Topic != topic {
+				return fmt.Errorf("rule %s: topic of event %s mismatches its signature", r.Name, event.Signature)
+			}
+			event.Topic = topic
+		}
+		if event.Topic == (common.Hash{}) {
+			return fmt.Errorf("rule %s: event %d has neither signature nor topic", r.Name, i)
+		}
+	}
+	for _, balance := range r.Balances {
+		if balance.Holder != HolderSender && balance.Holder != HolderRecipient && !common.IsHexAddress(balance.Holder) {
+			return fmt.Errorf("rule %s: invalid balance holder %q", r.Name, balance.Holder)
+		}
+		if balance.MinDelta == nil || (*big.Int)(balance.MinDelta).Sign() <= 0 {
+			return fmt.Errorf("rule %s: balance threshold must be positive", r.Name)
+		}
+	}
+	return nil
+}
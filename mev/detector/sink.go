@@ -0,0 +1,40 @@
+package detector
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink appends alerts as JSON lines to a file.
+type FileSink struct {
+	lock sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileSink opens the given file for appending alerts, creating it if it
+// does not exist yet.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Write implements Sink, appending the alert as a single line.
+func (s *FileSink) Write(alert *Alert) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.enc.Encode(alert)
+}
+
+// Close implements Sink.
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,69 @@
+package detector
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers/balance"
+)
+
+// Tracer is a lightweight vm.EVMLogger collecting the call tree features the
+// rules can match on, along with the native currency moved between accounts.
+// A tracer must only be used for a single transaction.
+type Tracer struct {
+	depth         int
+	MaxDepth      int              // Deepest call frame entered, 1 for a plain call
+	Calls         int              // Number of nested calls and creations
+	SelfDestructs []common.Address // Contracts which self destructed
+
+	Transfers *balance.Tracer // Native transfers, including internal calls
+}
+
+// NewTracer creates a tracer for a single transaction.
+func NewTracer() *Tracer {
+	return &Tracer{Transfers: balance.NewTracer()}
+}
+
+// CaptureStart implements vm.EVMLogger.
+func (t *Tracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.depth, t.MaxDepth = 1, 1
+	t.Transfers.CaptureStart(env, from, to, create, input, gas, value)
+}
+
+// CaptureState implements vm.EVMLogger.
+func (t *Tracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+
+// CaptureEnter implements vm.EVMLogger, tracking the call depth.
+func (t *Tracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.Transfers.CaptureEnter(typ, from, to, input, gas, value)
+
+	// Self destructs are reported as an enter/exit pair without a new frame
+	if typ == vm.SELFDESTRUCT {
+		t.SelfDestructs = append(t.SelfDestructs, from)
+		t.depth++
+		return
+	}
+	t.Calls++
+	t.depth++
+	if t.depth > t.MaxDepth {
+		t.MaxDepth = t.depth
+	}
+}
+
+// CaptureExit implements vm.EVMLogger.
+func (t *Tracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.depth--
+	t.Transfers.CaptureExit(output, gasUsed, err)
+}
+
+// CaptureFault implements vm.EVMLogger.
+func (t *Tracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnd implements vm.EVMLogger.
+func (t *Tracer) CaptureEnd(output []byte, gasUsed uint64, elapsed time.Duration, err error) {
+	t.Transfers.CaptureEnd(output, gasUsed, elapsed, err)
+}
@@ -0,0 +1,80 @@
+package mev
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/mev/detector"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the native balance changes of accounts neither sending nor
+// receiving the transaction are observed, so rules may refer to any holder.
+func TestObserveNativeDelta(t *testing.T) {
+	var (
+		key, _      = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender      = crypto.PubkeyToAddress(key.PublicKey)
+		forwarder   = common.HexToAddress("0xf0")
+		beneficiary = common.HexToAddress("0xbe")
+		gspec       = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				sender: {Balance: big.NewInt(params.Ether)},
+				// Forwards the call value: CALL(gas, 0xbe, callvalue, 0, 0, 0, 0) STOP
+				forwarder: {Balance: new(big.Int), Code: common.FromHex("0x60006000600060003460be5af100")},
+			},
+		}
+		db = rawdb.NewMemoryDatabase()
+	)
+	gspec.MustCommit(db)
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	sim := core.NewSimulator(chain, vm.Config{})
+	defer sim.Stop()
+
+	fork, err := sim.Fork()
+	if err != nil {
+		t.Fatalf("failed to fork simulator: %v", err)
+	}
+	tx := types.MustSignNewTx(key, types.LatestSigner(gspec.Config), &types.LegacyTx{
+		To:       &forwarder,
+		Value:    big.NewInt(1000),
+		Gas:      100000,
+		GasPrice: big.NewInt(1),
+		Data:     []byte{0x01},
+	})
+	obs, err := observe(fork, tx)
+	if err != nil {
+		t.Fatalf("failed to observe transaction: %v", err)
+	}
+	fee := new(big.Int).SetUint64(obs.Receipt.GasUsed)
+	if have := obs.NativeDelta[beneficiary]; have == nil || have.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("beneficiary delta mismatch: have %v, want %v", have, 1000)
+	}
+	if have := obs.NativeDelta[forwarder]; have != nil {
+		t.Fatalf("forwarder delta mismatch: have %v, want none", have)
+	}
+	if have, want := obs.NativeDelta[sender], new(big.Int).Neg(new(big.Int).Add(fee, big.NewInt(1000))); have == nil || have.Cmp(want) != 0 {
+		t.Fatalf("sender delta mismatch: have %v, want %v", have, want)
+	}
+	if have := obs.NativeDelta[fork.FeeRecipient()]; have == nil || have.Cmp(fee) != 0 {
+		t.Fatalf("fee recipient delta mismatch: have %v, want %v", have, fee)
+	}
+	// A rule on the third party holder must match
+	rule := &detector.Rule{
+		Name:     "beneficiary",
+		Balances: []detector.BalanceRule{{Holder: beneficiary.Hex(), MinDelta: (*math.HexOrDecimal256)(big.NewInt(1000))}},
+	}
+	if alerts := detector.New([]*detector.Rule{rule}).Inspect(obs); len(alerts) != 1 {
+		t.Fatalf("alerts mismatch: have %d, want 1", len(alerts))
+	}
+}
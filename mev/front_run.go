@@ -3,47 +3,33 @@ package mev
 import (
 	"context"
 	"encoding/hex"
-	"fmt"
+	"errors"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/math"
-	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/tracers/balance"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
-	"github.com/ethereum/go-ethereum/rpc"
-	lru "github.com/hashicorp/golang-lru"
-	"io"
-	myLog "log"
 	"math/big"
-	"os"
 	"strings"
-	"time"
 )
 
 const (
 	ContractCreateGasLimit = 10_000_000
-	ContractFRLimit = 100_000_000
-	GeneralGasLimit = 22_000
-	TransferEventHash      = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
-	DodoFlashloanEvent      = "0x0b82e93068db15abd9fbb2682c65462ea8a0a10582dce93a5664818e296f54eb"
-	ValasLendingFlashloanEvent      = "0x631042c832b07452973831137f2d73e395028b44b250dedc5abb0ee766e168ac"
+	ContractFRLimit        = 100_000_000
+	GeneralGasLimit        = 22_000
 
 	WbnbAddress = "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c"
 	UsdtAddress = "0x55d398326f99059fF775485246999027B3197955"
 	BusdAddress = "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56"
 	UsdcAddress = "0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d"
-
 )
 
 var (
-	MyAddress              = "0xF98560cfEbabBB4244e824A02d08FaC0727D37e3"
-	MyPrivateKey           = "5adcad86a2c64251ba3454b385bfb19a52733a50495159ccd4c6185263377cfc"
 	//MyContractAddress      = "0xfEcce0De36743802767d4436E1658F6A66c0200a" //fixed one, already deployed on bsc-mainnet
-	PriceOracleAddress     = "0xfbD61B037C325b959c0F6A7e69D8f37770C2c550" //bsc-mainnet
+	PriceOracleAddress = "0xfbD61B037C325b959c0F6A7e69D8f37770C2c550" //bsc-mainnet
 	//PriceOracleAddress     = "0xb6E3aE5ef1019a202B16CCAe530C07C039F58b8d" //test
-	BUSDAddress            = "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56"
+	BUSDAddress          = "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56"
 	BlackContractAddress = map[string]bool{
 		"0x10ed43c718714eb63d5aa57b78b54704e256024e": true,
 		"0x6cd71a07e72c514f5d511651f6808c6395353968": true,
@@ -52,85 +38,75 @@ var (
 		"0x3a6d8ca21d1cf76f653a67577fa0d27453350dd8": true,
 		"0x0000000000004946c0e9f43f4dee607b0ef1fa1c": true, //chi token?
 	}
-
-	//全局lru
-	ContractCreationCodeMap, _ = lru.New(10000)
 )
 
-func init(){
-	initMyLog()
+func init() {
+	Register("frontrun", newFrontRunner)
 }
 
-func initMyLog(){
-	if os.Getenv("MyAddress") != ""{
-		MyAddress = os.Getenv("MyAddress")
-	}
-	if os.Getenv("MyPrivateKey") != ""{
-		MyPrivateKey = os.Getenv("MyPrivateKey")
+// frontRunner replays pending transactions with the sender replaced by our own
+// account, including re-deploying the target contract if necessary.
+type frontRunner struct {
+	BaseStrategy
+	backend ethapi.Backend
+	signer  *Signer
+}
+
+func newFrontRunner(env *Env) (Strategy, error) {
+	if env.Signer == nil {
+		return nil, errNoSender
 	}
-	fmt.Printf("address %s\n", MyAddress)
-	fmt.Println("init my configs")
-	time.Local = time.FixedZone("CST", 0)
-	logFileLocation, _ := os.OpenFile("./info.log", os.O_CREATE|os.O_APPEND|os.O_RDWR, 0666)
-	mw := io.MultiWriter(os.Stdout, logFileLocation)
-	myLog.SetOutput(mw)
+	return &frontRunner{backend: env.Backend, signer: env.Signer}, nil
 }
 
-func SimulateTx(txn *types.Transaction, backend ethapi.Backend, eth *eth.Ethereum) {
-	fmt.Printf("txn hash: %s\n", txn.Hash().String())
-	startTime := time.Now()
+// Name implements Strategy.
+func (s *frontRunner) Name() string { return "frontrun" }
+
+// OnPendingTx implements Strategy, replaying the transaction from our own
+// account and checking whether the replay is profitable.
+func (s *frontRunner) OnPendingTx(ctx context.Context, txn *types.Transaction) error {
+	backend, me := s.backend, s.signer.Address()
+	logger.Trace("Front running pending transaction", "hash", txn.Hash())
 	msg, e := txn.AsMessage(types.LatestSignerForChainID(txn.ChainId()))
 	if e != nil {
-		fmt.Println(e.Error())
+		return e
 	}
 	from := msg.From()
-	if strings.ToLower(from.String()) == strings.ToLower(MyAddress) {
-		return
+	if from == me {
+		return nil
 	}
-	// 部署合约我们需要存下creation code等待后续使用
+	// Contract deployments are picked up by the contract creation index once mined
 	if txn.To() == nil {
-		contractAddress := crypto.CreateAddress(from, txn.Nonce())
-		ContractCreationCodeMap.Add(contractAddress.String(), txn.Data())
-		fmt.Printf("saved contract creation code. contract address %s\n", contractAddress.String())
-		return
-	}
-	fmt.Printf("txn to: %s\n", txn.To().String())
-	if  txn.Value().Cmp(big.NewInt(0)) != 0 || BlackContractAddress[strings.ToLower(txn.To().String())]{
-		return
+		return nil
 	}
-	currentBN := backend.CurrentBlock().Number().Int64()
-	//fmt.Printf("current bn %d\n", currentBN)
-	statedb, header, err := backend.StateAndHeaderByNumberOrHash(context.Background(), rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(currentBN)))
-	if statedb == nil || err != nil {
-		fmt.Println("err get state")
-		return
+	if txn.Value().Cmp(big.NewInt(0)) != 0 || BlackContractAddress[strings.ToLower(txn.To().String())] {
+		return nil
 	}
-	//对于每次模拟copy一份进行
-	//code := statedb.GetCode(*txn.To())
-	//code为0是普通转账
+	// Plain transfers carry no call to replay
 	if len(txn.Data()) == 0 {
-		return
+		return nil
+	}
+	// Simulate every candidate on its own fork of the pending state
+	fork, err := backend.Simulator().Fork()
+	if err != nil {
+		return err
 	}
-	state := statedb.Copy()
-	gp := new(core.GasPool).AddGas(math.MaxUint64)
 
 	// start to generate my simulated tx
-	fmt.Printf("start to sim, tx hash %s\n", txn.Hash().String())
-
-	ogReceipt, err := core.ApplyTransaction(backend.ChainConfig(), eth.BlockChain(), &header.Coinbase, gp, state, header, txn, &header.GasUsed, vm.Config{})
-	if err != nil || ogReceipt.Status == 0{
-		//原始请求就不能够成功
-		return
+	ogResult, err := simulate(fork, txn)
+	if err != nil || ogResult.Receipt.Status == 0 {
+		// The original transaction fails, so would the replay
+		return nil
 	}
 
-	myData := strings.ReplaceAll(hex.EncodeToString(txn.Data()), strings.ToLower(msg.From().String()[2:]), strings.ToLower(MyAddress[2:]))
+	myData := strings.ReplaceAll(hex.EncodeToString(txn.Data()), strings.ToLower(msg.From().String()[2:]), strings.ToLower(me.Hex()[2:]))
 	myDataBytes, err := hex.DecodeString(myData)
 	if err != nil {
-		return
+		return nil
 	}
-	nonce, err := backend.GetPoolNonce(context.Background(), common.HexToAddress(MyAddress))
+	nonce, err := backend.GetPoolNonce(ctx, me)
 	if err != nil {
-		return
+		return nil
 	}
 	myTx := types.NewTx(&types.LegacyTx{
 		Nonce:    nonce,
@@ -140,93 +116,47 @@ func SimulateTx(txn *types.Transaction, backend ethapi.Backend, eth *eth.Ethereu
 		GasPrice: txn.GasPrice(),
 		Data:     myDataBytes,
 	})
-	privateKey, _ := crypto.HexToECDSA(MyPrivateKey)
-	signedTx, _ := types.SignTx(myTx, types.NewEIP155Signer(txn.ChainId()), privateKey)
-
-	// done: generate new txn instead of target one, replace from and data
-	receipt, err := core.ApplyTransaction(backend.ChainConfig(), eth.BlockChain(), &header.Coinbase, gp, state, header, signedTx, &header.GasUsed, vm.Config{})
+	// The replays are simulated unsigned, a wallet requiring confirmation
+	// would otherwise be asked for each and every pending transaction
+	result, err := simulateFrom(fork, me, myTx)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
-	}
-	fmt.Printf("direct sim receipt status %d\n", receipt.Status)
-	if receipt.Status == 1 {
-		logs := state.Logs()
-		checkProfit(logs, txn)
-		//if token == nil || amount == nil{
-		//	return
-		//}
-		////// 构建price oracle请求 理论是一定能成功的
-		//priceOracleABI, err := abi.JSON(strings.NewReader(mev.PriceOracleABI))
-		//if err != nil {
-		//	return
-		//}
-		//dataPacked, err := priceOracleABI.Pack("getRate", *token, common.HexToAddress(BUSDAddress), true)
-		//if err != nil{
-		//	fmt.Println(err.Error())
-		//	return
-		//}
-		//oracleAddr := common.HexToAddress(PriceOracleAddress)
-		//priceTx := types.NewTx(&types.LegacyTx{
-		//	Nonce:    nonce + 1,
-		//	To:       &oracleAddr,
-		//	Gas:      txn.Gas(),
-		//	GasPrice: txn.GasPrice(),
-		//	Data:     dataPacked,
-		//})
-		//signedPriceTx, _ := types.SignTx(priceTx, types.NewEIP155Signer(txn.ChainId()), privateKey)
-		//receiptPO, result, err := core.ApplyTransactionWithResult(backend.ChainConfig(), eth.BlockChain(), &header.Coinbase, gp, state, header, signedPriceTx, &header.GasUsed, vm.Config{})
-		//if err != nil {
-		//	myLog.Printf("get price err: %s\n", err.Error())
-		//	return
-		//}
-		//if receiptPO.Status == 0{
-		//	myLog.Printf("get price receipt failed: %d\n", receiptPO.Status)
-		//	return
-		//}
-		//tokenPriceRate := big.NewInt(0).SetBytes(result.ReturnData)
-		//if tokenPriceRate.Cmp(big.NewInt(0)) == 0{
-		//	return
-		//}
-		//multiplier := big.NewInt(0).Mul(amount, ETHER)
-		//value := big.NewInt(0).Div(multiplier, tokenPriceRate)
-		//myLog.Printf("profit calculated.. txn: %s, to: %s, token: %s, value: %s\n", txn.Hash().String(), txn.To().String(), token.String(), value.String())
-		//if value.Cmp(ETHER) == 1{
-		//	//todo: 大于一刀才抢跑
-		//}
-		//fmt.Printf("time used %d ms\n", time.Since(startTime).Milliseconds())
-	} else { // 暂时先不考虑合约创建的情况
-		// 直接模拟失败 则部署完全一样的合约进行模拟 若成功则抢跑部署+调用 若失败则放弃
-		// 替换合约里写死的地址
-		contractCreationCode, ok := ContractCreationCodeMap.Get(txn.To().String()); if !ok{
-			fmt.Println("not found creation code in map")
-			return
+		return err
+	}
+	logger.Trace("Simulated direct replay", "hash", txn.Hash(), "status", result.Receipt.Status)
+	if result.Receipt.Status == 1 {
+		logs := fork.Logs()
+		checkProfit(logs, txn, me)
+		// TODO: value the gains through the price oracle, only front running
+		// the ones worth more than a dollar.
+	} else {
+		// The replay failed, likely because the contract checks its owner. Deploy
+		// a replica owned by us and replay the call against it instead.
+		contractCreationCode, err := s.creationCode(ctx, *txn.To())
+		if err != nil {
+			logger.Trace("Missing contract creation code", "address", txn.To(), "err", err)
+			return nil
 		}
-		//替换
-		newCodeHexStr := strings.ReplaceAll(hex.EncodeToString(contractCreationCode.([]byte)), strings.ToLower(from.String()[2:]), strings.ToLower(MyAddress[2:]))
+		newCodeHexStr := strings.ReplaceAll(hex.EncodeToString(contractCreationCode), strings.ToLower(from.String()[2:]), strings.ToLower(me.Hex()[2:]))
 		newCodeBytes, err := hex.DecodeString(newCodeHexStr)
 		if err != nil {
-			return
+			return nil
 		}
-		//fmt.Println(hex.EncodeToString(contractCreationCode.([]byte)))
 		myCreateContractTx := types.NewTx(&types.LegacyTx{
 			Nonce:    nonce + 1,
 			Gas:      ContractCreateGasLimit,
 			GasPrice: txn.GasPrice(),
 			Data:     newCodeBytes,
 		})
-		singedMyCreateContractTx, _ := types.SignTx(myCreateContractTx, types.NewEIP155Signer(txn.ChainId()), privateKey)
-		receiptContractCreate, err := core.ApplyTransaction(backend.ChainConfig(), eth.BlockChain(), &header.Coinbase, gp, state, header, singedMyCreateContractTx, &header.GasUsed, vm.Config{})
+		resultContractCreate, err := simulateFrom(fork, me, myCreateContractTx)
 		if err != nil {
-			fmt.Println(err.Error())
-			return
+			return err
 		}
-		fmt.Printf("sim create contract status %d\n", receiptContractCreate.Status)
-		if receiptContractCreate.Status == 0{
-			fmt.Println("sim create contract failed")
-			return
+		receiptContractCreate := resultContractCreate.Receipt
+		if receiptContractCreate.Status == 0 {
+			logger.Trace("Simulated contract replica creation failed", "hash", txn.Hash())
+			return nil
 		}
-		fmt.Printf("sim create contract at %s\n", receiptContractCreate.ContractAddress)
+		logger.Trace("Simulated contract replica creation", "hash", txn.Hash(), "address", receiptContractCreate.ContractAddress)
 		myCallContractTx := types.NewTx(&types.LegacyTx{
 			Nonce:    nonce + 2,
 			Value:    big.NewInt(0),
@@ -235,58 +165,55 @@ func SimulateTx(txn *types.Transaction, backend ethapi.Backend, eth *eth.Ethereu
 			GasPrice: txn.GasPrice(),
 			Data:     myDataBytes,
 		})
-		singedMyCallContractTx, _ := types.SignTx(myCallContractTx, types.NewEIP155Signer(txn.ChainId()), privateKey)
-		receiptCall, err := core.ApplyTransaction(backend.ChainConfig(), eth.BlockChain(), &header.Coinbase, gp, state, header, singedMyCallContractTx, &header.GasUsed, vm.Config{})
+		resultCall, err := simulateFrom(fork, me, myCallContractTx)
 		if err != nil {
-			fmt.Println(err.Error())
-			return
+			return err
 		}
-		fmt.Printf("replica contract receipt: %d\n", receiptCall.Status)
+		receiptCall := resultCall.Receipt
+		logger.Trace("Simulated contract replica call", "hash", txn.Hash(), "status", receiptCall.Status)
 		if receiptCall.Status == 1 {
-			//通过logs判断是否有利可图
 			logs := receiptCall.Logs
-			checkProfit(logs, txn)
-			fmt.Printf("time used %d ms\n", time.Since(startTime).Milliseconds())
+			checkProfit(logs, txn, me)
 		}
 	}
-
+	return nil
 }
 
-// need to improve todo: 暂时只返回了一个
-func checkProfit(logs []*types.Log, txn *types.Transaction) (*common.Address, *big.Int){
-	if len(logs) == 0 {
-		return nil, nil
+// creationCode retrieves the init code the contract at the given address was
+// deployed with. Only contracts deployed directly by a transaction are supported,
+// the init code of internal creations is not retained.
+func (s *frontRunner) creationCode(ctx context.Context, address common.Address) ([]byte, error) {
+	entry := rawdb.ReadContractCreation(s.backend.ChainDb(), address)
+	if entry == nil {
+		return nil, errors.New("contract creation not indexed")
 	}
-	for _, log := range logs {
-		topics := log.Topics
+	tx, _, _, _, err := s.backend.GetTransaction(ctx, entry.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil || tx.To() != nil || crypto.Keccak256Hash(tx.Data()) != entry.InitCodeHash {
+		return nil, errors.New("contract created internally")
+	}
+	return tx.Data(), nil
+}
 
-		//判断这个log是否是Transfer
-		if len(topics) == 3 && strings.ToLower(topics[0].String()) == strings.ToLower(TransferEventHash) {
-			fromAddr := common.HexToAddress(topics[1].Hex())
-			toAddr := common.HexToAddress(topics[2].Hex())
-			if  fromAddr.String() == toAddr.String(){
-				continue
-			}
-			if strings.ToLower(toAddr.String()) == strings.ToLower(MyAddress){
-				//data 为amount
-				token := log.Address
-				amount := big.NewInt(0).SetBytes(log.Data)
-				if amount.Cmp(big.NewInt(0)) == 1{
-					myLog.Printf("tx: %s, transfer amount %s(token %s) to me\n", txn.Hash().String(), amount.String(), token)
-				}
-				//amount > 0
-				if strings.ToLower(token.String()) == strings.ToLower(WbnbAddress) && amount.Cmp(big.NewInt(0).Div(ETHER, big.NewInt(100))) == 1{
-					myLog.Printf("tx: %s, transfer amount %s(token %s) to me\n", txn.Hash().String(), amount.String(), token)
-					//front run
-				}
-				if (strings.ToLower(token.String()) == strings.ToLower(BusdAddress) || strings.ToLower(token.String()) == strings.ToLower(UsdcAddress) || strings.ToLower(token.String()) == strings.ToLower(UsdtAddress)) && amount.Cmp(ETHER) == 1{
-					fmt.Printf("transfer amount %d(token %s) to me\n", amount.Uint64(), token)
-					myLog.Printf("tx: %s, transfer amount %s(token %s) to me\n", txn.Hash().String(), amount.String(), token)
-					// 需要写一个合约 将可能增加的erc20代币 扔到合约里计算最终拿到的等同于多少BNB
-					// calculate the usd value of the free token
-					return &token, amount
-				}
-			}
+// checkProfit reports the tokens gained by the replayed transaction. Only the
+// first stablecoin gain is returned.
+func checkProfit(logs []*types.Log, txn *types.Transaction, me common.Address) (*common.Address, *big.Int) {
+	tokens := balance.TokenDeltas(logs)
+
+	// Net WBNB gains are only reported, stablecoin gains are front run
+	wbnb := common.HexToAddress(WbnbAddress)
+	if amount := tokens[wbnb][me]; amount != nil && amount.Cmp(new(big.Int).Div(ETHER, big.NewInt(100))) > 0 {
+		logger.Info("Found front running profit", "hash", txn.Hash(), "token", wbnb, "amount", amount)
+		profitMeter.Mark(1)
+	}
+	for _, addr := range []string{BusdAddress, UsdcAddress, UsdtAddress} {
+		token := common.HexToAddress(addr)
+		if amount := tokens[token][me]; amount != nil && amount.Cmp(ETHER) > 0 {
+			logger.Info("Found front running profit", "hash", txn.Hash(), "token", token, "amount", amount)
+			profitMeter.Mark(1)
+			return &token, amount
 		}
 	}
 	return nil, nil
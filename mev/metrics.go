@@ -0,0 +1,51 @@
+package mev
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	taskDropMeter   = metrics.NewRegisteredMeter("mev/task/drop", nil)
+	simulationTimer = metrics.NewRegisteredTimer("mev/simulation", nil)
+	profitMeter     = metrics.NewRegisteredMeter("mev/profit", nil)
+)
+
+// strategyMetrics tracks the callbacks of a single strategy.
+type strategyMetrics struct {
+	runTimer     metrics.Timer // Duration of the finished callbacks
+	failMeter    metrics.Meter // Callbacks returning an error
+	panicMeter   metrics.Meter // Callbacks which panicked
+	timeoutMeter metrics.Meter // Callbacks abandoned after the timeout
+	busyMeter    metrics.Meter // Pending transaction callbacks skipped with all slots taken
+}
+
+// newStrategyMetrics registers the metrics of the named strategy.
+func newStrategyMetrics(name string) *strategyMetrics {
+	prefix := "mev/strategy/" + name
+	return &strategyMetrics{
+		runTimer:     metrics.GetOrRegisterTimer(prefix+"/run", nil),
+		failMeter:    metrics.GetOrRegisterMeter(prefix+"/fail", nil),
+		panicMeter:   metrics.GetOrRegisterMeter(prefix+"/panic", nil),
+		timeoutMeter: metrics.GetOrRegisterMeter(prefix+"/timeout", nil),
+		busyMeter:    metrics.GetOrRegisterMeter(prefix+"/busy", nil),
+	}
+}
+
+// simulate applies the transaction on top of the fork, tracking the number
+// and latency of simulations.
+func simulate(fork *core.SimFork, tx *types.Transaction) (*core.SimResult, error) {
+	defer simulationTimer.UpdateSince(time.Now())
+	return fork.ApplyTransaction(tx)
+}
+
+// simulateFrom applies the unsigned transaction as sent by the given account on
+// top of the fork, tracking the number and latency of simulations.
+func simulateFrom(fork *core.SimFork, from common.Address, tx *types.Transaction) (*core.SimResult, error) {
+	defer simulationTimer.UpdateSince(time.Now())
+	return fork.ApplyMessage(from, tx)
+}
@@ -2,52 +2,76 @@ package mev
 
 import (
 	"context"
-	"fmt"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/math"
-	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	mev "github.com/ethereum/go-ethereum/mev/abi"
-	"github.com/ethereum/go-ethereum/rpc"
-	myLog "log"
 	"math/big"
 	"strings"
-	"time"
 )
 
-var(
+var (
 	Big10 = big.NewInt(10)
-	Big9 = big.NewInt(9)
+	Big9  = big.NewInt(9)
 	Big18 = big.NewInt(18)
 	ETHER = big.NewInt(1).Exp(Big10, Big18, nil)
-	GWEI = big.NewInt(1).Exp(Big10, Big9, nil)
+	GWEI  = big.NewInt(1).Exp(Big10, Big9, nil)
 )
 
-const(
+const (
 	skimTokenContractAddress = "0x03275A7751D610bd4350e884fA90e0D6e64470DC"
 )
 
-func SimRebaseTokenSkim(backend ethapi.Backend, eth *eth.Ethereum, maxGas *big.Int) {
-	startTime := time.Now()
+func init() {
+	Register("skim", newRebaseSkimmer)
+}
+
+// rebaseSkimmer checks on every new head whether the deployed skim contract
+// can extract profit from rebase tokens.
+type rebaseSkimmer struct {
+	BaseStrategy
+	backend ethapi.Backend
+	signer  *Signer
+}
+
+func newRebaseSkimmer(env *Env) (Strategy, error) {
+	if env.Signer == nil {
+		return nil, errNoSender
+	}
+	return &rebaseSkimmer{backend: env.Backend, signer: env.Signer}, nil
+}
+
+// Name implements Strategy.
+func (s *rebaseSkimmer) Name() string { return "skim" }
+
+// OnNewHead implements Strategy, simulating the skim call on top of the new
+// head with the highest gas price currently seen in the pool.
+func (s *rebaseSkimmer) OnNewHead(ctx context.Context, head *types.Header) error {
+	backend := s.backend
+	txns, err := backend.GetPoolTransactions()
+	if err != nil {
+		return err
+	}
+	var maxGas = big.NewInt(0)
+	for _, tx := range txns {
+		if tx.GasPrice().Cmp(maxGas) > 0 {
+			maxGas = tx.GasPrice()
+		}
+	}
 	// 构造请求
 	ABI, err := abi.JSON(strings.NewReader(mev.SkimTokenExpABI))
 	if err != nil {
-		return
+		return nil
 	}
 	dataPacked, err := ABI.Pack("exp")
-	if err != nil{
-		fmt.Println(err.Error())
-		return
+	if err != nil {
+		return err
 	}
 	skimTokenContract := common.HexToAddress(skimTokenContractAddress)
-	nonce, err := backend.GetPoolNonce(context.Background(), common.HexToAddress(MyAddress))
+	nonce, err := backend.GetPoolNonce(ctx, s.signer.Address())
 	if err != nil {
-		return
+		return nil
 	}
 	priceTx := types.NewTx(&types.LegacyTx{
 		Nonce:    nonce,
@@ -56,40 +80,31 @@ func SimRebaseTokenSkim(backend ethapi.Backend, eth *eth.Ethereum, maxGas *big.I
 		GasPrice: maxGas,
 		Data:     dataPacked,
 	})
-	privateKey, _ := crypto.HexToECDSA(MyPrivateKey)
-	signedTx, _ := types.SignTx(priceTx, types.NewEIP155Signer(big.NewInt(56)), privateKey)
-	currentBN := backend.CurrentBlock().Number().Int64()
-	//fmt.Printf("current bn %d\n", currentBN)
-	statedb, header, err := backend.StateAndHeaderByNumberOrHash(context.Background(), rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(currentBN)))
-	if statedb == nil || err != nil {
-		fmt.Println("err get state")
-		return
+	currentBN := head.Number.Int64()
+	//对于每次模拟fork一份进行
+	fork, err := backend.Simulator().ForkAt(head)
+	if err != nil {
+		return err
 	}
-	//对于每次模拟copy一份进行
-	state := statedb.Copy()
-	// start to generate my simulated tx
-	gp := new(core.GasPool).AddGas(math.MaxUint64)
 	// done: generate new txn instead of target one, replace from and data
-	receipt, result, err := core.ApplyTransactionWithResult(backend.ChainConfig(), eth.BlockChain(), &header.Coinbase, gp, state, header, signedTx, &header.GasUsed, vm.Config{})
+	result, err := simulateFrom(fork, s.signer.Address(), priceTx)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		return err
 	}
+	receipt := result.Receipt
 
 	if receipt.Status == 1 {
 		// look result
 		profit := big.NewInt(0).SetBytes(result.ReturnData)
 
-		fmt.Printf("sim receipt status %d, profit: %s \n", receipt.Status, profit.String())
-
+		logger.Trace("Simulated rebase skim", "number", currentBN, "profit", profit)
 
-		if profit.Cmp(big.NewInt(0)) == 1{
+		if profit.Cmp(big.NewInt(0)) == 1 {
 			// run my tx
-			myLog.Printf("found profit @ %d", currentBN)
-			// backend.SendTx(context.Background(), signedTx)
+			logger.Info("Found rebase skim profit", "number", currentBN, "profit", profit)
+			profitMeter.Mark(1)
+			// Submission is disabled, priceTx has to be signed once enabled
 		}
-
-		fmt.Printf("time used %d ms\n", time.Since(startTime).Milliseconds())
 	}
+	return nil
 }
-
@@ -0,0 +1,360 @@
+package mev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/mev/detector"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// logger is the logger of the mev module, all strategies log through it.
+var logger = log.New("module", "mev")
+
+const (
+	// txChanSize is the size of channel listening to NewTxsEvent.
+	txChanSize = 4096
+
+	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+	chainHeadChanSize = 10
+)
+
+// task is a single strategy callback waiting for a free worker.
+type task struct {
+	runner *strategyRunner
+	event  string
+	run    func(ctx context.Context) error
+}
+
+// strategyRunner tracks the callbacks of a single strategy.
+type strategyRunner struct {
+	strategy Strategy
+	metrics  *strategyMetrics
+	slots    chan struct{} // Callbacks yet to return, abandoned ones included
+
+	chainLock  sync.Mutex
+	chainTasks []*task       // Head and reorg callbacks waiting to run, in order
+	chainWake  chan struct{} // Signalled whenever a chain callback is queued
+}
+
+// newStrategyRunner creates the runner of a strategy, allowing at most slots
+// of its callbacks to be in flight at once.
+func newStrategyRunner(strategy Strategy, slots int) *strategyRunner {
+	return &strategyRunner{
+		strategy:  strategy,
+		metrics:   newStrategyMetrics(strategy.Name()),
+		slots:     make(chan struct{}, slots),
+		chainWake: make(chan struct{}, 1),
+	}
+}
+
+// queueChain schedules a head or reorg callback. Chain callbacks are never
+// dropped, they run one after the other in the order of the chain events.
+func (r *strategyRunner) queueChain(t *task) {
+	r.chainLock.Lock()
+	r.chainTasks = append(r.chainTasks, t)
+	r.chainLock.Unlock()
+
+	select {
+	case r.chainWake <- struct{}{}:
+	default:
+	}
+}
+
+// nextChain pops the oldest queued chain callback, if any.
+func (r *strategyRunner) nextChain() *task {
+	r.chainLock.Lock()
+	defer r.chainLock.Unlock()
+
+	if len(r.chainTasks) == 0 {
+		return nil
+	}
+	t := r.chainTasks[0]
+	r.chainTasks = r.chainTasks[1:]
+	return t
+}
+
+// Service runs the configured strategies against the pending transaction
+// stream and chain head updates of the local node.
+type Service struct {
+	config     Config
+	backend    ethapi.Backend
+	detector   *detector.Detector
+	strategies []Strategy
+	runners    []*strategyRunner
+
+	tasks   chan *task
+	headSub event.Subscription
+	txSub   event.Subscription
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates the strategy service and registers it as a lifecycle on the
+// given node. The strategies listed in the config must have been registered
+// beforehand.
+func New(stack *node.Node, backend ethapi.Backend, config *Config) (*Service, error) {
+	if backend.Simulator() == nil {
+		return nil, errors.New("mev strategies require a full node")
+	}
+	conf := config.sanitize()
+	env := &Env{Backend: backend, Config: &conf}
+	if conf.Sender != (common.Address{}) {
+		signer, err := newSigner(backend.AccountManager(), conf.Sender, backend.ChainConfig().ChainID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mev sender %s: %v", conf.Sender.Hex(), err)
+		}
+		env.Signer = signer
+	}
+	det, err := newDetector(stack, &conf)
+	if err != nil {
+		return nil, err
+	}
+	env.Detector = det
+
+	strategies, err := newStrategies(env, conf.Strategies)
+	if err != nil {
+		det.Close()
+		return nil, err
+	}
+	s := &Service{
+		config:     conf,
+		backend:    backend,
+		detector:   det,
+		strategies: strategies,
+		tasks:      make(chan *task, conf.QueueSize),
+		quit:       make(chan struct{}),
+	}
+	for _, strategy := range strategies {
+		s.runners = append(s.runners, newStrategyRunner(strategy, conf.Workers))
+	}
+	stack.RegisterAPIs(s.APIs())
+	stack.RegisterLifecycle(s)
+	return s, nil
+}
+
+// newDetector creates the exploit detector with the configured rules and
+// alert sink.
+func newDetector(stack *node.Node, config *Config) (*detector.Detector, error) {
+	rules := detector.DefaultRules
+	if config.DetectorRules != "" {
+		var err error
+		if rules, err = detector.LoadRules(config.DetectorRules); err != nil {
+			return nil, err
+		}
+	}
+	var sinks []detector.Sink
+	if config.DetectorSink != "" {
+		sink, err := detector.NewFileSink(stack.ResolvePath(config.DetectorSink))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open detector sink: %v", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return detector.New(rules, sinks...), nil
+}
+
+// APIs returns the RPC services offered by the strategy service.
+func (s *Service) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "mev",
+			Version:   "1.0",
+			Service:   NewPublicDetectorAPI(s.detector),
+			Public:    true,
+		},
+	}
+}
+
+// Start implements node.Lifecycle, subscribing to chain events and spinning up
+// the worker pool.
+func (s *Service) Start() error {
+	txCh := make(chan core.NewTxsEvent, txChanSize)
+	s.txSub = s.backend.SubscribeNewTxsEvent(txCh)
+	headCh := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	s.headSub = s.backend.SubscribeChainHeadEvent(headCh)
+
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	for _, runner := range s.runners {
+		s.wg.Add(1)
+		go s.chainWorker(runner)
+	}
+	s.wg.Add(1)
+	go s.loop(txCh, headCh)
+
+	names := make([]string, 0, len(s.strategies))
+	for _, strategy := range s.strategies {
+		names = append(names, strategy.Name())
+	}
+	logger.Info("Started mev strategy service", "strategies", names, "workers", s.config.Workers)
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the event loop and waiting for
+// the workers to finish their current callbacks.
+func (s *Service) Stop() error {
+	s.txSub.Unsubscribe()
+	s.headSub.Unsubscribe()
+	close(s.quit)
+	s.wg.Wait()
+	if err := s.detector.Close(); err != nil {
+		logger.Warn("Failed to close exploit detector", "err", err)
+	}
+	logger.Info("Stopped mev strategy service")
+	return nil
+}
+
+// loop dispatches chain events to the strategies until the service is stopped.
+func (s *Service) loop(txCh chan core.NewTxsEvent, headCh chan core.ChainHeadEvent) {
+	defer s.wg.Done()
+
+	head := s.backend.CurrentHeader()
+	for {
+		select {
+		case ev := <-txCh:
+			for _, tx := range ev.Txs {
+				tx := tx
+				for _, runner := range s.runners {
+					strategy := runner.strategy
+					s.enqueue(&task{runner: runner, event: "pendingTx", run: func(ctx context.Context) error {
+						return strategy.OnPendingTx(ctx, tx)
+					}})
+				}
+			}
+
+		case ev := <-headCh:
+			oldHead, newHead := head, ev.Block.Header()
+			head = newHead
+
+			reorg := oldHead != nil && newHead.ParentHash != oldHead.Hash()
+			for _, runner := range s.runners {
+				strategy := runner.strategy
+				if reorg {
+					runner.queueChain(&task{runner: runner, event: "reorg", run: func(ctx context.Context) error {
+						return strategy.OnReorg(ctx, oldHead, newHead)
+					}})
+				}
+				runner.queueChain(&task{runner: runner, event: "newHead", run: func(ctx context.Context) error {
+					return strategy.OnNewHead(ctx, newHead)
+				}})
+			}
+
+		case <-s.txSub.Err():
+			return
+		case <-s.headSub.Err():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// enqueue schedules a pending transaction callback, dropping it if all workers
+// are busy and the queue is full. Blocking here would stall the event
+// subscriptions.
+func (s *Service) enqueue(t *task) {
+	select {
+	case s.tasks <- t:
+	default:
+		logger.Debug("Dropping mev strategy callback, queue full", "strategy", t.runner.strategy.Name(), "event", t.event)
+		taskDropMeter.Mark(1)
+	}
+}
+
+// worker executes queued pending transaction callbacks until the service is
+// stopped. Callbacks of a strategy with all its slots taken are skipped.
+func (s *Service) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case t := <-s.tasks:
+			select {
+			case t.runner.slots <- struct{}{}:
+				s.execute(t)
+			default:
+				logger.Debug("Skipping mev strategy callback, strategy busy", "strategy", t.runner.strategy.Name(), "event", t.event)
+				t.runner.metrics.busyMeter.Mark(1)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// chainWorker executes the head and reorg callbacks of a strategy in order
+// until the service is stopped, waiting for a free slot instead of skipping
+// them.
+func (s *Service) chainWorker(r *strategyRunner) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-r.chainWake:
+		case <-s.quit:
+			return
+		}
+		for t := r.nextChain(); t != nil; t = r.nextChain() {
+			select {
+			case r.slots <- struct{}{}:
+				s.execute(t)
+			case <-s.quit:
+				return
+			}
+		}
+	}
+}
+
+// execute runs a single callback holding a slot of its strategy, abandoning it
+// once the configured timeout elapses so a misbehaving strategy cannot starve
+// the pool. The slot is only released once the callback returns, even if
+// abandoned, so hanging callbacks cannot pile up.
+func (s *Service) execute(t *task) {
+	var (
+		strategy = t.runner.strategy
+		metrics  = t.runner.metrics
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+
+	var (
+		start = time.Now()
+		done  = make(chan error, 1)
+	)
+	go func() {
+		defer func() { <-t.runner.slots }()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Mev strategy panicked", "strategy", strategy.Name(), "event", t.event, "err", r)
+				metrics.panicMeter.Mark(1)
+				done <- nil
+			}
+		}()
+		done <- t.run(ctx)
+	}()
+	select {
+	case err := <-done:
+		metrics.runTimer.UpdateSince(start)
+		if err != nil {
+			logger.Debug("Mev strategy failed", "strategy", strategy.Name(), "event", t.event, "err", err)
+			metrics.failMeter.Mark(1)
+		}
+	case <-ctx.Done():
+		logger.Warn("Mev strategy timed out", "strategy", strategy.Name(), "event", t.event, "elapsed", time.Since(start))
+		metrics.timeoutMeter.Mark(1)
+	case <-s.quit:
+	}
+}
@@ -0,0 +1,228 @@
+package mev
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/mev/detector"
+)
+
+// testBackend implements the subset of ethapi.Backend used by the service.
+type testBackend struct {
+	ethapi.Backend
+
+	txFeed   event.Feed
+	headFeed event.Feed
+	head     *types.Header
+}
+
+func (b *testBackend) CurrentHeader() *types.Header { return b.head }
+
+func (b *testBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return b.txFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.headFeed.Subscribe(ch)
+}
+
+// recordingStrategy records every callback it receives.
+type recordingStrategy struct {
+	lock   sync.Mutex
+	events []string
+	delay  time.Duration
+	hang   chan struct{} // If set, pending transactions block until closed, ignoring the context
+	hung   chan struct{} // Signalled once a pending transaction blocks
+}
+
+func (s *recordingStrategy) Name() string { return "recorder" }
+
+func (s *recordingStrategy) record(event string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *recordingStrategy) recorded() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.events...)
+}
+
+func (s *recordingStrategy) OnPendingTx(ctx context.Context, tx *types.Transaction) error {
+	if s.hang != nil {
+		s.hung <- struct{}{}
+		<-s.hang
+		s.record("tx")
+		return nil
+	}
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.record("tx")
+	return nil
+}
+
+func (s *recordingStrategy) OnNewHead(ctx context.Context, head *types.Header) error {
+	s.record("head " + head.Number.String())
+	return nil
+}
+
+func (s *recordingStrategy) OnReorg(ctx context.Context, oldHead, newHead *types.Header) error {
+	s.record("reorg " + oldHead.Number.String() + " " + newHead.Number.String())
+	return nil
+}
+
+func newTestService(backend *testBackend, strategy Strategy, config Config) *Service {
+	conf := config.sanitize()
+	return &Service{
+		config:     conf,
+		backend:    backend,
+		detector:   detector.New(nil),
+		strategies: []Strategy{strategy},
+		runners:    []*strategyRunner{newStrategyRunner(strategy, conf.Workers)},
+		tasks:      make(chan *task, conf.QueueSize),
+		quit:       make(chan struct{}),
+	}
+}
+
+func waitEvents(t *testing.T, strategy *recordingStrategy, n int) []string {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if events := strategy.recorded(); len(events) >= n {
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d events, have %v", n, strategy.recorded())
+	return nil
+}
+
+func TestServiceDispatch(t *testing.T) {
+	var (
+		genesis  = &types.Header{Number: big.NewInt(0)}
+		backend  = &testBackend{head: genesis}
+		strategy = new(recordingStrategy)
+		service  = newTestService(backend, strategy, Config{Workers: 1})
+	)
+	if err := service.Start(); err != nil {
+		t.Fatalf("failed to start service: %v", err)
+	}
+	defer service.Stop()
+
+	backend.txFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{types.NewTx(&types.LegacyTx{})}})
+	waitEvents(t, strategy, 1)
+
+	// Extend the chain, then switch to a sibling of the new head
+	child := &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash()}
+	backend.headFeed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(child)})
+	waitEvents(t, strategy, 2)
+
+	sibling := &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash(), Extra: []byte{1}}
+	backend.headFeed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(sibling)})
+
+	want := []string{"tx", "head 1", "reorg 1 1", "head 1"}
+	have := waitEvents(t, strategy, len(want))
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("event %d mismatch: have %q, want %q", i, have[i], want[i])
+		}
+	}
+}
+
+func TestServiceTimeout(t *testing.T) {
+	var (
+		backend  = &testBackend{head: &types.Header{Number: big.NewInt(0)}}
+		strategy = &recordingStrategy{delay: time.Hour}
+		service  = newTestService(backend, strategy, Config{Workers: 1, Timeout: 50 * time.Millisecond})
+	)
+	if err := service.Start(); err != nil {
+		t.Fatalf("failed to start service: %v", err)
+	}
+	defer service.Stop()
+
+	// The first callback hangs until the timeout, the head update must still
+	// be processed by the single worker once the abandoned callback returned.
+	backend.txFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{types.NewTx(&types.LegacyTx{})}})
+	time.Sleep(200 * time.Millisecond)
+	backend.headFeed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), ParentHash: backend.head.Hash()})})
+
+	if have := waitEvents(t, strategy, 1); have[0] != "head 1" {
+		t.Fatalf("unexpected events: %v", have)
+	}
+}
+
+func TestServiceBusy(t *testing.T) {
+	var (
+		backend  = &testBackend{head: &types.Header{Number: big.NewInt(0)}}
+		strategy = &recordingStrategy{hang: make(chan struct{}), hung: make(chan struct{}, 1)}
+		service  = newTestService(backend, strategy, Config{Workers: 1, Timeout: 50 * time.Millisecond})
+	)
+	if err := service.Start(); err != nil {
+		t.Fatalf("failed to start service: %v", err)
+	}
+	defer service.Stop()
+
+	// The first callback ignores the timeout and holds the only slot of the
+	// strategy. Pending transactions are skipped until it returns, while chain
+	// events wait for it.
+	tx := types.NewTx(&types.LegacyTx{})
+	backend.txFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
+	<-strategy.hung
+
+	first := &types.Header{Number: big.NewInt(1), ParentHash: backend.head.Hash()}
+	backend.headFeed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(first)})
+	second := &types.Header{Number: big.NewInt(2), ParentHash: first.Hash()}
+	backend.headFeed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(second)})
+
+	backend.txFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
+	for i := 0; i < 100 && len(service.tasks) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(strategy.hang)
+
+	want := []string{"tx", "head 1", "head 2"}
+	have := waitEvents(t, strategy, len(want))
+	time.Sleep(100 * time.Millisecond)
+	if have = strategy.recorded(); len(have) != len(want) {
+		t.Fatalf("event count mismatch: have %v, want %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("event %d mismatch: have %q, want %q", i, have[i], want[i])
+		}
+	}
+}
+
+func TestNewStrategies(t *testing.T) {
+	Register("test-noop", func(env *Env) (Strategy, error) { return new(recordingStrategy), nil })
+
+	if _, err := newStrategies(&Env{}, []string{"test-noop"}); err != nil {
+		t.Fatalf("failed to create registered strategy: %v", err)
+	}
+	if _, err := newStrategies(&Env{}, []string{"test-noop", "test-noop"}); err == nil {
+		t.Fatalf("duplicate strategy accepted")
+	}
+	if _, err := newStrategies(&Env{}, []string{"test-missing"}); err == nil {
+		t.Fatalf("unknown strategy accepted")
+	}
+	var found bool
+	for _, name := range Registered() {
+		if name == "test-noop" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("registered strategy not listed: %v", Registered())
+	}
+}
@@ -0,0 +1,48 @@
+package mev
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// errNoSender is returned by strategies that need to sign transactions if no
+// sender account was configured.
+var errNoSender = errors.New("no mev sender account configured")
+
+// Signer signs strategy transactions on behalf of the configured sender through
+// the node's account manager, so keys stay within the keystore, hardware
+// wallet or external signer backing the account.
+type Signer struct {
+	manager *accounts.Manager
+	account accounts.Account
+	chainID *big.Int
+}
+
+// newSigner creates a signer for the given sender, ensuring it is known by one
+// of the wallets of the account manager.
+func newSigner(manager *accounts.Manager, sender common.Address, chainID *big.Int) (*Signer, error) {
+	account := accounts.Account{Address: sender}
+	if _, err := manager.Find(account); err != nil {
+		return nil, err
+	}
+	return &Signer{manager: manager, account: account, chainID: chainID}, nil
+}
+
+// Address returns the address of the sender account.
+func (s *Signer) Address() common.Address {
+	return s.account.Address
+}
+
+// SignTx signs the given transaction with the sender account. The wallet is
+// looked up on every call since wallets may be attached or detached at runtime.
+func (s *Signer) SignTx(tx *types.Transaction) (*types.Transaction, error) {
+	wallet, err := s.manager.Find(s.account)
+	if err != nil {
+		return nil, err
+	}
+	return wallet.SignTx(s.account, tx, s.chainID)
+}
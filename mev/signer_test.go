@@ -0,0 +1,55 @@
+package mev
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mev-signer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	manager := accounts.NewManager(&accounts.Config{InsecureUnlockAllowed: true}, ks)
+	defer manager.Close()
+
+	if _, err := newSigner(manager, common.Address{0x01}, big.NewInt(56)); err == nil {
+		t.Fatalf("signer created for unknown account")
+	}
+	signer, err := newSigner(manager, account.Address, big.NewInt(56))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+	if _, err := signer.SignTx(tx); err == nil {
+		t.Fatalf("locked account signed transaction")
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	signed, err := signer.SignTx(tx)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	sender, err := types.Sender(types.NewEIP155Signer(big.NewInt(56)), signed)
+	if err != nil {
+		t.Fatalf("failed to recover sender: %v", err)
+	}
+	if sender != account.Address {
+		t.Fatalf("sender mismatch: have %x, want %x", sender, account.Address)
+	}
+}
@@ -0,0 +1,117 @@
+package mev
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/mev/detector"
+)
+
+// Strategy is a pluggable detector or searcher reacting to the pending
+// transaction stream and to chain head changes. All callbacks are invoked from
+// the service worker pool, possibly concurrently, and must honour ctx
+// cancellation: the service abandons callbacks exceeding the configured timeout.
+type Strategy interface {
+	// Name returns the name the strategy was registered under.
+	Name() string
+
+	// OnPendingTx is invoked for every transaction entering the pool.
+	OnPendingTx(ctx context.Context, tx *types.Transaction) error
+
+	// OnNewHead is invoked whenever the canonical chain head changes.
+	OnNewHead(ctx context.Context, head *types.Header) error
+
+	// OnReorg is invoked before OnNewHead if the new head does not extend the
+	// previously seen one.
+	OnReorg(ctx context.Context, oldHead, newHead *types.Header) error
+}
+
+// Env contains the node facilities handed to strategy constructors.
+type Env struct {
+	Backend  ethapi.Backend
+	Config   *Config
+	Signer   *Signer            // Nil if no sender account was configured
+	Detector *detector.Detector // Exploit detector shared by all strategies
+}
+
+// Constructor creates a strategy instance bound to the given environment.
+type Constructor func(env *Env) (Strategy, error)
+
+// BaseStrategy implements all Strategy callbacks as no-ops, so concrete
+// strategies only need to override the events they are interested in.
+type BaseStrategy struct{}
+
+// OnPendingTx implements Strategy, ignoring the transaction.
+func (BaseStrategy) OnPendingTx(ctx context.Context, tx *types.Transaction) error { return nil }
+
+// OnNewHead implements Strategy, ignoring the head.
+func (BaseStrategy) OnNewHead(ctx context.Context, head *types.Header) error { return nil }
+
+// OnReorg implements Strategy, ignoring the reorg.
+func (BaseStrategy) OnReorg(ctx context.Context, oldHead, newHead *types.Header) error { return nil }
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]Constructor)
+)
+
+// Register makes a strategy constructor available under the given name. It is
+// meant to be called from the init function of the package implementing the
+// strategy and panics if the name is already taken.
+func Register(name string, ctor Constructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if ctor == nil {
+		panic("mev: nil strategy constructor for " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("mev: strategy " + name + " registered twice")
+	}
+	registry[name] = ctor
+}
+
+// Registered returns the sorted names of all registered strategies.
+func Registered() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newStrategies instantiates the named strategies in the requested order.
+func newStrategies(env *Env, names []string) ([]Strategy, error) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	var (
+		seen       = make(map[string]bool)
+		strategies []Strategy
+	)
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("strategy %q enabled twice", name)
+		}
+		seen[name] = true
+
+		ctor, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown strategy %q", name)
+		}
+		strategy, err := ctor(env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create strategy %q: %v", name, err)
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	bundleCommitMeter = metrics.NewRegisteredMeter("worker/bundles/commit", nil)
+	bundleFailMeter   = metrics.NewRegisteredMeter("worker/bundles/fail", nil)
+)
+
+// errBundleReverted is returned if a bundle transaction not marked as
+// revertible fails during execution.
+var errBundleReverted = errors.New("bundle transaction reverted")
+
+// simulatedBundle is a bundle executed against the pending state, along with
+// what it pays the block producer.
+type simulatedBundle struct {
+	bundle  *types.Bundle
+	gasUsed uint64
+	profit  *big.Int // Increase of the producer balance caused by the bundle
+	price   *big.Int // Effective gas price paid to the producer, profit / gasUsed
+}
+
+// applyBundle executes all transactions of a bundle in order on top of the
+// given state. It fails if any transaction is invalid, or reverts without being
+// allowed to, leaving the state in an undefined condition which the caller has
+// to roll back.
+func (w *worker) applyBundle(bundle *types.Bundle, statedb *state.StateDB, gasPool *core.GasPool, header *types.Header, coinbase common.Address, txIndex int, vmConfig vm.Config, receiptProcessors ...core.ReceiptProcessor) ([]*types.Receipt, error) {
+	receipts := make([]*types.Receipt, 0, len(bundle.Txs))
+	for i, tx := range bundle.Txs {
+		if tx.Protected() && !w.chainConfig.IsEIP155(header.Number) {
+			return nil, fmt.Errorf("transaction %d: %w", i, types.ErrInvalidChainId)
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, txIndex+i)
+
+		receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, gasPool, statedb, header, tx, &header.GasUsed, vmConfig, receiptProcessors...)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		if receipt.Status == types.ReceiptStatusFailed && !bundle.MayRevert(tx.Hash()) {
+			return nil, fmt.Errorf("transaction %d: %w", i, errBundleReverted)
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+// simulateBundles executes every bundle in isolation on top of the current
+// environment and returns the ones which apply cleanly and pay the producer,
+// ordered by the effective gas price they pay.
+func (w *worker) simulateBundles(bundles []*types.Bundle, coinbase common.Address) []*simulatedBundle {
+	env := w.current
+
+	simulated := make([]*simulatedBundle, 0, len(bundles))
+	for _, bundle := range bundles {
+		var (
+			statedb = env.state.Copy()
+			gasPool = new(core.GasPool).AddGas(env.gasPool.Gas())
+			header  = types.CopyHeader(env.header)
+			before  = core.ProducerBalance(w.chainConfig, statedb, coinbase)
+		)
+		if _, err := w.applyBundle(bundle, statedb, gasPool, header, coinbase, env.tcount, *w.chain.GetVMConfig()); err != nil {
+			log.Debug("Discarding failed bundle", "hash", bundle.Hash(), "err", err)
+			bundleFailMeter.Mark(1)
+			continue
+		}
+		gasUsed := header.GasUsed - env.header.GasUsed
+		if gasUsed == 0 {
+			continue
+		}
+		profit := new(big.Int).Sub(core.ProducerBalance(w.chainConfig, statedb, coinbase), before)
+		if profit.Sign() <= 0 {
+			log.Debug("Discarding unprofitable bundle", "hash", bundle.Hash(), "profit", profit)
+			bundleFailMeter.Mark(1)
+			continue
+		}
+		simulated = append(simulated, &simulatedBundle{
+			bundle:  bundle,
+			gasUsed: gasUsed,
+			profit:  profit,
+			price:   new(big.Int).Div(profit, new(big.Int).SetUint64(gasUsed)),
+		})
+	}
+	sort.SliceStable(simulated, func(i, j int) bool {
+		return simulated[i].price.Cmp(simulated[j].price) > 0
+	})
+	return simulated
+}
+
+// commitBundles includes the simulated bundles in the current block, best
+// paying first. Every bundle is applied atomically: if any of its transactions
+// fails on top of the bundles committed before it, or it does not pay the
+// producer anymore, the whole bundle is rolled back. The return value mirrors
+// commitTransactions.
+func (w *worker) commitBundles(bundles []*simulatedBundle, coinbase common.Address, interrupt *int32) bool {
+	env := w.current
+
+	bloomProcessors := core.NewAsyncReceiptBloomGenerator(len(bundles))
+	defer bloomProcessors.Close()
+
+	for _, sim := range bundles {
+		if interrupt != nil && atomic.LoadInt32(interrupt) == commitInterruptNewHead {
+			return true
+		}
+		if env.gasPool.Gas() < sim.gasUsed {
+			continue
+		}
+		// Roll back through a copy, the journal does not survive the
+		// finalisation after every transaction
+		var (
+			backup  = env.state.Copy()
+			gas     = env.gasPool.Gas()
+			gasUsed = env.header.GasUsed
+			before  = core.ProducerBalance(w.chainConfig, env.state, coinbase)
+
+			creationSnap int
+		)
+		if env.creations != nil {
+			creationSnap = env.creations.Snapshot()
+		}
+		receipts, err := w.applyBundle(sim.bundle, env.state, env.gasPool, env.header, coinbase, env.tcount, env.vmConfig(*w.chain.GetVMConfig()), bloomProcessors)
+		if err == nil {
+			// Earlier bundles may have taken what this one pays out of
+			if profit := new(big.Int).Sub(core.ProducerBalance(w.chainConfig, env.state, coinbase), before); profit.Sign() <= 0 {
+				err = fmt.Errorf("unprofitable bundle, profit %v", profit)
+			}
+		}
+		if err != nil {
+			env.state = backup
+			*env.gasPool = core.GasPool(gas)
+			env.header.GasUsed = gasUsed
+			if env.creations != nil {
+				env.creations.RevertToSnapshot(creationSnap)
+			}
+
+			log.Debug("Bundle invalidated by previous ones", "hash", sim.bundle.Hash(), "err", err)
+			bundleFailMeter.Mark(1)
+			continue
+		}
+		env.txs = append(env.txs, sim.bundle.Txs...)
+		env.receipts = append(env.receipts, receipts...)
+		env.tcount += len(receipts)
+
+		log.Debug("Committed bundle", "hash", sim.bundle.Hash(), "txs", len(receipts), "gas", sim.gasUsed, "price", sim.price)
+		bundleCommitMeter.Mark(1)
+	}
+	return false
+}
@@ -30,9 +30,11 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/consensus/parlia"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/systemcontracts"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
@@ -82,6 +84,10 @@ const (
 
 var (
 	commitTxsTimer = metrics.NewRegisteredTimer("worker/committxs", nil)
+
+	preExecHitMeter   = metrics.NewRegisteredMeter("worker/preexec/hit", nil)
+	preExecMissMeter  = metrics.NewRegisteredMeter("worker/preexec/miss", nil)
+	preExecStaleMeter = metrics.NewRegisteredMeter("worker/preexec/stale", nil)
 )
 
 // environment is the worker's current environment and holds all of the current state information.
@@ -98,11 +104,32 @@ type environment struct {
 	header   *types.Header
 	txs      []*types.Transaction
 	receipts []*types.Receipt
+
+	creations *core.CreationTracer // Contracts deployed by the transactions, if indexed
+}
+
+// vmConfig returns the EVM configuration the transactions of the environment
+// are executed with, collecting their contract creations if indexed.
+func (env *environment) vmConfig(config vm.Config) vm.Config {
+	if env.creations != nil {
+		config.Debug, config.Tracer = true, env.creations
+	}
+	return config
+}
+
+// initGasPool sets up the gas pool of the environment if not done yet,
+// reserving the gas needed by system transactions.
+func (env *environment) initGasPool() {
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+		env.gasPool.SubGas(params.SystemTxsGas)
+	}
 }
 
 // task contains all information for consensus engine sealing and result submitting.
 type task struct {
 	receipts  []*types.Receipt
+	creations []*rawdb.ContractCreation
 	state     *state.StateDB
 	block     *types.Block
 	createdAt time.Time
@@ -637,6 +664,7 @@ func (w *worker) resultLoop() {
 			}
 			// Commit block and state to database.
 			task.state.SetExpectedStateRoot(block.Root())
+			w.chain.WriteContractCreations(block, task.creations)
 			_, err := w.chain.WriteBlockWithState(block, receipts, logs, task.state, true)
 			if err != nil {
 				log.Error("Failed writing block to chain", "err", err)
@@ -675,6 +703,9 @@ func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
 		uncles:    mapset.NewSet(),
 		header:    header,
 	}
+	if w.chain.ContractIndexEnabled() {
+		env.creations = core.NewCreationTracer()
+	}
 	// Keep track of transactions which return errors so they can be removed
 	env.tcount = 0
 
@@ -739,14 +770,43 @@ func (w *worker) updateSnapshot() {
 	w.snapshotState = w.current.state.Copy()
 }
 
-func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Address, receiptProcessors ...core.ReceiptProcessor) ([]*types.Log, error) {
-	snap := w.current.state.Snapshot()
+// commitTransaction applies the transaction to the current state, reusing its
+// pre-executed result if nothing it read was written since. The state written
+// by the transaction is recorded into the written set.
+func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Address, preExecuted *core.PreExecutedTxs, written *state.WriteSet, receiptProcessors ...core.ReceiptProcessor) ([]*types.Log, error) {
+	if preExecuted != nil {
+		receipt, err := preExecuted.Apply(w.current.state, written, w.current.gasPool, w.current.header, tx, &w.current.header.GasUsed, receiptProcessors...)
+		switch {
+		case err == nil:
+			preExecHitMeter.Mark(1)
+
+			w.current.txs = append(w.current.txs, tx)
+			w.current.receipts = append(w.current.receipts, receipt)
+			return receipt.Logs, nil
 
-	receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, w.current.gasPool, w.current.state, w.current.header, tx, &w.current.header.GasUsed, *w.chain.GetVMConfig(), receiptProcessors...)
+		case errors.Is(err, core.ErrPreExecutionStale):
+			preExecStaleMeter.Mark(1)
+
+		default:
+			preExecMissMeter.Mark(1)
+		}
+	}
+	snap := w.current.state.Snapshot()
+	var creationSnap int
+	if w.current.creations != nil {
+		creationSnap = w.current.creations.Snapshot()
+	}
+	w.current.state.StartReadWriteSet()
+	receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, w.current.gasPool, w.current.state, w.current.header, tx, &w.current.header.GasUsed, w.current.vmConfig(*w.chain.GetVMConfig()), receiptProcessors...)
+	rwSet := w.current.state.StopReadWriteSet()
 	if err != nil {
 		w.current.state.RevertToSnapshot(snap)
+		if w.current.creations != nil {
+			w.current.creations.RevertToSnapshot(creationSnap)
+		}
 		return nil, err
 	}
+	written.Add(rwSet)
 	w.current.txs = append(w.current.txs, tx)
 	w.current.receipts = append(w.current.receipts, receipt)
 
@@ -759,10 +819,7 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		return true
 	}
 
-	if w.current.gasPool == nil {
-		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
-		w.current.gasPool.SubGas(params.SystemTxsGas)
-	}
+	w.current.initGasPool()
 
 	var coalescedLogs []*types.Log
 	var stopTimer *time.Timer
@@ -780,13 +837,22 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 	}
 	bloomProcessors := core.NewAsyncReceiptBloomGenerator(processorCapacity)
 
+	// The transactions pre-executed by the prefetcher can only be reused if they
+	// paid the same coinbase, which is not set in the header unless mining, and
+	// if their contract creations need not be collected.
+	var preExecuted *core.PreExecutedTxs
+	if coinbase == w.current.header.Coinbase && w.current.creations == nil {
+		preExecuted = core.NewPreExecutedTxs()
+	}
+	written := state.NewWriteSet()
+
 	interruptCh := make(chan struct{})
 	defer close(interruptCh)
 	//prefetch txs from all pending txs
 	txsPrefetch := txs.Copy()
 	tx := txsPrefetch.Peek()
 	txCurr := &tx
-	w.prefetcher.PrefetchMining(txsPrefetch, w.current.header, w.current.gasPool.Gas(), w.current.state.Copy(), *w.chain.GetVMConfig(), interruptCh, txCurr)
+	w.prefetcher.PrefetchMining(txsPrefetch, w.current.header, w.current.gasPool.Gas(), w.current.state.Copy(), *w.chain.GetVMConfig(), interruptCh, txCurr, preExecuted)
 
 LOOP:
 	for {
@@ -843,7 +909,7 @@ LOOP:
 		// Start executing the transaction
 		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
 
-		logs, err := w.commitTransaction(tx, coinbase, bloomProcessors)
+		logs, err := w.commitTransaction(tx, coinbase, preExecuted, written, bloomProcessors)
 		switch {
 		case errors.Is(err, core.ErrGasLimitReached):
 			// Pop the current out-of-gas transaction without shifting in the next from the account
@@ -958,7 +1024,10 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	if w.chainConfig.DAOForkSupport && w.chainConfig.DAOForkBlock != nil && w.chainConfig.DAOForkBlock.Cmp(header.Number) == 0 {
 		misc.ApplyDAOHardFork(env.state)
 	}
-	systemcontracts.UpgradeBuildInSystemContract(w.chainConfig, header.Number, env.state)
+	if err := systemcontracts.UpgradeBuildInSystemContract(w.chainConfig, header.Number, env.state); err != nil {
+		log.Error("Failed to upgrade system contracts", "err", err)
+		return
+	}
 	// Accumulate the uncles for the current block
 	uncles := make([]*types.Header, 0)
 	// Create an empty block based on temporary copied state for
@@ -967,6 +1036,15 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		w.commit(uncles, nil, false, tstart)
 	}
 
+	// Place the bundles targeting this block ahead of any public transaction.
+	if pool := w.eth.BundlePool(); pool != nil {
+		if bundles := pool.Bundles(header.Number, header.Time); len(bundles) > 0 {
+			env.initGasPool()
+			if w.commitBundles(w.simulateBundles(bundles, w.coinbase), w.coinbase, interrupt) {
+				return
+			}
+		}
+	}
 	// Fill the block with all available pending transactions.
 	pending, err := w.eth.TxPool().Pending()
 	if err != nil {
@@ -1017,8 +1095,12 @@ func (w *worker) commit(uncles []*types.Header, interval func(), update bool, st
 		if interval != nil {
 			interval()
 		}
+		var creations []*rawdb.ContractCreation
+		if w.current.creations != nil {
+			creations = w.current.creations.Creations()
+		}
 		select {
-		case w.taskCh <- &task{receipts: receipts, state: s, block: block, createdAt: time.Now()}:
+		case w.taskCh <- &task{receipts: receipts, creations: creations, state: s, block: block, createdAt: time.Now()}:
 			w.unconfirmed.Shift(block.NumberU64() - 1)
 			log.Info("Commit new mining work", "number", block.Number(), "sealhash", w.engine.SealHash(block.Header()),
 				"uncles", len(uncles), "txs", w.current.tcount,
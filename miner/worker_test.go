@@ -17,6 +17,7 @@
 package miner
 
 import (
+	"crypto/ecdsa"
 	"math/big"
 	"math/rand"
 	"sync/atomic"
@@ -107,6 +108,7 @@ func init() {
 type testWorkerBackend struct {
 	db         ethdb.Database
 	txPool     *core.TxPool
+	bundlePool *core.BundlePool
 	chain      *core.BlockChain
 	testTxFeed event.Feed
 	genesis    *core.Genesis
@@ -134,6 +136,7 @@ func newTestWorkerBackend(t *testing.T, chainConfig *params.ChainConfig, engine
 
 	chain, _ := core.NewBlockChain(db, &core.CacheConfig{TrieDirtyDisabled: true}, gspec.Config, engine, vm.Config{}, nil, nil)
 	txpool := core.NewTxPool(testTxPoolConfig, chainConfig, chain)
+	bundlepool := core.NewBundlePool(core.DefaultBundlePoolConfig, chainConfig, chain)
 
 	// Generate a small n-block chain and an uncle block for it
 	if n > 0 {
@@ -156,6 +159,7 @@ func newTestWorkerBackend(t *testing.T, chainConfig *params.ChainConfig, engine
 		db:         db,
 		chain:      chain,
 		txPool:     txpool,
+		bundlePool: bundlepool,
 		genesis:    &gspec,
 		uncleBlock: blocks[0],
 	}
@@ -163,6 +167,7 @@ func newTestWorkerBackend(t *testing.T, chainConfig *params.ChainConfig, engine
 
 func (b *testWorkerBackend) BlockChain() *core.BlockChain { return b.chain }
 func (b *testWorkerBackend) TxPool() *core.TxPool         { return b.txPool }
+func (b *testWorkerBackend) BundlePool() *core.BundlePool { return b.bundlePool }
 
 func (b *testWorkerBackend) newRandomUncle() *types.Block {
 	var parent *types.Block
@@ -260,6 +265,160 @@ func testGenerateBlockAndImport(t *testing.T, isClique bool) {
 	}
 }
 
+func TestBundleInclusion(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	// Bundles are only profitable if not paid by the producer itself
+	w.setEtherbase(common.HexToAddress("0xc0ffee"))
+
+	// Submit a valid bundle racing the pooled transaction for the same nonce,
+	// one which can never be included and one paying nothing.
+	signer := types.LatestSigner(ethashChainConfig)
+	bundleTx := types.MustSignNewTx(testBankKey, signer, &types.LegacyTx{
+		Nonce:    0,
+		To:       &testUserAddress,
+		Value:    big.NewInt(1),
+		Gas:      params.TxGas,
+		GasPrice: big.NewInt(2),
+	})
+	invalidTx := types.MustSignNewTx(testBankKey, signer, &types.LegacyTx{
+		Nonce:    5,
+		To:       &testUserAddress,
+		Value:    big.NewInt(1),
+		Gas:      params.TxGas,
+		GasPrice: big.NewInt(10),
+	})
+	unpaidTx := types.MustSignNewTx(testUserKey, signer, &types.LegacyTx{
+		Nonce:    0,
+		To:       &testBankAddress,
+		Gas:      params.TxGas,
+		GasPrice: new(big.Int),
+	})
+	for _, tx := range []*types.Transaction{bundleTx, invalidTx, unpaidTx} {
+		if err := b.bundlePool.AddBundle(&types.Bundle{Txs: types.Transactions{tx}, BlockNumber: big.NewInt(1)}); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+	}
+	if err := b.bundlePool.AddBundle(&types.Bundle{Txs: types.Transactions{bundleTx}, BlockNumber: big.NewInt(1)}); err != core.ErrAlreadyKnown {
+		t.Fatalf("duplicate bundle error mismatch: have %v, want %v", err, core.ErrAlreadyKnown)
+	}
+	taskCh := make(chan *task, 3)
+	w.skipSealHook = func(task *task) bool {
+		if len(task.receipts) > 0 {
+			select {
+			case taskCh <- task:
+			default:
+			}
+		}
+		return true
+	}
+	w.start()
+
+	select {
+	case task := <-taskCh:
+		txs := task.block.Transactions()
+		if len(txs) != 1 || txs[0].Hash() != bundleTx.Hash() {
+			t.Fatalf("bundle not included at the top of the block: %d txs", len(txs))
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout")
+	}
+}
+
+// Tests that bundles paying the producer in isolation, but not anymore on top
+// of the bundles committed before them, are rolled back.
+func TestBundleProfitRecheck(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	var (
+		coinbase = common.HexToAddress("0xc0ffee")
+		parent   = b.chain.CurrentBlock()
+		header   = &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     big.NewInt(1),
+			GasLimit:   parent.GasLimit(),
+			Time:       parent.Time() + 1,
+			Coinbase:   coinbase,
+			Difficulty: big.NewInt(1),
+		}
+	)
+	if err := w.makeCurrent(parent, header); err != nil {
+		t.Fatalf("failed to prepare environment: %v", err)
+	}
+	w.current.gasPool = new(core.GasPool).AddGas(header.GasLimit)
+
+	// A tip jar paying its whole balance to the coinbase of the first caller:
+	// CALL(gas, coinbase, selfbalance, 0, 0, 0, 0) POP STOP
+	jar := common.HexToAddress("0x7a")
+	w.current.state.SetCode(jar, common.FromHex("0x600060006000600047415af15000"))
+	w.current.state.SetBalance(jar, big.NewInt(params.Ether))
+
+	signer := types.LatestSigner(ethashChainConfig)
+	var bundles []*types.Bundle
+	for _, key := range []*ecdsa.PrivateKey{testBankKey, testUserKey} {
+		tx := types.MustSignNewTx(key, signer, &types.LegacyTx{
+			To:       &jar,
+			Gas:      100000,
+			GasPrice: new(big.Int),
+		})
+		bundles = append(bundles, &types.Bundle{Txs: types.Transactions{tx}, BlockNumber: big.NewInt(1)})
+	}
+	simulated := w.simulateBundles(bundles, coinbase)
+	if len(simulated) != 2 {
+		t.Fatalf("simulated bundle count mismatch: have %d, want 2", len(simulated))
+	}
+	w.commitBundles(simulated, coinbase, nil)
+	if len(w.current.txs) != 1 {
+		t.Fatalf("committed transaction count mismatch: have %d, want 1", len(w.current.txs))
+	}
+	if balance := w.current.state.GetBalance(coinbase); balance.Cmp(big.NewInt(params.Ether)) != 0 {
+		t.Fatalf("coinbase balance mismatch: have %v, want %v", balance, params.Ether)
+	}
+}
+
+// Tests that the contract creations of mined blocks are collected by the miner
+// and indexed once the block is written.
+func TestContractIndexMined(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	b := newTestWorkerBackend(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	core.EnableContractIndex(b.chain)
+
+	w := newWorker(testConfig, ethashChainConfig, engine, b, new(event.TypeMux), nil, false)
+	w.setEtherbase(testBankAddress)
+	defer w.close()
+
+	w.skipSealHook = func(task *task) bool {
+		return len(task.receipts) == 0
+	}
+	sub := w.mux.Subscribe(core.NewMinedBlockEvent{})
+	defer sub.Unsubscribe()
+
+	tx := b.newRandomTx(true)
+	b.txPool.AddLocal(tx)
+	w.start()
+
+	select {
+	case ev := <-sub.Chan():
+		block := ev.Data.(core.NewMinedBlockEvent).Block
+		entry := rawdb.ReadContractCreation(b.db, crypto.CreateAddress(testBankAddress, tx.Nonce()))
+		if entry == nil || entry.BlockHash != block.Hash() || entry.TxHash != tx.Hash() || entry.Creator != testBankAddress {
+			t.Fatalf("mined creation mismatch: have %+v, want block %x", entry, block.Hash())
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout")
+	}
+}
+
 func TestAdjustIntervalEthash(t *testing.T) {
 	testAdjustInterval(t, ethashChainConfig, ethash.NewFaker())
 }
@@ -70,6 +70,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the database engine ("leveldb" or "pebble") used for new
+	// databases. If empty, the engine of an existing database is detected and
+	// leveldb is used otherwise.
+	DBEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
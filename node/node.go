@@ -32,7 +32,6 @@ import (
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/ethdb"
-	"github.com/ethereum/go-ethereum/ethdb/leveldb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -574,7 +573,11 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string, r
 	if n.config.DataDir == "" {
 		db = rawdb.NewMemoryDatabase()
 	} else {
-		db, err = rawdb.NewLevelDBDatabase(n.ResolvePath(name), cache, handles, namespace, readonly)
+		var kvdb ethdb.KeyValueStore
+		kvdb, err = rawdb.NewKeyValueStore(n.config.DBEngine, n.ResolvePath(name), cache, handles, namespace, readonly)
+		if err == nil {
+			db = rawdb.NewDatabase(kvdb)
+		}
 	}
 
 	if err == nil {
@@ -627,7 +630,14 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 		case !filepath.IsAbs(freezer):
 			freezer = n.ResolvePath(freezer)
 		}
-		db, err = rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace, readonly, disableFreeze, isLastOffset)
+		var kvdb ethdb.KeyValueStore
+		kvdb, err = rawdb.NewKeyValueStore(n.config.DBEngine, root, cache, handles, namespace, readonly)
+		if err == nil {
+			db, err = rawdb.NewDatabaseWithFreezer(kvdb, freezer, namespace, readonly, disableFreeze, isLastOffset)
+			if err != nil {
+				kvdb.Close()
+			}
+		}
 	}
 
 	if err == nil {
@@ -636,15 +646,13 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 	return db, err
 }
 
-func (n *Node) OpenDiffDatabase(name string, handles int, diff, namespace string, readonly bool) (*leveldb.Database, error) {
+func (n *Node) OpenDiffDatabase(name string, handles int, diff, namespace string, readonly bool) (ethdb.KeyValueStore, error) {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 	if n.state == closedState {
 		return nil, ErrNodeStopped
 	}
 
-	var db *leveldb.Database
-	var err error
 	if n.config.DataDir == "" {
 		panic("datadir is missing")
 	}
@@ -655,9 +663,7 @@ func (n *Node) OpenDiffDatabase(name string, handles int, diff, namespace string
 	case !filepath.IsAbs(diff):
 		diff = n.ResolvePath(diff)
 	}
-	db, err = leveldb.New(diff, 0, handles, namespace, readonly)
-
-	return db, err
+	return rawdb.NewKeyValueStore(n.config.DBEngine, diff, 0, handles, namespace, readonly)
 }
 
 // ResolvePath returns the absolute path of a resource in the instance directory.
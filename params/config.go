@@ -22,6 +22,7 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -339,6 +340,13 @@ var (
 	// adding flags to the config to also have to set these fields.
 	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil}
 
+	// AllParliaProtocolChanges contains every protocol change introduced and
+	// accepted by BSC into the Parlia consensus.
+	//
+	// This configuration is intentionally not using keyed fields to force anyone
+	// adding flags to the config to also have to set these fields.
+	AllParliaProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &ParliaConfig{Period: 3, Epoch: 200}}
+
 	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig), nil, nil}
 
 	TestRules = TestChainConfig.Rules(new(big.Int))
@@ -457,6 +465,23 @@ func (c *CliqueConfig) String() string {
 type ParliaConfig struct {
 	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
 	Epoch  uint64 `json:"epoch"`  // Epoch length to update validatorSet
+
+	// Upgrades replace the code of system contracts when hard forks activate.
+	// They are only honoured on networks without built-in upgrades, i.e. not
+	// on mainnet, Chapel and Rialto.
+	Upgrades []*SystemContractUpgrade `json:"upgrades,omitempty"`
+}
+
+// SystemContractUpgrade replaces the code of a system contract at the
+// activation block of a hard fork.
+type SystemContractUpgrade struct {
+	Fork      string         `json:"fork"`                // Activating hard fork: ramanujan, niels, mirrorSync or bruno
+	Contract  common.Address `json:"contract"`            // System contract to upgrade
+	Code      hexutil.Bytes  `json:"code"`                // Runtime code after the upgrade
+	CommitURL string         `json:"commitUrl,omitempty"` // Source of the code, for the logs
+
+	BeforeUpgrade string `json:"beforeUpgrade,omitempty"` // Registered hook run before replacing the code
+	AfterUpgrade  string `json:"afterUpgrade,omitempty"`  // Registered hook run after replacing the code
 }
 
 // String implements the stringer interface, returning the consensus engine details.
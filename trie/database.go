@@ -93,6 +93,8 @@ type Database struct {
 	roughPreimagesSize common.StorageSize
 	roughDirtiesSize   common.StorageSize
 
+	writeHook func(common.Hash) // Optional hook notified of every node persisted from the dirty cache
+
 	lock sync.RWMutex
 }
 
@@ -595,6 +597,26 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 	}
 }
 
+// SetWriteHook installs a hook notified with the hash of every trie node moved
+// from the dirty cache into the persistent database by Cap or Commit. The hook
+// runs before the node reaches the disk, allowing a concurrent pruner to keep
+// track of resurrected nodes. A nil hook removes any previously installed one.
+func (db *Database) SetWriteHook(hook func(common.Hash)) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.writeHook = hook
+}
+
+// EvictClean removes the given trie node from the clean cache. It is meant to
+// be called after the node was deleted from the persistent database, so that
+// neither the cache nor its journal keep resolving it.
+func (db *Database) EvictClean(hash common.Hash) {
+	if db.cleans != nil {
+		db.cleans.Del(hash[:])
+	}
+}
+
 // Cap iteratively flushes old but still referenced trie nodes until the total
 // memory usage goes below the given threshold.
 //
@@ -641,6 +663,9 @@ func (db *Database) Cap(limit common.StorageSize) error {
 			// Fetch the oldest referenced node and push into the batch
 			node := db.dirties[oldest]
 			rawdb.WriteTrieNode(batch, oldest, node.rlp())
+			if db.writeHook != nil {
+				db.writeHook(oldest)
+			}
 
 			// If we exceeded the ideal batch size, commit and reset
 			if batch.ValueSize() >= ethdb.IdealBatchSize {
@@ -735,6 +760,17 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 	}
 	// Move the trie itself into the batch, flushing if enough data is accumulated
 	nodes, storage := len(db.dirties), db.dirtiesSize
+	if hook := db.writeHook; hook != nil {
+		if callback == nil {
+			callback = hook
+		} else {
+			next := callback
+			callback = func(hash common.Hash) {
+				hook(hash)
+				next(hash)
+			}
+		}
+	}
 	db.lock.RUnlock()
 
 	uncacher := &cleaner{db}